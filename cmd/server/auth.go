@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna"
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// principal is who a request is made by
+type principal struct {
+	ID   string // API key ID or token subject; empty when anonymous
+	Name string
+	Role models.Role
+}
+
+type principalKey struct{}
+
+// principalFrom returns who made the request ctx belongs to
+func principalFrom(ctx context.Context) (principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(principal)
+	return p, ok
+}
+
+// errNoCredentials is returned by authenticate when a request carries none
+var errNoCredentials = errors.New("authentication required")
+
+// authorize lets requests through to h only if they come from a role that
+// allows read for GET and HEAD requests, or write for any other method
+func (s *Server) authorize(read, write models.Role, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		required := write
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			required = read
+		}
+
+		p, err := s.authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="acousticdna"`)
+			s.respondError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if !p.Role.Allows(required) {
+			s.respondError(w, http.StatusForbidden, fmt.Sprintf("This requires the %s role", required))
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	}
+}
+
+// authenticate works out who made r. Credentials are an API key or a JWT
+// as a bearer token, or an API key in X-API-Key.
+// Requests without credentials get the anonymous role, if there is one.
+func (s *Server) authenticate(r *http.Request) (principal, error) {
+	credential := r.Header.Get("X-API-Key")
+	if auth := r.Header.Get("Authorization"); credential == "" && auth != "" {
+		scheme, token, ok := strings.Cut(auth, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return principal{}, errors.New("use a Bearer token")
+		}
+		credential = strings.TrimSpace(token)
+	}
+
+	switch {
+	case credential == "":
+		if !s.config.AnonymousRole.Valid() {
+			return principal{}, errNoCredentials
+		}
+		return principal{Name: "anonymous", Role: s.config.AnonymousRole}, nil
+
+	case strings.HasPrefix(credential, acousticdna.APIKeyPrefix):
+		key, err := acousticdna.AuthenticateAPIKey(s.keys, credential)
+		if err != nil {
+			if !errors.Is(err, acousticdna.ErrInvalidAPIKey) {
+				s.log.Errorf("Failed to look up API key: %v", err)
+			}
+			return principal{}, acousticdna.ErrInvalidAPIKey
+		}
+		return principal{ID: key.ID, Name: key.Name, Role: key.Role}, nil
+
+	case s.jwt != nil:
+		p, err := s.jwt.Verify(credential)
+		if err != nil {
+			return principal{}, fmt.Errorf("invalid token: %w", err)
+		}
+		return p, nil
+
+	default:
+		return principal{}, acousticdna.ErrInvalidAPIKey
+	}
+}
+
+// handleKeys routes requests to /api/keys
+func (s *Server) handleKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		keys, err := s.keys.ListAPIKeys()
+		if err != nil {
+			s.log.Errorf("Failed to list API keys: %v", err)
+			s.respondError(w, http.StatusInternalServerError, "Failed to list API keys")
+			return
+		}
+		resp := models.ListAPIKeysResponse{Keys: make([]models.APIKeyDTO, len(keys)), Count: len(keys)}
+		for i, key := range keys {
+			resp.Keys[i] = models.NewAPIKeyDTO(key)
+		}
+		s.respondJSON(w, http.StatusOK, resp)
+
+	case http.MethodPost:
+		var req models.CreateAPIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.respondError(w, http.StatusBadRequest, "Invalid JSON request body")
+			return
+		}
+		if !req.Role.Valid() {
+			s.respondError(w, http.StatusBadRequest, fmt.Sprintf("Unknown role %q (use metrics, matcher, editor or admin)", req.Role))
+			return
+		}
+		secret, key, err := acousticdna.CreateAPIKey(s.keys, req.Name, req.Role)
+		if err != nil {
+			s.log.Errorf("Failed to create API key: %v", err)
+			s.respondError(w, http.StatusInternalServerError, "Failed to create API key")
+			return
+		}
+		p, _ := principalFrom(r.Context())
+		s.log.Infof("API key %s (%s, %s) created by %s", key.ID, key.Name, key.Role, p.Name)
+		s.respondJSON(w, http.StatusCreated, models.CreateAPIKeyResponse{Key: secret, APIKey: models.NewAPIKeyDTO(*key)})
+
+	default:
+		s.respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleKey routes requests to /api/keys/{id}
+func (s *Server) handleKey(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Path[len("/api/keys/"):]
+	if id == "" {
+		s.respondError(w, http.StatusBadRequest, "Key ID required")
+		return
+	}
+	if r.Method != http.MethodDelete {
+		s.respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	key, err := acousticdna.RevokeAPIKey(s.keys, id)
+	if errors.Is(err, acousticdna.ErrAPIKeyNotFound) {
+		s.respondError(w, http.StatusNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		s.log.Errorf("Failed to revoke API key %s: %v", id, err)
+		s.respondError(w, http.StatusInternalServerError, "Failed to revoke API key")
+		return
+	}
+	p, _ := principalFrom(r.Context())
+	s.log.Infof("API key %s (%s) revoked by %s", key.ID, key.Name, p.Name)
+	s.respondJSON(w, http.StatusOK, models.NewAPIKeyDTO(*key))
+}
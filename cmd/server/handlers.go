@@ -3,24 +3,37 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
-	"path/filepath"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna"
-	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/audio"
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/fingerprint"
 	"github.com/himanishpuri/AcousticDNA/pkg/logger"
 	"github.com/himanishpuri/AcousticDNA/pkg/models"
-	"github.com/himanishpuri/AcousticDNA/pkg/utils"
 )
 
 type Server struct {
 	service acousticdna.Service
+	jobs    *acousticdna.JobQueue
+	keys    acousticdna.KeyStore
+	jwt     *jwtVerifier // nil unless JWTs are accepted
+	metrics *metrics
 	config  *ServerConfig
 	log     acousticdna.Logger
+
+	// Request budgets per client; nil ones don't limit
+	matchLimit  *rateLimiter
+	ingestLimit *rateLimiter
+	adminLimit  *rateLimiter
+
+	http     *http.Server
+	draining atomic.Bool // Set once Shutdown starts
 }
 
 type ServerConfig struct {
@@ -29,14 +42,75 @@ type ServerConfig struct {
 	TempDir        string
 	SampleRate     int
 	AllowedOrigins []string
+
+	// AnonymousRole is granted to requests without credentials; empty
+	// refuses them
+	AnonymousRole models.Role
+
+	// Bearer JWTs are accepted if signed with JWTSecret (HMAC) or by the
+	// key whose PEM public key is in JWTPublicKeyFile. JWTIssuer and
+	// JWTAudience, if set, must match the token's claims.
+	JWTSecret        string
+	JWTPublicKeyFile string
+	JWTIssuer        string
+	JWTAudience      string
+
+	// Budgets per client of matching, of adding and changing songs, and of
+	// the admin routes
+	MatchRateLimit  RateLimit
+	IngestRateLimit RateLimit
+	AdminRateLimit  RateLimit
+
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For is
+	// believed; other clients are known by their connection's address
+	TrustedProxies []netip.Prefix
+
+	// Timeouts of the HTTP server, as in http.Server. ReadTimeout and
+	// WriteTimeout bound a whole request, so they must cover uploading and
+	// matching the largest recording.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	// On Shutdown the server reports not ready for ShutdownDelay while still
+	// serving, so load balancers stop sending it requests, before it stops
+	// listening and drains
+	ShutdownDelay time.Duration
+
+	// TLS is served with the PEM certificate chain and key in these files
+	// when both are set
+	TLSCertFile string
+	TLSKeyFile  string
 }
 
-func NewServer(service acousticdna.Service, config *ServerConfig) *Server {
-	return &Server{
+func NewServer(service acousticdna.Service, jobs *acousticdna.JobQueue, keys acousticdna.KeyStore, metrics *metrics, config *ServerConfig) (*Server, error) {
+	verifier, err := newJWTVerifier(config.JWTSecret, config.JWTPublicKeyFile, config.JWTIssuer, config.JWTAudience)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
 		service: service,
+		jobs:    jobs,
+		keys:    keys,
+		jwt:     verifier,
+		metrics: metrics,
 		config:  config,
 		log:     logger.GetLogger(),
+
+		matchLimit:  newRateLimiter(config.MatchRateLimit),
+		ingestLimit: newRateLimiter(config.IngestRateLimit),
+		adminLimit:  newRateLimiter(config.AdminRateLimit),
 	}
+	s.http = &http.Server{
+		Addr:              fmt.Sprintf(":%d", config.Port),
+		Handler:           s.setupRoutes(),
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+	}
+	return s, nil
 }
 
 func (s *Server) respondJSON(w http.ResponseWriter, statusCode int, data interface{}) {
@@ -55,13 +129,55 @@ func (s *Server) respondError(w http.ResponseWriter, statusCode int, message str
 	})
 }
 
+// handleHealth reports liveness and readiness together. It answers 200
+// whenever the process can, for monitors that only check the status.
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	health := s.health()
+	if health.Ready {
+		health.Status = "healthy"
+	}
+	s.respondJSON(w, http.StatusOK, health)
+}
+
+// handleLive is the liveness probe: the process is serving requests. It
+// doesn't touch storage, so an unavailable database doesn't get the server
+// restarted.
+func (s *Server) handleLive(w http.ResponseWriter, r *http.Request) {
 	s.respondJSON(w, http.StatusOK, map[string]string{
-		"status": "healthy",
+		"status": "alive",
 		"time":   time.Now().Format(time.RFC3339),
 	})
 }
 
+// handleReady is the readiness probe: the server takes new requests. It
+// answers 503 while shutting down or when storage can't be reached.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	health := s.health()
+	status := http.StatusOK
+	if !health.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	s.respondJSON(w, status, health)
+}
+
+func (s *Server) health() models.HealthResponse {
+	health := models.HealthResponse{
+		Status: "ready",
+		Live:   true,
+		Ready:  true,
+		Time:   time.Now().Format(time.RFC3339),
+	}
+	if s.draining.Load() {
+		health.Status, health.Ready = "draining", false
+		health.Reason = "Server is shutting down"
+	} else if _, err := s.service.QuerySongs(models.SongQuery{Limit: 1}); err != nil {
+		s.log.Warnf("Readiness check failed: %v", err)
+		health.Status, health.Ready = "unavailable", false
+		health.Reason = "Storage is unavailable"
+	}
+	return health
+}
+
 func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 	songs, err := s.service.ListSongs()
 	if err != nil {
@@ -70,39 +186,137 @@ func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	profile := s.service.Profile()
 	s.respondJSON(w, http.StatusOK, models.MetricsResponse{
 		Status:       "healthy",
 		DatabasePath: s.config.DBPath,
 		SongCount:    len(songs),
-		SampleRate:   s.config.SampleRate,
+		SampleRate:   profile.SampleRate,
+		Profile:      profile.ID(),
 	})
 }
 
+// handleProfile returns the fingerprint profile clients must hash with
+func (s *Server) handleProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	s.respondJSON(w, http.StatusOK, s.service.Profile())
+}
+
+// errorStatus maps service errors to HTTP status codes
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, acousticdna.ErrIncompatibleProfile), errors.Is(err, acousticdna.ErrJobFinished),
+		errors.Is(err, acousticdna.ErrSongExists):
+		return http.StatusConflict
+	case errors.Is(err, acousticdna.ErrJobNotFound), errors.Is(err, acousticdna.ErrSongNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, acousticdna.ErrInvalidMetadata):
+		return http.StatusBadRequest
+	case errors.Is(err, acousticdna.ErrJobQueueFull):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Page sizes for GET /api/songs
+const (
+	defaultSongPageSize = 50
+	maxSongPageSize     = 1000
+)
+
 func (s *Server) handleListSongs(w http.ResponseWriter, r *http.Request) {
-	songs, err := s.service.ListSongs()
+	q, err := parseSongQuery(r.URL.Query())
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := s.service.QuerySongs(q)
 	if err != nil {
+		if errors.Is(err, acousticdna.ErrInvalidQuery) {
+			s.respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		s.log.Errorf("Failed to list songs: %v", err)
 		s.respondError(w, http.StatusInternalServerError, "Failed to retrieve songs")
 		return
 	}
 
-	songDTOs := make([]models.SongDTO, len(songs))
-	for i, song := range songs {
-		songDTOs[i] = models.SongDTO{
-			ID:         song.ID,
-			Title:      song.Title,
-			Artist:     song.Artist,
-			YouTubeID:  song.YouTubeID,
-			DurationMs: song.DurationMs,
-		}
+	songDTOs := make([]models.SongDTO, len(page.Songs))
+	for i, song := range page.Songs {
+		songDTOs[i] = models.NewSongDTO(song)
 	}
 
 	s.respondJSON(w, http.StatusOK, models.ListSongsResponse{
-		Songs: songDTOs,
-		Count: len(songDTOs),
+		Songs:      songDTOs,
+		Count:      len(songDTOs),
+		Total:      page.Total,
+		NextCursor: page.NextCursor,
 	})
 }
 
+// parseSongQuery reads the GET /api/songs query parameters
+func parseSongQuery(params url.Values) (models.SongQuery, error) {
+	q := models.SongQuery{
+		Search: params.Get("search"),
+		Source: models.SongSource(params.Get("source")),
+		Sort:   models.SongSort(params.Get("sort")),
+		Cursor: params.Get("cursor"),
+		Limit:  defaultSongPageSize,
+	}
+
+	switch params.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return q, fmt.Errorf("order must be asc or desc")
+	}
+
+	for name, dst := range map[string]*int{
+		"limit":           &q.Limit,
+		"min_duration_ms": &q.MinDurationMs,
+		"max_duration_ms": &q.MaxDurationMs,
+	} {
+		if v := params.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return q, fmt.Errorf("%s must be a non-negative integer", name)
+			}
+			*dst = n
+		}
+	}
+	if q.Limit == 0 || q.Limit > maxSongPageSize {
+		return q, fmt.Errorf("limit must be between 1 and %d", maxSongPageSize)
+	}
+
+	for name, dst := range map[string]*time.Time{
+		"created_after":  &q.CreatedAfter,
+		"created_before": &q.CreatedBefore,
+	} {
+		if v := params.Get(name); v != "" {
+			t, err := parseQueryTime(v)
+			if err != nil {
+				return q, fmt.Errorf("%s must be an RFC 3339 time or a YYYY-MM-DD date", name)
+			}
+			*dst = t
+		}
+	}
+	return q, nil
+}
+
+// parseQueryTime accepts an RFC 3339 timestamp or a date, taken as UTC midnight
+func parseQueryTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, v)
+}
+
 func (s *Server) handleGetSong(w http.ResponseWriter, r *http.Request, songID string) {
 	song, err := s.service.GetSongByID(songID)
 	if err != nil {
@@ -111,13 +325,25 @@ func (s *Server) handleGetSong(w http.ResponseWriter, r *http.Request, songID st
 		return
 	}
 
-	s.respondJSON(w, http.StatusOK, models.SongDTO{
-		ID:         song.ID,
-		Title:      song.Title,
-		Artist:     song.Artist,
-		YouTubeID:  song.YouTubeID,
-		DurationMs: song.DurationMs,
-	})
+	s.respondJSON(w, http.StatusOK, models.NewSongDTO(*song))
+}
+
+func (s *Server) handleUpdateSong(w http.ResponseWriter, r *http.Request, songID string) {
+	var req models.UpdateSongRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, http.StatusBadRequest, "Invalid JSON request body")
+		return
+	}
+
+	song, err := s.service.UpdateSong(songID, req.SongUpdate())
+	if err != nil {
+		s.log.Warnf("Failed to update song %s: %v", songID, err)
+		s.respondError(w, errorStatus(err), err.Error())
+		return
+	}
+
+	s.log.Infof("Updated song: %s by %s (ID: %s)", song.Title, song.Artist, songID)
+	s.respondJSON(w, http.StatusOK, models.NewSongDTO(*song))
 }
 
 func (s *Server) handleDeleteSong(w http.ResponseWriter, r *http.Request, songID string) {
@@ -142,16 +368,20 @@ func (s *Server) handleDeleteSong(w http.ResponseWriter, r *http.Request, songID
 	})
 }
 
-func (s *Server) handleAddSongFile(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute)
-	defer cancel()
+// respondAccepted tells the client where to follow a queued job
+func (s *Server) respondAccepted(w http.ResponseWriter, job *models.Job) {
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	s.respondJSON(w, http.StatusAccepted, models.NewJobDTO(*job))
+}
 
+func (s *Server) handleAddSongFile(w http.ResponseWriter, r *http.Request) {
 	// Max 100MB
 	if err := r.ParseMultipartForm(100 << 20); err != nil {
 		s.log.Errorf("Failed to parse form: %v", err)
 		s.respondError(w, http.StatusBadRequest, "Failed to parse form data")
 		return
 	}
+	defer r.MultipartForm.RemoveAll()
 
 	title := r.FormValue("title")
 	artist := r.FormValue("artist")
@@ -170,44 +400,21 @@ func (s *Server) handleAddSongFile(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	tempFile := filepath.Join(s.config.TempDir, fmt.Sprintf("upload_%d_%s", time.Now().UnixNano(), header.Filename))
-	out, err := os.Create(tempFile)
+	s.log.Infof("Queueing song from file: %s (%s by %s)", header.Filename, title, artist)
+	job, err := s.jobs.SubmitFile(file, header.Filename, title, artist, youtubeID)
 	if err != nil {
-		s.log.Errorf("Failed to create temp file: %v", err)
-		s.respondError(w, http.StatusInternalServerError, "Failed to process upload")
+		s.log.Errorf("Failed to queue song: %v", err)
+		s.respondError(w, errorStatus(err), fmt.Sprintf("Failed to queue song: %v", err))
 		return
 	}
-	defer out.Close()
-	defer os.Remove(tempFile)
-
-	if _, err := io.Copy(out, file); err != nil {
-		s.log.Errorf("Failed to save file: %v", err)
-		s.respondError(w, http.StatusInternalServerError, "Failed to save uploaded file")
-		return
-	}
-	out.Close()
-
-	s.log.Infof("Adding song from file: %s by %s", title, artist)
-	songID, err := s.service.AddSong(ctx, tempFile, title, artist, youtubeID)
-	if err != nil {
-		s.log.Errorf("Failed to add song: %v", err)
-		s.respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to add song: %v", err))
-		return
-	}
-
-	s.log.Infof("Successfully added song: %s by %s (ID: %d)", title, artist, songID)
-	s.respondJSON(w, http.StatusCreated, models.AddSongResponse{
-		Message:   "Song added successfully",
-		ID:        songID,
-		Title:     title,
-		Artist:    artist,
-		YouTubeID: youtubeID,
-	})
+	s.respondAccepted(w, job)
 }
 
 func (s *Server) handleAddSongYouTube(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute)
-	defer cancel()
+	if r.Method != http.MethodPost {
+		s.respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
 
 	var req models.AddSongYouTubeRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -221,53 +428,54 @@ func (s *Server) handleAddSongYouTube(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.log.Infof("Adding song from YouTube URL: %s", req.YouTubeURL)
-
-	downloadedPath, ytMeta, err := audio.DownloadYouTubeAudio(ctx, req.YouTubeURL, s.config.TempDir, s.config.SampleRate)
+	s.log.Infof("Queueing song from YouTube URL: %s", req.YouTubeURL)
+	job, err := s.jobs.SubmitYouTube(req.YouTubeURL, req.Title, req.Artist)
 	if err != nil {
-		s.log.Errorf("Failed to download YouTube video: %v", err)
-		s.respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to download YouTube video: %v", err))
+		s.log.Errorf("Failed to queue song: %v", err)
+		s.respondError(w, errorStatus(err), fmt.Sprintf("Failed to queue song: %v", err))
 		return
 	}
-	defer os.Remove(downloadedPath)
+	s.respondAccepted(w, job)
+}
 
-	// Use YouTube metadata if not provided
-	title := req.Title
-	artist := req.Artist
-	if title == "" {
-		title = ytMeta.Title
-	}
-	if artist == "" {
-		artist = ytMeta.Artist
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := s.jobs.List()
+	if err != nil {
+		s.log.Errorf("Failed to list jobs: %v", err)
+		s.respondError(w, http.StatusInternalServerError, "Failed to retrieve jobs")
+		return
 	}
 
-	youtubeID, err := utils.ExtractYouTubeID(req.YouTubeURL)
-	if err != nil {
-		s.log.Warnf("Failed to extract YouTube ID: %v", err)
-		youtubeID = ""
+	status := models.JobStatus(r.URL.Query().Get("status"))
+	jobDTOs := make([]models.JobDTO, 0, len(jobs))
+	for _, job := range jobs {
+		if status == "" || job.Status == status {
+			jobDTOs = append(jobDTOs, models.NewJobDTO(job))
+		}
 	}
 
-	if title == "" || artist == "" {
-		s.respondError(w, http.StatusBadRequest, "Could not determine title or artist from YouTube metadata. Please provide them explicitly.")
+	s.respondJSON(w, http.StatusOK, models.ListJobsResponse{
+		Jobs:  jobDTOs,
+		Count: len(jobDTOs),
+	})
+}
+
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request, jobID string) {
+	job, err := s.jobs.Get(jobID)
+	if err != nil {
+		s.respondError(w, errorStatus(err), fmt.Sprintf("Job %s: %v", jobID, err))
 		return
 	}
+	s.respondJSON(w, http.StatusOK, models.NewJobDTO(*job))
+}
 
-	s.log.Infof("Adding downloaded song: %s by %s", title, artist)
-	songID, err := s.service.AddSong(ctx, downloadedPath, title, artist, youtubeID)
+func (s *Server) handleCancelJob(w http.ResponseWriter, r *http.Request, jobID string) {
+	job, err := s.jobs.Cancel(jobID)
 	if err != nil {
-		s.log.Errorf("Failed to add song: %v", err)
-		s.respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to add song: %v", err))
+		s.respondError(w, errorStatus(err), fmt.Sprintf("Job %s: %v", jobID, err))
 		return
 	}
-
-	s.log.Infof("Successfully added song from YouTube: %s by %s (ID: %d)", title, artist, songID)
-	s.respondJSON(w, http.StatusCreated, models.AddSongResponse{
-		Message:   "Song added successfully from YouTube",
-		ID:        songID,
-		Title:     title,
-		Artist:    artist,
-		YouTubeID: youtubeID,
-	})
+	s.respondJSON(w, http.StatusOK, models.NewJobDTO(*job))
 }
 
 func (s *Server) handleMatchFile(w http.ResponseWriter, r *http.Request) {
@@ -290,51 +498,18 @@ func (s *Server) handleMatchFile(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	// Save to temporary file
-	tempFile := filepath.Join(s.config.TempDir, fmt.Sprintf("query_%d_%s", time.Now().UnixNano(), header.Filename))
-	out, err := os.Create(tempFile)
-	if err != nil {
-		s.log.Errorf("Failed to create temp file: %v", err)
-		s.respondError(w, http.StatusInternalServerError, "Failed to process upload")
-		return
-	}
-	defer out.Close()
-	defer os.Remove(tempFile)
-
-	if _, err := io.Copy(out, file); err != nil {
-		s.log.Errorf("Failed to save file: %v", err)
-		s.respondError(w, http.StatusInternalServerError, "Failed to save uploaded file")
-		return
-	}
-	out.Close()
-
 	s.log.Infof("Matching uploaded file: %s", header.Filename)
-	matches, err := s.service.MatchSong(ctx, tempFile)
+	matches, diag, err := s.service.MatchReaderWithDiagnostics(ctx, file)
 	if err != nil {
 		s.log.Errorf("Failed to match song: %v", err)
-		s.respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to match song: %v", err))
+		s.respondError(w, errorStatus(err), fmt.Sprintf("Failed to match song: %v", err))
 		return
 	}
 
-	// Convert to DTOs
-	matchDTOs := make([]models.MatchResultDTO, len(matches))
-	for i, match := range matches {
-		matchDTOs[i] = models.MatchResultDTO{
-			SongID:     match.SongID,
-			Title:      match.Title,
-			Artist:     match.Artist,
-			YouTubeID:  match.YouTubeID,
-			Score:      match.Score,
-			OffsetMs:   match.OffsetMs,
-			Confidence: match.Confidence,
-		}
-	}
-
-	s.log.Infof("Match complete: found %d matches", len(matchDTOs))
-	s.respondJSON(w, http.StatusOK, models.MatchHashesResponse{
-		Matches: matchDTOs,
-		Count:   len(matchDTOs),
-	})
+	resp := models.NewMatchHashesResponse(matches)
+	resp.Diagnostics = models.NewQueryDiagnosticsDTO(*diag)
+	s.log.Infof("Match complete: found %d matches (%s)", resp.Count, resp.Verdict)
+	s.respondJSON(w, http.StatusOK, resp)
 }
 
 // For WASM clients - matches pre-computed hashes
@@ -354,46 +529,38 @@ func (s *Server) handleMatchHashes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Convert string map to uint32 with validation
-	hashMap, err := req.ToHashMap()
+	profile := fingerprint.DefaultProfile()
+	if len(req.Profile) > 0 {
+		if err := json.Unmarshal(req.Profile, &profile); err != nil {
+			s.respondError(w, http.StatusBadRequest, fmt.Sprintf("Invalid fingerprint profile: %v", err))
+			return
+		}
+	}
+
+	// Convert to query pairs with validation
+	query, err := req.ToQuery(profile.ValidHash)
 	if err != nil {
 		s.respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	// Log warning for large batches
-	if len(hashMap) >= models.HashWarningThreshold {
-		s.log.Warnf("Large hash batch received: %d hashes", len(hashMap))
+	if len(query) >= models.HashWarningThreshold {
+		s.log.Warnf("Large hash batch received: %d hashes", len(query))
 	}
 
-	s.log.Infof("Matching %d hashes from client", len(hashMap))
+	s.log.Infof("Matching %d hashes from client", len(query))
 
-	matches, err := s.service.MatchHashes(ctx, hashMap)
+	matches, err := s.service.MatchHashes(ctx, profile, query)
 	if err != nil {
 		s.log.Errorf("Failed to match hashes: %v", err)
-		s.respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to match hashes: %v", err))
+		s.respondError(w, errorStatus(err), fmt.Sprintf("Failed to match hashes: %v", err))
 		return
 	}
 
-	// Convert to DTOs
-	matchDTOs := make([]models.MatchResultDTO, len(matches))
-	for i, match := range matches {
-		matchDTOs[i] = models.MatchResultDTO{
-			SongID:     match.SongID,
-			Title:      match.Title,
-			Artist:     match.Artist,
-			YouTubeID:  match.YouTubeID,
-			Score:      match.Score,
-			OffsetMs:   match.OffsetMs,
-			Confidence: match.Confidence,
-		}
-	}
-
-	s.log.Infof("Hash match complete: found %d matches", len(matchDTOs))
-	s.respondJSON(w, http.StatusOK, models.MatchHashesResponse{
-		Matches: matchDTOs,
-		Count:   len(matchDTOs),
-	})
+	resp := models.NewMatchHashesResponse(matches)
+	s.log.Infof("Hash match complete: found %d matches (%s)", resp.Count, resp.Verdict)
+	s.respondJSON(w, http.StatusOK, resp)
 }
 
 // handleSongs routes requests to /api/songs
@@ -420,6 +587,8 @@ func (s *Server) handleSong(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		s.handleGetSong(w, r, idStr)
+	case http.MethodPatch:
+		s.handleUpdateSong(w, r, idStr)
 	case http.MethodDelete:
 		s.handleDeleteSong(w, r, idStr)
 	default:
@@ -427,6 +596,33 @@ func (s *Server) handleSong(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleJobs routes requests to /api/jobs
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	s.handleListJobs(w, r)
+}
+
+// handleJob routes requests to /api/jobs/{id}
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	jobID := r.URL.Path[len("/api/jobs/"):]
+	if jobID == "" {
+		s.respondError(w, http.StatusBadRequest, "Job ID required")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.handleGetJob(w, r, jobID)
+	case http.MethodDelete:
+		s.handleCancelJob(w, r, jobID)
+	default:
+		s.respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
 // handleMatch routes requests to /api/match
 func (s *Server) handleMatch(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// jwtLeeway absorbs clock skew between the token issuer and this server
+const jwtLeeway = time.Minute
+
+// jwtVerifier checks bearer JWTs signed by a trusted issuer, either with a
+// shared HMAC secret or with the private half of a public key. Tokens name
+// their role in a "role" claim, or in a "roles" list of which the most
+// privileged known role counts.
+type jwtVerifier struct {
+	secret    []byte
+	publicKey crypto.PublicKey
+	issuer    string
+	audience  string
+}
+
+// jwtClaims are the claims a token is checked against
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *float64        `json:"exp"`
+	NotBefore *float64        `json:"nbf"`
+	Role      models.Role     `json:"role"`
+	Roles     []models.Role   `json:"roles"`
+}
+
+// newJWTVerifier trusts tokens signed with secret, or with the key whose
+// PEM public key is in keyFile. It returns nil if neither is given.
+func newJWTVerifier(secret, keyFile, issuer, audience string) (*jwtVerifier, error) {
+	if secret != "" && keyFile != "" {
+		return nil, errors.New("use either a JWT secret or a JWT public key, not both")
+	}
+	v := &jwtVerifier{issuer: issuer, audience: audience}
+	switch {
+	case secret != "":
+		v.secret = []byte(secret)
+	case keyFile != "":
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading JWT public key: %w", err)
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("%s holds no PEM block", keyFile)
+		}
+		if v.publicKey, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("parsing JWT public key: %w", err)
+		}
+	default:
+		return nil, nil
+	}
+	return v, nil
+}
+
+// Verify checks token's signature and claims and returns who it stands for
+func (v *jwtVerifier) Verify(token string) (principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return principal{}, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return principal{}, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return principal{}, errors.New("malformed token signature")
+	}
+	if err := v.verifySignature(header.Alg, parts[0]+"."+parts[1], sig); err != nil {
+		return principal{}, err
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return principal{}, err
+	}
+	now := time.Now()
+	switch {
+	case claims.ExpiresAt != nil && now.After(unixTime(*claims.ExpiresAt).Add(jwtLeeway)):
+		return principal{}, errors.New("token has expired")
+	case claims.NotBefore != nil && now.Add(jwtLeeway).Before(unixTime(*claims.NotBefore)):
+		return principal{}, errors.New("token is not valid yet")
+	case v.issuer != "" && claims.Issuer != v.issuer:
+		return principal{}, errors.New("token is from another issuer")
+	case v.audience != "" && !audienceContains(claims.Audience, v.audience):
+		return principal{}, errors.New("token is for another audience")
+	}
+
+	role := claims.Role
+	for _, r := range claims.Roles {
+		if r.Outranks(role) {
+			role = r
+		}
+	}
+	if !role.Valid() {
+		return principal{}, errors.New("token grants no known role")
+	}
+	return principal{ID: claims.Subject, Name: claims.Subject, Role: role}, nil
+}
+
+// verifySignature checks sig over signed with the configured key. The
+// algorithm must suit the key, so a token can't pass an RSA public key off
+// as an HMAC secret.
+func (v *jwtVerifier) verifySignature(alg, signed string, sig []byte) error {
+	var newHash func() hash.Hash
+	var h crypto.Hash
+	switch alg[min(2, len(alg)):] {
+	case "256":
+		newHash, h = sha256.New, crypto.SHA256
+	case "384":
+		newHash, h = sha512.New384, crypto.SHA384
+	case "512":
+		newHash, h = sha512.New, crypto.SHA512
+	}
+
+	invalid := errors.New("invalid token signature")
+	switch key := v.publicKey; {
+	case v.secret != nil && strings.HasPrefix(alg, "HS") && newHash != nil:
+		mac := hmac.New(newHash, v.secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return invalid
+		}
+		return nil
+
+	case alg == "EdDSA":
+		edKey, ok := key.(ed25519.PublicKey)
+		if !ok || !ed25519.Verify(edKey, []byte(signed), sig) {
+			return invalid
+		}
+		return nil
+
+	case newHash != nil && key != nil:
+		digest := newHash()
+		digest.Write([]byte(signed))
+		sum := digest.Sum(nil)
+
+		switch key := key.(type) {
+		case *rsa.PublicKey:
+			switch {
+			case strings.HasPrefix(alg, "RS"):
+				if rsa.VerifyPKCS1v15(key, h, sum, sig) != nil {
+					return invalid
+				}
+				return nil
+			case strings.HasPrefix(alg, "PS"):
+				if rsa.VerifyPSS(key, h, sum, sig, nil) != nil {
+					return invalid
+				}
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			// JWS carries r and s as fixed-size big-endian halves
+			size := (key.Curve.Params().BitSize + 7) / 8
+			if strings.HasPrefix(alg, "ES") && len(sig) == 2*size {
+				r := new(big.Int).SetBytes(sig[:size])
+				s := new(big.Int).SetBytes(sig[size:])
+				if !ecdsa.Verify(key, sum, r, s) {
+					return invalid
+				}
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("token algorithm %q does not suit the configured key", alg)
+}
+
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errors.New("malformed token")
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.New("malformed token")
+	}
+	return nil
+}
+
+// audienceContains reports whether an aud claim, a string or a list of
+// them, names audience
+func audienceContains(aud json.RawMessage, audience string) bool {
+	var one string
+	if json.Unmarshal(aud, &one) == nil {
+		return one == audience
+	}
+	var many []string
+	if json.Unmarshal(aud, &many) == nil {
+		for _, a := range many {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func unixTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
@@ -4,12 +4,22 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna"
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/audio"
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/fingerprint"
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/matcher"
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
 )
 
 var (
@@ -18,14 +28,65 @@ var (
 	tempDir        string
 	sampleRate     int
 	allowedOrigins string
+	profileName    string
+	jobWorkers     int
+	spoolDir       string
+	fpRate         float64
+	anonymousRole  string
+	jwtSecret      string
+	jwtPublicKey   string
+	jwtIssuer      string
+	jwtAudience    string
+	matchLimit     float64
+	matchBurst     int
+	ingestLimit    float64
+	ingestBurst    int
+	adminLimit     float64
+	adminBurst     int
+	ffmpegWorkers  int
+	headerTimeout  time.Duration
+	readTimeout    time.Duration
+	writeTimeout   time.Duration
+	idleTimeout    time.Duration
+	shutdownDelay  time.Duration
+	shutdownWait   time.Duration
+	tlsCert        string
+	tlsKey         string
+	trustedProxies string
 )
 
 func init() {
 	flag.IntVar(&port, "port", 8080, "HTTP server port")
-	flag.StringVar(&dbPath, "db", getEnvOrDefault("ACOUSTIC_DB_PATH", "acousticdna.sqlite3"), "Path to SQLite database")
+	flag.StringVar(&dbPath, "db", getEnvOrDefault("ACOUSTIC_DB_DSN", getEnvOrDefault("ACOUSTIC_DB_PATH", "acousticdna.sqlite3")),
+		"Storage DSN (memory://, sqlite:///path, postgres://...) or SQLite file path")
 	flag.StringVar(&tempDir, "temp", getEnvOrDefault("ACOUSTIC_TEMP_DIR", "/tmp"), "Temporary directory")
 	flag.IntVar(&sampleRate, "rate", 11025, "Audio sample rate")
 	flag.StringVar(&allowedOrigins, "origins", "*", "Comma-separated list of allowed CORS origins (use * for all)")
+	flag.StringVar(&profileName, "profile", "", "Fingerprint profile for a new catalogue (default, speech); existing catalogues keep theirs")
+	flag.IntVar(&jobWorkers, "job-workers", 2, "Songs added in the background at once")
+	flag.StringVar(&spoolDir, "spool", getEnvOrDefault("ACOUSTIC_SPOOL_DIR", ""), "Directory holding uploads until their job runs (default: <temp>/acousticdna-jobs)")
+	flag.Float64Var(&fpRate, "false-positive-rate", matcher.DefaultFalsePositiveRate, "Share of unknown clips that may be reported as a match")
+	flag.StringVar(&anonymousRole, "anonymous-role", "none", "Role of requests without credentials (none, matcher, editor, admin)")
+	flag.StringVar(&jwtSecret, "jwt-secret", os.Getenv("ACOUSTIC_JWT_SECRET"), "HMAC secret bearer JWTs are signed with")
+	flag.StringVar(&jwtPublicKey, "jwt-public-key", "", "PEM public key bearer JWTs are signed for (RSA, ECDSA or Ed25519)")
+	flag.StringVar(&jwtIssuer, "jwt-issuer", "", "Required iss claim of bearer JWTs")
+	flag.StringVar(&jwtAudience, "jwt-audience", "", "Required aud claim of bearer JWTs")
+	flag.Float64Var(&matchLimit, "match-limit", 60, "Match requests a minute per client (0: unlimited)")
+	flag.IntVar(&matchBurst, "match-burst", 20, "Match requests a client may make at once")
+	flag.Float64Var(&ingestLimit, "ingest-limit", 10, "Song additions and changes a minute per client (0: unlimited)")
+	flag.IntVar(&ingestBurst, "ingest-burst", 10, "Song additions and changes a client may make at once")
+	flag.Float64Var(&adminLimit, "admin-limit", 30, "Admin requests a minute per client (0: unlimited)")
+	flag.IntVar(&adminBurst, "admin-burst", 10, "Admin requests a client may make at once")
+	flag.IntVar(&ffmpegWorkers, "ffmpeg-workers", runtime.NumCPU(), "ffmpeg conversions run at once (0: unlimited)")
+	flag.DurationVar(&headerTimeout, "read-header-timeout", 10*time.Second, "Longest a client may take to send request headers")
+	flag.DurationVar(&readTimeout, "read-timeout", 5*time.Minute, "Longest a client may take to send a request, upload included (0: no limit)")
+	flag.DurationVar(&writeTimeout, "write-timeout", 5*time.Minute, "Longest a request may take from its headers to the end of its response (0: no limit)")
+	flag.DurationVar(&idleTimeout, "idle-timeout", 2*time.Minute, "How long an idle keep-alive connection stays open")
+	flag.DurationVar(&shutdownDelay, "shutdown-delay", 0, "How long to keep serving, reported not ready, after SIGTERM before draining")
+	flag.DurationVar(&shutdownWait, "shutdown-timeout", 30*time.Second, "How long shutdown waits for requests and running jobs")
+	flag.StringVar(&tlsCert, "tls-cert", os.Getenv("ACOUSTIC_TLS_CERT"), "PEM certificate chain to serve HTTPS with")
+	flag.StringVar(&tlsKey, "tls-key", os.Getenv("ACOUSTIC_TLS_KEY"), "PEM private key of -tls-cert")
+	flag.StringVar(&trustedProxies, "trusted-proxies", os.Getenv("ACOUSTIC_TRUSTED_PROXIES"), "Comma-separated proxy addresses or CIDR ranges whose X-Forwarded-For is believed")
 }
 
 func getEnvOrDefault(key, defaultValue string) string {
@@ -37,6 +98,20 @@ func getEnvOrDefault(key, defaultValue string) string {
 
 func main() {
 	flag.Parse()
+	if (tlsCert == "") != (tlsKey == "") {
+		log.Fatalf("-tls-cert and -tls-key must be given together")
+	}
+	var anonymous models.Role
+	if anonymousRole != "none" {
+		anonymous = models.Role(anonymousRole)
+		if !anonymous.Valid() {
+			log.Fatalf("Unknown -anonymous-role %q (use none, matcher, editor or admin)", anonymousRole)
+		}
+	}
+	proxies, err := parseTrustedProxies(trustedProxies)
+	if err != nil {
+		log.Fatalf("-trusted-proxies: %v", err)
+	}
 	var origins []string
 	if allowedOrigins == "*" {
 		origins = []string{"*"}
@@ -47,26 +122,123 @@ func main() {
 		}
 	}
 
-	service, err := acousticdna.NewService(
-		acousticdna.WithDBPath(dbPath),
+	audio.SetFFmpegConcurrency(ffmpegWorkers)
+
+	stor, err := acousticdna.OpenStorage(dbPath)
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+
+	// Metrics see every ingestion and match the service runs
+	size, _ := stor.(acousticdna.SizeReporter)
+	metrics := newMetrics(size)
+
+	matchOpts := matcher.DefaultOptions()
+	matchOpts.FalsePositiveRate = fpRate
+	opts := []acousticdna.Option{
+		acousticdna.WithStorage(stor),
 		acousticdna.WithTempDir(tempDir),
 		acousticdna.WithSampleRate(sampleRate),
-	)
+		acousticdna.WithMatchOptions(matchOpts),
+		acousticdna.WithObserver(metrics),
+	}
+	if profileName != "" {
+		profile, ok := fingerprint.Profiles()[profileName]
+		if !ok {
+			log.Fatalf("Unknown fingerprint profile %q", profileName)
+		}
+		opts = append(opts, acousticdna.WithFingerprintProfile(profile))
+	}
+
+	service, err := acousticdna.NewService(opts...)
 	if err != nil {
 		log.Fatalf("Failed to create service: %v", err)
 	}
-	defer service.Close()
+
+	// Jobs live next to the catalogue when the backend can hold them
+	jobStore, ok := stor.(acousticdna.JobStore)
+	if !ok {
+		log.Printf("Storage %s can't persist jobs; they will be lost on restart", acousticdna.RedactDSN(dbPath))
+		jobStore = acousticdna.NewMemoryStorage().(acousticdna.JobStore)
+	}
+	if spoolDir == "" {
+		spoolDir = filepath.Join(tempDir, "acousticdna-jobs")
+	}
+	jobs := acousticdna.NewJobQueue(service, jobStore,
+		acousticdna.WithJobWorkers(jobWorkers),
+		acousticdna.WithJobDirs(spoolDir, tempDir),
+	)
+	if err := jobs.Start(context.Background()); err != nil {
+		log.Fatalf("Failed to start job queue: %v", err)
+	}
+
+	// API keys live in the catalogue too
+	keyStore, ok := stor.(acousticdna.KeyStore)
+	if !ok {
+		log.Printf("Storage %s can't hold API keys; only JWTs are accepted", acousticdna.RedactDSN(dbPath))
+		keyStore = acousticdna.NewMemoryStorage().(acousticdna.KeyStore)
+	}
 
 	config := &ServerConfig{
 		Port:           port,
-		DBPath:         dbPath,
+		DBPath:         acousticdna.RedactDSN(dbPath),
 		TempDir:        tempDir,
-		SampleRate:     sampleRate,
+		SampleRate:     service.Profile().SampleRate,
 		AllowedOrigins: origins,
+
+		AnonymousRole:    anonymous,
+		JWTSecret:        jwtSecret,
+		JWTPublicKeyFile: jwtPublicKey,
+		JWTIssuer:        jwtIssuer,
+		JWTAudience:      jwtAudience,
+
+		MatchRateLimit:  RateLimit{PerMinute: matchLimit, Burst: matchBurst},
+		IngestRateLimit: RateLimit{PerMinute: ingestLimit, Burst: ingestBurst},
+		AdminRateLimit:  RateLimit{PerMinute: adminLimit, Burst: adminBurst},
+		TrustedProxies:  proxies,
+
+		ReadHeaderTimeout: headerTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+		ShutdownDelay:     shutdownDelay,
+		TLSCertFile:       tlsCert,
+		TLSKeyFile:        tlsKey,
 	}
 
-	server := NewServer(service, config)
-	if err := server.Start(); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	server, err := NewServer(service, jobs, keyStore, metrics, config)
+	if err != nil {
+		log.Fatalf("Failed to create server: %v", err)
+	}
+
+	// Serve until SIGINT or SIGTERM, then let requests and jobs in flight
+	// finish so no song is left half stored
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	served := make(chan error, 1)
+	go func() { served <- server.Start() }()
+
+	var failed error
+	select {
+	case failed = <-served:
+		jobs.Close()
+	case <-ctx.Done():
+		// A second signal kills the process straight away
+		stop()
+		log.Printf("Shutting down (send the signal again to force)")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownDelay+shutdownWait)
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Shutdown incomplete: %v", err)
+		}
+		cancel()
+		failed = <-served
+	}
+
+	if err := service.Close(); err != nil {
+		log.Printf("Failed to close storage: %v", err)
+	}
+	if failed != nil {
+		log.Fatalf("Server failed: %v", failed)
 	}
+	log.Printf("Server stopped")
 }
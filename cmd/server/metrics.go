@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna"
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// The /metrics endpoint, in the Prometheus text exposition format
+// (https://prometheus.io/docs/instrumenting/exposition_formats/). The few
+// metric types it needs are kept here rather than pulling in the client
+// library.
+
+// Bucket upper bounds
+var (
+	requestBuckets   = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+	stageBuckets     = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	sizeBuckets      = []float64{10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 25000, 50000, 100000}
+	candidateBuckets = []float64{0, 1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500}
+)
+
+// metrics holds the server's counters and histograms. It implements
+// acousticdna.PipelineObserver.
+type metrics struct {
+	requests        *counterVec
+	requestDuration *histogramVec
+	stageDuration   *histogramVec
+	peaks           *histogramVec
+	hashes          *histogramVec
+	candidates      *histogramVec
+	outcomes        *counterVec
+
+	size acousticdna.SizeReporter // nil if the backend can't tell
+}
+
+func newMetrics(size acousticdna.SizeReporter) *metrics {
+	return &metrics{
+		requests: newCounterVec("acousticdna_http_requests_total",
+			"HTTP requests by route, method and status.", "route", "method", "status"),
+		requestDuration: newHistogramVec("acousticdna_http_request_duration_seconds",
+			"HTTP request latency by route, method and status.", requestBuckets, "route", "method", "status"),
+		stageDuration: newHistogramVec("acousticdna_pipeline_stage_duration_seconds",
+			"Time one ingestion or match spent in a pipeline stage.", stageBuckets, "operation", "stage"),
+		peaks: newHistogramVec("acousticdna_pipeline_peaks",
+			"Spectral peaks per ingested song or query.", sizeBuckets, "operation"),
+		hashes: newHistogramVec("acousticdna_pipeline_hashes",
+			"Hashes per ingested song or query.", sizeBuckets, "operation"),
+		candidates: newHistogramVec("acousticdna_match_candidates",
+			"Songs sharing a hash with a query.", candidateBuckets, "operation"),
+		outcomes: newCounterVec("acousticdna_match_outcomes_total",
+			"Queries by whether their top result was a match.", "operation", "outcome"),
+		size: size,
+	}
+}
+
+// ObservePipeline records the stages and sizes of an ingestion or match
+func (m *metrics) ObservePipeline(stats acousticdna.PipelineStats) {
+	op := stats.Operation
+	for _, stage := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"decode", stats.Decode},
+		{"stft", stats.STFT},
+		{"peaks", stats.PeakExtraction},
+		{"hashing", stats.Hashing},
+		{"lookup", stats.Lookup},
+		{"voting", stats.Voting},
+	} {
+		if stage.d > 0 {
+			m.stageDuration.observe(stage.d.Seconds(), op, stage.name)
+		}
+	}
+
+	if op != acousticdna.OpMatchHashes {
+		m.peaks.observe(float64(stats.Peaks), op)
+	}
+	m.hashes.observe(float64(stats.Hashes), op)
+	if op == acousticdna.OpIngest {
+		return
+	}
+	m.candidates.observe(float64(stats.Candidates), op)
+	outcome := "no_match"
+	if stats.Matched {
+		outcome = "match"
+	}
+	m.outcomes.add(1, op, outcome)
+}
+
+// instrument counts and times every request by the route pattern it was
+// served by, so IDs in paths don't each become a series
+func (m *metrics) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(wrapped, r)
+
+		// The mux records the pattern on the request it was handed
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(wrapped.statusCode)
+		m.requests.add(1, route, r.Method, status)
+		m.requestDuration.observe(time.Since(start).Seconds(), route, r.Method, status)
+	})
+}
+
+// handlePrometheus serves /metrics
+func (s *Server) handlePrometheus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+
+	// Catalogue gauges are read at scrape time
+	m := s.metrics
+	if page, err := s.service.QuerySongs(models.SongQuery{Limit: 1}); err == nil {
+		writeGauge(bw, "acousticdna_catalogue_songs", "Songs in the catalogue.", float64(page.Total))
+	} else {
+		s.log.Warnf("Failed to count songs for metrics: %v", err)
+	}
+	if m.size != nil {
+		if size, err := m.size.SizeBytes(); err == nil {
+			writeGauge(bw, "acousticdna_catalogue_size_bytes", "Size of the catalogue on disk.", float64(size))
+		} else {
+			s.log.Warnf("Failed to read catalogue size for metrics: %v", err)
+		}
+	}
+
+	m.requests.write(bw)
+	m.requestDuration.write(bw)
+	m.stageDuration.write(bw)
+	m.peaks.write(bw)
+	m.hashes.write(bw)
+	m.candidates.write(bw)
+	m.outcomes.write(bw)
+}
+
+// counterVec is a counter with labels
+type counterVec struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	series map[string]float64 // By joined label values
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, series: make(map[string]float64)}
+}
+
+func (c *counterVec) add(v float64, values ...string) {
+	key := seriesKey(values)
+	c.mu.Lock()
+	c.series[key] += v
+	c.mu.Unlock()
+}
+
+func (c *counterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.series) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, labelSet(c.labels, key, ""), formatValue(c.series[key]))
+	}
+}
+
+// histogramVec is a histogram with labels
+type histogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // Per bucket, not cumulative; the last is +Inf
+	sum    float64
+	count  uint64
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogram)}
+}
+
+func (h *histogramVec) observe(v float64, values ...string) {
+	key := seriesKey(values)
+	i := sort.SearchFloat64s(h.buckets, v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets)+1)}
+		h.series[key] = s
+	}
+	s.counts[i]++
+	s.sum += v
+	s.count++
+}
+
+func (h *histogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelSet(h.labels, key, formatValue(le)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelSet(h.labels, key, "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelSet(h.labels, key, ""), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelSet(h.labels, key, ""), s.count)
+	}
+}
+
+func writeGauge(w *bufio.Writer, name, help string, v float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", name, help, name, name, formatValue(v))
+}
+
+// seriesKey joins label values with a byte that can't occur in UTF-8
+func seriesKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// labelSet renders {name="value",...} for a series key, with le added for
+// histogram buckets
+func labelSet(names []string, key, le string) string {
+	var b strings.Builder
+	values := strings.Split(key, "\xff")
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, name, escapeLabel(values[i]))
+	}
+	if le != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `le="%s"`, le)
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return "{" + b.String() + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
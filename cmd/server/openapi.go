@@ -0,0 +1,24 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec is the OpenAPI 3 document of every route. Keep it in step
+// with setupRoutes and the DTOs in pkg/models.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// handleOpenAPI serves /api/openapi.json. The contract is public, so it
+// needs no credentials.
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		s.respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(openAPISpec)
+}
@@ -0,0 +1,776 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/audio"
+	"github.com/himanishpuri/AcousticDNA/pkg/client"
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// openAPIDoc checks requests and responses against the embedded OpenAPI
+// document, and records which operations were seen
+type openAPIDoc struct {
+	doc map[string]any
+
+	mu   sync.Mutex
+	seen map[string]bool // "GET /api/songs/{id}"
+}
+
+func loadOpenAPI(t *testing.T) *openAPIDoc {
+	t.Helper()
+	dec := json.NewDecoder(bytes.NewReader(openAPISpec))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+	o := &openAPIDoc{doc: doc, seen: map[string]bool{}}
+	if err := o.checkRefs(doc); err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+	return o
+}
+
+// checkRefs makes sure every $ref in v points somewhere
+func (o *openAPIDoc) checkRefs(v any) error {
+	switch v := v.(type) {
+	case map[string]any:
+		if ref, ok := v["$ref"].(string); ok {
+			if _, err := o.resolve(ref); err != nil {
+				return err
+			}
+		}
+		for _, x := range v {
+			if err := o.checkRefs(x); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, x := range v {
+			if err := o.checkRefs(x); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolve looks up a local reference such as #/components/schemas/Song
+func (o *openAPIDoc) resolve(ref string) (map[string]any, error) {
+	var node any = o.doc
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("dangling $ref %s", ref)
+		}
+		if node, ok = m[part]; !ok {
+			return nil, fmt.Errorf("dangling $ref %s", ref)
+		}
+	}
+	m, ok := node.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("$ref %s is not an object", ref)
+	}
+	return m, nil
+}
+
+// deref follows node's $ref, if it has one
+func (o *openAPIDoc) deref(node map[string]any) map[string]any {
+	if ref, ok := node["$ref"].(string); ok {
+		if target, err := o.resolve(ref); err == nil {
+			return target
+		}
+	}
+	return node
+}
+
+// operation finds the operation serving method and path, returning its
+// path template. As in the router, literal segments win over parameters.
+func (o *openAPIDoc) operation(method, path string) (string, map[string]any, error) {
+	paths := o.doc["paths"].(map[string]any)
+	segments := strings.Split(path, "/")
+	best, bestParams := "", len(segments)+1
+	for tmpl := range paths {
+		parts := strings.Split(tmpl, "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+		params := 0
+		for i, part := range parts {
+			if strings.HasPrefix(part, "{") {
+				params++
+			} else if part != segments[i] {
+				params = len(segments) + 1
+				break
+			}
+		}
+		if params < bestParams {
+			best, bestParams = tmpl, params
+		}
+	}
+	if best == "" {
+		return "", nil, fmt.Errorf("%s %s: undocumented path", method, path)
+	}
+	op, ok := paths[best].(map[string]any)[strings.ToLower(method)].(map[string]any)
+	if !ok {
+		return "", nil, fmt.Errorf("%s %s: no such operation on %s", method, path, best)
+	}
+	return best, op, nil
+}
+
+// parameters lists the operation's parameters and those of its path
+func (o *openAPIDoc) parameters(tmpl string, op map[string]any) []map[string]any {
+	var params []map[string]any
+	item := o.doc["paths"].(map[string]any)[tmpl].(map[string]any)
+	for _, list := range []any{item["parameters"], op["parameters"]} {
+		items, _ := list.([]any)
+		for _, p := range items {
+			params = append(params, o.deref(p.(map[string]any)))
+		}
+	}
+	return params
+}
+
+// validate checks a decoded JSON value against a schema
+func (o *openAPIDoc) validate(v any, schema map[string]any, at string) error {
+	schema = o.deref(schema)
+	typ, _ := schema["type"].(string)
+	switch typ {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: want an object, got %v", at, v)
+		}
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if _, ok := obj[name.(string)]; !ok {
+				return fmt.Errorf("%s: missing required %s", at, name)
+			}
+		}
+		props, _ := schema["properties"].(map[string]any)
+		extra, _ := schema["additionalProperties"].(map[string]any)
+		for name, x := range obj {
+			switch prop, ok := props[name].(map[string]any); {
+			case ok:
+				if err := o.validate(x, prop, at+"."+name); err != nil {
+					return err
+				}
+			case extra != nil:
+				if err := o.validate(x, extra, at+"."+name); err != nil {
+					return err
+				}
+			case props != nil:
+				return fmt.Errorf("%s: undocumented property %s", at, name)
+			}
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s: want an array, got %v", at, v)
+		}
+		if max, ok := schema["maxItems"].(json.Number); ok {
+			if n, _ := max.Int64(); int64(len(arr)) > n {
+				return fmt.Errorf("%s: %d items, at most %d allowed", at, len(arr), n)
+			}
+		}
+		items, _ := schema["items"].(map[string]any)
+		for i, x := range arr {
+			if err := o.validate(x, items, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: want a string, got %v", at, v)
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				return fmt.Errorf("%s: %q is not a date-time", at, s)
+			}
+		}
+	case "integer", "number":
+		n, ok := v.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: want %s, got %v", at, typ, v)
+		}
+		if typ == "integer" {
+			if _, err := n.Int64(); err != nil {
+				return fmt.Errorf("%s: want an integer, got %s", at, n)
+			}
+		}
+		f, _ := n.Float64()
+		if min, ok := schema["minimum"].(json.Number); ok {
+			if m, _ := min.Float64(); f < m {
+				return fmt.Errorf("%s: %s is below the minimum %s", at, n, min)
+			}
+		}
+		if max, ok := schema["maximum"].(json.Number); ok {
+			if m, _ := max.Float64(); f > m {
+				return fmt.Errorf("%s: %s is above the maximum %s", at, n, max)
+			}
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: want a boolean, got %v", at, v)
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		for _, e := range enum {
+			if fmt.Sprint(e) == fmt.Sprint(v) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: %v is not one of %v", at, v, enum)
+	}
+	return nil
+}
+
+// decodeJSON decodes a message body keeping numbers as written
+func decodeJSON(body []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	err := dec.Decode(&v)
+	return v, err
+}
+
+// checkResponse validates a response to method and path, and marks its
+// operation as seen
+func (o *openAPIDoc) checkResponse(method, path string, status int, header http.Header, body []byte) error {
+	tmpl, op, err := o.operation(method, path)
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	o.seen[method+" "+tmpl] = true
+	o.mu.Unlock()
+
+	resp, ok := op["responses"].(map[string]any)[strconv.Itoa(status)].(map[string]any)
+	if !ok {
+		return fmt.Errorf("%s %s: undocumented status %d: %.200s", method, path, status, body)
+	}
+	content, _ := o.deref(resp)["content"].(map[string]any)
+	if len(content) == 0 {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	media, ok := content[mediaType].(map[string]any)
+	if !ok {
+		return fmt.Errorf("%s %s %d: undocumented content type %q", method, path, status, mediaType)
+	}
+	if mediaType != "application/json" {
+		return nil
+	}
+	v, err := decodeJSON(body)
+	if err != nil {
+		return fmt.Errorf("%s %s %d: %v", method, path, status, err)
+	}
+	if err := o.validate(v, media["schema"].(map[string]any), "$"); err != nil {
+		return fmt.Errorf("%s %s %d: %v", method, path, status, err)
+	}
+	return nil
+}
+
+// checkRequest validates a request's query, credentials and body
+func (o *openAPIDoc) checkRequest(r *http.Request, body []byte) error {
+	method, path := r.Method, r.URL.Path
+	tmpl, op, err := o.operation(method, path)
+	if err != nil {
+		return err
+	}
+
+	params := map[string]map[string]any{}
+	for _, p := range o.parameters(tmpl, op) {
+		if p["in"] == "query" {
+			params[p["name"].(string)] = p["schema"].(map[string]any)
+		}
+	}
+	for name, values := range r.URL.Query() {
+		schema, ok := params[name]
+		if !ok {
+			return fmt.Errorf("%s %s: undocumented query parameter %s", method, path, name)
+		}
+		var v any = values[0]
+		if typ := o.deref(schema)["type"]; typ == "integer" || typ == "number" {
+			v = json.Number(values[0])
+		}
+		if err := o.validate(v, schema, name); err != nil {
+			return fmt.Errorf("%s %s: %v", method, path, err)
+		}
+	}
+
+	security, ok := op["security"].([]any)
+	if !ok {
+		security, _ = o.doc["security"].([]any)
+	}
+	if len(security) > 0 && r.Header.Get("X-API-Key") == "" && !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		return fmt.Errorf("%s %s: sent without credentials", method, path)
+	}
+
+	reqBody, ok := op["requestBody"].(map[string]any)
+	if !ok {
+		if len(body) > 0 {
+			return fmt.Errorf("%s %s: takes no body, sent %d bytes", method, path, len(body))
+		}
+		return nil
+	}
+	mediaType, mediaParams, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	media, ok := o.deref(reqBody)["content"].(map[string]any)[mediaType].(map[string]any)
+	if !ok {
+		return fmt.Errorf("%s %s: undocumented request content type %q", method, path, mediaType)
+	}
+	schema := o.deref(media["schema"].(map[string]any))
+
+	switch mediaType {
+	case "application/json":
+		v, err := decodeJSON(body)
+		if err != nil {
+			return fmt.Errorf("%s %s: request body: %v", method, path, err)
+		}
+		if err := o.validate(v, schema, "$"); err != nil {
+			return fmt.Errorf("%s %s: request body: %v", method, path, err)
+		}
+	case "multipart/form-data":
+		// Form fields arrive as strings; binary ones must be files
+		props, _ := schema["properties"].(map[string]any)
+		form := map[string]any{}
+		mr := multipart.NewReader(bytes.NewReader(body), mediaParams["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("%s %s: request form: %v", method, path, err)
+			}
+			prop, ok := props[part.FormName()].(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s %s: undocumented form field %s", method, path, part.FormName())
+			}
+			if prop["format"] == "binary" && part.FileName() == "" {
+				return fmt.Errorf("%s %s: form field %s is not a file", method, path, part.FormName())
+			}
+			value, _ := io.ReadAll(part)
+			form[part.FormName()] = string(value)
+		}
+		if err := o.validate(form, schema, "form"); err != nil {
+			return fmt.Errorf("%s %s: %v", method, path, err)
+		}
+	}
+	return nil
+}
+
+// unseen lists the documented operations not yet seen
+func (o *openAPIDoc) unseen() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var missing []string
+	for tmpl, item := range o.doc["paths"].(map[string]any) {
+		for method := range item.(map[string]any) {
+			if method == "parameters" {
+				continue
+			}
+			if op := strings.ToUpper(method) + " " + tmpl; !o.seen[op] {
+				missing = append(missing, op)
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// call sends a request to the test server and checks the response against
+// the document. It returns the status and the decoded JSON body, if any.
+func (ts *testServer) call(t *testing.T, spec *openAPIDoc, method, path, key, contentType string, body []byte) (int, any) {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	if err := spec.checkResponse(method, req.URL.Path, resp.StatusCode, resp.Header, data); err != nil {
+		t.Error(err)
+	}
+	v, _ := decodeJSON(data)
+	return resp.StatusCode, v
+}
+
+// callJSON sends in as a JSON body
+func (ts *testServer) callJSON(t *testing.T, spec *openAPIDoc, method, path, key string, in any) (int, any) {
+	t.Helper()
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts.call(t, spec, method, path, key, "application/json", data)
+}
+
+const testSongFile = "../../test/testCroppedAudio/moosy_test.wav"
+
+// uploadForm builds a multipart form of fields and, unless file is empty,
+// the recording at file as "audio"
+func uploadForm(t *testing.T, file string, fields ...string) (string, []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+	for i := 0; i+1 < len(fields); i += 2 {
+		form.WriteField(fields[i], fields[i+1])
+	}
+	if file != "" {
+		data, err := readQuery(file, 0)
+		if err != nil {
+			t.Fatalf("reading %s: %v", file, err)
+		}
+		w, _ := form.CreateFormFile("audio", "recording.wav")
+		w.Write(data)
+	}
+	form.Close()
+	return form.FormDataContentType(), buf.Bytes()
+}
+
+// readQuery returns the recording at path as a WAV, cropped to a few
+// seconds from offset unless offset is 0
+func readQuery(path string, offset time.Duration) ([]byte, error) {
+	samples, rate, err := audio.ReadWavAsFloat64(path)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		start := int(offset.Seconds() * float64(rate))
+		samples = samples[start : start+6*rate]
+	}
+	var buf bytes.Buffer
+	err = audio.EncodeWAV(&buf, samples, rate)
+	return buf.Bytes(), err
+}
+
+// field digs a string out of a decoded JSON object
+func field(v any, path ...string) string {
+	for _, name := range path {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return ""
+		}
+		v = obj[name]
+	}
+	s, _ := v.(string)
+	return s
+}
+
+func TestOpenAPIDescribesHandlers(t *testing.T) {
+	spec := loadOpenAPI(t)
+	ts := newTestServer(t)
+	admin, editor, matcher := ts.key(t, models.RoleAdmin), ts.key(t, models.RoleEditor), ts.key(t, models.RoleMatcher)
+	get := func(path, key string) (int, any) { return ts.call(t, spec, http.MethodGet, path, key, "", nil) }
+	expect := func(what string, got int, want int) {
+		t.Helper()
+		if got != want {
+			t.Errorf("%s: status %d, want %d", what, got, want)
+		}
+	}
+
+	for _, path := range []string{"/health", "/health/live", "/health/ready", "/api/openapi.json"} {
+		status, _ := get(path, "")
+		expect(path, status, http.StatusOK)
+	}
+	status, _ := get("/api/health/metrics", admin)
+	expect("metrics", status, http.StatusOK)
+	status, _ = get("/api/health/metrics", matcher)
+	expect("metrics as a matcher", status, http.StatusForbidden)
+	status, _ = get("/metrics", ts.key(t, models.RoleMetrics))
+	expect("Prometheus metrics", status, http.StatusOK)
+	status, _ = get("/api/profile", matcher)
+	expect("profile", status, http.StatusOK)
+	status, _ = get("/api/songs", "")
+	expect("songs without a key", status, http.StatusUnauthorized)
+
+	// Add a song through the job queue
+	contentType, form := uploadForm(t, testSongFile, "title", "Moosy", "artist", "Test Artist")
+	status, job := ts.call(t, spec, http.MethodPost, "/api/songs", editor, contentType, form)
+	expect("upload", status, http.StatusAccepted)
+	contentType, form = uploadForm(t, "", "title", "Moosy")
+	status, _ = ts.call(t, spec, http.MethodPost, "/api/songs", editor, contentType, form)
+	expect("upload without audio", status, http.StatusBadRequest)
+
+	jobID := field(job, "id")
+	deadline := time.Now().Add(time.Minute)
+	for field(job, "status") != string(models.JobSucceeded) {
+		if s := field(job, "status"); s == string(models.JobFailed) || time.Now().After(deadline) {
+			t.Fatalf("job %s, %s", s, field(job, "error"))
+		}
+		time.Sleep(50 * time.Millisecond)
+		_, job = get("/api/jobs/"+jobID, editor)
+	}
+	songID := field(job, "song_id")
+	status, _ = get("/api/jobs?status=succeeded", editor)
+	expect("jobs", status, http.StatusOK)
+	status, _ = get("/api/jobs/nope", editor)
+	expect("unknown job", status, http.StatusNotFound)
+
+	// Songs
+	status, _ = get("/api/songs?limit=1&sort=title&order=desc&source=file&search=moosy", matcher)
+	expect("song list", status, http.StatusOK)
+	status, _ = get("/api/songs?limit=0", matcher)
+	expect("song list with a zero limit", status, http.StatusBadRequest)
+	status, _ = get("/api/songs/"+songID, matcher)
+	expect("song", status, http.StatusOK)
+	status, _ = get("/api/songs/nope", matcher)
+	expect("unknown song", status, http.StatusNotFound)
+	status, _ = ts.callJSON(t, spec, http.MethodPatch, "/api/songs/"+songID, editor,
+		map[string]any{"genre": "Test", "year": 2020, "tags": []string{"a"}, "external_ids": map[string]string{"mb": "x"}})
+	expect("song update", status, http.StatusOK)
+	status, _ = ts.callJSON(t, spec, http.MethodPatch, "/api/songs/"+songID, editor, map[string]any{"year": "soon"})
+	expect("song update with a bad year", status, http.StatusBadRequest)
+
+	// Matching
+	query, err := readQuery(testSongFile, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	w, _ := mw.CreateFormFile("audio", "query.wav")
+	w.Write(query)
+	mw.Close()
+	status, match := ts.call(t, spec, http.MethodPost, "/api/match", matcher, mw.FormDataContentType(), buf.Bytes())
+	expect("match", status, http.StatusOK)
+	if field(match, "verdict") != string(models.VerdictMatch) {
+		t.Errorf("crop of a catalogued song: verdict %q", field(match, "verdict"))
+	}
+	contentType, form = uploadForm(t, "")
+	status, _ = ts.call(t, spec, http.MethodPost, "/api/match", matcher, contentType, form)
+	expect("match without audio", status, http.StatusBadRequest)
+	status, _ = ts.callJSON(t, spec, http.MethodPost, "/api/match/hashes", matcher,
+		models.MatchHashesRequest{Pairs: []models.HashPairDTO{{Hash: 123456789, AnchorTimeMs: 10}}})
+	expect("hash match", status, http.StatusOK)
+	status, _ = ts.callJSON(t, spec, http.MethodPost, "/api/match/hashes", matcher, models.MatchHashesRequest{})
+	expect("hash match without hashes", status, http.StatusBadRequest)
+
+	// A YouTube job, cancelled; it may already have failed for want of yt-dlp
+	status, _ = ts.callJSON(t, spec, http.MethodPost, "/api/songs/youtube", editor, map[string]any{})
+	expect("YouTube job without a URL", status, http.StatusBadRequest)
+	status, job = ts.callJSON(t, spec, http.MethodPost, "/api/songs/youtube", editor,
+		models.AddSongYouTubeRequest{YouTubeURL: "https://www.youtube.com/watch?v=dQw4w9WgXcQ"})
+	expect("YouTube job", status, http.StatusAccepted)
+	status, _ = ts.call(t, spec, http.MethodDelete, "/api/jobs/"+field(job, "id"), editor, "", nil)
+	if status != http.StatusOK && status != http.StatusConflict {
+		t.Errorf("cancelling a job: status %d", status)
+	}
+
+	// Keys
+	status, created := ts.callJSON(t, spec, http.MethodPost, "/api/keys", admin, models.CreateAPIKeyRequest{Name: "probe", Role: models.RoleMatcher})
+	expect("key creation", status, http.StatusCreated)
+	status, _ = ts.callJSON(t, spec, http.MethodPost, "/api/keys", admin, map[string]string{"name": "probe", "role": "bogus"})
+	expect("key with a bogus role", status, http.StatusBadRequest)
+	status, _ = get("/api/keys", admin)
+	expect("key list", status, http.StatusOK)
+	status, _ = ts.call(t, spec, http.MethodDelete, "/api/keys/"+field(created, "api_key", "id"), admin, "", nil)
+	expect("key revocation", status, http.StatusOK)
+	status, _ = ts.call(t, spec, http.MethodDelete, "/api/keys/nope", admin, "", nil)
+	expect("unknown key revocation", status, http.StatusNotFound)
+
+	status, _ = ts.call(t, spec, http.MethodDelete, "/api/songs/"+songID, editor, "", nil)
+	expect("song deletion", status, http.StatusOK)
+	status, _ = ts.call(t, spec, http.MethodDelete, "/api/songs/"+songID, editor, "", nil)
+	expect("deleted song deletion", status, http.StatusNotFound)
+
+	if missing := spec.unseen(); len(missing) > 0 {
+		t.Errorf("operations not exercised: %v", missing)
+	}
+}
+
+// conformingProxy forwards to the test server's handler, checking every
+// request and response against the document on the way
+func conformingProxy(t *testing.T, spec *openAPIDoc, ts *testServer) *httptest.Server {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("%s %s: reading request: %v", r.Method, r.URL.Path, err)
+		}
+		if err := spec.checkRequest(r, body); err != nil {
+			t.Errorf("client request: %v", err)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		rec := httptest.NewRecorder()
+		ts.srv.http.Handler.ServeHTTP(rec, r)
+		if err := spec.checkResponse(r.Method, r.URL.Path, rec.Code, rec.Header(), rec.Body.Bytes()); err != nil {
+			t.Errorf("server response: %v", err)
+		}
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+func TestClientRequestsMatchOpenAPI(t *testing.T) {
+	spec := loadOpenAPI(t)
+	ts := newTestServer(t)
+	proxy := conformingProxy(t, spec, ts)
+	ctx := t.Context()
+
+	newClient := func(role models.Role) *client.Client {
+		c, err := client.New(proxy.URL, client.WithAPIKey(ts.key(t, role)))
+		if err != nil {
+			t.Fatalf("client.New: %v", err)
+		}
+		return c
+	}
+	admin, editor, matcher := newClient(models.RoleAdmin), newClient(models.RoleEditor), newClient(models.RoleMatcher)
+	check := func(what string, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s: %v", what, err)
+		}
+	}
+
+	_, err := admin.Health(ctx)
+	check("Health", err)
+	_, err = admin.Metrics(ctx)
+	check("Metrics", err)
+	profile, err := matcher.Profile(ctx)
+	check("Profile", err)
+
+	data, err := readQuery(testSongFile, 0)
+	check("reading the song", err)
+	job, err := editor.AddSongFile(ctx, bytes.NewReader(data), "moosy.wav", "Moosy", "Test Artist", "dQw4w9WgXcQ")
+	check("AddSongFile", err)
+	job, err = editor.WaitJob(ctx, job.ID, 20*time.Millisecond)
+	check("WaitJob", err)
+	if job.Status != models.JobSucceeded {
+		t.Fatalf("job %s: %s", job.Status, job.Error)
+	}
+	_, err = editor.ListJobs(ctx, models.JobSucceeded)
+	check("ListJobs", err)
+	_, err = editor.GetJob(ctx, job.ID)
+	check("GetJob", err)
+
+	page, err := matcher.ListSongs(ctx, models.SongQuery{
+		Search:        "moosy",
+		MinDurationMs: 1000,
+		MaxDurationMs: 600000,
+		Source:        models.SourceYouTube,
+		CreatedAfter:  time.Now().Add(-time.Hour),
+		CreatedBefore: time.Now().Add(time.Hour),
+		Sort:          models.SortByTitle,
+		Desc:          true,
+		Limit:         10,
+	})
+	check("ListSongs", err)
+	if page.Total != 1 {
+		t.Errorf("ListSongs found %d songs, want the one added", page.Total)
+	}
+
+	// A second song, so the list has a next page
+	data, err = readQuery("../../test/testCroppedAudio/bruatiful_test.wav", 0)
+	check("reading the second song", err)
+	other, err := editor.AddSongFile(ctx, bytes.NewReader(data), "bruatiful.wav", "Bruatiful", "Test Artist", "")
+	check("AddSongFile", err)
+	if other, err = editor.WaitJob(ctx, other.ID, 20*time.Millisecond); err != nil || other.Status != models.JobSucceeded {
+		t.Fatalf("second song: %v, %+v", err, other)
+	}
+	page, err = matcher.ListSongs(ctx, models.SongQuery{Limit: 1})
+	check("ListSongs", err)
+	if page.NextCursor == "" {
+		t.Fatal("first page of two songs has no cursor")
+	}
+	_, err = matcher.ListSongs(ctx, models.SongQuery{Limit: 1, Cursor: page.NextCursor})
+	check("ListSongs with a cursor", err)
+	_, err = matcher.GetSong(ctx, job.SongID)
+	check("GetSong", err)
+	genre, year, tags := "Test", 2020, []string{"a", "b"}
+	_, err = editor.UpdateSong(ctx, job.SongID, models.UpdateSongRequest{
+		Genre: &genre, Year: &year, Tags: &tags, ExternalIDs: map[string]string{"mb": "x"},
+	})
+	check("UpdateSong", err)
+
+	query, err := readQuery(testSongFile, 5*time.Second)
+	check("cropping the song", err)
+	match, err := matcher.MatchFile(ctx, bytes.NewReader(query), "query.wav")
+	check("MatchFile", err)
+	if match.Verdict != models.VerdictMatch {
+		t.Errorf("MatchFile verdict %q", match.Verdict)
+	}
+	rawProfile, err := json.Marshal(profile)
+	check("encoding the profile", err)
+	_, err = matcher.MatchHashes(ctx, models.MatchHashesRequest{
+		Pairs:   []models.HashPairDTO{{Hash: 123456789, AnchorTimeMs: 10}},
+		Profile: rawProfile,
+	})
+	check("MatchHashes", err)
+
+	yt, err := editor.AddSongYouTube(ctx, models.AddSongYouTubeRequest{
+		YouTubeURL: "https://www.youtube.com/watch?v=dQw4w9WgXcQ", Title: "Song", Artist: "Artist",
+	})
+	check("AddSongYouTube", err)
+	if _, err := editor.CancelJob(ctx, yt.ID); err != nil && !isStatus(err, http.StatusConflict) {
+		t.Errorf("CancelJob: %v", err)
+	}
+
+	created, err := admin.CreateAPIKey(ctx, "probe", models.RoleMatcher)
+	check("CreateAPIKey", err)
+	_, err = admin.ListAPIKeys(ctx)
+	check("ListAPIKeys", err)
+	_, err = admin.RevokeAPIKey(ctx, created.APIKey.ID)
+	check("RevokeAPIKey", err)
+
+	check("DeleteSong", editor.DeleteSong(ctx, job.SongID))
+	if _, err := matcher.GetSong(ctx, job.SongID); !client.IsNotFound(err) {
+		t.Errorf("GetSong of a deleted song: %v, want a 404", err)
+	}
+
+	// The client sends nothing to the probes or the document
+	unused := map[string]bool{
+		"GET /health/live": true, "GET /health/ready": true, "GET /api/openapi.json": true,
+		"GET /metrics": true,
+	}
+	for _, op := range spec.unseen() {
+		if !unused[op] {
+			t.Errorf("no client request for %s", op)
+		}
+	}
+}
+
+// isStatus reports whether err is an API error with status
+func isStatus(err error, status int) bool {
+	var apiErr *client.Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
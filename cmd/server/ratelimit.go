@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit is the budget of one group of routes: each client may make
+// Burst requests at once, refilled at PerMinute requests a minute
+type RateLimit struct {
+	PerMinute float64 // 0 disables the limit
+	Burst     int
+}
+
+// bucketSweepInterval is how often buckets of clients that stopped calling
+// are dropped
+const bucketSweepInterval = time.Minute
+
+// maxBuckets caps the clients a limiter tracks at once. When a new client
+// finds it full, the bucket that was used longest ago is dropped; that
+// client starts over with a full bucket if it comes back.
+const maxBuckets = 100_000
+
+// rateLimiter keeps a token bucket per client
+type rateLimiter struct {
+	limit RateLimit
+	rate  float64 // Tokens per second
+
+	mu         sync.Mutex
+	buckets    map[string]*tokenBucket
+	maxBuckets int
+	lastSweep  time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns nil, which lets everything through, for a disabled
+// limit
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	if limit.PerMinute <= 0 {
+		return nil
+	}
+	limit.Burst = max(1, limit.Burst)
+	return &rateLimiter{
+		limit:      limit,
+		rate:       limit.PerMinute / 60,
+		buckets:    make(map[string]*tokenBucket),
+		maxBuckets: maxBuckets,
+	}
+}
+
+// take spends a token of client's bucket. It returns whether there was one,
+// the whole tokens left and how long until the next token and a full bucket.
+func (l *rateLimiter) take(client string, now time.Time) (ok bool, remaining int, retry, reset time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	burst := float64(l.limit.Burst)
+	if now.Sub(l.lastSweep) >= bucketSweepInterval {
+		l.sweep(now)
+	}
+
+	b, found := l.buckets[client]
+	if !found {
+		if len(l.buckets) >= l.maxBuckets {
+			l.sweep(now)
+		}
+		if len(l.buckets) >= l.maxBuckets {
+			l.evictOldest()
+		}
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		ok = true
+	} else {
+		retry = l.wait(1 - b.tokens)
+	}
+	return ok, int(b.tokens), retry, l.wait(burst - b.tokens)
+}
+
+// sweep drops the buckets that would have refilled by now; they hold
+// nothing worth keeping
+func (l *rateLimiter) sweep(now time.Time) {
+	burst := float64(l.limit.Burst)
+	for k, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= burst {
+			delete(l.buckets, k)
+		}
+	}
+	l.lastSweep = now
+}
+
+// evictOldest drops the bucket that was used longest ago
+func (l *rateLimiter) evictOldest() {
+	var oldest string
+	var last time.Time
+	for k, b := range l.buckets {
+		if oldest == "" || b.last.Before(last) {
+			oldest, last = k, b.last
+		}
+	}
+	delete(l.buckets, oldest)
+}
+
+// wait is how long the bucket takes to gain tokens
+func (l *rateLimiter) wait(tokens float64) time.Duration {
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// limit charges requests to h against the read limiter for GET and HEAD and
+// the write limiter for other methods; a nil limiter doesn't limit. Clients
+// are told apart by API key or token subject, or else by address (see
+// clientIP), so it must run inside authorize.
+func (s *Server) limit(read, write *rateLimiter, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := write
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			l = read
+		}
+		if l == nil {
+			h(w, r)
+			return
+		}
+
+		client := "ip:" + s.clientIP(r)
+		if p, ok := principalFrom(r.Context()); ok && p.ID != "" {
+			client = "id:" + p.ID
+		}
+		ok, remaining, retry, reset := l.take(client, time.Now())
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(l.limit.Burst))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(reset)))
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(retry)))
+			s.respondError(w, http.StatusTooManyRequests,
+				fmt.Sprintf("Rate limit of %g requests a minute exceeded", l.limit.PerMinute))
+			return
+		}
+		h(w, r)
+	}
+}
+
+// ceilSeconds rounds d up to whole seconds, as the headers carry them
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
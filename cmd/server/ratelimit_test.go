@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := parseTrustedProxies("10.0.0.0/8, 192.168.1.10")
+	if err != nil {
+		t.Fatalf("parseTrustedProxies: %v", err)
+	}
+	s := &Server{config: &ServerConfig{TrustedProxies: proxies}}
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    []string
+		realIP string
+		want   string
+	}{
+		{"direct", "203.0.113.7:5000", nil, "", "203.0.113.7"},
+		{"direct ignores forwarded", "203.0.113.7:5000", []string{"198.51.100.1"}, "198.51.100.2", "203.0.113.7"},
+		{"IPv6 peer", "[2001:db8::1]:5000", nil, "", "2001:db8::1"},
+		{"trusted proxy", "10.1.2.3:5000", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"spoofed hop left of the client", "10.1.2.3:5000", []string{"1.2.3.4, 198.51.100.1"}, "", "198.51.100.1"},
+		{"proxy chain", "10.1.2.3:5000", []string{"198.51.100.1, 192.168.1.10", "10.9.9.9"}, "", "198.51.100.1"},
+		{"all hops trusted", "10.1.2.3:5000", []string{"10.4.4.4, 10.5.5.5"}, "", "10.4.4.4"},
+		{"garbage hop", "10.1.2.3:5000", []string{"junk, 10.5.5.5"}, "", "10.5.5.5"},
+		{"no forwarded header", "10.1.2.3:5000", nil, "", "10.1.2.3"},
+		{"real IP from a trusted proxy", "192.168.1.10:5000", nil, "198.51.100.3", "198.51.100.3"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/songs", nil)
+			r.RemoteAddr = tc.remote
+			for _, v := range tc.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if tc.realIP != "" {
+				r.Header.Set("X-Real-IP", tc.realIP)
+			}
+			if got := s.clientIP(r); got != tc.want {
+				t.Errorf("clientIP = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesRejectsGarbage(t *testing.T) {
+	for _, list := range []string{"10.0.0.0/33", "proxy.local", "10.0.0.1, nope"} {
+		if _, err := parseTrustedProxies(list); err == nil {
+			t.Errorf("parseTrustedProxies(%q) succeeded", list)
+		}
+	}
+	if p, err := parseTrustedProxies(""); err != nil || len(p) != 0 {
+		t.Errorf("parseTrustedProxies(\"\") = %v, %v; want none", p, err)
+	}
+}
+
+func TestRateLimiterTakesAndRefills(t *testing.T) {
+	l := newRateLimiter(RateLimit{PerMinute: 60, Burst: 2})
+	now := time.Unix(1000, 0)
+
+	for i := 0; i < 2; i++ {
+		if ok, _, _, _ := l.take("a", now); !ok {
+			t.Fatalf("request %d within the burst refused", i+1)
+		}
+	}
+	ok, remaining, retry, _ := l.take("a", now)
+	if ok || remaining != 0 || retry != time.Second {
+		t.Errorf("request over the burst: ok %v, remaining %d, retry %v; want refused with 1s to wait", ok, remaining, retry)
+	}
+	if ok, _, _, _ := l.take("b", now); !ok {
+		t.Errorf("another client was refused")
+	}
+	if ok, _, _, _ := l.take("a", now.Add(time.Second)); !ok {
+		t.Errorf("request after a refill refused")
+	}
+}
+
+func TestRateLimiterBoundsBuckets(t *testing.T) {
+	l := newRateLimiter(RateLimit{PerMinute: 1, Burst: 1})
+	l.maxBuckets = 10
+	now := time.Unix(1000, 0)
+
+	// Every client empties its bucket, so a sweep finds nothing to drop
+	for i := 0; i < 100; i++ {
+		l.take("client-"+strconv.Itoa(i), now.Add(time.Duration(i)*time.Millisecond))
+	}
+	if len(l.buckets) != l.maxBuckets {
+		t.Fatalf("%d buckets tracked, want at most %d", len(l.buckets), l.maxBuckets)
+	}
+	if _, ok := l.buckets["client-99"]; !ok {
+		t.Errorf("newest client's bucket was evicted")
+	}
+	if _, ok := l.buckets["client-0"]; ok {
+		t.Errorf("oldest client's bucket was kept")
+	}
+
+	// Refilled buckets go at the next sweep
+	l.take("late", now.Add(time.Hour))
+	if len(l.buckets) != 1 {
+		t.Errorf("%d buckets after a sweep, want only the new one", len(l.buckets))
+	}
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
-	"fmt"
+	"cmp"
+	"context"
+	"errors"
 	"net/http"
-	"strings"
+	"time"
 
 	"github.com/himanishpuri/AcousticDNA/pkg/logger"
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
 )
 
 func (s *Server) setupRoutes() http.Handler {
@@ -15,21 +18,44 @@ func (s *Server) setupRoutes() http.Handler {
 	fs := http.FileServer(http.Dir("./web/public"))
 	mux.Handle("/", fs)
 
+	// Roles for reading (GET) and changing (other methods) each resource,
+	// and the budgets the requests are charged to. Reading songs and jobs
+	// is cheap and left unlimited.
+	matcher, editor, admin := models.RoleMatcher, models.RoleEditor, models.RoleAdmin
+	match, ingest, adm := s.matchLimit, s.ingestLimit, s.adminLimit
+
 	// Health endpoints
 	mux.HandleFunc("/health", s.handleHealth)
-	mux.HandleFunc("/api/health/metrics", s.handleMetrics)
+	mux.HandleFunc("/health/live", s.handleLive)
+	mux.HandleFunc("/health/ready", s.handleReady)
+	mux.HandleFunc("/api/health/metrics", s.authorize(admin, admin, s.limit(adm, adm, s.handleMetrics)))
+	// Scrapers get a metrics key, which opens nothing else
+	scrape := models.RoleMetrics
+	mux.HandleFunc("/metrics", s.authorize(scrape, scrape, s.handlePrometheus))
+
+	// The API contract
+	mux.HandleFunc("/api/openapi.json", s.handleOpenAPI)
 
 	// Song management endpoints
-	mux.HandleFunc("/api/songs", s.handleSongs)
-	mux.HandleFunc("/api/songs/", s.handleSong)
-	mux.HandleFunc("/api/songs/youtube", s.handleAddSongYouTube)
+	mux.HandleFunc("/api/songs", s.authorize(matcher, editor, s.limit(nil, ingest, s.handleSongs)))
+	mux.HandleFunc("/api/songs/", s.authorize(matcher, editor, s.limit(nil, ingest, s.handleSong)))
+	mux.HandleFunc("/api/songs/youtube", s.authorize(editor, editor, s.limit(ingest, ingest, s.handleAddSongYouTube)))
+
+	// Background ingestion jobs
+	mux.HandleFunc("/api/jobs", s.authorize(editor, editor, s.limit(nil, ingest, s.handleJobs)))
+	mux.HandleFunc("/api/jobs/", s.authorize(editor, editor, s.limit(nil, ingest, s.handleJob)))
 
-	// Match endpoints
-	mux.HandleFunc("/api/match", s.handleMatch)
-	mux.HandleFunc("/api/match/hashes", s.handleMatchHashesRoute)
+	// Match endpoints; matching changes nothing, whatever the method
+	mux.HandleFunc("/api/match", s.authorize(matcher, matcher, s.limit(match, match, s.handleMatch)))
+	mux.HandleFunc("/api/match/hashes", s.authorize(matcher, matcher, s.limit(match, match, s.handleMatchHashesRoute)))
+	mux.HandleFunc("/api/profile", s.authorize(matcher, matcher, s.handleProfile))
 
-	// Wrap with CORS middleware
-	return corsMiddleware(s.config.AllowedOrigins)(mux)
+	// API key management
+	mux.HandleFunc("/api/keys", s.authorize(admin, admin, s.limit(adm, adm, s.handleKeys)))
+	mux.HandleFunc("/api/keys/", s.authorize(admin, admin, s.limit(adm, adm, s.handleKey)))
+
+	// Wrap with CORS middleware, and count everything
+	return s.metrics.instrument(corsMiddleware(s.config.AllowedOrigins)(mux))
 }
 
 func corsMiddleware(allowedOrigins []string) func(http.Handler) http.Handler {
@@ -37,14 +63,19 @@ func corsMiddleware(allowedOrigins []string) func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			origin := r.Header.Get("Origin")
 
+			// Credentials are only allowed for listed origins; browsers
+			// refuse them alongside a wildcard, which would otherwise let any
+			// page act with a visitor's cookies
 			allowed := false
 			if len(allowedOrigins) == 0 || (len(allowedOrigins) == 1 && allowedOrigins[0] == "*") {
 				w.Header().Set("Access-Control-Allow-Origin", "*")
 				allowed = true
 			} else {
+				w.Header().Add("Vary", "Origin")
 				for _, allowedOrigin := range allowedOrigins {
 					if allowedOrigin == origin {
 						w.Header().Set("Access-Control-Allow-Origin", origin)
+						w.Header().Set("Access-Control-Allow-Credentials", "true")
 						allowed = true
 						break
 					}
@@ -52,10 +83,10 @@ func corsMiddleware(allowedOrigins []string) func(http.Handler) http.Handler {
 			}
 
 			if allowed {
-				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Requested-With")
+				w.Header().Set("Access-Control-Expose-Headers", "Location, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset")
 				w.Header().Set("Access-Control-Max-Age", "3600")
-				w.Header().Set("Access-Control-Allow-Credentials", "true")
 			}
 
 			if r.Method == "OPTIONS" {
@@ -68,13 +99,13 @@ func corsMiddleware(allowedOrigins []string) func(http.Handler) http.Handler {
 	}
 }
 
-func loggingMiddleware(next http.Handler) http.Handler {
+func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Create a response writer wrapper to capture status code
 		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 
 		logger := logger.GetLogger()
-		logger.Infof("%s %s from %s", r.Method, r.URL.Path, getClientIP(r))
+		logger.Infof("%s %s from %s", r.Method, r.URL.Path, s.clientIP(r))
 
 		next.ServeHTTP(wrapped, r)
 
@@ -92,49 +123,87 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-func getClientIP(r *http.Request) string {
-	xff := r.Header.Get("X-Forwarded-For")
-	if xff != "" {
-		// X-Forwarded-For can contain multiple IPs, take the first one
-		ips := strings.Split(xff, ",")
-		if len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
-		}
-	}
-
-	xri := r.Header.Get("X-Real-IP")
-	if xri != "" {
-		return xri
-	}
-
-	ip := r.RemoteAddr
-	if idx := strings.LastIndex(ip, ":"); idx != -1 {
-		ip = ip[:idx]
-	}
-	return ip
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// flush it
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
 }
 
+// Start serves until Shutdown is called, which makes it return nil
 func (s *Server) Start() error {
-	handler := s.setupRoutes()
-
 	// Optionally wrap with logging middleware
-	// handler = loggingMiddleware(handler)
+	// s.http.Handler = s.loggingMiddleware(s.http.Handler)
 
-	addr := fmt.Sprintf(":%d", s.config.Port)
-	s.log.Infof("🚀 AcousticDNA server starting on %s", addr)
+	tls := s.config.TLSCertFile != "" && s.config.TLSKeyFile != ""
+	s.log.Infof("🚀 AcousticDNA server starting on %s", s.http.Addr)
 	s.log.Infof("   Database: %s", s.config.DBPath)
-	s.log.Infof("   Sample Rate: %d Hz", s.config.SampleRate)
+	s.log.Infof("   Profile: %s (%d Hz)", s.service.Profile().ID(), s.service.Profile().SampleRate)
 	s.log.Infof("   CORS Origins: %v", s.config.AllowedOrigins)
+	s.log.Infof("   Anonymous role: %s", cmp.Or(string(s.config.AnonymousRole), "none"))
+	if s.jwt != nil {
+		s.log.Infof("   JWT: accepted")
+	}
+	if tls {
+		s.log.Infof("   TLS: %s", s.config.TLSCertFile)
+	}
 	s.log.Infof("\nEndpoints:")
-	s.log.Infof("   GET    /health                  - Health check")
+	s.log.Infof("   GET    /health                  - Liveness and readiness")
+	s.log.Infof("   GET    /health/live             - Liveness probe")
+	s.log.Infof("   GET    /health/ready            - Readiness probe (503 when not ready)")
 	s.log.Infof("   GET    /api/health/metrics      - Server metrics")
+	s.log.Infof("   GET    /metrics                 - Prometheus metrics (metrics)")
+	s.log.Infof("   GET    /api/openapi.json        - OpenAPI document")
 	s.log.Infof("   GET    /api/songs               - List all songs")
-	s.log.Infof("   POST   /api/songs               - Add song from file")
-	s.log.Infof("   POST   /api/songs/youtube       - Add song from YouTube URL")
+	s.log.Infof("   POST   /api/songs               - Queue song from file (202 + job)")
+	s.log.Infof("   POST   /api/songs/youtube       - Queue song from YouTube URL (202 + job)")
 	s.log.Infof("   GET    /api/songs/{id}          - Get song by ID")
+	s.log.Infof("   PATCH  /api/songs/{id}          - Edit song metadata")
 	s.log.Infof("   DELETE /api/songs/{id}          - Delete song by ID")
+	s.log.Infof("   GET    /api/jobs                - List jobs (?status=queued|running|...)")
+	s.log.Infof("   GET    /api/jobs/{id}           - Job status, stage and song ID")
+	s.log.Infof("   DELETE /api/jobs/{id}           - Cancel a job")
 	s.log.Infof("   POST   /api/match               - Match audio file")
 	s.log.Infof("   POST   /api/match/hashes        - Match pre-computed hashes (WASM)")
+	s.log.Infof("   GET    /api/profile             - Fingerprint profile for clients")
+	s.log.Infof("   GET    /api/keys                - List API keys (admin)")
+	s.log.Infof("   POST   /api/keys                - Create an API key (admin)")
+	s.log.Infof("   DELETE /api/keys/{id}           - Revoke an API key (admin)")
+
+	var err error
+	if tls {
+		err = s.http.ListenAndServeTLS(s.config.TLSCertFile, s.config.TLSKeyFile)
+	} else {
+		err = s.http.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
 
-	return http.ListenAndServe(addr, handler)
+// Shutdown stops the server gracefully. It stops starting queued jobs and
+// reports not ready for the configured delay, then stops listening and
+// waits for requests in flight and running jobs to finish, both at once. If
+// ctx ends first, connections still open are closed and interrupted jobs are
+// left queued for the next start.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.draining.Store(true)
+	s.jobs.StopStarting()
+	if d := s.config.ShutdownDelay; d > 0 {
+		s.log.Infof("Shutting down: not ready, serving for another %s", d)
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+		}
+	}
+
+	s.log.Infof("Shutting down: waiting for requests and jobs")
+	drained := make(chan error, 1)
+	go func() { drained <- s.jobs.Drain(ctx) }()
+
+	err := s.http.Shutdown(ctx)
+	if err != nil {
+		s.http.Close()
+	}
+	return errors.Join(err, <-drained)
 }
@@ -0,0 +1,116 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna"
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// testServer is a server on a memory catalogue, with a running job queue
+type testServer struct {
+	*httptest.Server
+	srv  *Server
+	stor acousticdna.Storage
+	keys acousticdna.KeyStore
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	stor := acousticdna.NewMemoryStorage()
+	metrics := newMetrics(nil)
+	svc, err := acousticdna.NewService(acousticdna.WithStorage(stor), acousticdna.WithObserver(metrics))
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	jobs := acousticdna.NewJobQueue(svc, stor.(acousticdna.JobStore),
+		acousticdna.WithJobDirs(t.TempDir(), t.TempDir()))
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := jobs.Start(ctx); err != nil {
+		t.Fatalf("starting jobs: %v", err)
+	}
+	keys := stor.(acousticdna.KeyStore)
+
+	srv, err := NewServer(svc, jobs, keys, metrics, &ServerConfig{
+		TempDir:         t.TempDir(),
+		SampleRate:      svc.Profile().SampleRate,
+		AllowedOrigins:  []string{"*"},
+		MatchRateLimit:  RateLimit{PerMinute: 6000, Burst: 1000},
+		IngestRateLimit: RateLimit{PerMinute: 6000, Burst: 1000},
+		AdminRateLimit:  RateLimit{PerMinute: 6000, Burst: 1000},
+	})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ts := httptest.NewServer(srv.http.Handler)
+	t.Cleanup(func() {
+		ts.Close()
+		cancel()
+		jobs.Close()
+		svc.Close()
+	})
+	return &testServer{Server: ts, srv: srv, stor: stor, keys: keys}
+}
+
+// key creates an API key with role
+func (ts *testServer) key(t *testing.T, role models.Role) string {
+	t.Helper()
+	secret, _, err := acousticdna.CreateAPIKey(ts.keys, string(role)+" test", role)
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	return secret
+}
+
+// get sends an authenticated GET and returns the response status
+func (ts *testServer) get(t *testing.T, path, key string) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestMetricsRole(t *testing.T) {
+	ts := newTestServer(t)
+	keys := map[models.Role]string{"": ""}
+	for _, role := range []models.Role{models.RoleMetrics, models.RoleMatcher, models.RoleAdmin} {
+		keys[role] = ts.key(t, role)
+	}
+
+	tests := []struct {
+		path string
+		role models.Role
+		want int
+	}{
+		{"/metrics", "", http.StatusUnauthorized},
+		{"/metrics", models.RoleMetrics, http.StatusOK},
+		{"/metrics", models.RoleAdmin, http.StatusOK},
+		{"/metrics", models.RoleMatcher, http.StatusForbidden},
+		{"/api/songs", models.RoleMetrics, http.StatusForbidden},
+		{"/api/profile", models.RoleMetrics, http.StatusForbidden},
+		{"/api/health/metrics", models.RoleMetrics, http.StatusForbidden},
+		{"/api/keys", models.RoleMetrics, http.StatusForbidden},
+		{"/api/songs", models.RoleMatcher, http.StatusOK},
+	}
+	for _, tc := range tests {
+		if got := ts.get(t, tc.path, keys[tc.role]); got != tc.want {
+			t.Errorf("GET %s with a %q key: %d, want %d", tc.path, tc.role, got, tc.want)
+		}
+	}
+}
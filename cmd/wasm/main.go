@@ -4,10 +4,13 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"syscall/js"
 
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/audio"
 	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/fingerprint"
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/matcher"
 )
 
 // Error codes returned to JavaScript
@@ -20,13 +23,23 @@ const (
 	ErrorHashGeneration
 )
 
-// Processes audio samples and returns fingerprint hashes.
-// Returns: {error: number, data: array | string}
+// Processes audio samples and returns fingerprint hashes. The optional fourth
+// argument selects the fingerprint profile, either by name or as the JSON
+// served by /api/profile; it must match the server's catalogue.
+// Returns: {error: number, data: array | string, profile: object}
 func generateFingerprint(this js.Value, args []js.Value) interface{} {
 	if len(args) < 3 {
 		return makeErrorResponse(ErrorInvalidArgs, "Expected 3 arguments: audioArray, sampleRate, channels")
 	}
 
+	profile := fingerprint.DefaultProfile()
+	if len(args) > 3 && args[3].Type() != js.TypeUndefined && args[3].Type() != js.TypeNull {
+		var err error
+		if profile, err = parseProfile(args[3]); err != nil {
+			return makeErrorResponse(ErrorInvalidArgs, err.Error())
+		}
+	}
+
 	audioDataJS := args[0]
 	sampleRateJS := args[1]
 	channelsJS := args[2]
@@ -69,41 +82,70 @@ func generateFingerprint(this js.Value, args []js.Value) interface{} {
 		samples = stereoToMono(samples)
 	}
 
-	duration := float64(len(samples)) / float64(sampleRate)
+	// Fingerprints are only comparable at the profile's sample rate
+	samples, err := audio.ResampleSamples(samples, sampleRate, profile.SampleRate)
+	if err != nil {
+		return makeErrorResponse(ErrorProcessing, fmt.Sprintf("Failed to resample audio: %v", err))
+	}
 
-	spec, err := fingerprint.ComputeSpectrogramFromSamples(samples, sampleRate, 0, 0)
+	spec, err := profile.Spectrogram(samples)
 	if err != nil {
 		return makeErrorResponse(ErrorSpectrogramFailed, fmt.Sprintf("Failed to generate spectrogram: %v", err))
 	}
 
-	peaks := fingerprint.ExtractPeaks(spec, duration, sampleRate)
+	peaks := profile.ExtractQueryPeaks(spec)
 	if len(peaks) == 0 {
 		return makeErrorResponse(ErrorPeakExtraction, "No peaks found in audio (audio may be silent or too short)")
 	}
 
-	fingerprintMap := fingerprint.Fingerprint(peaks, "")
-	if len(fingerprintMap) == 0 {
+	// The query keeps every (hash, anchor time) pair in time order, exactly
+	// as the server-side matcher consumes it
+	query := matcher.FromCouples(profile.Fingerprint(peaks, ""))
+	if len(query) == 0 {
 		return makeErrorResponse(ErrorHashGeneration, "No fingerprint hashes generated")
 	}
 
-	hashArray := js.Global().Get("Array").New()
-	idx := 0
-	for hash, couples := range fingerprintMap {
-		for _, couple := range couples {
-			hashObj := js.Global().Get("Object").New()
-			hashObj.Set("hash", hash)
-			hashObj.Set("anchorTime", couple.AnchorTimeMs)
-			hashArray.SetIndex(idx, hashObj)
-			idx++
-		}
+	hashArray := js.Global().Get("Array").New(len(query))
+	for i, pair := range query {
+		hashObj := js.Global().Get("Object").New()
+		hashObj.Set("hash", pair.Hash)
+		hashObj.Set("anchorTime", pair.AnchorTimeMs)
+		hashArray.SetIndex(i, hashObj)
 	}
 
 	result := js.Global().Get("Object").New()
 	result.Set("error", ErrorNone)
 	result.Set("data", hashArray)
+	profileJSON, _ := json.Marshal(profile)
+	result.Set("profile", js.Global().Get("JSON").Call("parse", string(profileJSON)))
 	return result
 }
 
+// parseProfile accepts a built-in profile name, a JSON string or a plain object
+func parseProfile(v js.Value) (fingerprint.Profile, error) {
+	var raw string
+	switch v.Type() {
+	case js.TypeString:
+		raw = v.String()
+		if p, ok := fingerprint.Profiles()[raw]; ok {
+			return p, nil
+		}
+	case js.TypeObject:
+		raw = js.Global().Get("JSON").Call("stringify", v).String()
+	default:
+		return fingerprint.Profile{}, fmt.Errorf("profile must be a name or an object")
+	}
+
+	var p fingerprint.Profile
+	if err := json.Unmarshal([]byte(raw), &p); err != nil {
+		return p, fmt.Errorf("unknown fingerprint profile %q", raw)
+	}
+	if err := p.Validate(); err != nil {
+		return p, fmt.Errorf("invalid fingerprint profile: %v", err)
+	}
+	return p, nil
+}
+
 func stereoToMono(stereo []float64) []float64 {
 	if len(stereo)%2 != 0 {
 		stereo = stereo[:len(stereo)-1]
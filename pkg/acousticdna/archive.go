@@ -0,0 +1,480 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+package acousticdna
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/index"
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/storage"
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// A catalogue archive is a gzip stream holding, in order:
+//
+//	header       one JSON line: format name, version, song count and the
+//	             catalogue's fingerprint profile
+//	songs        one JSON line per song, numbered 0..n-1 by "ref"
+//	fingerprints 12-byte records up to the end of the stream: little-endian
+//	             uint32 hash, song ref and anchor time (ms)
+//
+// It doesn't depend on a storage backend, so it moves catalogues between
+// SQLite, PostgreSQL and memory stores and across releases.
+const (
+	archiveFormat  = "acousticdna-archive"
+	archiveVersion = 1
+
+	archiveRecordSize = 12
+
+	// importBatchSize caps the couples held before a StoreFingerprints call
+	importBatchSize = 200_000
+)
+
+// ErrBadArchive is returned when a stream isn't a catalogue archive this
+// release can read
+var ErrBadArchive = errors.New("invalid catalogue archive")
+
+// ConflictPolicy decides what an import does with an archived song whose
+// title and artist are already in the catalogue
+type ConflictPolicy string
+
+const (
+	ConflictSkip      ConflictPolicy = "skip"      // keep the catalogued song
+	ConflictOverwrite ConflictPolicy = "overwrite" // replace it with the archived one
+	ConflictKeepBoth  ConflictPolicy = "keep-both" // add the archived one as "Title (2)"
+)
+
+// ArchiveConfig configures ExportArchive and ImportArchive
+type ArchiveConfig struct {
+	// SongIDs limits the songs exported, or imported from the archive, to
+	// these IDs. Empty means all.
+	SongIDs []string
+
+	// OnConflict applies to imports
+	OnConflict ConflictPolicy
+}
+
+type ArchiveOption func(*ArchiveConfig)
+
+func defaultArchiveConfig() ArchiveConfig {
+	return ArchiveConfig{OnConflict: ConflictSkip}
+}
+
+// WithArchiveSongs limits an export or import to the songs with these IDs.
+// An import matches the IDs songs had in the exporting catalogue.
+func WithArchiveSongs(ids ...string) ArchiveOption {
+	return func(c *ArchiveConfig) {
+		c.SongIDs = append(c.SongIDs, ids...)
+	}
+}
+
+// WithConflictPolicy sets how an import treats songs that already exist
+func WithConflictPolicy(p ConflictPolicy) ArchiveOption {
+	return func(c *ArchiveConfig) {
+		c.OnConflict = p
+	}
+}
+
+// ArchiveStats summarises an export or import
+type ArchiveStats struct {
+	Songs        int // Songs written, or added to the catalogue
+	Fingerprints int
+	Skipped      int // Songs left out because of a conflict
+	Overwritten  int // Catalogued songs replaced by archived ones
+	Renamed      int // Archived songs added under a new title to keep both
+}
+
+type archiveHeader struct {
+	Format    string              `json:"format"`
+	Version   int                 `json:"version"`
+	CreatedAt time.Time           `json:"created_at"`
+	Songs     int                 `json:"songs"`
+	Profile   *FingerprintProfile `json:"profile,omitempty"`
+}
+
+type archiveSong struct {
+	Ref         uint32            `json:"ref"`
+	ID          string            `json:"id"`
+	Title       string            `json:"title"`
+	Artist      string            `json:"artist"`
+	YouTubeID   string            `json:"youtube_id,omitempty"`
+	DurationMs  int               `json:"duration_ms"`
+	CreatedAt   time.Time         `json:"created_at,omitzero"`
+	SpotifyID   string            `json:"spotify_id,omitempty"`
+	Album       string            `json:"album,omitempty"`
+	ISRC        string            `json:"isrc,omitempty"`
+	Year        int               `json:"year,omitempty"`
+	Genre       string            `json:"genre,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	ExternalIDs map[string]string `json:"external_ids,omitempty"`
+}
+
+func newArchiveSong(ref uint32, s models.Song) archiveSong {
+	return archiveSong{
+		Ref: ref, ID: s.ID, Title: s.Title, Artist: s.Artist, YouTubeID: s.YouTubeID,
+		DurationMs: s.DurationMs, CreatedAt: s.CreatedAt, SpotifyID: s.SpotifyID,
+		Album: s.Album, ISRC: s.ISRC, Year: s.Year, Genre: s.Genre,
+		Tags: s.Tags, ExternalIDs: s.ExternalIDs,
+	}
+}
+
+func (a archiveSong) model() models.Song {
+	return models.Song{
+		ID: a.ID, Title: a.Title, Artist: a.Artist, YouTubeID: a.YouTubeID,
+		DurationMs: a.DurationMs, CreatedAt: a.CreatedAt, SpotifyID: a.SpotifyID,
+		Album: a.Album, ISRC: a.ISRC, Year: a.Year, Genre: a.Genre,
+		Tags: a.Tags, ExternalIDs: a.ExternalIDs,
+	}
+}
+
+// idFilter reports whether a song ID was selected; every ID is when ids
+// is empty
+func idFilter(ids []string) func(string) bool {
+	if len(ids) == 0 {
+		return func(string) bool { return true }
+	}
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return func(id string) bool { return set[id] }
+}
+
+// ExportArchive writes the songs and fingerprints of src, with its
+// fingerprint profile, to w as a compressed archive. src must be able to
+// enumerate its fingerprints, which all built-in backends can.
+func ExportArchive(ctx context.Context, src Storage, w io.Writer, opts ...ArchiveOption) (ArchiveStats, error) {
+	cfg := defaultArchiveConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	var stats ArchiveStats
+
+	source, ok := src.(index.Source)
+	if !ok {
+		return stats, fmt.Errorf("storage %T can't enumerate its fingerprints", src)
+	}
+
+	all, err := src.ListSongs()
+	if err != nil {
+		return stats, fmt.Errorf("listing songs: %w", err)
+	}
+	selected := idFilter(cfg.SongIDs)
+	refs := make(map[string]uint32)
+	var songs []archiveSong
+	for _, song := range all {
+		if selected(song.ID) {
+			refs[song.ID] = uint32(len(songs))
+			songs = append(songs, newArchiveSong(uint32(len(songs)), song))
+		}
+	}
+	if len(songs) < len(cfg.SongIDs) {
+		for _, id := range cfg.SongIDs {
+			if _, ok := refs[id]; !ok {
+				return stats, fmt.Errorf("%w: %s", ErrSongNotFound, id)
+			}
+		}
+	}
+
+	header := archiveHeader{Format: archiveFormat, Version: archiveVersion, CreatedAt: time.Now().UTC(), Songs: len(songs)}
+	if profile, ok, err := StoredProfile(src); err != nil {
+		return stats, err
+	} else if ok {
+		header.Profile = &profile
+	}
+
+	zw := gzip.NewWriter(w)
+	bw := bufio.NewWriter(zw)
+	enc := json.NewEncoder(bw)
+	if err := enc.Encode(header); err != nil {
+		return stats, fmt.Errorf("writing archive: %w", err)
+	}
+	for _, song := range songs {
+		if err := enc.Encode(song); err != nil {
+			return stats, fmt.Errorf("writing archive: %w", err)
+		}
+	}
+	stats.Songs = len(songs)
+
+	var rec [archiveRecordSize]byte
+	err = source.ForEachFingerprint(func(hash uint32, c models.Couple) error {
+		ref, ok := refs[c.SongID]
+		if !ok {
+			return nil
+		}
+		if stats.Fingerprints%importBatchSize == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		binary.LittleEndian.PutUint32(rec[0:], hash)
+		binary.LittleEndian.PutUint32(rec[4:], ref)
+		binary.LittleEndian.PutUint32(rec[8:], c.AnchorTimeMs)
+		stats.Fingerprints++
+		_, err := bw.Write(rec[:])
+		return err
+	})
+	if err != nil {
+		return stats, fmt.Errorf("writing fingerprints: %w", err)
+	}
+
+	if err := bw.Flush(); err != nil {
+		return stats, fmt.Errorf("writing archive: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return stats, fmt.Errorf("writing archive: %w", err)
+	}
+	return stats, nil
+}
+
+// ImportArchive adds the songs and fingerprints of an archive made by
+// ExportArchive to dst. Songs get new IDs; one whose title and artist are
+// already catalogued is handled by the conflict policy. An empty catalogue
+// takes on the archive's fingerprint profile, any other must already use a
+// compatible one. If the import fails, the songs it added are removed
+// again and nothing is overwritten.
+func ImportArchive(ctx context.Context, dst Storage, r io.Reader, opts ...ArchiveOption) (ArchiveStats, error) {
+	cfg := defaultArchiveConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	switch cfg.OnConflict {
+	case ConflictSkip, ConflictOverwrite, ConflictKeepBoth:
+	default:
+		return ArchiveStats{}, fmt.Errorf("unknown conflict policy %q", cfg.OnConflict)
+	}
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return ArchiveStats{}, fmt.Errorf("%w: %v", ErrBadArchive, err)
+	}
+	defer zr.Close()
+	br := bufio.NewReader(zr)
+
+	var header archiveHeader
+	if err := readArchiveLine(br, &header); err != nil {
+		return ArchiveStats{}, err
+	}
+	if header.Format != archiveFormat {
+		return ArchiveStats{}, fmt.Errorf("%w: not a catalogue archive", ErrBadArchive)
+	}
+	if header.Version < 1 || header.Version > archiveVersion {
+		return ArchiveStats{}, fmt.Errorf("%w: unsupported version %d", ErrBadArchive, header.Version)
+	}
+
+	existing, err := dst.ListSongs()
+	if err != nil {
+		return ArchiveStats{}, fmt.Errorf("listing songs: %w", err)
+	}
+	if err := adoptArchiveProfile(dst, header.Profile, len(existing) > 0); err != nil {
+		return ArchiveStats{}, err
+	}
+
+	imp := &archiveImport{
+		dst:    dst,
+		policy: cfg.OnConflict,
+		byName: make(map[string]string, len(existing)),
+		ids:    make(map[uint32]string),
+	}
+	for _, song := range existing {
+		imp.byName[storage.SongKey(song.Title, song.Artist)] = song.ID
+	}
+
+	stats, err := imp.run(ctx, br, header.Songs, idFilter(cfg.SongIDs))
+	if err != nil {
+		imp.rollback()
+		return ArchiveStats{}, err
+	}
+
+	// Everything is in; swap overwritten songs for their replacements
+	for _, r := range imp.replaced {
+		if err := dst.DeleteSongByID(r.oldID); err != nil {
+			return stats, fmt.Errorf("removing overwritten song %s: %w", r.oldID, err)
+		}
+		if err := dst.UpdateSong(&r.song); err != nil {
+			return stats, fmt.Errorf("renaming song %s: %w", r.song.ID, err)
+		}
+	}
+	return stats, nil
+}
+
+// adoptArchiveProfile checks that an archive's fingerprints can join the
+// catalogue, stamping an empty catalogue with the archive's profile
+func adoptArchiveProfile(dst Storage, archived *FingerprintProfile, hasSongs bool) error {
+	if archived == nil {
+		return nil
+	}
+	stored, ok, err := StoredProfile(dst)
+	if err != nil {
+		return err
+	}
+	if ok && hasSongs {
+		if err := archived.CompatibleWith(stored); err != nil {
+			return fmt.Errorf("catalogue uses %s: %w", stored.ID(), err)
+		}
+		return nil
+	}
+	if err := SaveProfile(dst, *archived); err != nil {
+		return fmt.Errorf("recording fingerprint profile: %w", err)
+	}
+	return nil
+}
+
+func readArchiveLine(br *bufio.Reader, v any) error {
+	line, err := br.ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadArchive, err)
+	}
+	if err := json.Unmarshal(line, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadArchive, err)
+	}
+	return nil
+}
+
+// archiveImport tracks an import so it can be finished or undone
+type archiveImport struct {
+	dst    Storage
+	policy ConflictPolicy
+	byName map[string]string // title+artist -> catalogued song ID
+	ids    map[uint32]string // archive ref -> new song ID
+
+	added []string // songs registered by this import
+
+	// replaced pairs a catalogued song with the archived song that
+	// overwrites it; the old song is only deleted once the import succeeded
+	replaced []replacement
+}
+
+type replacement struct {
+	oldID string
+	song  models.Song // archived song, registered under a placeholder title
+}
+
+// run adds the selected songs and their fingerprints
+func (imp *archiveImport) run(ctx context.Context, br *bufio.Reader, songCount int, selected func(string) bool) (ArchiveStats, error) {
+	var stats ArchiveStats
+	for i := 0; i < songCount; i++ {
+		var a archiveSong
+		if err := readArchiveLine(br, &a); err != nil {
+			return stats, err
+		}
+		if !selected(a.ID) {
+			continue
+		}
+		if err := imp.addSong(a, &stats); err != nil {
+			return stats, err
+		}
+	}
+
+	batch := make(map[uint32][]models.Couple)
+	pending := 0
+	flush := func() error {
+		if pending == 0 {
+			return nil
+		}
+		if err := imp.dst.StoreFingerprints(batch); err != nil {
+			return fmt.Errorf("storing fingerprints: %w", err)
+		}
+		batch, pending = make(map[uint32][]models.Couple), 0
+		return ctx.Err()
+	}
+
+	var rec [archiveRecordSize]byte
+	for {
+		if _, err := io.ReadFull(br, rec[:]); err == io.EOF {
+			break
+		} else if err != nil {
+			return stats, fmt.Errorf("%w: %v", ErrBadArchive, err)
+		}
+		hash := binary.LittleEndian.Uint32(rec[0:])
+		ref := binary.LittleEndian.Uint32(rec[4:])
+		if int(ref) >= songCount {
+			return stats, fmt.Errorf("%w: fingerprint refers to song %d of %d", ErrBadArchive, ref, songCount)
+		}
+		id, ok := imp.ids[ref]
+		if !ok {
+			continue
+		}
+		batch[hash] = append(batch[hash], models.Couple{SongID: id, AnchorTimeMs: binary.LittleEndian.Uint32(rec[8:])})
+		stats.Fingerprints++
+		if pending++; pending >= importBatchSize {
+			if err := flush(); err != nil {
+				return stats, err
+			}
+		}
+	}
+	return stats, flush()
+}
+
+// addSong registers an archived song as the conflict policy says
+func (imp *archiveImport) addSong(a archiveSong, stats *ArchiveStats) error {
+	song := a.model()
+	key := storage.SongKey(song.Title, song.Artist)
+	oldID, conflict := imp.byName[key]
+
+	var placeholder bool
+	if conflict {
+		switch imp.policy {
+		case ConflictSkip:
+			stats.Skipped++
+			return nil
+		case ConflictOverwrite:
+			placeholder = true
+			stats.Overwritten++
+		case ConflictKeepBoth:
+			title := song.Title
+			for n := 2; imp.byName[storage.SongKey(title, song.Artist)] != ""; n++ {
+				title = fmt.Sprintf("%s (%d)", song.Title, n)
+			}
+			song.Title = title
+			stats.Renamed++
+		}
+	}
+
+	// An overwriting song can't take its title until the old one is gone
+	title := song.Title
+	if placeholder {
+		title = fmt.Sprintf("%s (importing %s)", song.Title, song.ID)
+	}
+	id, created, err := imp.dst.RegisterSong(title, song.Artist, song.YouTubeID, song.DurationMs)
+	if err != nil {
+		return fmt.Errorf("registering %s - %s: %w", song.Artist, song.Title, err)
+	}
+	if !created {
+		// Added since the import started; it isn't ours to roll back
+		return fmt.Errorf("registering %s - %s: %w", song.Artist, song.Title, ErrSongExists)
+	}
+	imp.added = append(imp.added, id)
+	imp.ids[a.Ref] = id
+
+	song.ID = id
+	stored := song
+	stored.Title = title
+	if err := imp.dst.UpdateSong(&stored); err != nil {
+		return fmt.Errorf("storing metadata of %s - %s: %w", song.Artist, song.Title, err)
+	}
+
+	if placeholder {
+		imp.replaced = append(imp.replaced, replacement{oldID: oldID, song: song})
+	} else {
+		imp.byName[storage.SongKey(song.Title, song.Artist)] = id
+	}
+	stats.Songs++
+	return nil
+}
+
+// rollback removes the songs an unfinished import added
+func (imp *archiveImport) rollback() {
+	for _, id := range imp.added {
+		imp.dst.DeleteSongByID(id)
+	}
+}
@@ -0,0 +1,177 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrUnsupportedFormat is returned when no built-in decoder recognises the
+// input. Callers may fall back to ffmpeg for such files.
+var ErrUnsupportedFormat = errors.New("unsupported audio format")
+
+// Format identifies a container/codec handled by the built-in decoders
+type Format string
+
+const (
+	FormatUnknown Format = ""
+	FormatWAV     Format = "wav"
+	FormatFLAC    Format = "flac"
+	FormatMP3     Format = "mp3"
+	FormatOGG     Format = "ogg"
+)
+
+// Decoder streams interleaved samples normalized to [-1, 1].
+// Read returns io.EOF once the stream is exhausted.
+type Decoder interface {
+	SampleRate() int
+	Channels() int
+	Read(p []float64) (int, error)
+}
+
+// sniffLen is the number of bytes inspected by DetectFormat
+const sniffLen = 12
+
+// DetectFormat inspects the first bytes of a stream and reports its format
+func DetectFormat(header []byte) Format {
+	switch {
+	case len(header) >= 12 && string(header[0:4]) == "RIFF" && string(header[8:12]) == "WAVE":
+		return FormatWAV
+	case len(header) >= 4 && string(header[0:4]) == "fLaC":
+		return FormatFLAC
+	case len(header) >= 4 && string(header[0:4]) == "OggS":
+		return FormatOGG
+	case len(header) >= 3 && string(header[0:3]) == "ID3":
+		return FormatMP3
+	case len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0 && header[1]&0x06 != 0:
+		// MPEG audio frame sync with a layer set (rules out ADTS AAC, whose layer bits are 00)
+		return FormatMP3
+	default:
+		return FormatUnknown
+	}
+}
+
+// NewDecoder sniffs the stream format and returns a matching decoder.
+// It returns ErrUnsupportedFormat for anything the built-in decoders can't read.
+func NewDecoder(r io.Reader) (Decoder, Format, error) {
+	header, src, err := sniff(r)
+	if err != nil {
+		return nil, FormatUnknown, err
+	}
+
+	format := DetectFormat(header)
+
+	var dec Decoder
+	switch format {
+	case FormatWAV:
+		dec, err = newWavDecoder(src)
+	case FormatFLAC:
+		dec, err = newFLACDecoder(src)
+	case FormatMP3:
+		dec, err = newMP3Decoder(src)
+	case FormatOGG:
+		dec, err = newOggDecoder(src)
+	default:
+		return nil, FormatUnknown, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, format, fmt.Errorf("decoding %s: %w", format, err)
+	}
+	return dec, format, nil
+}
+
+// DecodeFile decodes a whole file into mono samples at its native sample rate
+func DecodeFile(path string) ([]float64, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	dec, _, err := NewDecoder(f)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	samples, err := readAllMono(dec)
+	if err != nil {
+		return nil, 0, err
+	}
+	return samples, dec.SampleRate(), nil
+}
+
+// readAllMono drains a decoder and downmixes it to mono
+func readAllMono(dec Decoder) ([]float64, error) {
+	mono := NewMonoReader(dec)
+	out := make([]float64, 0, 1<<16)
+	buf := make([]float64, 8192)
+	for {
+		n, err := mono.Read(buf)
+		out = append(out, buf[:n]...)
+		if errors.Is(err, io.EOF) {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// MonoReader downmixes an interleaved decoder stream by averaging channels
+type MonoReader struct {
+	dec      Decoder
+	channels int
+	buf      []float64
+}
+
+// NewMonoReader wraps dec so that Read returns one sample per frame
+func NewMonoReader(dec Decoder) *MonoReader {
+	return &MonoReader{dec: dec, channels: dec.Channels()}
+}
+
+func (m *MonoReader) SampleRate() int { return m.dec.SampleRate() }
+
+func (m *MonoReader) Channels() int { return 1 }
+
+func (m *MonoReader) Read(p []float64) (int, error) {
+	if m.channels <= 1 {
+		return m.dec.Read(p)
+	}
+
+	need := len(p) * m.channels
+	if cap(m.buf) < need {
+		m.buf = make([]float64, need)
+	}
+	buf := m.buf[:need]
+
+	// Accumulate whole frames; decoders may return partial frames at packet edges
+	filled := 0
+	var readErr error
+	for filled < m.channels || filled%m.channels != 0 {
+		n, err := m.dec.Read(buf[filled:])
+		filled += n
+		if err != nil {
+			readErr = err
+			break
+		}
+		if n == 0 {
+			break
+		}
+	}
+
+	frames := filled / m.channels
+	scale := 1.0 / float64(m.channels)
+	for i := 0; i < frames; i++ {
+		var sum float64
+		for c := 0; c < m.channels; c++ {
+			sum += buf[i*m.channels+c]
+		}
+		p[i] = sum * scale
+	}
+
+	if frames > 0 && errors.Is(readErr, io.EOF) {
+		return frames, nil
+	}
+	return frames, readErr
+}
@@ -0,0 +1,741 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// FLAC metadata block types
+const (
+	flacBlockStreamInfo    = 0
+	flacBlockVorbisComment = 4
+)
+
+// FLAC inter-channel decorrelation modes (channel assignment 8-10)
+const (
+	flacLeftSide  = 8
+	flacSideRight = 9
+	flacMidSide   = 10
+)
+
+var (
+	errFLACSync      = errors.New("flac: lost frame sync")
+	errFLACHeaderCRC = errors.New("flac: frame header CRC-8 mismatch")
+	errFLACFrameCRC  = errors.New("flac: frame CRC-16 mismatch")
+	errFLACMD5       = errors.New("flac: decoded audio does not match the STREAMINFO MD5 signature")
+)
+
+// flacStreamInfo holds the fields of the mandatory STREAMINFO block
+type flacStreamInfo struct {
+	sampleRate    int
+	channels      int
+	bitsPerSample int
+	totalSamples  int64
+	md5           [16]byte
+}
+
+// flacDecoder is a minimal pure-Go FLAC decoder. It supports every subframe
+// type (constant, verbatim, fixed and LPC) and all stereo decorrelation modes.
+// Every frame's header CRC-8 and CRC-16 are checked, and once the stream is
+// exhausted the decoded audio is checked against the STREAMINFO MD5.
+type flacDecoder struct {
+	br       *flacBitReader
+	info     flacStreamInfo
+	comments map[string]string
+	pending  []float64
+	samples  [][]int64
+	md5      hash.Hash // nil when STREAMINFO carries no signature
+	md5buf   []byte
+}
+
+func newFLACDecoder(r io.Reader) (*flacDecoder, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+
+	var magic [4]byte
+	if _, err := io.ReadFull(br, magic[:]); err != nil {
+		return nil, fmt.Errorf("reading flac signature: %w", err)
+	}
+	if string(magic[:]) != "fLaC" {
+		return nil, errors.New("not a FLAC stream")
+	}
+
+	d := &flacDecoder{comments: map[string]string{}}
+	infoFound := false
+
+	for last := false; !last; {
+		var header [4]byte
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			return nil, fmt.Errorf("reading metadata block header: %w", err)
+		}
+		last = header[0]&0x80 != 0
+		blockType := header[0] & 0x7F
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+
+		// Pictures, seek tables and the like can run to megabytes; skip them
+		if blockType != flacBlockStreamInfo && blockType != flacBlockVorbisComment {
+			if _, err := io.CopyN(io.Discard, br, int64(length)); err != nil {
+				return nil, fmt.Errorf("skipping metadata block: %w", err)
+			}
+			continue
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(br, body); err != nil {
+			return nil, fmt.Errorf("reading metadata block: %w", err)
+		}
+
+		switch blockType {
+		case flacBlockStreamInfo:
+			if length < 34 {
+				return nil, errors.New("flac: STREAMINFO too short")
+			}
+			packed := binary.BigEndian.Uint64(body[10:18])
+			d.info = flacStreamInfo{
+				sampleRate:    int(packed >> 44),
+				channels:      int((packed>>41)&0x7) + 1,
+				bitsPerSample: int((packed>>36)&0x1F) + 1,
+				totalSamples:  int64(packed & 0xFFFFFFFFF),
+			}
+			copy(d.info.md5[:], body[18:34])
+			infoFound = true
+		case flacBlockVorbisComment:
+			d.comments = parseFLACVorbisComment(body)
+		}
+	}
+
+	if !infoFound {
+		return nil, errors.New("flac: STREAMINFO block missing")
+	}
+	// Encoders that can't compute the signature (e.g. when streaming) leave it zero
+	if d.info.md5 != ([16]byte{}) {
+		d.md5 = md5.New()
+	}
+
+	d.br = &flacBitReader{r: br}
+	return d, nil
+}
+
+// parseFLACVorbisComment decodes a little-endian VORBIS_COMMENT block body
+func parseFLACVorbisComment(body []byte) map[string]string {
+	readString := func(pos int) (string, int, bool) {
+		if pos+4 > len(body) {
+			return "", pos, false
+		}
+		n := int(binary.LittleEndian.Uint32(body[pos:]))
+		pos += 4
+		if n < 0 || pos+n > len(body) {
+			return "", pos, false
+		}
+		return string(body[pos : pos+n]), pos + n, true
+	}
+
+	_, pos, ok := readString(0) // vendor
+	if !ok || pos+4 > len(body) {
+		return map[string]string{}
+	}
+	count := int(binary.LittleEndian.Uint32(body[pos:]))
+	pos += 4
+	// Each comment takes at least its 4-byte length, so a count beyond what
+	// the block can hold is a lie
+	if fit := (len(body) - pos) / 4; count > fit {
+		count = fit
+	}
+
+	comments := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		var c string
+		if c, pos, ok = readString(pos); !ok {
+			break
+		}
+		comments = append(comments, c)
+	}
+	return parseVorbisComments(comments)
+}
+
+func (d *flacDecoder) SampleRate() int { return d.info.sampleRate }
+
+func (d *flacDecoder) Channels() int { return d.info.channels }
+
+// frameCount returns the total number of frames declared in STREAMINFO (0 if unknown)
+func (d *flacDecoder) frameCount() int64 { return d.info.totalSamples }
+
+// bitDepth returns the source bits per sample
+func (d *flacDecoder) bitDepth() int { return d.info.bitsPerSample }
+
+// tags returns the Vorbis comments as a lower-cased key/value map
+func (d *flacDecoder) tags() map[string]string { return d.comments }
+
+func (d *flacDecoder) Read(p []float64) (int, error) {
+	for len(d.pending) == 0 {
+		if err := d.decodeFrame(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+// decodeFrame decodes the next frame into d.pending as interleaved floats
+func (d *flacDecoder) decodeFrame() error {
+	br := d.br
+
+	br.resetCRC()
+	sync, err := br.readBits(14)
+	if err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return d.checkMD5()
+		}
+		return err
+	}
+	if sync != 0x3FFE {
+		return errFLACSync
+	}
+
+	// reserved(1) strategy(1) | block size(4) rate(4) | channels(4) sample size(3) reserved(1)
+	fields, err := br.readBits(18)
+	if err != nil {
+		return err
+	}
+	blockSizeCode := (fields >> 12) & 0xF
+	sampleRateCode := (fields >> 8) & 0xF
+	channelAssignment := (fields >> 4) & 0xF
+	sampleSizeCode := (fields >> 1) & 0x7
+
+	if err := br.skipUTF8Number(); err != nil {
+		return err
+	}
+
+	blockSize := 0
+	switch {
+	case blockSizeCode == 1:
+		blockSize = 192
+	case blockSizeCode >= 2 && blockSizeCode <= 5:
+		blockSize = 576 << (blockSizeCode - 2)
+	case blockSizeCode == 6:
+		v, err := br.readBits(8)
+		if err != nil {
+			return err
+		}
+		blockSize = int(v) + 1
+	case blockSizeCode == 7:
+		v, err := br.readBits(16)
+		if err != nil {
+			return err
+		}
+		blockSize = int(v) + 1
+	case blockSizeCode >= 8:
+		blockSize = 256 << (blockSizeCode - 8)
+	default:
+		return errors.New("flac: reserved block size")
+	}
+
+	// Only the extra header bytes matter; the stream rate comes from STREAMINFO
+	switch sampleRateCode {
+	case 12:
+		_, err = br.readBits(8)
+	case 13, 14:
+		_, err = br.readBits(16)
+	case 15:
+		err = errors.New("flac: invalid sample rate code")
+	}
+	if err != nil {
+		return err
+	}
+
+	bps := d.info.bitsPerSample
+	switch sampleSizeCode {
+	case 1:
+		bps = 8
+	case 2:
+		bps = 12
+	case 4:
+		bps = 16
+	case 5:
+		bps = 20
+	case 6:
+		bps = 24
+	case 7:
+		bps = 32
+	}
+
+	// The header is whole bytes, so everything read so far is covered
+	headerCRC := br.crc8
+	if crc, err := br.readBits(8); err != nil {
+		return err
+	} else if uint8(crc) != headerCRC {
+		return errFLACHeaderCRC
+	}
+
+	channels := int(channelAssignment) + 1
+	if channelAssignment >= flacLeftSide && channelAssignment <= flacMidSide {
+		channels = 2
+	} else if channelAssignment > flacMidSide {
+		return errors.New("flac: reserved channel assignment")
+	}
+	if channels != d.info.channels {
+		return fmt.Errorf("flac: frame has %d channels, STREAMINFO %d", channels, d.info.channels)
+	}
+
+	if len(d.samples) < channels {
+		d.samples = make([][]int64, channels)
+	}
+	for ch := 0; ch < channels; ch++ {
+		subBps := bps
+		if (channelAssignment == flacLeftSide || channelAssignment == flacMidSide) && ch == 1 {
+			subBps++
+		}
+		if channelAssignment == flacSideRight && ch == 0 {
+			subBps++
+		}
+		if cap(d.samples[ch]) < blockSize {
+			d.samples[ch] = make([]int64, blockSize)
+		}
+		d.samples[ch] = d.samples[ch][:blockSize]
+		if err := d.decodeSubframe(d.samples[ch], subBps); err != nil {
+			return err
+		}
+	}
+
+	br.alignToByte()
+	frameCRC := br.crc16
+	if crc, err := br.readBits(16); err != nil {
+		return err
+	} else if uint16(crc) != frameCRC {
+		return errFLACFrameCRC
+	}
+
+	d.decorrelate(int(channelAssignment), blockSize)
+	d.hashFrame(channels, blockSize)
+
+	scale := 1.0 / float64(int64(1)<<(bps-1))
+	d.pending = d.pending[:0]
+	for i := 0; i < blockSize; i++ {
+		for ch := 0; ch < channels; ch++ {
+			d.pending = append(d.pending, float64(d.samples[ch][i])*scale)
+		}
+	}
+	return nil
+}
+
+// hashFrame feeds the decoded samples to the MD5 signature check: interleaved,
+// little-endian, in as few whole bytes as the stream's bit depth needs
+func (d *flacDecoder) hashFrame(channels, n int) {
+	if d.md5 == nil {
+		return
+	}
+	width := (d.info.bitsPerSample + 7) / 8
+	buf := d.md5buf[:0]
+	for i := 0; i < n; i++ {
+		for ch := 0; ch < channels; ch++ {
+			v := d.samples[ch][i]
+			for b := 0; b < width; b++ {
+				buf = append(buf, byte(v>>(8*b)))
+			}
+		}
+	}
+	d.md5.Write(buf)
+	d.md5buf = buf
+}
+
+// checkMD5 is called at the end of the stream. It returns io.EOF if the
+// decoded audio matches the STREAMINFO signature, or there is none.
+func (d *flacDecoder) checkMD5() error {
+	if d.md5 == nil {
+		return io.EOF
+	}
+	sum := d.md5.Sum(nil)
+	d.md5 = nil
+	if !bytes.Equal(sum, d.info.md5[:]) {
+		return errFLACMD5
+	}
+	return io.EOF
+}
+
+// decorrelate undoes the stereo channel coding in place
+func (d *flacDecoder) decorrelate(assignment, n int) {
+	switch assignment {
+	case flacLeftSide:
+		left, side := d.samples[0], d.samples[1]
+		for i := 0; i < n; i++ {
+			side[i] = left[i] - side[i]
+		}
+	case flacSideRight:
+		side, right := d.samples[0], d.samples[1]
+		for i := 0; i < n; i++ {
+			side[i] = side[i] + right[i]
+		}
+	case flacMidSide:
+		mid, side := d.samples[0], d.samples[1]
+		for i := 0; i < n; i++ {
+			m := mid[i]<<1 | side[i]&1
+			mid[i] = (m + side[i]) >> 1
+			side[i] = (m - side[i]) >> 1
+		}
+	}
+}
+
+// decodeSubframe decodes one channel of a frame into out
+func (d *flacDecoder) decodeSubframe(out []int64, bps int) error {
+	br := d.br
+
+	header, err := br.readBits(8)
+	if err != nil {
+		return err
+	}
+	if header&0x80 != 0 {
+		return errors.New("flac: invalid subframe padding")
+	}
+	kind := int(header>>1) & 0x3F
+
+	wasted := 0
+	if header&1 != 0 {
+		k, err := br.readUnary()
+		if err != nil {
+			return err
+		}
+		wasted = int(k) + 1
+		bps -= wasted
+		if bps <= 0 {
+			return errors.New("flac: more wasted bits than the sample size")
+		}
+	}
+
+	switch {
+	case kind == 0: // constant
+		v, err := br.readSigned(bps)
+		if err != nil {
+			return err
+		}
+		for i := range out {
+			out[i] = v
+		}
+	case kind == 1: // verbatim
+		for i := range out {
+			if out[i], err = br.readSigned(bps); err != nil {
+				return err
+			}
+		}
+	case kind >= 8 && kind <= 12: // fixed
+		if err := d.decodeFixed(out, bps, kind-8); err != nil {
+			return err
+		}
+	case kind >= 32: // LPC
+		if err := d.decodeLPC(out, bps, kind-31); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("flac: reserved subframe type %d", kind)
+	}
+
+	if wasted > 0 {
+		for i := range out {
+			out[i] <<= uint(wasted)
+		}
+	}
+	return nil
+}
+
+// decodeFixed decodes a subframe using one of the fixed polynomial predictors
+func (d *flacDecoder) decodeFixed(out []int64, bps, order int) error {
+	if order > len(out) {
+		return errors.New("flac: predictor order exceeds block size")
+	}
+	for i := 0; i < order; i++ {
+		v, err := d.br.readSigned(bps)
+		if err != nil {
+			return err
+		}
+		out[i] = v
+	}
+	if err := d.decodeResidual(out, order); err != nil {
+		return err
+	}
+
+	for i := order; i < len(out); i++ {
+		var pred int64
+		switch order {
+		case 1:
+			pred = out[i-1]
+		case 2:
+			pred = 2*out[i-1] - out[i-2]
+		case 3:
+			pred = 3*out[i-1] - 3*out[i-2] + out[i-3]
+		case 4:
+			pred = 4*out[i-1] - 6*out[i-2] + 4*out[i-3] - out[i-4]
+		}
+		out[i] += pred
+	}
+	return nil
+}
+
+// decodeLPC decodes a subframe using transmitted linear prediction coefficients
+func (d *flacDecoder) decodeLPC(out []int64, bps, order int) error {
+	br := d.br
+	if order > len(out) {
+		return errors.New("flac: predictor order exceeds block size")
+	}
+	for i := 0; i < order; i++ {
+		v, err := br.readSigned(bps)
+		if err != nil {
+			return err
+		}
+		out[i] = v
+	}
+
+	precision, err := br.readBits(4)
+	if err != nil {
+		return err
+	}
+	if precision == 0xF {
+		return errors.New("flac: invalid LPC precision")
+	}
+	shift, err := br.readSigned(5)
+	if err != nil {
+		return err
+	}
+	if shift < 0 {
+		return errors.New("flac: negative LPC shift")
+	}
+
+	coeffs := make([]int64, order)
+	for i := range coeffs {
+		if coeffs[i], err = br.readSigned(int(precision) + 1); err != nil {
+			return err
+		}
+	}
+
+	if err := d.decodeResidual(out, order); err != nil {
+		return err
+	}
+
+	for i := order; i < len(out); i++ {
+		var sum int64
+		for j, c := range coeffs {
+			sum += c * out[i-1-j]
+		}
+		out[i] += sum >> uint(shift)
+	}
+	return nil
+}
+
+// decodeResidual reads Rice-coded residuals into out[order:]
+func (d *flacDecoder) decodeResidual(out []int64, order int) error {
+	br := d.br
+
+	method, err := br.readBits(2)
+	if err != nil {
+		return err
+	}
+	paramBits, escape := 4, uint64(0xF)
+	if method == 1 {
+		paramBits, escape = 5, 0x1F
+	} else if method > 1 {
+		return errors.New("flac: reserved residual coding method")
+	}
+
+	partitionOrder, err := br.readBits(4)
+	if err != nil {
+		return err
+	}
+	partitions := 1 << partitionOrder
+	partitionSize := len(out) >> partitionOrder
+
+	i := order
+	for p := 0; p < partitions; p++ {
+		n := partitionSize
+		if p == 0 {
+			n -= order
+		}
+		if n < 0 || i+n > len(out) {
+			return errors.New("flac: invalid residual partition size")
+		}
+
+		param, err := br.readBits(paramBits)
+		if err != nil {
+			return err
+		}
+
+		if param == escape {
+			rawBits, err := br.readBits(5)
+			if err != nil {
+				return err
+			}
+			for end := i + n; i < end; i++ {
+				if rawBits == 0 {
+					out[i] = 0
+					continue
+				}
+				if out[i], err = br.readSigned(int(rawBits)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		for end := i + n; i < end; i++ {
+			q, err := br.readUnary()
+			if err != nil {
+				return err
+			}
+			r, err := br.readBits(int(param))
+			if err != nil {
+				return err
+			}
+			v := q<<param | r
+			out[i] = int64(v>>1) ^ -int64(v&1)
+		}
+	}
+	return nil
+}
+
+// flacBitReader reads big-endian bit fields from a byte stream, keeping the
+// CRC-8 and CRC-16 of every byte consumed since the last resetCRC
+type flacBitReader struct {
+	r     *bufio.Reader
+	cache uint64
+	bits  int
+	crc8  uint8
+	crc16 uint16
+}
+
+// resetCRC starts the checksums afresh at a frame boundary
+func (b *flacBitReader) resetCRC() {
+	b.crc8, b.crc16 = 0, 0
+}
+
+// readByte takes the next byte from the stream into the checksums
+func (b *flacBitReader) readByte() (byte, error) {
+	c, err := b.r.ReadByte()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	b.crc8 = flacCRC8Table[b.crc8^c]
+	b.crc16 = b.crc16<<8 ^ flacCRC16Table[byte(b.crc16>>8)^c]
+	return c, nil
+}
+
+func (b *flacBitReader) readBits(n int) (uint64, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	for b.bits < n {
+		c, err := b.readByte()
+		if err != nil {
+			return 0, err
+		}
+		b.cache = b.cache<<8 | uint64(c)
+		b.bits += 8
+	}
+	b.bits -= n
+	v := (b.cache >> uint(b.bits)) & (1<<uint(n) - 1)
+	b.cache &= 1<<uint(b.bits) - 1
+	return v, nil
+}
+
+// readSigned reads an n-bit two's complement value
+func (b *flacBitReader) readSigned(n int) (int64, error) {
+	v, err := b.readBits(n)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	shift := uint(64 - n)
+	return int64(v<<shift) >> shift, nil
+}
+
+// readUnary counts zero bits up to the next one bit
+func (b *flacBitReader) readUnary() (uint64, error) {
+	var count uint64
+	for {
+		if b.bits == 0 {
+			c, err := b.readByte()
+			if err != nil {
+				return 0, err
+			}
+			b.cache = uint64(c)
+			b.bits = 8
+		}
+		// Scan the buffered bits from the most significant end
+		for b.bits > 0 {
+			b.bits--
+			if b.cache>>uint(b.bits)&1 == 1 {
+				b.cache &= 1<<uint(b.bits) - 1
+				return count, nil
+			}
+			count++
+		}
+		b.cache = 0
+	}
+}
+
+// skipUTF8Number skips the UTF-8 style coded frame or sample number
+func (b *flacBitReader) skipUTF8Number() error {
+	first, err := b.readBits(8)
+	if err != nil {
+		return err
+	}
+	extra := 0
+	for mask := uint64(0x80); mask > 0 && first&mask != 0; mask >>= 1 {
+		extra++
+	}
+	if extra == 1 || extra > 7 {
+		return errors.New("flac: invalid coded frame number")
+	}
+	if extra > 1 {
+		extra--
+	}
+	_, err = b.readBits(8 * extra)
+	return err
+}
+
+// alignToByte discards bits up to the next byte boundary
+func (b *flacBitReader) alignToByte() {
+	b.bits -= b.bits % 8
+	b.cache &= 1<<uint(b.bits) - 1
+}
+
+// FLAC frame checksums: CRC-8 with polynomial x^8+x^2+x+1 over the header,
+// CRC-16 with x^16+x^15+x^2+1 over the whole frame, both MSB first from zero
+var (
+	flacCRC8Table  = makeFLACCRC8Table(0x07)
+	flacCRC16Table = makeFLACCRC16Table(0x8005)
+)
+
+func makeFLACCRC8Table(poly uint8) (table [256]uint8) {
+	for i := range table {
+		crc := uint8(i)
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ poly
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}
+
+func makeFLACCRC16Table(poly uint16) (table [256]uint16) {
+	for i := range table {
+		crc := uint16(i) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ poly
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}
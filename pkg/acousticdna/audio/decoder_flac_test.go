@@ -0,0 +1,498 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+	"testing"
+)
+
+// flacBitWriter packs big-endian bit fields, the inverse of flacBitReader
+type flacBitWriter struct {
+	buf   []byte
+	cache byte
+	n     int
+}
+
+func (w *flacBitWriter) write(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.cache = w.cache<<1 | byte(v>>uint(i)&1)
+		if w.n++; w.n == 8 {
+			w.buf = append(w.buf, w.cache)
+			w.cache, w.n = 0, 0
+		}
+	}
+}
+
+func (w *flacBitWriter) signed(v int64, n int) { w.write(uint64(v)&(1<<uint(n)-1), n) }
+
+func (w *flacBitWriter) unary(q uint64) {
+	for ; q > 0; q-- {
+		w.write(0, 1)
+	}
+	w.write(1, 1)
+}
+
+func (w *flacBitWriter) align() {
+	for w.n != 0 {
+		w.write(0, 1)
+	}
+}
+
+// Bit-at-a-time CRCs, kept apart from the decoder's tables so that each
+// checks the other
+func testCRC8(data []byte) uint8 {
+	var crc uint8
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func testCRC16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// Subframe encodings the test encoder can write
+const (
+	subConstant = iota
+	subVerbatim
+	subFixed
+	subLPC
+)
+
+// flacTestFrame describes how to encode one frame
+type flacTestFrame struct {
+	size       int
+	assignment int // channel assignment, as in the frame header
+	subframe   int
+	order      int
+	wasted     int  // low zero bits to declare; the samples must have them
+	partitions int  // residual partition order
+	rice2      bool // 5-bit Rice parameters
+	escaped    bool // residuals written raw, through the escape code
+}
+
+// flacTestFixed are the fixed predictors' coefficients by order
+var flacTestFixed = [][]int64{{}, {1}, {2, -1}, {3, -3, 1}, {4, -6, 4, -1}}
+
+// flacTestLPC is the predictor of subLPC frames: coefficients of 12-bit
+// precision, shifted right by 10
+var flacTestLPC = []int64{1900, -940, 20}
+
+// flacTestStream is what encodeFLAC needs to write a stream
+type flacTestStream struct {
+	rate     int
+	bps      int
+	samples  [][]int64 // per channel
+	frames   []flacTestFrame
+	comments []string
+	badMD5   bool
+	noMD5    bool
+}
+
+// encodeFLAC writes a FLAC stream, returning it and the offset of each frame
+func encodeFLAC(t *testing.T, s flacTestStream) ([]byte, []int) {
+	t.Helper()
+	channels := len(s.samples)
+	total := len(s.samples[0])
+
+	// STREAMINFO, with the MD5 of the samples as the decoder will see them
+	sum := md5.New()
+	width := (s.bps + 7) / 8
+	for i := 0; i < total; i++ {
+		for ch := 0; ch < channels; ch++ {
+			for b := 0; b < width; b++ {
+				sum.Write([]byte{byte(s.samples[ch][i] >> (8 * b))})
+			}
+		}
+	}
+	signature := sum.Sum(nil)
+	if s.badMD5 {
+		signature[0] ^= 1
+	}
+	if s.noMD5 {
+		signature = make([]byte, 16)
+	}
+
+	w := &flacBitWriter{buf: []byte("fLaC")}
+	w.write(flacBlockStreamInfo, 8)
+	w.write(34, 24)
+	w.write(16, 16)
+	w.write(65535, 16)
+	w.write(0, 48)
+	w.write(uint64(s.rate), 20)
+	w.write(uint64(channels-1), 3)
+	w.write(uint64(s.bps-1), 5)
+	w.write(uint64(total), 36)
+	w.buf = append(w.buf, signature...)
+
+	// A picture the decoder should skip over unread
+	w.write(6, 8)
+	w.write(5000, 24)
+	w.buf = append(w.buf, make([]byte, 5000)...)
+
+	comment := binary.LittleEndian.AppendUint32(nil, 4)
+	comment = append(comment, "test"...)
+	comment = binary.LittleEndian.AppendUint32(comment, uint32(len(s.comments)))
+	for _, c := range s.comments {
+		comment = binary.LittleEndian.AppendUint32(comment, uint32(len(c)))
+		comment = append(comment, c...)
+	}
+	w.write(0x80|flacBlockVorbisComment, 8)
+	w.write(uint64(len(comment)), 24)
+	w.buf = append(w.buf, comment...)
+
+	var offsets []int
+	start := 0
+	for n, f := range s.frames {
+		offsets = append(offsets, len(w.buf))
+		frame := &flacBitWriter{}
+		frame.write(0x3FFE, 14)
+		frame.write(0, 2)
+		frame.write(7, 4) // block size follows as 16 bits
+		frame.write(0, 4) // sample rate from STREAMINFO
+		frame.write(uint64(f.assignment), 4)
+		sizeCode := 0 // from STREAMINFO on odd frames, spelled out on even ones
+		if n%2 == 0 {
+			sizeCode = map[int]int{8: 1, 12: 2, 16: 4, 20: 5, 24: 6, 32: 7}[s.bps]
+		}
+		frame.write(uint64(sizeCode), 3)
+		frame.write(0, 1)
+		frame.write(uint64(n), 8) // frame numbers under 128 are one byte
+		frame.write(uint64(f.size-1), 16)
+		frame.write(uint64(testCRC8(frame.buf)), 8)
+
+		block := make([][]int64, channels)
+		for ch := range block {
+			block[ch] = s.samples[ch][start : start+f.size]
+		}
+		for ch, x := range decorrelateForTest(block, f.assignment) {
+			bps := s.bps
+			if (f.assignment == flacLeftSide || f.assignment == flacMidSide) && ch == 1 ||
+				f.assignment == flacSideRight && ch == 0 {
+				bps++
+			}
+			encodeSubframe(frame, x, bps, f)
+		}
+		frame.align()
+		frame.write(uint64(testCRC16(frame.buf)), 16)
+		w.buf = append(w.buf, frame.buf...)
+		start += f.size
+	}
+	if start != total {
+		t.Fatalf("frames cover %d samples of %d", start, total)
+	}
+	return w.buf, offsets
+}
+
+// decorrelateForTest applies a frame's stereo coding
+func decorrelateForTest(block [][]int64, assignment int) [][]int64 {
+	if assignment < flacLeftSide {
+		return block
+	}
+	left, right := block[0], block[1]
+	a, b := make([]int64, len(left)), make([]int64, len(left))
+	for i := range left {
+		switch assignment {
+		case flacLeftSide:
+			a[i], b[i] = left[i], left[i]-right[i]
+		case flacSideRight:
+			a[i], b[i] = left[i]-right[i], right[i]
+		case flacMidSide:
+			a[i], b[i] = (left[i]+right[i])>>1, left[i]-right[i]
+		}
+	}
+	return [][]int64{a, b}
+}
+
+func encodeSubframe(w *flacBitWriter, x []int64, bps int, f flacTestFrame) {
+	kind := map[int]int{subConstant: 0, subVerbatim: 1, subFixed: 8 + f.order, subLPC: 31 + f.order}[f.subframe]
+	w.write(0, 1)
+	w.write(uint64(kind), 6)
+	if f.wasted > 0 {
+		w.write(1, 1)
+		w.unary(uint64(f.wasted - 1))
+		shifted := make([]int64, len(x))
+		for i, v := range x {
+			shifted[i] = v >> uint(f.wasted)
+		}
+		x, bps = shifted, bps-f.wasted
+	} else {
+		w.write(0, 1)
+	}
+
+	switch f.subframe {
+	case subConstant:
+		w.signed(x[0], bps)
+		return
+	case subVerbatim:
+		for _, v := range x {
+			w.signed(v, bps)
+		}
+		return
+	}
+
+	for _, v := range x[:f.order] {
+		w.signed(v, bps)
+	}
+	residual := make([]int64, len(x))
+	for i := f.order; i < len(x); i++ {
+		var pred int64
+		if f.subframe == subFixed {
+			for j, c := range flacTestFixed[f.order] {
+				pred += c * x[i-1-j]
+			}
+		} else {
+			for j, c := range flacTestLPC[:f.order] {
+				pred += c * x[i-1-j]
+			}
+			pred >>= 10
+		}
+		residual[i] = x[i] - pred
+	}
+	if f.subframe == subLPC {
+		w.write(11, 4) // precision 12
+		w.signed(10, 5)
+		for _, c := range flacTestLPC[:f.order] {
+			w.signed(c, 12)
+		}
+	}
+
+	paramBits, escape := 4, uint64(0xF)
+	if f.rice2 {
+		paramBits, escape = 5, 0x1F
+		w.write(1, 2)
+	} else {
+		w.write(0, 2)
+	}
+	w.write(uint64(f.partitions), 4)
+	size := len(x) >> uint(f.partitions)
+	for p := 0; p < 1<<uint(f.partitions); p++ {
+		from := p * size
+		if p == 0 {
+			from = f.order
+		}
+		part := residual[from : (p+1)*size]
+		if f.escaped {
+			width := 0
+			for _, v := range part {
+				if v < 0 {
+					v = ^v
+				}
+				width = max(width, bits.Len64(uint64(v))+1)
+			}
+			w.write(escape, paramBits)
+			w.write(uint64(width), 5)
+			for _, v := range part {
+				w.signed(v, width)
+			}
+			continue
+		}
+		var mean float64
+		for _, v := range part {
+			mean += math.Abs(float64(v))
+		}
+		k := 0
+		if mean /= float64(len(part)); mean >= 1 {
+			k = min(int(math.Log2(mean)), int(escape)-1)
+		}
+		w.write(uint64(k), paramBits)
+		for _, v := range part {
+			u := uint64(v<<1 ^ v>>63)
+			w.unary(u >> uint(k))
+			w.write(u&(1<<uint(k)-1), k)
+		}
+	}
+}
+
+// testTones makes channels of overlaid tones and noise at bps bits
+func testTones(channels, bps, n int) [][]int64 {
+	amp := float64(int64(1)<<(bps-1)) * 0.4
+	seed := uint32(1)
+	out := make([][]int64, channels)
+	for ch := range out {
+		out[ch] = make([]int64, n)
+		for i := range out[ch] {
+			seed = seed*1664525 + 1013904223
+			noise := float64(int32(seed)>>20) / 2048 * amp * 0.05
+			v := amp * math.Sin(2*math.Pi*float64(i)*float64(440+ch*220)/44100)
+			out[ch][i] = int64(v + noise)
+		}
+	}
+	return out
+}
+
+// stereoTestStream covers every subframe type and stereo coding, with a
+// silent opening frame and a closing one with wasted bits
+func stereoTestStream() flacTestStream {
+	frames := []flacTestFrame{
+		{size: 1152, assignment: 1, subframe: subConstant},
+		{size: 1152, assignment: 1, subframe: subVerbatim},
+		{size: 4096, assignment: flacLeftSide, subframe: subFixed, order: 2, partitions: 2},
+		{size: 4096, assignment: flacSideRight, subframe: subLPC, order: 3, rice2: true},
+		{size: 4096, assignment: flacMidSide, subframe: subFixed, order: 1, escaped: true, partitions: 1},
+		{size: 2048, assignment: 1, subframe: subFixed, order: 4},
+		{size: 1000, assignment: 1, subframe: subVerbatim, wasted: 2},
+	}
+	total := 0
+	for _, f := range frames {
+		total += f.size
+	}
+	samples := testTones(2, 16, total)
+	for ch := range samples {
+		for i := 0; i < 1152; i++ {
+			samples[ch][i] = 0
+		}
+		for i := total - 1000; i < total; i++ {
+			samples[ch][i] &^= 3
+		}
+	}
+	return flacTestStream{
+		rate:     44100,
+		bps:      16,
+		samples:  samples,
+		frames:   frames,
+		comments: []string{"TITLE=Test Tone", "ARTIST=AcousticDNA", "no separator"},
+	}
+}
+
+func TestDecodeFLAC(t *testing.T) {
+	mono := testTones(1, 24, 9000)
+	tests := map[string]flacTestStream{
+		"16-bit stereo": stereoTestStream(),
+		"24-bit mono": {rate: 48000, bps: 24, samples: mono, frames: []flacTestFrame{
+			{size: 4096, subframe: subLPC, order: 2, partitions: 4},
+			{size: 4096, subframe: subFixed, order: 3, rice2: true},
+			{size: 808, subframe: subVerbatim},
+		}},
+	}
+	for name, s := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, _ := encodeFLAC(t, s)
+			dec := openDecoder(t, data, FormatFLAC)
+			if dec.SampleRate() != s.rate || dec.Channels() != len(s.samples) {
+				t.Fatalf("%d Hz, %d channels; want %d Hz, %d", dec.SampleRate(), dec.Channels(), s.rate, len(s.samples))
+			}
+			got, err := decodeAll(dec)
+			if err != nil {
+				t.Fatalf("decoding: %v", err)
+			}
+
+			channels := len(s.samples)
+			if len(got) != channels*len(s.samples[0]) {
+				t.Fatalf("%d samples, want %d", len(got), channels*len(s.samples[0]))
+			}
+			scale := float64(int64(1) << (s.bps - 1))
+			for i, v := range got {
+				if want := float64(s.samples[i%channels][i/channels]) / scale; v != want {
+					t.Fatalf("sample %d of channel %d: %v, want %v", i/channels, i%channels, v, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFLACTags(t *testing.T) {
+	data, _ := encodeFLAC(t, stereoTestStream())
+	dec, err := newFLACDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("newFLACDecoder: %v", err)
+	}
+	tags := dec.tags()
+	if tags["title"] != "Test Tone" || tags["artist"] != "AcousticDNA" || len(tags) != 2 {
+		t.Errorf("tags %v", tags)
+	}
+}
+
+func TestFLACCorruption(t *testing.T) {
+	data, offsets := encodeFLAC(t, stereoTestStream())
+
+	tests := []struct {
+		name string
+		at   int // byte to damage
+		want error
+	}{
+		{"frame number", offsets[1] + 4, errFLACHeaderCRC},
+		{"verbatim sample", offsets[1] + 200, errFLACFrameCRC},
+		{"last frame", offsets[len(offsets)-1] + 100, errFLACFrameCRC},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			damaged := bytes.Clone(data)
+			damaged[tc.at] ^= 0x10
+			_, err := decodeAll(openDecoder(t, damaged, FormatFLAC))
+			if !errors.Is(err, tc.want) {
+				t.Errorf("decoding: %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestFLACMD5(t *testing.T) {
+	s := stereoTestStream()
+	s.badMD5 = true
+	data, _ := encodeFLAC(t, s)
+	if _, err := decodeAll(openDecoder(t, data, FormatFLAC)); !errors.Is(err, errFLACMD5) {
+		t.Errorf("stream with the wrong MD5: %v, want %v", err, errFLACMD5)
+	}
+
+	// An all-zero signature means the encoder didn't compute one
+	s.badMD5, s.noMD5 = false, true
+	data, _ = encodeFLAC(t, s)
+	if _, err := decodeAll(openDecoder(t, data, FormatFLAC)); err != nil {
+		t.Errorf("stream without an MD5: %v", err)
+	}
+}
+
+func TestFLACCRCTables(t *testing.T) {
+	// The standard check values for CRC-8 and CRC-16/UMTS
+	check := []byte("123456789")
+	br := &flacBitReader{r: bufio.NewReader(bytes.NewReader(check))}
+	for range check {
+		if _, err := br.readBits(8); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if br.crc8 != 0xF4 || testCRC8(check) != 0xF4 {
+		t.Errorf("CRC-8 %#x (bitwise %#x), want 0xf4", br.crc8, testCRC8(check))
+	}
+	if br.crc16 != 0xFEE8 || testCRC16(check) != 0xFEE8 {
+		t.Errorf("CRC-16 %#x (bitwise %#x), want 0xfee8", br.crc16, testCRC16(check))
+	}
+}
+
+func TestParseFLACVorbisCommentCount(t *testing.T) {
+	// A comment count of 4 billion over a block holding one comment
+	body := binary.LittleEndian.AppendUint32(nil, 0)
+	body = binary.LittleEndian.AppendUint32(body, math.MaxUint32)
+	body = binary.LittleEndian.AppendUint32(body, 10)
+	body = append(body, "TITLE=Tone"...)
+
+	tags := parseFLACVorbisComment(body)
+	if len(tags) != 1 || tags["title"] != "Tone" {
+		t.Errorf("tags %v", tags)
+	}
+}
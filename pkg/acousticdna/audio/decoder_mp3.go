@@ -0,0 +1,50 @@
+package audio
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/hajimehoshi/go-mp3"
+)
+
+// mp3Decoder adapts go-mp3, which always emits 16-bit little-endian stereo
+type mp3Decoder struct {
+	dec *mp3.Decoder
+	raw []byte
+}
+
+func newMP3Decoder(r io.Reader) (*mp3Decoder, error) {
+	dec, err := mp3.NewDecoder(r)
+	if err != nil {
+		return nil, err
+	}
+	return &mp3Decoder{dec: dec}, nil
+}
+
+func (d *mp3Decoder) SampleRate() int { return d.dec.SampleRate() }
+
+func (d *mp3Decoder) Channels() int { return 2 }
+
+// frameCount returns the total number of stereo frames, or -1 if unknown
+func (d *mp3Decoder) frameCount() int64 {
+	if d.dec.Length() < 0 {
+		return -1
+	}
+	return d.dec.Length() / 4
+}
+
+func (d *mp3Decoder) Read(p []float64) (int, error) {
+	need := len(p) * 2
+	if cap(d.raw) < need {
+		d.raw = make([]byte, need)
+	}
+	n, err := io.ReadFull(d.dec, d.raw[:need])
+	samples := n / 2
+	for i := 0; i < samples; i++ {
+		p[i] = float64(int16(binary.LittleEndian.Uint16(d.raw[2*i:]))) / 32768.0
+	}
+	if err == io.ErrUnexpectedEOF || (err == io.EOF && samples > 0) {
+		err = nil
+	}
+	return samples, err
+}
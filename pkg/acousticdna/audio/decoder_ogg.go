@@ -0,0 +1,64 @@
+package audio
+
+import (
+	"io"
+	"strings"
+
+	"github.com/jfreymuth/oggvorbis"
+)
+
+// oggDecoder adapts oggvorbis, which emits interleaved float32 samples
+type oggDecoder struct {
+	dec *oggvorbis.Reader
+	buf []float32
+}
+
+func newOggDecoder(r io.Reader) (*oggDecoder, error) {
+	dec, err := oggvorbis.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &oggDecoder{dec: dec}, nil
+}
+
+func (d *oggDecoder) SampleRate() int { return d.dec.SampleRate() }
+
+func (d *oggDecoder) Channels() int { return d.dec.Channels() }
+
+// frameCount returns the total number of frames, or 0 if the input wasn't seekable
+func (d *oggDecoder) frameCount() int64 { return d.dec.Length() }
+
+// tags returns the Vorbis comments as a lower-cased key/value map
+func (d *oggDecoder) tags() map[string]string {
+	return parseVorbisComments(d.dec.CommentHeader().Comments)
+}
+
+func (d *oggDecoder) Read(p []float64) (int, error) {
+	if cap(d.buf) < len(p) {
+		d.buf = make([]float32, len(p))
+	}
+	n, err := d.dec.Read(d.buf[:len(p)])
+	for i := 0; i < n; i++ {
+		p[i] = float64(d.buf[i])
+	}
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// parseVorbisComments turns "KEY=value" comments into a map keyed by lower-case KEY
+func parseVorbisComments(comments []string) map[string]string {
+	tags := make(map[string]string, len(comments))
+	for _, c := range comments {
+		key, value, ok := strings.Cut(c, "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(key)
+		if _, exists := tags[key]; !exists {
+			tags[key] = value
+		}
+	}
+	return tags
+}
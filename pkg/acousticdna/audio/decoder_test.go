@@ -0,0 +1,123 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"testing"
+)
+
+// The fixtures in testdata come with the PCM a reference decoder makes of them:
+//
+//	speech.mp3  the first 30 frames of go-mp3's example/mpeg2.mp3 (public
+//	            domain), ID3 tag included; MPEG-2 layer III, 22050 Hz mono
+//	speech.s16  its samples as signed 16-bit little-endian
+//	vorbis.ogg  oggvorbis's testdata/test.ogg (MIT); 44100 Hz mono
+//	vorbis.f32  the reference decode shipped with it, float32 little-endian
+
+// decodeAll drains a decoder of its interleaved samples
+func decodeAll(dec Decoder) ([]float64, error) {
+	var out []float64
+	buf := make([]float64, 1000) // not a multiple of any frame size
+	for {
+		n, err := dec.Read(buf)
+		out = append(out, buf[:n]...)
+		if errors.Is(err, io.EOF) {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+	}
+}
+
+// openDecoder sniffs and opens a decoder over data, checking the format
+func openDecoder(t *testing.T, data []byte, want Format) Decoder {
+	t.Helper()
+	dec, format, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewDecoder: %v", err)
+	}
+	if format != want {
+		t.Fatalf("format %q, want %q", format, want)
+	}
+	return dec
+}
+
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatalf("reading fixture: %v", err)
+	}
+	return data
+}
+
+func TestDecodeMP3(t *testing.T) {
+	dec := openDecoder(t, readTestdata(t, "speech.mp3"), FormatMP3)
+	if dec.SampleRate() != 22050 || dec.Channels() != 2 {
+		t.Fatalf("%d Hz, %d channels; want 22050 Hz, 2", dec.SampleRate(), dec.Channels())
+	}
+	got, err := decodeAll(dec)
+	if err != nil {
+		t.Fatalf("decoding: %v", err)
+	}
+
+	ref := readTestdata(t, "speech.s16")
+	if len(got) != len(ref) {
+		t.Fatalf("%d samples, want %d (mono source, doubled to stereo)", len(got), len(ref))
+	}
+	for i := 0; i < len(ref)/2; i++ {
+		want := float64(int16(binary.LittleEndian.Uint16(ref[2*i:]))) / 32768
+		if got[2*i] != want || got[2*i+1] != want {
+			t.Fatalf("frame %d: %v, %v; want %v on both channels", i, got[2*i], got[2*i+1], want)
+		}
+	}
+}
+
+func TestDecodeOgg(t *testing.T) {
+	dec := openDecoder(t, readTestdata(t, "vorbis.ogg"), FormatOGG)
+	if dec.SampleRate() != 44100 || dec.Channels() != 1 {
+		t.Fatalf("%d Hz, %d channels; want 44100 Hz, 1", dec.SampleRate(), dec.Channels())
+	}
+	got, err := decodeAll(dec)
+	if err != nil {
+		t.Fatalf("decoding: %v", err)
+	}
+
+	ref := readTestdata(t, "vorbis.f32")
+	if len(got) != len(ref)/4 {
+		t.Fatalf("%d samples, want %d", len(got), len(ref)/4)
+	}
+	for i := range got {
+		want := float64(math.Float32frombits(binary.LittleEndian.Uint32(ref[4*i:])))
+		if math.Abs(got[i]-want) > 2e-5 {
+			t.Fatalf("sample %d: %v, want %v", i, got[i], want)
+		}
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		header string
+		want   Format
+	}{
+		{"RIFF\x24\x00\x00\x00WAVE", FormatWAV},
+		{"RIFF\x24\x00\x00\x00AVI ", FormatUnknown},
+		{"fLaC\x00\x00\x00\x22", FormatFLAC},
+		{"OggS\x00\x02", FormatOGG},
+		{"ID3\x04\x00", FormatMP3},
+		{"\xFF\xFB\x90\x64", FormatMP3},
+		{"\xFF\xF1\x50\x80", FormatUnknown}, // ADTS AAC
+		{"\x00\x00\x00\x20ftypM4A ", FormatUnknown},
+		{"", FormatUnknown},
+	}
+	for _, tc := range tests {
+		if got := DetectFormat([]byte(tc.header)); got != tc.want {
+			t.Errorf("DetectFormat(%q) = %q, want %q", tc.header, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package audio
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// ffmpegSlots holds a token per running ffmpeg process; nil means no limit
+var ffmpegSlots atomic.Pointer[chan struct{}]
+
+func init() {
+	SetFFmpegConcurrency(runtime.NumCPU())
+}
+
+// SetFFmpegConcurrency caps how many ffmpeg conversions run at once across
+// the process; further conversions wait for a slot. n < 1 removes the cap.
+// Conversions already running keep the slot they hold.
+func SetFFmpegConcurrency(n int) {
+	if n < 1 {
+		ffmpegSlots.Store(nil)
+		return
+	}
+	slots := make(chan struct{}, n)
+	ffmpegSlots.Store(&slots)
+}
+
+// acquireFFmpeg waits for an ffmpeg slot and returns the func that frees
+// it, which may be called more than once
+func acquireFFmpeg(ctx context.Context) (func(), error) {
+	slots := ffmpegSlots.Load()
+	if slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case *slots <- struct{}{}:
+		var once sync.Once
+		return func() { once.Do(func() { <-*slots }) }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,114 @@
+package audio
+
+import (
+	"encoding/binary"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// readID3v2Tags parses the text frames of a leading ID3v2.3/2.4 tag.
+// Frames are keyed by their four-character ID (TIT2, TPE1, TALB, ...).
+// A missing or malformed tag yields an empty map rather than an error.
+func readID3v2Tags(r io.Reader) map[string]string {
+	tags := make(map[string]string)
+
+	var header [10]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil || string(header[:3]) != "ID3" {
+		return tags
+	}
+	version := header[3]
+	if version < 3 || version > 4 {
+		return tags
+	}
+	size := syncSafe(header[6:10])
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return tags
+	}
+
+	// Skip the extended header if present
+	pos := 0
+	if header[5]&0x40 != 0 && len(body) >= 4 {
+		if version == 4 {
+			pos = syncSafe(body[0:4])
+		} else {
+			pos = int(binary.BigEndian.Uint32(body[0:4])) + 4
+		}
+	}
+
+	for pos+10 <= len(body) {
+		id := string(body[pos : pos+4])
+		if id[0] == 0 {
+			break // padding
+		}
+		var frameSize int
+		if version == 4 {
+			frameSize = syncSafe(body[pos+4 : pos+8])
+		} else {
+			frameSize = int(binary.BigEndian.Uint32(body[pos+4 : pos+8]))
+		}
+		pos += 10
+		if frameSize <= 0 || pos+frameSize > len(body) {
+			break
+		}
+		if id[0] == 'T' && id != "TXXX" {
+			if _, exists := tags[id]; !exists {
+				tags[id] = decodeID3Text(body[pos : pos+frameSize])
+			}
+		}
+		pos += frameSize
+	}
+
+	return tags
+}
+
+// syncSafe decodes a 28-bit sync-safe integer
+func syncSafe(b []byte) int {
+	return int(b[0]&0x7F)<<21 | int(b[1]&0x7F)<<14 | int(b[2]&0x7F)<<7 | int(b[3]&0x7F)
+}
+
+// decodeID3Text decodes a text frame body: one encoding byte followed by the text
+func decodeID3Text(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	enc, data := b[0], b[1:]
+
+	var s string
+	switch enc {
+	case 1, 2: // UTF-16 with BOM, UTF-16BE
+		bigEndian := enc == 2
+		if len(data) >= 2 {
+			if data[0] == 0xFF && data[1] == 0xFE {
+				bigEndian, data = false, data[2:]
+			} else if data[0] == 0xFE && data[1] == 0xFF {
+				bigEndian, data = true, data[2:]
+			}
+		}
+		units := make([]uint16, 0, len(data)/2)
+		for i := 0; i+1 < len(data); i += 2 {
+			if bigEndian {
+				units = append(units, binary.BigEndian.Uint16(data[i:]))
+			} else {
+				units = append(units, binary.LittleEndian.Uint16(data[i:]))
+			}
+		}
+		s = string(utf16.Decode(units))
+	case 3: // UTF-8
+		s = string(data)
+	default: // ISO-8859-1
+		runes := make([]rune, len(data))
+		for i, c := range data {
+			runes[i] = rune(c)
+		}
+		s = string(runes)
+	}
+
+	// Multiple values are NUL-separated; keep the first
+	if idx := strings.IndexRune(s, 0); idx >= 0 {
+		s = s[:idx]
+	}
+	return strings.TrimSpace(s)
+}
@@ -4,9 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,6 +20,9 @@ type Metadata struct {
 	Title       string
 	Artist      string
 	Album       string
+	Genre       string
+	Year        int    // Release year, 0 when untagged
+	ISRC        string // International Standard Recording Code
 	Encoder     string
 	DurationSec float64
 	SampleRate  int
@@ -49,6 +57,136 @@ func (p *ffprobeOutput) firstAudioStream() *ffprobeStream {
 	return nil
 }
 
+// ReadMetadata reads stream properties and tags with the built-in decoders,
+// falling back to ffprobe for formats they don't understand.
+func ReadMetadata(ctx context.Context, path string) (*Metadata, error) {
+	meta, err := readMetadataNative(path)
+	if errors.Is(err, ErrUnsupportedFormat) {
+		if _, lookErr := exec.LookPath("ffprobe"); lookErr != nil {
+			return nil, fmt.Errorf("%w: %s (install ffprobe to enable fallback probing)", ErrUnsupportedFormat, filepath.Ext(path))
+		}
+		return ReadMetadataFFmpeg(ctx, path)
+	}
+	return meta, err
+}
+
+// readMetadataNative probes a file without external tools
+func readMetadataNative(path string) (*Metadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec, format, err := NewDecoder(f)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &Metadata{
+		Filename:   filepath.Base(path),
+		SampleRate: dec.SampleRate(),
+		Channels:   dec.Channels(),
+		Format:     string(format),
+	}
+
+	var frames int64
+	var tags map[string]string
+
+	switch d := dec.(type) {
+	case *wavDecoder:
+		meta.BitDepth = int(d.format.BitsPerSample)
+		// A streamed file's placeholder data size says nothing about its
+		// length, so its duration stays unknown
+		if d.remaining != math.MaxInt64 {
+			frames = d.remaining / int64(d.bytesPer*int(d.format.NumChannels))
+		}
+		tags = map[string]string{
+			"title":   d.tags["INAM"],
+			"artist":  d.tags["IART"],
+			"album":   d.tags["IPRD"],
+			"genre":   d.tags["IGNR"],
+			"date":    d.tags["ICRD"],
+			"encoder": d.tags["ISFT"],
+		}
+	case *flacDecoder:
+		meta.BitDepth = d.bitDepth()
+		frames = d.frameCount()
+		tags = d.tags()
+	case *oggDecoder:
+		frames = d.frameCount()
+		tags = d.tags()
+	case *mp3Decoder:
+		frames = d.frameCount()
+		if _, err := f.Seek(0, io.SeekStart); err == nil {
+			id3 := readID3v2Tags(f)
+			tags = map[string]string{
+				"title":   id3["TIT2"],
+				"artist":  id3["TPE1"],
+				"album":   id3["TALB"],
+				"genre":   id3Genre(id3["TCON"]),
+				"date":    firstNonEmpty(id3["TDRC"], id3["TYER"]),
+				"isrc":    id3["TSRC"],
+				"encoder": id3["TSSE"],
+			}
+		}
+	}
+
+	if frames > 0 && meta.SampleRate > 0 {
+		meta.DurationSec = float64(frames) / float64(meta.SampleRate)
+	}
+	if tags != nil {
+		meta.applyTags(tags)
+	}
+
+	return meta, nil
+}
+
+// applyTags copies tags keyed by lower-case Vorbis comment names
+func (m *Metadata) applyTags(tags map[string]string) {
+	m.Title = tags["title"]
+	m.Artist = tags["artist"]
+	m.Album = tags["album"]
+	m.Genre = tags["genre"]
+	m.Year = parseYear(firstNonEmpty(tags["date"], tags["year"]))
+	m.ISRC = tags["isrc"]
+	m.Encoder = tags["encoder"]
+}
+
+// parseYear takes the year from a date tag such as "1999", "1999-04-12" or
+// "1999-04-12T00:00:00"
+func parseYear(date string) int {
+	date = strings.TrimSpace(date)
+	if len(date) < 4 {
+		return 0
+	}
+	year, err := strconv.Atoi(date[:4])
+	if err != nil || year < 1000 {
+		return 0
+	}
+	return year
+}
+
+// id3Genre resolves an ID3v1 genre reference such as "(17)" or "(17)Rock"
+// to its text where the frame has some
+func id3Genre(s string) string {
+	if strings.HasPrefix(s, "(") {
+		if end := strings.Index(s, ")"); end > 0 && end+1 < len(s) {
+			return s[end+1:]
+		}
+	}
+	return s
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
 func ReadMetadataFFmpeg(ctx context.Context, path string) (*Metadata, error) {
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
@@ -97,10 +235,12 @@ func ReadMetadataFFmpeg(ctx context.Context, path string) (*Metadata, error) {
 	}
 
 	if probe.Format.Tags != nil {
-		meta.Title = probe.Format.Tags["title"]
-		meta.Artist = probe.Format.Tags["artist"]
-		meta.Album = probe.Format.Tags["album"]
-		meta.Encoder = probe.Format.Tags["encoder"]
+		// Tag names keep the container's case, e.g. "ARTIST" in FLAC
+		tags := make(map[string]string, len(probe.Format.Tags))
+		for k, v := range probe.Format.Tags {
+			tags[strings.ToLower(k)] = v
+		}
+		meta.applyTags(tags)
 	}
 
 	return meta, nil
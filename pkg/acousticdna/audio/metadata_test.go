@@ -0,0 +1,41 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWAVMetadataDuration(t *testing.T) {
+	data := make([]byte, 2*8000) // one second of 16-bit mono at 8 kHz
+	tests := []struct {
+		name     string
+		size     uint32
+		duration float64
+	}{
+		{"sized", uint32(len(data)), 1},
+		{"streamed, zero size", 0, 0},
+		{"streamed, maximum size", 0xFFFFFFFF, 0},
+	}
+	for _, tc := range tests {
+		var chunks bytes.Buffer
+		wavChunk(&chunks, "fmt ", wavFmt(wavFormatPCM, 1, 8000, 16, false))
+		chunks.WriteString("data")
+		binary.Write(&chunks, binary.LittleEndian, tc.size)
+		chunks.Write(data)
+
+		path := filepath.Join(t.TempDir(), "song.wav")
+		if err := os.WriteFile(path, wavFile(chunks.Bytes()), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		meta, err := readMetadataNative(path)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if meta.DurationSec != tc.duration {
+			t.Errorf("%s: duration %gs, want %gs", tc.name, meta.DurationSec, tc.duration)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+)
+
+// NewPCMStream turns an encoded audio stream into signed 16-bit little-endian
+// mono PCM at sampleRate. Formats supported by the built-in decoders are
+// converted in-process; anything else is piped through ffmpeg, so no
+// temporary files are written either way. The caller must Close the stream;
+// closing it again is harmless.
+func NewPCMStream(ctx context.Context, r io.Reader, sampleRate int) (io.ReadCloser, error) {
+	header, src, err := sniff(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if DetectFormat(header) == FormatUnknown {
+		return newFFmpegPCMStream(ctx, src, sampleRate)
+	}
+
+	dec, _, err := OpenMono(src, sampleRate)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(&pcmEncoder{src: dec}), nil
+}
+
+// sniff returns the first bytes of r along with a reader that still yields
+// them. Seekable inputs are rewound rather than buffered so decoders can
+// keep seeking.
+func sniff(r io.Reader) ([]byte, io.Reader, error) {
+	if rs, ok := r.(io.ReadSeeker); ok {
+		if start, err := rs.Seek(0, io.SeekCurrent); err == nil {
+			header := make([]byte, sniffLen)
+			n, err := io.ReadFull(rs, header)
+			if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+				return nil, nil, fmt.Errorf("reading stream header: %w", err)
+			}
+			if _, err := rs.Seek(start, io.SeekStart); err != nil {
+				return nil, nil, err
+			}
+			return header[:n], rs, nil
+		}
+	}
+
+	br := bufio.NewReaderSize(r, 64*1024)
+	header, err := br.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, fmt.Errorf("reading stream header: %w", err)
+	}
+	return header, br, nil
+}
+
+// pcmEncoder converts decoded float samples to 16-bit little-endian bytes
+type pcmEncoder struct {
+	src     Decoder
+	samples []float64
+	pending []byte
+}
+
+func (e *pcmEncoder) Read(p []byte) (int, error) {
+	if len(e.pending) > 0 {
+		n := copy(p, e.pending)
+		e.pending = e.pending[n:]
+		return n, nil
+	}
+
+	want := len(p) / 2
+	if want == 0 {
+		want = 1
+	}
+	if cap(e.samples) < want {
+		e.samples = make([]float64, want)
+	}
+	n, err := e.src.Read(e.samples[:want])
+
+	out := make([]byte, 2*n)
+	for i := 0; i < n; i++ {
+		binary.LittleEndian.PutUint16(out[2*i:], uint16(floatToInt16(e.samples[i])))
+	}
+	copied := copy(p, out)
+	e.pending = out[copied:]
+
+	if err != nil && (copied > 0 || len(e.pending) > 0) && errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return copied, err
+}
+
+// ffmpegPCMStream reads ffmpeg's stdout and reaps the process on Close
+type ffmpegPCMStream struct {
+	io.ReadCloser
+	cmd     *exec.Cmd
+	stderr  *bytes.Buffer
+	release func() // Frees the ffmpeg slot
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func newFFmpegPCMStream(ctx context.Context, r io.Reader, sampleRate int) (io.ReadCloser, error) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return nil, fmt.Errorf("%w (install ffmpeg to enable fallback decoding)", ErrUnsupportedFormat)
+	}
+	release, err := acquireFFmpeg(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(
+		ctx,
+		"ffmpeg",
+		"-v", "error",
+		"-i", "pipe:0",
+		"-ac", "1", // mono
+		"-ar", fmt.Sprintf("%d", sampleRate),
+		"-f", "s16le",
+		"pipe:1",
+	)
+	cmd.Stdin = r
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		release()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		release()
+		return nil, fmt.Errorf("starting ffmpeg: %w", err)
+	}
+	return &ffmpegPCMStream{ReadCloser: stdout, cmd: cmd, stderr: stderr, release: release}, nil
+}
+
+// Close stops ffmpeg and reports how it exited. Later calls return the
+// same error without waiting on the process again.
+func (s *ffmpegPCMStream) Close() error {
+	s.closeOnce.Do(func() {
+		defer s.release()
+		s.ReadCloser.Close()
+		if err := s.cmd.Wait(); err != nil {
+			s.closeErr = fmt.Errorf("ffmpeg failed: %v (%s)", err, s.stderr.String())
+		}
+	})
+	return s.closeErr
+}
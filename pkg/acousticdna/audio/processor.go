@@ -1,10 +1,15 @@
 package audio
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -18,6 +23,9 @@ type ConvertWAVConfig struct {
 	SampleRate int
 }
 
+// ConvertToMonoWAV converts inputPath to a mono 16-bit PCM WAV at cfg.SampleRate
+// inside outputDir. WAV, FLAC, MP3 and OGG/Vorbis are decoded in-process; any
+// other format falls back to ffmpeg when it is installed.
 func ConvertToMonoWAV(
 	ctx context.Context,
 	inputPath string,
@@ -29,22 +37,74 @@ func ConvertToMonoWAV(
 		cfg.SampleRate = 11025
 	}
 
-	if _, ok := ctx.Deadline(); !ok {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 10*time.Second)
-		defer cancel()
-	}
-
 	if err := utils.MakeDir(outputDir); err != nil {
 		return "", err
 	}
 
-	baseName := filepath.Base(inputPath)
-	outputPath := filepath.Join(outputDir, baseName)
+	// Reserve a unique output name so concurrent conversions of files that
+	// share a basename don't overwrite each other
+	baseName := strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath))
+	out, err := os.CreateTemp(outputDir, baseName+"-*.wav")
+	if err != nil {
+		return "", err
+	}
+	outputPath := out.Name()
+	out.Close()
 
 	tmpPath := outputPath + ".tmp.wav"
 	defer os.Remove(tmpPath)
 
+	err = convertNative(ctx, inputPath, tmpPath, cfg.SampleRate)
+	if errors.Is(err, ErrUnsupportedFormat) {
+		err = convertFFmpeg(ctx, inputPath, tmpPath, cfg.SampleRate)
+	}
+	if err != nil {
+		os.Remove(outputPath)
+		return "", err
+	}
+
+	if err := utils.MoveFile(tmpPath, outputPath); err != nil {
+		return "", err
+	}
+
+	return outputPath, nil
+}
+
+// convertNative decodes inputPath with the built-in decoders and writes a mono WAV
+func convertNative(ctx context.Context, inputPath, outputPath string, sampleRate int) error {
+	in, err := os.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	src, _, err := OpenMono(in, sampleRate)
+	if err != nil {
+		return err
+	}
+
+	return WriteMonoWAV(ctx, outputPath, src)
+}
+
+// convertFFmpeg shells out to ffmpeg for formats the built-in decoders can't handle
+func convertFFmpeg(ctx context.Context, inputPath, outputPath string, sampleRate int) error {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return fmt.Errorf("%w: %s (install ffmpeg to enable fallback decoding)", ErrUnsupportedFormat, filepath.Ext(inputPath))
+	}
+
+	// The timeout below is for ffmpeg itself, not the wait for a slot
+	release, err := acquireFFmpeg(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+	}
+
 	cmd := exec.CommandContext(
 		ctx,
 		"ffmpeg",
@@ -52,23 +112,124 @@ func ConvertToMonoWAV(
 		"-v", "quiet",
 		"-i", inputPath,
 		"-ac", "1", // mono
-		"-ar", fmt.Sprintf("%d", cfg.SampleRate),
+		"-ar", fmt.Sprintf("%d", sampleRate),
 		"-c:a", "pcm_s16le",
-		tmpPath,
+		outputPath,
 	)
 
 	if out, err := cmd.CombinedOutput(); err != nil {
 		if ctx.Err() != nil {
-			return "", ctx.Err()
+			return ctx.Err()
 		}
-		return "", fmt.Errorf("ffmpeg failed: %v (%s)", err, out)
+		return fmt.Errorf("ffmpeg failed: %v (%s)", err, out)
 	}
+	return nil
+}
 
-	if err := utils.MoveFile(tmpPath, outputPath); err != nil {
-		return "", err
+// WriteMonoWAV drains a mono decoder into a 16-bit PCM WAV file
+func WriteMonoWAV(ctx context.Context, path string, src Decoder) error {
+	if src.Channels() != 1 {
+		return errors.New("WriteMonoWAV requires a mono source")
 	}
 
-	return outputPath, nil
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Placeholder header; sizes are patched once the sample count is known
+	if err := writeWavHeader(f, src.SampleRate(), 0); err != nil {
+		return err
+	}
+
+	w := bufio.NewWriterSize(f, 64*1024)
+	buf := make([]float64, 8192)
+	pcm := make([]byte, 2*len(buf))
+	var dataBytes uint32
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, readErr := src.Read(buf)
+		for i := 0; i < n; i++ {
+			binary.LittleEndian.PutUint16(pcm[2*i:], uint16(floatToInt16(buf[i])))
+		}
+		if _, err := w.Write(pcm[:2*n]); err != nil {
+			return err
+		}
+		dataBytes += uint32(2 * n)
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := writeWavHeader(f, src.SampleRate(), dataBytes); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// EncodeWAV writes mono samples as a 16-bit PCM WAV stream
+func EncodeWAV(w io.Writer, samples []float64, sampleRate int) error {
+	if err := writeWavHeader(w, sampleRate, uint32(2*len(samples))); err != nil {
+		return err
+	}
+	pcm := make([]byte, 2*len(samples))
+	for i, v := range samples {
+		binary.LittleEndian.PutUint16(pcm[2*i:], uint16(floatToInt16(v)))
+	}
+	_, err := w.Write(pcm)
+	return err
+}
+
+// writeWavHeader writes a canonical 44-byte mono 16-bit PCM header
+func writeWavHeader(w io.Writer, sampleRate int, dataBytes uint32) error {
+	const (
+		channels      = 1
+		bitsPerSample = 16
+	)
+	blockAlign := channels * bitsPerSample / 8
+
+	header := make([]byte, 44)
+	copy(header[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:8], 36+dataBytes)
+	copy(header[8:12], "WAVE")
+	copy(header[12:16], "fmt ")
+	binary.LittleEndian.PutUint32(header[16:20], 16)
+	binary.LittleEndian.PutUint16(header[20:22], wavFormatPCM)
+	binary.LittleEndian.PutUint16(header[22:24], channels)
+	binary.LittleEndian.PutUint32(header[24:28], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(header[28:32], uint32(sampleRate*blockAlign))
+	binary.LittleEndian.PutUint16(header[32:34], uint16(blockAlign))
+	binary.LittleEndian.PutUint16(header[34:36], bitsPerSample)
+	copy(header[36:40], "data")
+	binary.LittleEndian.PutUint32(header[40:44], dataBytes)
+
+	_, err := w.Write(header)
+	return err
+}
+
+// floatToInt16 clips a [-1, 1] sample and scales it to 16-bit PCM
+func floatToInt16(v float64) int16 {
+	v = math.Round(v * 32767.0)
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
 }
 
 // YTMetadata contains metadata extracted from YouTube video
@@ -81,6 +242,11 @@ type YTMetadata struct {
 	Channel    string  `json:"channel"`     // Channel name
 	Duration   float64 `json:"duration"`    // Duration in seconds
 	WebpageURL string  `json:"webpage_url"` // Canonical YouTube URL
+
+	// Music metadata, present for tracks YouTube Music knows about
+	Album       string `json:"album"`
+	Genre       string `json:"genre"`
+	ReleaseYear int    `json:"release_year"`
 }
 
 func pickArtist(meta YTMetadata) string {
@@ -1,14 +1,31 @@
 package audio
 
 import (
-	"bytes"
+	"bufio"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 )
 
+// WAV audio format codes found in the fmt chunk
+const (
+	wavFormatPCM        = 0x0001
+	wavFormatFloat      = 0x0003
+	wavFormatExtensible = 0xFFFE
+)
+
+// maxListChunkSize bounds the LIST chunk read into memory for its INFO tags.
+// Real tag lists are a few hundred bytes; larger chunks are skipped unread.
+const maxListChunkSize = 1 << 20
+
+// maxWavChannels bounds the channel count a header may declare. Downmixing
+// buffers a whole frame per output sample, so the count sizes allocations;
+// 8 covers 7.1 surround.
+const maxWavChannels = 8
+
 // WavFormat holds the format information from the fmt chunk
 type WavFormat struct {
 	AudioFormat   uint16
@@ -17,25 +34,19 @@ type WavFormat struct {
 	BitsPerSample uint16
 }
 
-// WavData holds the complete WAV file data
-type WavData struct {
-	Format WavFormat
-	Data   []byte
-}
-
 // readRIFFHeader reads and validates the RIFF/WAVE header (12 bytes)
-func readRIFFHeader(f *os.File) error {
+func readRIFFHeader(r io.Reader) error {
 	var riff [4]byte
 	var fileSize uint32
 	var wave [4]byte
 
-	if err := binary.Read(f, binary.LittleEndian, &riff); err != nil {
+	if err := binary.Read(r, binary.LittleEndian, &riff); err != nil {
 		return fmt.Errorf("reading RIFF header: %w", err)
 	}
-	if err := binary.Read(f, binary.LittleEndian, &fileSize); err != nil {
+	if err := binary.Read(r, binary.LittleEndian, &fileSize); err != nil {
 		return fmt.Errorf("reading RIFF size: %w", err)
 	}
-	if err := binary.Read(f, binary.LittleEndian, &wave); err != nil {
+	if err := binary.Read(r, binary.LittleEndian, &wave); err != nil {
 		return fmt.Errorf("reading WAVE id: %w", err)
 	}
 
@@ -46,8 +57,13 @@ func readRIFFHeader(f *os.File) error {
 	return nil
 }
 
-// readFmtChunk reads the fmt chunk and returns format information
-func readFmtChunk(f *os.File, chunkSize uint32) (*WavFormat, error) {
+// readFmtChunk reads the fmt chunk and returns format information.
+// For WAVE_FORMAT_EXTENSIBLE the sub-format GUID is used as the audio format.
+func readFmtChunk(r io.Reader, chunkSize uint32) (*WavFormat, error) {
+	if chunkSize < 16 {
+		return nil, fmt.Errorf("fmt chunk too short: %d bytes", chunkSize)
+	}
+
 	var audioFormat uint16
 	var numChannels uint16
 	var sampleRate uint32
@@ -55,29 +71,40 @@ func readFmtChunk(f *os.File, chunkSize uint32) (*WavFormat, error) {
 	var blockAlign uint16
 	var bitsPerSample uint16
 
-	if err := binary.Read(f, binary.LittleEndian, &audioFormat); err != nil {
+	if err := binary.Read(r, binary.LittleEndian, &audioFormat); err != nil {
 		return nil, fmt.Errorf("reading fmt audioFormat: %w", err)
 	}
-	if err := binary.Read(f, binary.LittleEndian, &numChannels); err != nil {
+	if err := binary.Read(r, binary.LittleEndian, &numChannels); err != nil {
 		return nil, fmt.Errorf("reading fmt numChannels: %w", err)
 	}
-	if err := binary.Read(f, binary.LittleEndian, &sampleRate); err != nil {
+	if err := binary.Read(r, binary.LittleEndian, &sampleRate); err != nil {
 		return nil, fmt.Errorf("reading fmt sampleRate: %w", err)
 	}
-	if err := binary.Read(f, binary.LittleEndian, &byteRate); err != nil {
+	if err := binary.Read(r, binary.LittleEndian, &byteRate); err != nil {
 		return nil, fmt.Errorf("reading fmt byteRate: %w", err)
 	}
-	if err := binary.Read(f, binary.LittleEndian, &blockAlign); err != nil {
+	if err := binary.Read(r, binary.LittleEndian, &blockAlign); err != nil {
 		return nil, fmt.Errorf("reading fmt blockAlign: %w", err)
 	}
-	if err := binary.Read(f, binary.LittleEndian, &bitsPerSample); err != nil {
+	if err := binary.Read(r, binary.LittleEndian, &bitsPerSample); err != nil {
 		return nil, fmt.Errorf("reading fmt bitsPerSample: %w", err)
 	}
 
+	remaining := int64(chunkSize) - 16
+
+	// WAVE_FORMAT_EXTENSIBLE: cbSize(2) validBits(2) channelMask(4) subFormat(16)
+	if audioFormat == wavFormatExtensible && remaining >= 24 {
+		var ext [24]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return nil, fmt.Errorf("reading fmt extension: %w", err)
+		}
+		audioFormat = binary.LittleEndian.Uint16(ext[8:10])
+		remaining -= 24
+	}
+
 	// If there are extra bytes in fmt chunk, skip them
-	remaining := int(chunkSize) - 16
 	if remaining > 0 {
-		if _, err := f.Seek(int64(remaining), io.SeekCurrent); err != nil {
+		if err := skipChunk(r, uint32(remaining)); err != nil {
 			return nil, fmt.Errorf("seeking past fmt extras: %w", err)
 		}
 	}
@@ -90,43 +117,77 @@ func readFmtChunk(f *os.File, chunkSize uint32) (*WavFormat, error) {
 	}, nil
 }
 
-// readDataChunk reads the data chunk and returns raw PCM data
-func readDataChunk(f *os.File, chunkSize uint32) ([]byte, error) {
-	dataChunk := make([]byte, chunkSize)
-	if _, err := io.ReadFull(f, dataChunk); err != nil {
-		return nil, fmt.Errorf("reading data chunk: %w", err)
+// skipChunk skips an unknown chunk
+func skipChunk(r io.Reader, chunkSize uint32) error {
+	if s, ok := r.(io.Seeker); ok {
+		_, err := s.Seek(int64(chunkSize), io.SeekCurrent)
+		return err
 	}
-	return dataChunk, nil
+	_, err := io.CopyN(io.Discard, r, int64(chunkSize))
+	return err
 }
 
-// skipChunk skips an unknown chunk
-func skipChunk(f *os.File, chunkSize uint32) error {
-	skip := int64(chunkSize)
-	if _, err := f.Seek(skip, io.SeekCurrent); err != nil {
-		return err
+// validate checks that the sample encoding is one the decoder understands
+func (f *WavFormat) validate() error {
+	if f.NumChannels == 0 {
+		return errors.New("invalid WAV: zero channels")
 	}
-	return nil
+	if f.NumChannels > maxWavChannels {
+		return fmt.Errorf("unsupported WAV channel count: %d", f.NumChannels)
+	}
+	if f.SampleRate == 0 {
+		return errors.New("invalid WAV: zero sample rate")
+	}
+	switch f.AudioFormat {
+	case wavFormatPCM:
+		switch f.BitsPerSample {
+		case 8, 16, 24, 32:
+			return nil
+		}
+		return fmt.Errorf("unsupported PCM bit depth: %d", f.BitsPerSample)
+	case wavFormatFloat:
+		switch f.BitsPerSample {
+		case 32, 64:
+			return nil
+		}
+		return fmt.Errorf("unsupported float bit depth: %d", f.BitsPerSample)
+	default:
+		return fmt.Errorf("unsupported WAV audio format: %#x", f.AudioFormat)
+	}
+}
+
+// wavDecoder streams interleaved samples out of the data chunk of a WAV file
+type wavDecoder struct {
+	format    WavFormat
+	data      *bufio.Reader
+	remaining int64
+	bytesPer  int
+	frame     []byte
+	tags      map[string]string
 }
 
-// scanWavChunks scans through WAV chunks to find fmt and data chunks
-func scanWavChunks(f *os.File) (*WavData, error) {
-	var format WavFormat
-	var dataChunk []byte
-	fmtFound := false
-	dataFound := false
+// newWavDecoder parses the RIFF header and all chunks preceding the data
+// chunk, leaving r positioned at the first sample.
+func newWavDecoder(r io.Reader) (*wavDecoder, error) {
+	if err := readRIFFHeader(r); err != nil {
+		return nil, err
+	}
+
+	var format *WavFormat
+	tags := make(map[string]string)
 
 	for {
 		// Read next chunk header: ID (4) + Size (4)
 		var chunkID [4]byte
 		var chunkSize uint32
 
-		if err := binary.Read(f, binary.LittleEndian, &chunkID); err != nil {
+		if err := binary.Read(r, binary.LittleEndian, &chunkID); err != nil {
 			if errors.Is(err, io.EOF) {
-				break
+				return nil, errors.New("data chunk not found")
 			}
 			return nil, fmt.Errorf("reading chunk header: %w", err)
 		}
-		if err := binary.Read(f, binary.LittleEndian, &chunkSize); err != nil {
+		if err := binary.Read(r, binary.LittleEndian, &chunkSize); err != nil {
 			return nil, fmt.Errorf("reading chunk size: %w", err)
 		}
 
@@ -134,101 +195,141 @@ func scanWavChunks(f *os.File) (*WavData, error) {
 
 		switch id {
 		case "fmt ":
-			fmt, err := readFmtChunk(f, chunkSize)
+			f, err := readFmtChunk(r, chunkSize)
 			if err != nil {
 				return nil, err
 			}
-			format = *fmt
-			fmtFound = true
+			format = f
 
 		case "data":
-			data, err := readDataChunk(f, chunkSize)
-			if err != nil {
+			if format == nil {
+				return nil, errors.New("fmt chunk not found")
+			}
+			if err := format.validate(); err != nil {
 				return nil, err
 			}
-			dataChunk = data
-			dataFound = true
+			bytesPer := int(format.BitsPerSample) / 8
+			remaining := int64(chunkSize)
+			if chunkSize == 0 || chunkSize == math.MaxUint32 {
+				// Writers that stream to a pipe can't know the final size and
+				// leave a placeholder, so read until the input ends
+				remaining = math.MaxInt64
+			}
+			return &wavDecoder{
+				format:    *format,
+				data:      bufio.NewReaderSize(r, 64*1024),
+				remaining: remaining,
+				bytesPer:  bytesPer,
+				frame:     make([]byte, bytesPer),
+				tags:      tags,
+			}, nil
+
+		case "LIST":
+			if err := readListInfo(r, chunkSize, tags); err != nil {
+				return nil, fmt.Errorf("reading LIST chunk: %w", err)
+			}
 
 		default:
-			// Unknown chunk (e.g., LIST, INFO, junk). Skip it.
-			if err := skipChunk(f, chunkSize); err != nil {
+			// Unknown chunk (e.g., INFO, junk). Skip it.
+			if err := skipChunk(r, chunkSize); err != nil {
 				return nil, fmt.Errorf("skipping chunk %s: %w", id, err)
 			}
 		}
 
 		// If chunk size is odd, skip pad byte
 		if chunkSize%2 == 1 {
-			if _, err := f.Seek(1, io.SeekCurrent); err != nil {
+			if err := skipChunk(r, 1); err != nil {
 				return nil, fmt.Errorf("seeking pad byte: %w", err)
 			}
 		}
+	}
+}
 
-		// We can stop early if we have both fmt and data
-		if fmtFound && dataFound {
+// readListInfo extracts the INFO sub-chunks (INAM, IART, IPRD, ...) of a LIST chunk
+func readListInfo(r io.Reader, chunkSize uint32, tags map[string]string) error {
+	// The size comes straight from the file; don't trust it with an allocation
+	if chunkSize > maxListChunkSize {
+		return skipChunk(r, chunkSize)
+	}
+	body := make([]byte, chunkSize)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return err
+	}
+	if len(body) < 4 || string(body[:4]) != "INFO" {
+		return nil
+	}
+	for pos := 4; pos+8 <= len(body); {
+		id := string(body[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(body[pos+4 : pos+8]))
+		pos += 8
+		if size < 0 || pos+size > len(body) {
 			break
 		}
+		value := body[pos : pos+size]
+		for len(value) > 0 && value[len(value)-1] == 0 {
+			value = value[:len(value)-1]
+		}
+		tags[id] = string(value)
+		pos += size + size%2
 	}
+	return nil
+}
 
-	if !fmtFound {
-		return nil, errors.New("fmt chunk not found")
-	}
-	if !dataFound {
-		return nil, errors.New("data chunk not found")
-	}
+func (d *wavDecoder) SampleRate() int { return int(d.format.SampleRate) }
 
-	return &WavData{
-		Format: format,
-		Data:   dataChunk,
-	}, nil
-}
+func (d *wavDecoder) Channels() int { return int(d.format.NumChannels) }
 
-// convertToInt16Samples converts byte data to int16 samples
-func convertToInt16Samples(data []byte) ([]int16, error) {
-	sampleCount := len(data) / 2
-	int16Buf := make([]int16, sampleCount)
-	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, int16Buf); err != nil {
-		return nil, fmt.Errorf("decoding PCM samples: %w", err)
+// Read decodes up to len(p) interleaved samples normalized to [-1, 1]
+func (d *wavDecoder) Read(p []float64) (int, error) {
+	n := 0
+	for n < len(p) {
+		if d.remaining < int64(d.bytesPer) {
+			break
+		}
+		if _, err := io.ReadFull(d.data, d.frame); err != nil {
+			// Truncated files are common; return what we have
+			if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+				d.remaining = 0
+				break
+			}
+			return n, err
+		}
+		d.remaining -= int64(d.bytesPer)
+		p[n] = d.decodeSample(d.frame)
+		n++
 	}
-	return int16Buf, nil
-}
-
-// convertMonoToFloat64 converts mono int16 samples to float64
-func convertMonoToFloat64(samples []int16, scale float64) []float64 {
-	out := make([]float64, len(samples))
-	for i, s := range samples {
-		out[i] = float64(s) * scale
+	if n == 0 && len(p) > 0 {
+		return 0, io.EOF
 	}
-	return out
+	return n, nil
 }
 
-// convertStereoToMono converts stereo int16 samples to mono float64 by averaging channels
-func convertStereoToMono(samples []int16, scale float64) []float64 {
-	frames := len(samples) / 2
-	out := make([]float64, frames)
-	for i := 0; i < frames; i++ {
-		l := float64(samples[2*i]) * scale
-		r := float64(samples[2*i+1]) * scale
-		out[i] = (l + r) * 0.5
+// decodeSample converts one little-endian sample to float64
+func (d *wavDecoder) decodeSample(b []byte) float64 {
+	if d.format.AudioFormat == wavFormatFloat {
+		if d.format.BitsPerSample == 64 {
+			return math.Float64frombits(binary.LittleEndian.Uint64(b))
+		}
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
 	}
-	return out
-}
 
-// convertToMonoFloat64 converts int16 samples to mono float64 samples normalized to [-1, 1]
-func convertToMonoFloat64(samples []int16, numChannels uint16) ([]float64, error) {
-	const scale = 1.0 / 32768.0 // to ensure 16 bit PCM
-
-	switch numChannels {
-	case 1:
-		return convertMonoToFloat64(samples, scale), nil
-	case 2:
-		return convertStereoToMono(samples, scale), nil
+	switch d.format.BitsPerSample {
+	case 8:
+		// 8-bit WAV is unsigned
+		return (float64(b[0]) - 128.0) / 128.0
+	case 16:
+		return float64(int16(binary.LittleEndian.Uint16(b))) / 32768.0
+	case 24:
+		v := int32(b[0]) | int32(b[1])<<8 | int32(int8(b[2]))<<16
+		return float64(v) / 8388608.0
 	default:
-		return nil, errors.New("unsupported channel count: only mono/stereo supported")
+		return float64(int32(binary.LittleEndian.Uint32(b))) / 2147483648.0
 	}
 }
 
-// ReadWavAsFloat64 reads a 16-bit PCM WAV file and returns mono, normalized
-// samples in the range [-1,1] and the sample rate.
+// ReadWavAsFloat64 reads a PCM (8/16/24/32-bit) or IEEE float (32/64-bit) WAV
+// file and returns mono, normalized samples in the range [-1,1] and the sample rate.
+// Multi-channel files are downmixed by averaging all channels.
 // Does not assume a canonical 44-byte PCM WAV header.
 func ReadWavAsFloat64(path string) ([]float64, int, error) {
 	f, err := os.Open(path)
@@ -237,36 +338,14 @@ func ReadWavAsFloat64(path string) ([]float64, int, error) {
 	}
 	defer f.Close()
 
-	// Read and validate RIFF header
-	if err := readRIFFHeader(f); err != nil {
-		return nil, 0, err
-	}
-
-	// Scan chunks to find fmt and data
-	wavData, err := scanWavChunks(f)
+	dec, err := newWavDecoder(f)
 	if err != nil {
 		return nil, 0, err
 	}
 
-	// Validate format
-	if wavData.Format.AudioFormat != 1 {
-		return nil, 0, errors.New("unsupported WAV audio format: only PCM (1) supported")
-	}
-	if wavData.Format.BitsPerSample != 16 {
-		return nil, 0, errors.New("unsupported bits per sample: only 16-bit supported")
-	}
-
-	// Convert data chunk to int16 samples
-	int16Samples, err := convertToInt16Samples(wavData.Data)
-	if err != nil {
-		return nil, 0, err
-	}
-
-	// Convert to mono float64
-	monoSamples, err := convertToMonoFloat64(int16Samples, wavData.Format.NumChannels)
+	samples, err := readAllMono(dec)
 	if err != nil {
 		return nil, 0, err
 	}
-
-	return monoSamples, int(wavData.Format.SampleRate), nil
+	return samples, dec.SampleRate(), nil
 }
@@ -0,0 +1,199 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"runtime"
+	"testing"
+)
+
+// wavChunk appends a RIFF chunk, with its pad byte if the body is odd-sized
+func wavChunk(buf *bytes.Buffer, id string, body []byte) {
+	buf.WriteString(id)
+	binary.Write(buf, binary.LittleEndian, uint32(len(body)))
+	buf.Write(body)
+	if len(body)%2 == 1 {
+		buf.WriteByte(0)
+	}
+}
+
+// wavFile wraps chunks in a RIFF/WAVE header
+func wavFile(chunks []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(4+len(chunks)))
+	buf.WriteString("WAVE")
+	buf.Write(chunks)
+	return buf.Bytes()
+}
+
+// wavFmt builds a fmt chunk body; extensible uses WAVE_FORMAT_EXTENSIBLE
+// with format as the sub-format
+func wavFmt(format uint16, channels, rate, bits int, extensible bool) []byte {
+	var buf bytes.Buffer
+	tag := format
+	if extensible {
+		tag = wavFormatExtensible
+	}
+	block := channels * bits / 8
+	for _, field := range []any{tag, uint16(channels), uint32(rate), uint32(rate * block), uint16(block), uint16(bits)} {
+		binary.Write(&buf, binary.LittleEndian, field)
+	}
+	if extensible {
+		for _, field := range []any{uint16(22), uint16(bits), uint32(0), format} {
+			binary.Write(&buf, binary.LittleEndian, field)
+		}
+		buf.Write(make([]byte, 14)) // rest of the sub-format GUID
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeWAV(t *testing.T) {
+	// Reference frames, stereo, as fractions of full scale
+	ref := []float64{0, 0, 0.5, -0.5, -1, 0.25, 0.75, -0.125, 0.0625, 1 - 1.0/128}
+
+	tests := []struct {
+		name       string
+		format     uint16
+		bits       int
+		extensible bool
+		encode     func(v float64) []byte
+	}{
+		{"8-bit PCM", wavFormatPCM, 8, false, func(v float64) []byte {
+			return []byte{byte(int(v*128) + 128)}
+		}},
+		{"16-bit PCM", wavFormatPCM, 16, false, func(v float64) []byte {
+			return binary.LittleEndian.AppendUint16(nil, uint16(int16(v*32768)))
+		}},
+		{"24-bit PCM", wavFormatPCM, 24, false, func(v float64) []byte {
+			return binary.LittleEndian.AppendUint32(nil, uint32(int32(v*8388608)))[:3]
+		}},
+		{"32-bit PCM", wavFormatPCM, 32, false, func(v float64) []byte {
+			return binary.LittleEndian.AppendUint32(nil, uint32(int32(v*2147483648)))
+		}},
+		{"32-bit float", wavFormatFloat, 32, false, func(v float64) []byte {
+			return binary.LittleEndian.AppendUint32(nil, math.Float32bits(float32(v)))
+		}},
+		{"64-bit float", wavFormatFloat, 64, false, func(v float64) []byte {
+			return binary.LittleEndian.AppendUint64(nil, math.Float64bits(v))
+		}},
+		{"extensible 24-bit PCM", wavFormatPCM, 24, true, func(v float64) []byte {
+			return binary.LittleEndian.AppendUint32(nil, uint32(int32(v*8388608)))[:3]
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var data []byte
+			for _, v := range ref {
+				data = append(data, tc.encode(v)...)
+			}
+			var info bytes.Buffer
+			info.WriteString("INFO")
+			wavChunk(&info, "INAM", []byte("Test Tone\x00"))
+			wavChunk(&info, "IART", []byte("AcousticDNA\x00"))
+
+			var chunks bytes.Buffer
+			wavChunk(&chunks, "fmt ", wavFmt(tc.format, 2, 8000, tc.bits, tc.extensible))
+			wavChunk(&chunks, "LIST", info.Bytes())
+			wavChunk(&chunks, "junk", []byte{1, 2, 3})
+			wavChunk(&chunks, "data", data)
+
+			dec := openDecoder(t, wavFile(chunks.Bytes()), FormatWAV)
+			if dec.SampleRate() != 8000 || dec.Channels() != 2 {
+				t.Fatalf("%d Hz, %d channels; want 8000 Hz, 2", dec.SampleRate(), dec.Channels())
+			}
+			got, err := decodeAll(dec)
+			if err != nil {
+				t.Fatalf("decoding: %v", err)
+			}
+			if len(got) != len(ref) {
+				t.Fatalf("%d samples, want %d", len(got), len(ref))
+			}
+			for i, want := range ref {
+				if got[i] != want {
+					t.Errorf("sample %d: %v, want %v", i, got[i], want)
+				}
+			}
+			tags := dec.(*wavDecoder).tags
+			if tags["INAM"] != "Test Tone" || tags["IART"] != "AcousticDNA" {
+				t.Errorf("INFO tags %v", tags)
+			}
+		})
+	}
+}
+
+// streamOnly hides a reader's Seek, as a pipe or upload would
+type streamOnly struct{ io.Reader }
+
+func TestWAVOversizedListChunk(t *testing.T) {
+	var chunks bytes.Buffer
+	wavChunk(&chunks, "fmt ", wavFmt(wavFormatPCM, 1, 8000, 16, false))
+	// A LIST chunk claiming nearly 4 GiB in a file of a few dozen bytes
+	chunks.WriteString("LIST")
+	binary.Write(&chunks, binary.LittleEndian, uint32(0xFFFFFFF0))
+	chunks.WriteString("INFO")
+	file := wavFile(chunks.Bytes())
+
+	for name, r := range map[string]io.Reader{
+		"seekable": bytes.NewReader(file),
+		"stream":   streamOnly{bytes.NewReader(file)},
+	} {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		_, err := newWavDecoder(r)
+		runtime.ReadMemStats(&after)
+		if err == nil {
+			t.Errorf("%s: truncated file decoded", name)
+		}
+		if grew := after.TotalAlloc - before.TotalAlloc; grew > 1<<20 {
+			t.Errorf("%s: allocated %d bytes on the LIST chunk's say-so", name, grew)
+		}
+	}
+}
+
+func TestWAVShortFmtChunk(t *testing.T) {
+	var chunks bytes.Buffer
+	wavChunk(&chunks, "fmt ", []byte{1, 0, 1, 0})
+	wavChunk(&chunks, "data", make([]byte, 16))
+	if _, err := newWavDecoder(bytes.NewReader(wavFile(chunks.Bytes()))); err == nil {
+		t.Error("4-byte fmt chunk accepted")
+	}
+}
+
+func TestWAVTooManyChannels(t *testing.T) {
+	// 256 bytes claiming 65535 channels; downmixing it would buffer 65535
+	// samples per output sample
+	var chunks bytes.Buffer
+	wavChunk(&chunks, "fmt ", wavFmt(wavFormatPCM, 65535, 8000, 8, false))
+	wavChunk(&chunks, "data", make([]byte, 256-12-8-16-8))
+	file := wavFile(chunks.Bytes())
+
+	if _, err := newWavDecoder(bytes.NewReader(file)); err == nil {
+		t.Error("65535-channel header accepted")
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	stream, err := NewPCMStream(context.Background(), bytes.NewReader(file), 11025)
+	if err == nil {
+		_, err = io.Copy(io.Discard, stream)
+		stream.Close()
+	}
+	runtime.ReadMemStats(&after)
+	if err == nil {
+		t.Error("65535-channel file streamed")
+	}
+	if grew := after.TotalAlloc - before.TotalAlloc; grew > 1<<20 {
+		t.Errorf("allocated %d bytes on the channel count's say-so", grew)
+	}
+
+	chunks.Reset()
+	wavChunk(&chunks, "fmt ", wavFmt(wavFormatPCM, maxWavChannels, 8000, 16, false))
+	wavChunk(&chunks, "data", make([]byte, 2*maxWavChannels))
+	if _, err := newWavDecoder(bytes.NewReader(wavFile(chunks.Bytes()))); err != nil {
+		t.Errorf("%d-channel file: %v", maxWavChannels, err)
+	}
+}
@@ -0,0 +1,209 @@
+package audio
+
+import (
+	"errors"
+	"io"
+	"math"
+)
+
+const (
+	// resampleZeroCrossings is the number of sinc zero crossings on each side of the kernel
+	resampleZeroCrossings = 16
+
+	// resampleTableSize is the number of precomputed kernel points per side
+	resampleTableSize = 4096
+
+	// resampleReadSize is the number of input samples pulled from the source at a time
+	resampleReadSize = 4096
+)
+
+// Resampler converts a mono stream to another sample rate using band-limited
+// (Blackman-windowed sinc) interpolation. When downsampling, the kernel cutoff
+// is lowered to the output Nyquist frequency so the result is free of aliasing.
+type Resampler struct {
+	src     Decoder
+	inRate  int
+	outRate int
+
+	step      float64 // input samples advanced per output sample
+	cutoff    float64 // kernel cutoff relative to the input Nyquist frequency
+	halfWidth float64 // kernel half-width in input samples
+	table     []float64
+
+	hist      []float64 // buffered input samples
+	histStart int64     // absolute input index of hist[0]
+	outIdx    int64
+	eof       bool
+	readBuf   []float64
+}
+
+// NewResampler wraps a mono decoder so that Read returns samples at outRate.
+// If the source already runs at outRate the source is returned unchanged.
+func NewResampler(src Decoder, outRate int) (Decoder, error) {
+	if src.Channels() != 1 {
+		return nil, errors.New("resampler requires a mono source")
+	}
+	if outRate <= 0 || src.SampleRate() <= 0 {
+		return nil, errors.New("sample rates must be positive")
+	}
+	if src.SampleRate() == outRate {
+		return src, nil
+	}
+
+	inRate := src.SampleRate()
+	cutoff := math.Min(1.0, float64(outRate)/float64(inRate))
+
+	r := &Resampler{
+		src:       src,
+		inRate:    inRate,
+		outRate:   outRate,
+		step:      float64(inRate) / float64(outRate),
+		cutoff:    cutoff,
+		halfWidth: resampleZeroCrossings / cutoff,
+		readBuf:   make([]float64, resampleReadSize),
+	}
+	r.table = buildKernelTable(cutoff)
+	return r, nil
+}
+
+// buildKernelTable samples the windowed sinc over one side of the kernel
+func buildKernelTable(cutoff float64) []float64 {
+	table := make([]float64, resampleTableSize+1)
+	for i := range table {
+		u := float64(i) / resampleTableSize // 0..1 across the half-width
+		x := u * resampleZeroCrossings      // in units of cutoff-scaled samples
+		var sinc float64
+		if x == 0 {
+			sinc = 1
+		} else {
+			sinc = math.Sin(math.Pi*x) / (math.Pi * x)
+		}
+		// Blackman window centred on the kernel
+		w := 0.42 + 0.5*math.Cos(math.Pi*u) + 0.08*math.Cos(2*math.Pi*u)
+		table[i] = cutoff * sinc * w
+	}
+	return table
+}
+
+// kernel evaluates the interpolation kernel at a distance of x input samples
+func (r *Resampler) kernel(x float64) float64 {
+	u := math.Abs(x) / r.halfWidth
+	if u >= 1 {
+		return 0
+	}
+	pos := u * resampleTableSize
+	i := int(pos)
+	frac := pos - float64(i)
+	return r.table[i] + frac*(r.table[i+1]-r.table[i])
+}
+
+func (r *Resampler) SampleRate() int { return r.outRate }
+
+func (r *Resampler) Channels() int { return 1 }
+
+// fill pulls input until the buffer covers absolute index upTo or the source ends
+func (r *Resampler) fill(upTo int64) error {
+	for !r.eof && r.histStart+int64(len(r.hist)) <= upTo {
+		n, err := r.src.Read(r.readBuf)
+		r.hist = append(r.hist, r.readBuf[:n]...)
+		if errors.Is(err, io.EOF) {
+			r.eof = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Resampler) Read(p []float64) (int, error) {
+	n := 0
+	for n < len(p) {
+		t := float64(r.outIdx) * r.step
+		lo := int64(math.Ceil(t - r.halfWidth))
+		hi := int64(math.Floor(t + r.halfWidth))
+
+		if err := r.fill(hi); err != nil {
+			return n, err
+		}
+
+		end := r.histStart + int64(len(r.hist))
+		if r.eof && t >= float64(end) {
+			break
+		}
+
+		if lo < r.histStart {
+			lo = r.histStart
+		}
+		if hi >= end {
+			hi = end - 1
+		}
+
+		var sum float64
+		for k := lo; k <= hi; k++ {
+			sum += r.hist[k-r.histStart] * r.kernel(t-float64(k))
+		}
+		p[n] = sum
+		n++
+		r.outIdx++
+
+		// Drop input that no future output sample can reach
+		keepFrom := int64(math.Ceil(float64(r.outIdx)*r.step-r.halfWidth)) - 1
+		if drop := keepFrom - r.histStart; drop > resampleReadSize {
+			r.hist = append(r.hist[:0], r.hist[drop:]...)
+			r.histStart += drop
+		}
+	}
+
+	if n == 0 && len(p) > 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// OpenMono decodes r with the built-in decoders, downmixes it to mono and
+// resamples it to sampleRate. It returns ErrUnsupportedFormat if the
+// stream can't be decoded natively.
+func OpenMono(r io.Reader, sampleRate int) (Decoder, Format, error) {
+	dec, format, err := NewDecoder(r)
+	if err != nil {
+		return nil, format, err
+	}
+	out, err := NewResampler(NewMonoReader(dec), sampleRate)
+	if err != nil {
+		return nil, format, err
+	}
+	return out, format, nil
+}
+
+// ResampleSamples converts a buffer of mono samples from inRate to outRate
+func ResampleSamples(samples []float64, inRate, outRate int) ([]float64, error) {
+	if inRate == outRate {
+		return samples, nil
+	}
+	dec, err := NewResampler(&sliceDecoder{samples: samples, rate: inRate}, outRate)
+	if err != nil {
+		return nil, err
+	}
+	return readAllMono(dec)
+}
+
+// sliceDecoder serves mono samples held in memory
+type sliceDecoder struct {
+	samples []float64
+	rate    int
+}
+
+func (d *sliceDecoder) SampleRate() int { return d.rate }
+
+func (d *sliceDecoder) Channels() int { return 1 }
+
+func (d *sliceDecoder) Read(p []float64) (int, error) {
+	if len(d.samples) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, d.samples)
+	d.samples = d.samples[n:]
+	return n, nil
+}
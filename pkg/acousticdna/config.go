@@ -1,11 +1,27 @@
 package acousticdna
 
+import "github.com/himanishpuri/AcousticDNA/pkg/acousticdna/matcher"
+
 type Config struct {
+	// DSN selects the storage backend (see OpenStorage); when empty DBPath
+	// is opened as a SQLite file
+	DSN        string
 	DBPath     string
 	TempDir    string
 	SampleRate int
 	Logger     Logger
 	Storage    Storage
+
+	// Match tunes offset binning and the playback speed search
+	Match matcher.Options
+
+	// Profile selects the fingerprinting parameters. When nil the catalogue's
+	// recorded profile is used, or the default one at SampleRate for a new
+	// catalogue.
+	Profile *FingerprintProfile
+
+	// Observer, if set, receives the statistics of every ingestion and match
+	Observer PipelineObserver
 }
 
 type Option func(*Config)
@@ -16,6 +32,12 @@ func WithDBPath(path string) Option {
 	}
 }
 
+func WithDSN(dsn string) Option {
+	return func(c *Config) {
+		c.DSN = dsn
+	}
+}
+
 func WithTempDir(dir string) Option {
 	return func(c *Config) {
 		c.TempDir = dir
@@ -40,11 +62,35 @@ func WithStorage(storage Storage) Option {
 	}
 }
 
+// WithFingerprintProfile fingerprints with p instead of the catalogue's
+// recorded profile. Adding and matching fail with ErrIncompatibleProfile if
+// the catalogue was built with a different one.
+func WithFingerprintProfile(p FingerprintProfile) Option {
+	return func(c *Config) {
+		c.Profile = &p
+		c.SampleRate = p.SampleRate
+	}
+}
+
+func WithMatchOptions(opts matcher.Options) Option {
+	return func(c *Config) {
+		c.Match = opts
+	}
+}
+
+// WithObserver reports the statistics of every ingestion and match to o
+func WithObserver(o PipelineObserver) Option {
+	return func(c *Config) {
+		c.Observer = o
+	}
+}
+
 func defaultConfig() *Config {
 	return &Config{
 		DBPath:     "acousticdna.sqlite3",
 		TempDir:    "/tmp",
 		SampleRate: 11025,
 		Logger:     nil,
+		Match:      matcher.DefaultOptions(),
 	}
 }
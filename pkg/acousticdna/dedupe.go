@@ -0,0 +1,194 @@
+package acousticdna
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// DuplicateConfig tunes FindDuplicates
+type DuplicateConfig struct {
+	// MinScore is the fewest aligned hashes that link two songs
+	MinScore int
+
+	// MinOverlap is the smallest share of the shorter song that must line up
+	// for two songs to be reported as overlapping, e.g. an edit or excerpt
+	MinOverlap float64
+
+	// IdenticalCoverage is the share of both songs that must line up for
+	// them to count as the same recording. Re-encodes and remasters lose
+	// some hashes, so this is well below 1.
+	IdenticalCoverage float64
+}
+
+type DuplicateOption func(*DuplicateConfig)
+
+func WithDuplicateThresholds(minScore int, minOverlap, identicalCoverage float64) DuplicateOption {
+	return func(c *DuplicateConfig) {
+		c.MinScore = minScore
+		c.MinOverlap = minOverlap
+		c.IdenticalCoverage = identicalCoverage
+	}
+}
+
+func defaultDuplicateConfig() *DuplicateConfig {
+	return &DuplicateConfig{
+		MinScore:          20,
+		MinOverlap:        0.1,
+		IdenticalCoverage: 0.5,
+	}
+}
+
+// catalogueSnapshot holds every fingerprint of a catalogue in memory so a
+// pass that matches each song against all the others reads storage once
+type catalogueSnapshot struct {
+	couples map[uint32][]models.Couple
+	counts  map[string]int
+}
+
+func (c *catalogueSnapshot) GetCouplesByHashes(hashes []uint32) (map[uint32][]models.Couple, error) {
+	found := make(map[uint32][]models.Couple, len(hashes))
+	for _, h := range hashes {
+		if couples, ok := c.couples[h]; ok {
+			found[h] = couples
+		}
+	}
+	return found, nil
+}
+
+func (c *catalogueSnapshot) GetFingerprintCount(songID string) (int, error) {
+	return c.counts[songID], nil
+}
+
+// clusterDuplicates groups identical recordings first, then links those
+// groups by partial overlaps, each group standing in as its keeper, so an
+// edit that overlaps two copies of its original is reported once and the
+// copies can still be merged. Clusters are ordered by their strongest
+// overlap, songs within a cluster by preference as the one to keep.
+func clusterDuplicates(pairs []models.DuplicatePair, songs map[string]models.Song, counts map[string]int) []models.DuplicateCluster {
+	prefer := func(a, b models.Song) bool {
+		ra, rb := metadataRichness(a), metadataRichness(b)
+		if ra != rb {
+			return ra > rb
+		}
+		if counts[a.ID] != counts[b.ID] {
+			return counts[a.ID] > counts[b.ID]
+		}
+		return a.ID < b.ID
+	}
+
+	var identical, partial []models.DuplicatePair
+	for _, p := range pairs {
+		if p.Identical {
+			identical = append(identical, p)
+		} else {
+			partial = append(partial, p)
+		}
+	}
+
+	clusters := connectPairs(identical, songs, prefer, true)
+	keeper := make(map[string]string)
+	for _, c := range clusters {
+		for _, song := range c.Songs {
+			keeper[song.ID] = c.Songs[0].ID
+		}
+	}
+
+	rep := func(id string) string {
+		if k, ok := keeper[id]; ok {
+			return k
+		}
+		return id
+	}
+	best := make(map[[2]string]models.DuplicatePair)
+	var order [][2]string
+	for _, p := range partial {
+		p.SongA, p.SongB = rep(p.SongA), rep(p.SongB)
+		if p.SongA == p.SongB {
+			continue
+		}
+		key := [2]string{p.SongA, p.SongB}
+		if p.SongB < p.SongA {
+			key = [2]string{p.SongB, p.SongA}
+		}
+		prev, ok := best[key]
+		if !ok {
+			order = append(order, key)
+		}
+		if !ok || p.Overlap > prev.Overlap {
+			best[key] = p
+		}
+	}
+	partial = partial[:0]
+	for _, key := range order {
+		partial = append(partial, best[key])
+	}
+	clusters = append(clusters, connectPairs(partial, songs, prefer, false)...)
+
+	sort.SliceStable(clusters, func(i, j int) bool {
+		return clusters[i].Pairs[0].Overlap > clusters[j].Pairs[0].Overlap
+	})
+	return clusters
+}
+
+// connectPairs returns the connected components of pairs
+func connectPairs(pairs []models.DuplicatePair, songs map[string]models.Song, prefer func(a, b models.Song) bool, identical bool) []models.DuplicateCluster {
+	parent := make(map[string]string)
+	var find func(string) string
+	find = func(id string) string {
+		if p, ok := parent[id]; ok && p != id {
+			root := find(p)
+			parent[id] = root
+			return root
+		}
+		parent[id] = id
+		return id
+	}
+	for _, p := range pairs {
+		if a, b := find(p.SongA), find(p.SongB); a != b {
+			parent[b] = a
+		}
+	}
+
+	byRoot := make(map[string]*models.DuplicateCluster)
+	var roots []string
+	for _, p := range pairs {
+		root := find(p.SongA)
+		c, ok := byRoot[root]
+		if !ok {
+			c = &models.DuplicateCluster{Identical: identical}
+			byRoot[root] = c
+			roots = append(roots, root)
+		}
+		c.Pairs = append(c.Pairs, p)
+	}
+	for id := range parent {
+		byRoot[find(id)].Songs = append(byRoot[find(id)].Songs, songs[id])
+	}
+
+	clusters := make([]models.DuplicateCluster, 0, len(roots))
+	for _, root := range roots {
+		c := byRoot[root]
+		sort.Slice(c.Songs, func(i, j int) bool { return prefer(c.Songs[i], c.Songs[j]) })
+		sort.Slice(c.Pairs, func(i, j int) bool { return c.Pairs[i].Overlap > c.Pairs[j].Overlap })
+		clusters = append(clusters, *c)
+	}
+	return clusters
+}
+
+// metadataRichness counts the metadata fields a song has filled in
+func metadataRichness(song models.Song) int {
+	score := 0
+	for _, filled := range []bool{
+		song.Title != "",
+		song.Artist != "" && !strings.EqualFold(song.Artist, "Unknown Artist"),
+		song.YouTubeID != "",
+		song.DurationMs > 0,
+	} {
+		if filled {
+			score++
+		}
+	}
+	return score
+}
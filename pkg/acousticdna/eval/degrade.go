@@ -0,0 +1,322 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+package eval
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"math/cmplx"
+	"math/rand/v2"
+	"time"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/audio"
+	"github.com/mjibson/go-dsp/fft"
+)
+
+// Condition is one way of degrading a query. Every query is a crop of a
+// recording; Length fixes how long, otherwise it is drawn from the
+// configured range. Apply, if not nil, then degrades the crop.
+type Condition struct {
+	Name   string
+	Length time.Duration
+	Apply  func(samples []float64, sampleRate int, rng *rand.Rand) []float64
+}
+
+// DefaultConditions covers each kind of degradation at a few strengths
+func DefaultConditions() []Condition {
+	return []Condition{
+		Clean(),
+		Crop(3 * time.Second),
+		Crop(5 * time.Second),
+		Crop(10 * time.Second),
+		Crop(15 * time.Second),
+		WhiteNoise(20),
+		WhiteNoise(10),
+		WhiteNoise(5),
+		WhiteNoise(0),
+		PinkNoise(10),
+		PinkNoise(0),
+		Gain(-20),
+		Gain(12),
+		LowPass(2000),
+		Telephone(),
+		MP3Like(20),
+		MP3Like(10),
+		Speed(0.98),
+		Speed(1.02),
+		Speed(1.04),
+	}
+}
+
+// Clean queries with undegraded crops of random length
+func Clean() Condition {
+	return Condition{Name: "clean"}
+}
+
+// Crop queries with undegraded crops of length d
+func Crop(d time.Duration) Condition {
+	return Condition{Name: fmt.Sprintf("crop %gs", d.Seconds()), Length: d}
+}
+
+// WhiteNoise adds Gaussian white noise at snrDb below the crop's power
+func WhiteNoise(snrDb float64) Condition {
+	return Condition{
+		Name: fmt.Sprintf("white noise %gdB", snrDb),
+		Apply: func(samples []float64, _ int, rng *rand.Rand) []float64 {
+			noise := make([]float64, len(samples))
+			for i := range noise {
+				noise[i] = rng.NormFloat64()
+			}
+			return addNoise(samples, noise, snrDb)
+		},
+	}
+}
+
+// PinkNoise adds 1/f noise at snrDb below the crop's power. Most of its
+// energy sits in the low bands, like crowd and traffic noise.
+func PinkNoise(snrDb float64) Condition {
+	return Condition{
+		Name: fmt.Sprintf("pink noise %gdB", snrDb),
+		Apply: func(samples []float64, _ int, rng *rand.Rand) []float64 {
+			// Paul Kellet's economy filter, accurate to ±0.5dB above 1/400 of
+			// the sample rate
+			var b0, b1, b2 float64
+			noise := make([]float64, len(samples))
+			for i := range noise {
+				white := rng.NormFloat64()
+				b0 = 0.99765*b0 + white*0.0990460
+				b1 = 0.96300*b1 + white*0.2965164
+				b2 = 0.57000*b2 + white*1.0526913
+				noise[i] = b0 + b1 + b2 + white*0.1848
+			}
+			return addNoise(samples, noise, snrDb)
+		},
+	}
+}
+
+// addNoise scales noise to snrDb below the power of samples and mixes it in.
+// Silence is returned unchanged.
+func addNoise(samples, noise []float64, snrDb float64) []float64 {
+	signal, noisePower := meanPower(samples), meanPower(noise)
+	if signal == 0 || noisePower == 0 {
+		return samples
+	}
+	scale := math.Sqrt(signal / noisePower / math.Pow(10, snrDb/10))
+
+	out := make([]float64, len(samples))
+	for i := range samples {
+		out[i] = samples[i] + scale*noise[i]
+	}
+	return out
+}
+
+func meanPower(samples []float64) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range samples {
+		sum += v * v
+	}
+	return sum / float64(len(samples))
+}
+
+// Gain changes the level by db. Boosts clip at full scale when the query is
+// encoded.
+func Gain(db float64) Condition {
+	return Condition{
+		Name: fmt.Sprintf("gain %+gdB", db),
+		Apply: func(samples []float64, _ int, _ *rand.Rand) []float64 {
+			g := math.Pow(10, db/20)
+			out := make([]float64, len(samples))
+			for i, v := range samples {
+				out[i] = g * v
+			}
+			return out
+		},
+	}
+}
+
+// LowPass removes everything above cutoffHz with a 4th-order Butterworth
+// filter
+func LowPass(cutoffHz float64) Condition {
+	return Condition{
+		Name: fmt.Sprintf("low-pass %gHz", cutoffHz),
+		Apply: func(samples []float64, sampleRate int, _ *rand.Rand) []float64 {
+			return butterworth(samples, sampleRate, cutoffHz, false)
+		},
+	}
+}
+
+// Telephone band-limits the query to the 300-3400Hz voice band
+func Telephone() Condition {
+	return Condition{
+		Name: "telephone",
+		Apply: func(samples []float64, sampleRate int, _ *rand.Rand) []float64 {
+			return butterworth(butterworth(samples, sampleRate, 300, true), sampleRate, 3400, false)
+		},
+	}
+}
+
+// biquad is a second-order IIR section with a0 normalised to 1
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+}
+
+// butterworth runs samples through a 4th-order Butterworth low- or
+// high-pass filter built from two biquads. A cutoff at or above Nyquist
+// leaves samples unchanged.
+func butterworth(samples []float64, sampleRate int, cutoffHz float64, highPass bool) []float64 {
+	if cutoffHz <= 0 || cutoffHz >= float64(sampleRate)/2 {
+		return samples
+	}
+	w0 := 2 * math.Pi * cutoffHz / float64(sampleRate)
+	cos := math.Cos(w0)
+
+	out := samples
+	for _, q := range []float64{0.54119610, 1.3065630} {
+		alpha := math.Sin(w0) / (2 * q)
+		a0 := 1 + alpha
+		var f biquad
+		if highPass {
+			f = biquad{b0: (1 + cos) / 2, b1: -(1 + cos), b2: (1 + cos) / 2}
+		} else {
+			f = biquad{b0: (1 - cos) / 2, b1: 1 - cos, b2: (1 - cos) / 2}
+		}
+		f = biquad{b0: f.b0 / a0, b1: f.b1 / a0, b2: f.b2 / a0, a1: -2 * cos / a0, a2: (1 - alpha) / a0}
+		out = f.filter(out)
+	}
+	return out
+}
+
+func (f biquad) filter(in []float64) []float64 {
+	out := make([]float64, len(in))
+	var x1, x2, y1, y2 float64
+	for i, x := range in {
+		y := f.b0*x + f.b1*x1 + f.b2*x2 - f.a1*y1 - f.a2*y2
+		x2, x1 = x1, x
+		y2, y1 = y1, y
+		out[i] = y
+	}
+	return out
+}
+
+// criticalBands are the upper edges of the ear's critical bands in Hz, the
+// bands a perceptual coder allots its bits over
+var criticalBands = []float64{
+	100, 200, 300, 400, 510, 630, 770, 920, 1080, 1270, 1480, 1720, 2000,
+	2320, 2700, 3150, 3700, 4400, 5300, 6400, 7700, 9500, 12000, 15500,
+}
+
+// starvedBandDb is how far below a frame's loudest band a band may fall
+// before a low-bitrate coder spends no bits on it
+const starvedBandDb = 50
+
+// MP3Like imitates a transform codec. The crop is cut into overlapping
+// ~25ms frames, and the spectrum of each is quantised per critical band
+// with noise bandSNRDb below the band's energy. Bands far below the loudest
+// one are dropped. Lower bandSNRDb stands for a lower bitrate.
+func MP3Like(bandSNRDb float64) Condition {
+	return Condition{
+		Name: fmt.Sprintf("mp3-like %gdB", bandSNRDb),
+		Apply: func(samples []float64, sampleRate int, _ *rand.Rand) []float64 {
+			return quantizeBands(samples, sampleRate, bandSNRDb)
+		},
+	}
+}
+
+func quantizeBands(samples []float64, sampleRate int, bandSNRDb float64) []float64 {
+	n := 1 << bits.Len(uint(sampleRate/40))
+	hop := n / 2
+
+	// Square-root periodic Hann windows on analysis and synthesis overlap-add
+	// to one at 50% overlap
+	window := make([]float64, n)
+	for i := range window {
+		window[i] = math.Sin(math.Pi * float64(i) / float64(n))
+	}
+
+	// Band edges in bins; the last band runs up to Nyquist
+	var edges []int
+	for _, hz := range criticalBands {
+		bin := int(hz * float64(n) / float64(sampleRate))
+		if bin >= n/2 {
+			break
+		}
+		if bin > 0 && (len(edges) == 0 || bin > edges[len(edges)-1]) {
+			edges = append(edges, bin)
+		}
+	}
+	edges = append(edges, n/2+1)
+
+	// Pad by a frame on both sides so every sample is covered by two frames
+	padded := make([]float64, len(samples)+2*n)
+	copy(padded[n:], samples)
+	acc := make([]float64, len(padded))
+	frame := make([]float64, n)
+	energy := make([]float64, len(edges))
+	noiseRatio := math.Pow(10, -bandSNRDb/10)
+
+	for start := 0; start+n <= len(padded); start += hop {
+		for i := range frame {
+			frame[i] = padded[start+i] * window[i]
+		}
+		spec := fft.FFTReal(frame)
+
+		loudest := 0.0
+		lo := 0
+		for b, hi := range edges {
+			var sum float64
+			for k := lo; k < hi; k++ {
+				sum += real(spec[k])*real(spec[k]) + imag(spec[k])*imag(spec[k])
+			}
+			energy[b] = sum / float64(hi-lo)
+			loudest = math.Max(loudest, energy[b])
+			lo = hi
+		}
+
+		lo = 0
+		for b, hi := range edges {
+			// Uniform quantisation of both parts with step Δ adds Δ²/6 of
+			// noise power per bin
+			step := math.Sqrt(6 * energy[b] * noiseRatio)
+			starved := energy[b] < loudest*math.Pow(10, -starvedBandDb/10.0)
+			for k := lo; k < hi; k++ {
+				if starved || step == 0 {
+					spec[k] = 0
+					continue
+				}
+				spec[k] = complex(step*math.Round(real(spec[k])/step), step*math.Round(imag(spec[k])/step))
+			}
+			lo = hi
+		}
+		for k := n/2 + 1; k < n; k++ {
+			spec[k] = cmplx.Conj(spec[n-k])
+		}
+
+		out := fft.IFFT(spec)
+		for i := range out {
+			acc[start+i] += real(out[i]) * window[i]
+		}
+	}
+	return acc[n : n+len(samples)]
+}
+
+// Speed plays the query back ratio times as fast, shifting its pitch by
+// the same factor as a turntable or tape would
+func Speed(ratio float64) Condition {
+	return Condition{
+		Name: fmt.Sprintf("speed %gx", ratio),
+		Apply: func(samples []float64, sampleRate int, _ *rand.Rand) []float64 {
+			// Reading the samples as if recorded at ratio·rate and resampling
+			// back to rate shortens them by ratio
+			out, err := audio.ResampleSamples(samples, int(math.Round(float64(sampleRate)*ratio)), sampleRate)
+			if err != nil {
+				return samples
+			}
+			return out
+		},
+	}
+}
@@ -0,0 +1,218 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+package eval
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+const testRate = 11025
+
+// tone is seconds of a sine at hz with amplitude amp
+func tone(hz, amp, seconds float64) []float64 {
+	out := make([]float64, int(seconds*testRate))
+	for i := range out {
+		out[i] = amp * math.Sin(2*math.Pi*hz*float64(i)/testRate)
+	}
+	return out
+}
+
+func powerDb(samples []float64) float64 {
+	return 10 * math.Log10(meanPower(samples))
+}
+
+// difference is the sample-wise a-b
+func difference(a, b []float64) []float64 {
+	out := make([]float64, len(a))
+	for i := range a {
+		out[i] = a[i] - b[i]
+	}
+	return out
+}
+
+// zeroCrossings counts upward zero crossings, about a tone's frequency times
+// its length
+func zeroCrossings(samples []float64) int {
+	n := 0
+	for i := 1; i < len(samples); i++ {
+		if samples[i-1] < 0 && samples[i] >= 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func testRNG() *rand.Rand { return rand.New(rand.NewPCG(1, 2)) }
+
+func TestGain(t *testing.T) {
+	in := tone(440, 0.5, 1)
+	for _, db := range []float64{-20, 6, 12} {
+		out := Gain(db).Apply(in, testRate, testRNG())
+		if got := powerDb(out) - powerDb(in); math.Abs(got-db) > 1e-9 {
+			t.Errorf("Gain(%g) changed the level by %gdB", db, got)
+		}
+	}
+	if in[100] != 0.5*math.Sin(2*math.Pi*440*100/testRate) {
+		t.Error("Gain modified its input")
+	}
+}
+
+func TestNoiseSNR(t *testing.T) {
+	in := tone(440, 0.5, 2)
+	tests := []struct {
+		cond Condition
+		snr  float64
+	}{
+		{WhiteNoise(20), 20},
+		{WhiteNoise(0), 0},
+		{PinkNoise(10), 10},
+		{PinkNoise(0), 0},
+	}
+	for _, tc := range tests {
+		noise := difference(tc.cond.Apply(in, testRate, testRNG()), in)
+		if got := powerDb(in) - powerDb(noise); math.Abs(got-tc.snr) > 1e-6 {
+			t.Errorf("%s: SNR %gdB", tc.cond.Name, got)
+		}
+	}
+
+	silence := make([]float64, testRate)
+	if out := WhiteNoise(10).Apply(silence, testRate, testRNG()); meanPower(out) != 0 {
+		t.Error("noise added to silence")
+	}
+}
+
+func TestPinkNoiseFallsWithFrequency(t *testing.T) {
+	noise := PinkNoise(0).Apply(tone(440, 0.5, 4), testRate, testRNG())
+	noise = difference(noise, tone(440, 0.5, 4))
+
+	low := butterworth(noise, testRate, 200, false)
+	high := butterworth(noise, testRate, 2000, true)
+	// 1/f noise has as much power per octave; 0-200Hz spans far more octaves
+	// (down to the filter's 1/400 of the rate) than 2000-5512Hz does
+	if powerDb(low) <= powerDb(high) {
+		t.Errorf("pink noise has %.1fdB below 200Hz and %.1fdB above 2kHz", powerDb(low), powerDb(high))
+	}
+	white := difference(WhiteNoise(0).Apply(tone(440, 0.5, 4), testRate, testRNG()), tone(440, 0.5, 4))
+	if powerDb(butterworth(white, testRate, 200, false)) >= powerDb(butterworth(white, testRate, 2000, true)) {
+		t.Error("white noise weighted towards the low band")
+	}
+}
+
+func TestBandLimiting(t *testing.T) {
+	tests := []struct {
+		cond     Condition
+		hz       float64
+		passes   bool
+		describe string
+	}{
+		{LowPass(2000), 500, true, "below the cutoff"},
+		{LowPass(2000), 4000, false, "an octave above the cutoff"},
+		{Telephone(), 1000, true, "in the voice band"},
+		{Telephone(), 100, false, "below the voice band"},
+		{Telephone(), 5000, false, "above the voice band"},
+	}
+	for _, tc := range tests {
+		in := tone(tc.hz, 0.5, 1)
+		out := tc.cond.Apply(in, testRate, testRNG())
+		// Skip the filter's settling time
+		change := powerDb(out[testRate/2:]) - powerDb(in[testRate/2:])
+		if tc.passes && math.Abs(change) > 1 {
+			t.Errorf("%s: %gHz, %s, changed by %.1fdB", tc.cond.Name, tc.hz, tc.describe, change)
+		}
+		if !tc.passes && change > -20 {
+			t.Errorf("%s: %gHz, %s, only down %.1fdB", tc.cond.Name, tc.hz, tc.describe, -change)
+		}
+	}
+}
+
+func TestMP3LikeQuantisationNoise(t *testing.T) {
+	in := make([]float64, 2*testRate)
+	for _, hz := range []float64{220, 660, 1500, 3100} {
+		for i, v := range tone(hz, 0.2, 2) {
+			in[i] += v
+		}
+	}
+	for _, snr := range []float64{20, 10} {
+		out := MP3Like(snr).Apply(in, testRate, testRNG())
+		if len(out) != len(in) {
+			t.Fatalf("MP3Like(%g): %d samples from %d", snr, len(out), len(in))
+		}
+		// Quantisation noise lands around the target; it is never lossless
+		got := powerDb(in) - powerDb(difference(out, in))
+		if got < snr-3 || got > snr+10 {
+			t.Errorf("MP3Like(%g): SNR %.1fdB", snr, got)
+		}
+	}
+}
+
+func TestSpeedResamples(t *testing.T) {
+	in := tone(500, 0.5, 4)
+	for _, ratio := range []float64{0.98, 1.04} {
+		out := Speed(ratio).Apply(in, testRate, testRNG())
+		if want := float64(len(in)) / ratio; math.Abs(float64(len(out))-want) > 2 {
+			t.Errorf("Speed(%g): %d samples, want about %.0f", ratio, len(out), want)
+		}
+		// The same number of cycles in less time is a higher pitch
+		hz := float64(zeroCrossings(out)) / (float64(len(out)) / testRate)
+		if want := 500 * ratio; math.Abs(hz-want) > 1 {
+			t.Errorf("Speed(%g): tone at %.1fHz, want %.1fHz", ratio, hz, want)
+		}
+	}
+}
+
+func TestMakeQueryCrops(t *testing.T) {
+	rec := recording{path: "song.wav", samples: make([]float64, 60*testRate)}
+	for i := range rec.samples {
+		rec.samples[i] = float64(i)
+	}
+	cfg := defaultConfig()
+
+	// A fixed crop is that long, and a contiguous run of the recording
+	for q := 0; q < 5; q++ {
+		query := cfg.makeQuery(Crop(5*time.Second), rec, q, testRate)
+		if len(query) != 5*testRate {
+			t.Fatalf("5s crop has %d samples", len(query))
+		}
+		for i := 1; i < len(query); i++ {
+			if query[i] != query[i-1]+1 {
+				t.Fatalf("crop is not contiguous at %d", i)
+			}
+		}
+	}
+
+	// Random crops fall in the configured range, and differ between queries
+	starts := map[float64]bool{}
+	for q := 0; q < 20; q++ {
+		query := cfg.makeQuery(Clean(), rec, q, testRate)
+		if d := time.Duration(float64(len(query)) / testRate * float64(time.Second)); d < cfg.MinLength-time.Millisecond || d > cfg.MaxLength {
+			t.Errorf("query %d is %s long, outside %s-%s", q, d, cfg.MinLength, cfg.MaxLength)
+		}
+		starts[query[0]] = true
+	}
+	if len(starts) < 15 {
+		t.Errorf("20 queries start at only %d places", len(starts))
+	}
+
+	// The seed alone decides the crop and noise
+	a := cfg.makeQuery(WhiteNoise(10), rec, 3, testRate)
+	b := cfg.makeQuery(WhiteNoise(10), rec, 3, testRate)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatal("the same query came out differently twice")
+		}
+	}
+	cfg.Seed++
+	if c := cfg.makeQuery(WhiteNoise(10), rec, 3, testRate); len(c) == len(a) && c[0] == a[0] {
+		t.Error("another seed gave the same query")
+	}
+
+	// A recording shorter than the crop is queried whole
+	short := recording{path: "short.wav", samples: make([]float64, 2*testRate)}
+	if query := cfg.makeQuery(Crop(10*time.Second), short, 0, testRate); len(query) != len(short.samples) {
+		t.Errorf("10s crop of a 2s recording has %d samples", len(query))
+	}
+}
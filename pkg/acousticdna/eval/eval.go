@@ -0,0 +1,390 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+// Package eval measures how well recordings are recognised once degraded.
+// It catalogues a set of reference recordings in memory, queries them with
+// synthetic crops under each Condition, and reports top-1 accuracy,
+// precision, false positives and latency per condition, so that changes to
+// peak picking or scoring can be compared.
+package eval
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna"
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/audio"
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/storage"
+	"github.com/himanishpuri/AcousticDNA/pkg/logger"
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// Config controls an evaluation run
+type Config struct {
+	Conditions []Condition
+	Queries    int // Queries per recording and condition
+
+	// MinLength and MaxLength bound the crops of conditions without a length
+	MinLength time.Duration
+	MaxLength time.Duration
+
+	// A query is answered when its top result is Matched. If MinConfidence
+	// is positive, a top result with at least that confidence counts as an
+	// answer instead.
+	MinConfidence float64
+
+	// Seed makes the crops and noise reproducible
+	Seed uint64
+
+	// Negatives are recordings left out of the catalogue. They are queried
+	// like the references, and any answer for them is a false positive.
+	Negatives []string
+
+	// ServiceOptions configure the service under test, e.g. its fingerprint
+	// profile or match options. Its storage is always in memory.
+	ServiceOptions []acousticdna.Option
+
+	Progress func(done, total int)
+}
+
+type Option func(*Config)
+
+// WithConditions replaces the default conditions
+func WithConditions(conds ...Condition) Option {
+	return func(c *Config) {
+		c.Conditions = conds
+	}
+}
+
+// WithQueries sets how many queries are made of each recording per condition
+func WithQueries(n int) Option {
+	return func(c *Config) {
+		c.Queries = n
+	}
+}
+
+// WithCropRange sets the range random crop lengths are drawn from
+func WithCropRange(min, max time.Duration) Option {
+	return func(c *Config) {
+		c.MinLength = min
+		c.MaxLength = max
+	}
+}
+
+// WithMinConfidence judges answers by confidence rather than the matcher's decision
+func WithMinConfidence(confidence float64) Option {
+	return func(c *Config) {
+		c.MinConfidence = confidence
+	}
+}
+
+// WithSeed sets the seed for crops and noise
+func WithSeed(seed uint64) Option {
+	return func(c *Config) {
+		c.Seed = seed
+	}
+}
+
+// WithNegatives adds recordings that are queried but not catalogued
+func WithNegatives(paths ...string) Option {
+	return func(c *Config) {
+		c.Negatives = append(c.Negatives, paths...)
+	}
+}
+
+// WithServiceOptions configures the service under test
+func WithServiceOptions(opts ...acousticdna.Option) Option {
+	return func(c *Config) {
+		c.ServiceOptions = append(c.ServiceOptions, opts...)
+	}
+}
+
+// WithProgress is called after every query
+func WithProgress(fn func(done, total int)) Option {
+	return func(c *Config) {
+		c.Progress = fn
+	}
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Conditions: DefaultConditions(),
+		Queries:    3,
+		MinLength:  3 * time.Second,
+		MaxLength:  15 * time.Second,
+		Seed:       1,
+	}
+}
+
+// Report is the outcome of an evaluation run
+type Report struct {
+	Profile    string            `json:"profile"`
+	References int               `json:"references"`
+	Negatives  int               `json:"negatives"`
+	Conditions []ConditionResult `json:"conditions"`
+}
+
+// ConditionResult sums up the queries made under one condition
+type ConditionResult struct {
+	Condition string `json:"condition"`
+
+	Queries int `json:"queries"` // Queries of references
+	Correct int `json:"correct"` // ...answered with the right song
+	Wrong   int `json:"wrong"`   // ...answered with another song
+
+	NegativeQueries int `json:"negative_queries"`
+	FalseAlarms     int `json:"false_alarms"` // Negative queries that got an answer
+
+	// Accuracy is the share of reference queries answered correctly, i.e.
+	// top-1 recall. Precision is the share of answers that were right.
+	// FalsePositiveRate is the share of all queries answered wrongly.
+	Accuracy          float64 `json:"accuracy"`
+	Precision         float64 `json:"precision"`
+	FalsePositiveRate float64 `json:"false_positive_rate"`
+
+	Latency Latency `json:"latency"`
+}
+
+// Latency summarises how long queries took to match, in milliseconds
+type Latency struct {
+	MeanMs float64 `json:"mean_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P95Ms  float64 `json:"p95_ms"`
+	MaxMs  float64 `json:"max_ms"`
+}
+
+// recording is a decoded reference or negative
+type recording struct {
+	path    string
+	songID  string // Empty for negatives
+	samples []float64
+}
+
+// Run catalogues the references in a fresh in-memory service and queries it
+// under every condition. Queries are made one at a time so that latencies
+// are not skewed by each other.
+func Run(ctx context.Context, references []string, opts ...Option) (*Report, error) {
+	cfg := defaultConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	switch {
+	case len(references) == 0:
+		return nil, errors.New("no reference recordings")
+	case len(cfg.Conditions) == 0:
+		return nil, errors.New("no conditions")
+	case cfg.Queries < 1:
+		return nil, errors.New("queries per recording must be positive")
+	case cfg.MinLength <= 0 || cfg.MaxLength < cfg.MinLength:
+		return nil, fmt.Errorf("invalid crop range %s-%s", cfg.MinLength, cfg.MaxLength)
+	}
+
+	// The service logs every match; only its warnings are of interest here
+	logCfg := logger.DefaultConfig()
+	logCfg.Level = logger.WARN
+	svcOpts := append([]acousticdna.Option{acousticdna.WithLogger(logger.New(logCfg))}, cfg.ServiceOptions...)
+	svc, err := acousticdna.NewService(append(svcOpts, acousticdna.WithStorage(storage.NewMemoryStore()))...)
+	if err != nil {
+		return nil, err
+	}
+	defer svc.Close()
+	rate := svc.Profile().SampleRate
+
+	var recordings []recording
+	for _, path := range references {
+		rec, err := loadRecording(path, rate)
+		if err != nil {
+			return nil, err
+		}
+		wav, err := encode(rec.samples, rate)
+		if err != nil {
+			return nil, err
+		}
+		if rec.songID, err = svc.AddSongReader(ctx, wav, path, "", ""); err != nil {
+			return nil, fmt.Errorf("cataloguing %s: %w", path, err)
+		}
+		recordings = append(recordings, rec)
+	}
+	for _, path := range cfg.Negatives {
+		rec, err := loadRecording(path, rate)
+		if err != nil {
+			return nil, err
+		}
+		recordings = append(recordings, rec)
+	}
+
+	report := &Report{
+		Profile:    svc.Profile().ID(),
+		References: len(references),
+		Negatives:  len(cfg.Negatives),
+	}
+	done, total := 0, len(cfg.Conditions)*len(recordings)*cfg.Queries
+	for _, cond := range cfg.Conditions {
+		res := ConditionResult{Condition: cond.Name}
+		var latencies []time.Duration
+
+		for _, rec := range recordings {
+			for q := 0; q < cfg.Queries; q++ {
+				query := cfg.makeQuery(cond, rec, q, rate)
+				wav, err := encode(query, rate)
+				if err != nil {
+					return nil, err
+				}
+
+				start := time.Now()
+				matches, err := svc.MatchReader(ctx, wav)
+				if err != nil {
+					return nil, fmt.Errorf("%s: querying %s: %w", cond.Name, rec.path, err)
+				}
+				latencies = append(latencies, time.Since(start))
+
+				answer := ""
+				if len(matches) > 0 && cfg.answered(matches[0]) {
+					answer = matches[0].SongID
+				}
+				res.add(rec.songID, answer)
+
+				done++
+				if cfg.Progress != nil {
+					cfg.Progress(done, total)
+				}
+			}
+		}
+
+		res.finish(latencies)
+		report.Conditions = append(report.Conditions, res)
+	}
+	return report, nil
+}
+
+// add counts a query for the song want (empty for a negative) that was
+// answered with the song answer (empty for no answer)
+func (res *ConditionResult) add(want, answer string) {
+	if want == "" {
+		res.NegativeQueries++
+		if answer != "" {
+			res.FalseAlarms++
+		}
+		return
+	}
+	res.Queries++
+	switch answer {
+	case "":
+	case want:
+		res.Correct++
+	default:
+		res.Wrong++
+	}
+}
+
+// finish works out the rates from the counts, and the latency summary
+func (res *ConditionResult) finish(latencies []time.Duration) {
+	if res.Queries > 0 {
+		res.Accuracy = float64(res.Correct) / float64(res.Queries)
+	}
+	if answers := res.Correct + res.Wrong + res.FalseAlarms; answers > 0 {
+		res.Precision = float64(res.Correct) / float64(answers)
+	}
+	if n := res.Queries + res.NegativeQueries; n > 0 {
+		res.FalsePositiveRate = float64(res.Wrong+res.FalseAlarms) / float64(n)
+	}
+	res.Latency = summarise(latencies)
+}
+
+// answered reports whether top counts as an answer to its query
+func (cfg *Config) answered(top models.MatchResult) bool {
+	if cfg.MinConfidence > 0 {
+		return top.Confidence >= cfg.MinConfidence
+	}
+	return top.Matched
+}
+
+// loadRecording decodes path to mono samples at rate
+func loadRecording(path string, rate int) (recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return recording{}, err
+	}
+	defer f.Close()
+
+	dec, _, err := audio.OpenMono(f, rate)
+	if err != nil {
+		return recording{}, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	var samples []float64
+	buf := make([]float64, 8192)
+	for {
+		n, err := dec.Read(buf)
+		samples = append(samples, buf[:n]...)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return recording{}, fmt.Errorf("decoding %s: %w", path, err)
+		}
+	}
+	return recording{path: path, samples: samples}, nil
+}
+
+// makeQuery crops the q-th query of rec under cond and degrades it. The
+// random choices depend only on the seed, the condition, the recording and
+// q, so results are comparable between runs with different settings.
+func (cfg *Config) makeQuery(cond Condition, rec recording, q, rate int) []float64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00%s\x00%d", cond.Name, rec.path, q)
+	rng := rand.New(rand.NewPCG(cfg.Seed, h.Sum64()))
+
+	length := cond.Length
+	if length == 0 {
+		length = cfg.MinLength + time.Duration(rng.Int64N(int64(cfg.MaxLength-cfg.MinLength)+1))
+	}
+	n := int(length.Seconds() * float64(rate))
+	query := rec.samples
+	if n < len(query) {
+		start := rng.IntN(len(query) - n + 1)
+		query = query[start : start+n]
+	}
+
+	if cond.Apply != nil {
+		query = cond.Apply(query, rate, rng)
+	}
+	return query
+}
+
+func encode(samples []float64, rate int) (*bytes.Reader, error) {
+	var buf bytes.Buffer
+	if err := audio.EncodeWAV(&buf, samples, rate); err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(buf.Bytes()), nil
+}
+
+func summarise(latencies []time.Duration) Latency {
+	if len(latencies) == 0 {
+		return Latency{}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	var sum time.Duration
+	for _, d := range latencies {
+		sum += d
+	}
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	percentile := func(p float64) time.Duration {
+		return latencies[int(p*float64(len(latencies)-1)+0.5)]
+	}
+	return Latency{
+		MeanMs: ms(sum / time.Duration(len(latencies))),
+		P50Ms:  ms(percentile(0.50)),
+		P95Ms:  ms(percentile(0.95)),
+		MaxMs:  ms(latencies[len(latencies)-1]),
+	}
+}
@@ -0,0 +1,146 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+package eval
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConditionResultRates(t *testing.T) {
+	var res ConditionResult
+	// 10 reference queries: 6 right, 2 wrong, 2 unanswered
+	for i := 0; i < 6; i++ {
+		res.add("song-a", "song-a")
+	}
+	res.add("song-a", "song-b")
+	res.add("song-b", "song-a")
+	res.add("song-b", "")
+	res.add("song-b", "")
+	// 5 negative queries, 2 of them answered
+	res.add("", "song-a")
+	res.add("", "song-b")
+	for i := 0; i < 3; i++ {
+		res.add("", "")
+	}
+	res.finish(nil)
+
+	if res.Queries != 10 || res.Correct != 6 || res.Wrong != 2 || res.NegativeQueries != 5 || res.FalseAlarms != 2 {
+		t.Fatalf("counts %+v", res)
+	}
+	if res.Accuracy != 0.6 {
+		t.Errorf("accuracy (recall) %g, want 6/10", res.Accuracy)
+	}
+	if res.Precision != 0.6 {
+		t.Errorf("precision %g, want 6 right of 10 answers", res.Precision)
+	}
+	if want := 4.0 / 15; res.FalsePositiveRate != want {
+		t.Errorf("false-positive rate %g, want %g", res.FalsePositiveRate, want)
+	}
+}
+
+func TestConditionResultRatesWithoutAnswers(t *testing.T) {
+	var res ConditionResult
+	res.add("song-a", "")
+	res.add("", "")
+	res.finish(nil)
+	if res.Accuracy != 0 || res.Precision != 0 || res.FalsePositiveRate != 0 {
+		t.Errorf("rates %g, %g, %g with no answers; want zeros", res.Accuracy, res.Precision, res.FalsePositiveRate)
+	}
+
+	var empty ConditionResult
+	empty.finish(nil)
+	if empty.Accuracy != 0 || empty.Precision != 0 || empty.FalsePositiveRate != 0 {
+		t.Errorf("rates of no queries %+v", empty)
+	}
+}
+
+func TestSummariseLatency(t *testing.T) {
+	var latencies []time.Duration
+	for i := 20; i >= 1; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	got := summarise(latencies)
+	want := Latency{MeanMs: 10.5, P50Ms: 11, P95Ms: 19, MaxMs: 20}
+	if got != want {
+		t.Errorf("summarise = %+v, want %+v", got, want)
+	}
+	if (summarise(nil) != Latency{}) {
+		t.Error("latency of no queries is not zero")
+	}
+}
+
+func TestRunRejectsBadConfig(t *testing.T) {
+	ctx := context.Background()
+	refs := []string{"song.wav"}
+	tests := map[string]struct {
+		refs []string
+		opts []Option
+	}{
+		"no references": {nil, nil},
+		"no conditions": {refs, []Option{WithConditions()}},
+		"no queries":    {refs, []Option{WithQueries(0)}},
+		"crop range":    {refs, []Option{WithCropRange(5*time.Second, 3*time.Second)}},
+	}
+	for name, tc := range tests {
+		if _, err := Run(ctx, tc.refs, tc.opts...); err == nil {
+			t.Errorf("%s: Run succeeded", name)
+		}
+	}
+}
+
+func TestRunOverCroppedFixtures(t *testing.T) {
+	fixtures, err := filepath.Glob("../../../test/testCroppedAudio/*.wav")
+	if err != nil || len(fixtures) < 2 {
+		t.Fatalf("fixtures: %v, %v", fixtures, err)
+	}
+
+	// Each fixture in turn is the catalogue; the others are negatives
+	for _, ref := range fixtures {
+		var negatives []string
+		for _, f := range fixtures {
+			if f != ref {
+				negatives = append(negatives, f)
+			}
+		}
+		progress := 0
+		report, err := Run(context.Background(), []string{ref},
+			WithConditions(Clean(), Gain(-20), WhiteNoise(20)),
+			WithQueries(2),
+			WithCropRange(5*time.Second, 8*time.Second),
+			WithNegatives(negatives...),
+			WithProgress(func(done, total int) { progress = done }),
+		)
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+
+		name := filepath.Base(ref)
+		if report.References != 1 || report.Negatives != len(negatives) || report.Profile == "" {
+			t.Errorf("%s: report header %+v", name, report)
+		}
+		if want := 3 * (1 + len(negatives)) * 2; progress != want {
+			t.Errorf("%s: progress reached %d of %d queries", name, progress, want)
+		}
+		if len(report.Conditions) != 3 {
+			t.Fatalf("%s: %d condition results, want 3", name, len(report.Conditions))
+		}
+		for _, res := range report.Conditions {
+			if res.Queries != 2 || res.NegativeQueries != 2*len(negatives) {
+				t.Errorf("%s, %s: %d reference and %d negative queries", name, res.Condition, res.Queries, res.NegativeQueries)
+			}
+			// Mild degradations of a catalogued recording must be found,
+			// and nothing else matched
+			if res.Accuracy != 1 || res.Precision != 1 || res.FalsePositiveRate != 0 {
+				t.Errorf("%s, %s: accuracy %g, precision %g, false positives %g",
+					name, res.Condition, res.Accuracy, res.Precision, res.FalsePositiveRate)
+			}
+			if res.Latency.MaxMs <= 0 || res.Latency.P50Ms > res.Latency.MaxMs {
+				t.Errorf("%s, %s: latency %+v", name, res.Condition, res.Latency)
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package fingerprint
+
+import (
+	"math"
+	"sort"
+)
+
+// tilePicker picks peaks to a target density. A bin is a candidate when no
+// bin within PeakFreqNeighbour bins and PeakTimeNeighbour frames is louder,
+// and each band keeps only its strongest candidates per PeakTileMs tile, so
+// dense and sparse recordings end up with about as many peaks per second.
+//
+// Frames are pushed in order and a tile is picked as soon as every frame its
+// neighbourhood reaches into is known, which keeps the streaming
+// Fingerprinter in step with ExtractPeaks.
+type tilePicker struct {
+	profile    Profile
+	bands      [][]int
+	tileFrames int
+	quota      int // Peaks kept per band and tile
+	emit       PeakFunc
+
+	frames   [][]float64 // Spectra from time index base on
+	admitted []bool      // ...and whether the gate let them through
+	base     int
+	next     int // Time index of the next tile to pick
+}
+
+// newTilePicker keeps density peaks per second in each band and passes
+// them to emit in time order
+func (p Profile) newTilePicker(density float64, emit PeakFunc) *tilePicker {
+	tileFrames := max(1, int(math.Round(float64(p.PeakTileMs)/1000/p.frameTime())))
+	return &tilePicker{
+		profile:    p,
+		bands:      peakBands(p.WindowSize / 2),
+		tileFrames: tileFrames,
+		quota:      max(1, int(math.Round(density*float64(tileFrames)*p.frameTime()))),
+		emit:       emit,
+	}
+}
+
+// push adds the next frame; admitted is false if the gate rejected it
+func (tp *tilePicker) push(frame []float64, admitted bool) {
+	tp.frames = append(tp.frames, frame)
+	tp.admitted = append(tp.admitted, admitted)
+
+	last := tp.base + len(tp.frames) - 1
+	for last >= tp.next+tp.tileFrames-1+tp.profile.PeakTimeNeighbour {
+		tp.pick(tp.next + tp.tileFrames)
+	}
+}
+
+// flush picks the frames left once the input has ended
+func (tp *tilePicker) flush() {
+	end := tp.base + len(tp.frames)
+	for tp.next < end {
+		tp.pick(min(tp.next+tp.tileFrames, end))
+	}
+}
+
+// pick picks the tile of frames from next up to end, then drops the frames
+// no later tile reaches
+func (tp *tilePicker) pick(end int) {
+	rt := tp.profile.PeakTimeNeighbour
+	freqRes, frameTime := tp.profile.freqRes(), tp.profile.frameTime()
+	known := tp.base + len(tp.frames)
+
+	neighbours := make([][]float64, 2*rt+1)
+	perBand := make([][]Peak, len(tp.bands))
+	for t := tp.next; t < end; t++ {
+		if !tp.admitted[t-tp.base] {
+			continue
+		}
+		for dt := -rt; dt <= rt; dt++ {
+			neighbours[dt+rt] = nil
+			if i := t + dt; i >= tp.base && i < known {
+				neighbours[dt+rt] = tp.frames[i-tp.base]
+			}
+		}
+
+		frame := tp.frames[t-tp.base]
+		for b, band := range tp.bands {
+			for bin := band[0]; bin < min(band[1], len(frame)); bin++ {
+				mag := frame[bin]
+				if mag <= 0 || !isLocalMax(neighbours, rt, bin, mag, tp.profile.PeakFreqNeighbour) {
+					continue
+				}
+				perBand[b] = append(perBand[b], Peak{
+					TimeIdx: t,
+					FreqIdx: bin,
+					Time:    float64(t) * frameTime,
+					Freq:    float64(bin) * freqRes,
+					MagDB:   20.0 * math.Log10(mag+eps),
+				})
+			}
+		}
+	}
+
+	var kept []Peak
+	for _, cands := range perBand {
+		sort.SliceStable(cands, func(i, j int) bool { return cands[i].MagDB > cands[j].MagDB })
+		kept = append(kept, cands[:min(len(cands), tp.quota)]...)
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		if kept[i].TimeIdx == kept[j].TimeIdx {
+			return kept[i].FreqIdx < kept[j].FreqIdx
+		}
+		return kept[i].TimeIdx < kept[j].TimeIdx
+	})
+	for _, p := range kept {
+		tp.emit(p)
+	}
+
+	tp.next = end
+	if drop := end - rt - tp.base; drop > 0 {
+		drop = min(drop, len(tp.frames))
+		tp.frames = append(tp.frames[:0], tp.frames[drop:]...)
+		tp.admitted = append(tp.admitted[:0], tp.admitted[drop:]...)
+		tp.base += drop
+	}
+}
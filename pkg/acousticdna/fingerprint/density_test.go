@@ -0,0 +1,175 @@
+package fingerprint
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// bandOf is the index of the peak band holding bin
+func bandOf(bands [][]int, bin int) int {
+	for b, band := range bands {
+		if bin >= band[0] && bin < band[1] {
+			return b
+		}
+	}
+	return -1
+}
+
+// sortedHashes flattens hashes and their anchor times into a sorted list
+func sortedHashes(fp map[uint32][]uint32) []uint64 {
+	var out []uint64
+	for hash, anchors := range fp {
+		for _, ms := range anchors {
+			out = append(out, uint64(hash)<<32|uint64(ms))
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// streamed runs the streaming fingerprinter made by newFP over signal
+func streamed(newFP func(HashFunc) *Fingerprinter, signal []float64) ([]Peak, []uint64) {
+	var peaks []Peak
+	fp := map[uint32][]uint32{}
+	f := newFP(func(hash, anchorTimeMs uint32) { fp[hash] = append(fp[hash], anchorTimeMs) })
+	f.OnPeak = func(p Peak) { peaks = append(peaks, p) }
+	f.Write(signal)
+	f.Flush()
+	return peaks, sortedHashes(fp)
+}
+
+// batchHashes is what Fingerprint makes of peaks, in sortedHashes form
+func batchHashes(p Profile, peaks []Peak) []uint64 {
+	fp := map[uint32][]uint32{}
+	for hash, couples := range p.Fingerprint(slices.Clone(peaks), "") {
+		for _, c := range couples {
+			fp[hash] = append(fp[hash], c.AnchorTimeMs)
+		}
+	}
+	return sortedHashes(fp)
+}
+
+func TestDensityMeetsTarget(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	p := DefaultProfile()
+
+	// Six seconds of three chord sequences at once, then six more 30dB
+	// quieter, which should get as many peaks
+	const seconds = 12
+	var signal []float64
+	for _, amp := range []float64{0.1, 0.003} {
+		layers := make([]float64, seconds/2*p.SampleRate)
+		for range 3 {
+			for i, x := range music(rng, p.SampleRate, seconds/2, amp) {
+				layers[i] += x
+			}
+		}
+		signal = append(signal, layers...)
+	}
+	spec, err := p.Spectrogram(signal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bands := peakBands(p.WindowSize / 2)
+	for _, tc := range []struct {
+		name    string
+		density float64
+		peaks   []Peak
+	}{
+		{"reference", p.PeakDensity, p.ExtractPeaks(spec)},
+		{"query", p.QueryPeakDensity, p.ExtractQueryPeaks(spec)},
+	} {
+		tileFrames := p.newTilePicker(tc.density, nil).tileFrames
+		quota := int(math.Round(tc.density * float64(p.PeakTileMs) / 1000))
+		tiles := (len(spec) + tileFrames - 1) / tileFrames
+		perTile := make([][]int, len(bands))
+		for b := range perTile {
+			perTile[b] = make([]int, tiles)
+		}
+		loud, quiet := 0, 0
+		for _, pk := range tc.peaks {
+			perTile[bandOf(bands, pk.FreqIdx)][pk.TimeIdx/tileFrames]++
+			if pk.Time < seconds/2 {
+				loud++
+			} else {
+				quiet++
+			}
+		}
+
+		// No band and tile goes over its quota, and the bands the chords
+		// reach, from about 100Hz up, come close to it throughout
+		for b, counts := range perTile {
+			total := 0
+			for tile, n := range counts {
+				if n > quota {
+					t.Errorf("%s: %d peaks in band %v, tile %d; quota %d", tc.name, n, bands[b], tile, quota)
+				}
+				total += n
+			}
+			perSecond := float64(total) / seconds
+			if b > 0 && perSecond < 0.9*tc.density {
+				t.Errorf("%s: %.2f peaks/s in band %v, want about %g", tc.name, perSecond, bands[b], tc.density)
+			}
+		}
+		if quiet < loud*4/5 || quiet > loud*5/4 {
+			t.Errorf("%s: %d peaks in loud music, %d in quiet", tc.name, loud, quiet)
+		}
+
+		// The streaming fingerprinter picks the same peaks
+		newFP := p.NewFingerprinter
+		if tc.name == "query" {
+			newFP = p.NewQueryFingerprinter
+		}
+		peaks, hashes := streamed(newFP, signal)
+		if !slices.Equal(peaks, tc.peaks) {
+			t.Errorf("%s: %d peaks streamed, %d extracted", tc.name, len(peaks), len(tc.peaks))
+		}
+		if want := batchHashes(p, tc.peaks); !slices.Equal(hashes, want) {
+			t.Errorf("%s: %d hashes streamed, %d from the extracted peaks", tc.name, len(hashes), len(want))
+		}
+	}
+}
+
+func TestLegacyProfileUnchanged(t *testing.T) {
+	// Catalogues at default@1 must keep matching, so its peaks and hashes
+	// are pinned to what the fingerprinter made before gating and density
+	// control: 297 peaks and 1759 hashes over this signal
+	rng := rand.New(rand.NewPCG(1, 2))
+	p := LegacyProfile()
+	signal := music(rng, p.SampleRate, 10, 0.1)
+	spec, err := p.Spectrogram(signal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peaks := p.ExtractPeaks(spec)
+	if q := p.ExtractQueryPeaks(spec); !slices.Equal(q, peaks) {
+		t.Errorf("%d query peaks, %d reference peaks", len(q), len(peaks))
+	}
+
+	h := fnv.New64a()
+	for _, pk := range peaks {
+		h.Write(binary.LittleEndian.AppendUint32(binary.LittleEndian.AppendUint32(nil, uint32(pk.TimeIdx)), uint32(pk.FreqIdx)))
+	}
+	if len(peaks) != 297 || h.Sum64() != 0xba0b76f5e75d795c {
+		t.Errorf("%d peaks, digest %#x; want 297, 0xba0b76f5e75d795c", len(peaks), h.Sum64())
+	}
+
+	hashes := batchHashes(p, peaks)
+	h.Reset()
+	for _, hash := range hashes {
+		h.Write(binary.LittleEndian.AppendUint32(binary.LittleEndian.AppendUint32(nil, uint32(hash>>32)), uint32(hash)))
+	}
+	if len(hashes) != 1759 || h.Sum64() != 0x3b1376eb0d672c84 {
+		t.Errorf("%d hashes, digest %#x; want 1759, 0x3b1376eb0d672c84", len(hashes), h.Sum64())
+	}
+
+	streamedPeaks, streamedHashes := streamed(p.NewQueryFingerprinter, signal)
+	if !slices.Equal(streamedPeaks, peaks) || !slices.Equal(streamedHashes, hashes) {
+		t.Errorf("streamed %d peaks and %d hashes, want %d and %d", len(streamedPeaks), len(streamedHashes), len(peaks), len(hashes))
+	}
+}
@@ -0,0 +1,72 @@
+package fingerprint
+
+import "math"
+
+// GateStats counts the frames whose peaks were suppressed before hashing.
+// Peaks in such frames stand out only from silence or noise, and their
+// hashes would match everything.
+type GateStats struct {
+	ZeroFrames   int // Digital silence
+	SilentFrames int // Quieter than the profile's SilenceDb
+	NoisyFrames  int // Spectrally flatter than the profile's MaxFlatness
+}
+
+// Skipped returns the number of suppressed frames
+func (g GateStats) Skipped() int {
+	return g.ZeroFrames + g.SilentFrames + g.NoisyFrames
+}
+
+// frameGate decides per frame, from its magnitude spectrum alone, whether
+// peak picking runs on it
+type frameGate struct {
+	minPower    float64 // Spectral power of a frame at SilenceDb
+	maxFlatness float64
+}
+
+func (p Profile) newGate() frameGate {
+	g := frameGate{maxFlatness: p.MaxFlatness}
+	if p.SilenceDb < 0 {
+		// By Parseval, a frame of mean square level L has half-spectrum
+		// power L·N·Σw²/2 through the window w
+		var windowPower float64
+		for _, w := range Hamming(p.WindowSize) {
+			windowPower += w * w
+		}
+		g.minPower = math.Pow(10, p.SilenceDb/10) * float64(p.WindowSize) * windowPower / 2
+	}
+	return g
+}
+
+// admit reports whether peaks may be picked in frame, and counts it in
+// stats if not
+func (g frameGate) admit(frame []float64, stats *GateStats) bool {
+	if len(frame) < 2 {
+		return true
+	}
+
+	// The DC bin says nothing about the sound and would skew the flatness
+	var power, logSum float64
+	zero := true
+	for _, m := range frame[1:] {
+		power += m * m
+		logSum += math.Log(m*m + eps)
+		zero = zero && m == 0
+	}
+	n := float64(len(frame) - 1)
+
+	switch {
+	case zero && frame[0] == 0:
+		stats.ZeroFrames++
+		return false
+	case power < g.minPower:
+		stats.SilentFrames++
+		return false
+	case g.maxFlatness > 0 && math.Exp(logSum/n)/(power/n) > g.maxFlatness:
+		// Spectral flatness, the geometric over the arithmetic mean of the
+		// power spectrum, is near 0.56 for white noise and far lower for
+		// tones and music
+		stats.NoisyFrames++
+		return false
+	}
+	return true
+}
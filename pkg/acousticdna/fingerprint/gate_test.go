@@ -0,0 +1,114 @@
+package fingerprint
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+// music is seconds of chords at rate: four random partials between 100Hz
+// and 4kHz, changing every quarter second, at an RMS level of about amp
+func music(rng *rand.Rand, rate int, seconds, amp float64) []float64 {
+	out := make([]float64, int(seconds*float64(rate)))
+	chordLen := rate / 4
+	var freqs [4]float64
+	for i := range out {
+		if i%chordLen == 0 {
+			for k := range freqs {
+				freqs[k] = 100 * math.Pow(40, rng.Float64())
+			}
+		}
+		for _, f := range freqs {
+			out[i] += amp / math.Sqrt2 * math.Sin(2*math.Pi*f*float64(i)/float64(rate))
+		}
+	}
+	return out
+}
+
+// whiteNoise is seconds of uniform noise at an RMS level of amp
+func whiteNoise(rng *rand.Rand, rate int, seconds, amp float64) []float64 {
+	out := make([]float64, int(seconds*float64(rate)))
+	for i := range out {
+		out[i] = amp * math.Sqrt(3) * (2*rng.Float64() - 1)
+	}
+	return out
+}
+
+// peaksBetween counts the peaks in [from, to) seconds
+func peaksBetween(peaks []Peak, from, to float64) int {
+	n := 0
+	for _, p := range peaks {
+		if p.Time >= from && p.Time < to {
+			n++
+		}
+	}
+	return n
+}
+
+func TestGateSkipsSilenceAndNoise(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	p := DefaultProfile()
+	rate := p.SampleRate
+
+	// Two seconds each of music, digital silence, music at -90dBFS, white
+	// noise and music again
+	var signal []float64
+	signal = append(signal, music(rng, rate, 2, 0.1)...)
+	signal = append(signal, make([]float64, 2*rate)...)
+	signal = append(signal, music(rng, rate, 2, 3e-5)...)
+	signal = append(signal, whiteNoise(rng, rate, 2, 0.1)...)
+	signal = append(signal, music(rng, rate, 2, 0.1)...)
+
+	threshold := p
+	threshold.PeakDensity, threshold.QueryPeakDensity = 0, 0
+	for name, prof := range map[string]Profile{"density": p, "threshold": threshold} {
+		spec, err := prof.Spectrogram(signal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		peaks := prof.ExtractPeaks(spec)
+		// Frames straddling a boundary hear both sides, so leave a window's
+		// length either side of each out
+		margin := float64(p.WindowSize) / float64(rate)
+		for _, seg := range []struct {
+			name  string
+			from  float64
+			gated bool
+		}{
+			{"music", 0, false},
+			{"silence", 2, true},
+			{"quiet music", 4, true},
+			{"noise", 6, true},
+			{"music again", 8, false},
+		} {
+			n := peaksBetween(peaks, seg.from+margin, seg.from+2-margin)
+			if seg.gated && n > 0 {
+				t.Errorf("%s: %d peaks in %s", name, n, seg.name)
+			}
+			if !seg.gated && n < 5 {
+				t.Errorf("%s: only %d peaks in %s", name, n, seg.name)
+			}
+		}
+	}
+
+	// Without gating, as in the legacy profile, quiet music and noise get
+	// peaks like any other sound
+	legacy := LegacyProfile()
+	spec, _ := legacy.Spectrogram(signal)
+	peaks := legacy.ExtractPeaks(spec)
+	if n := peaksBetween(peaks, 4.1, 5.9); n < 5 {
+		t.Errorf("legacy profile: only %d peaks in quiet music", n)
+	}
+	if n := peaksBetween(peaks, 6.1, 7.9); n < 5 {
+		t.Errorf("legacy profile: only %d peaks in noise", n)
+	}
+
+	// The streaming fingerprinter counts what it skipped
+	f := p.NewFingerprinter(nil)
+	f.Write(signal)
+	gated := f.Flush().Gated
+	secondFrames := rate / p.HopSize
+	if gated.ZeroFrames < secondFrames || gated.SilentFrames < secondFrames || gated.NoisyFrames < secondFrames {
+		t.Errorf("gated frames %+v, want at least %d of each", gated, secondFrames)
+	}
+}
@@ -4,19 +4,27 @@ import (
 	"math"
 	"sort"
 
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/matcher"
 	"github.com/himanishpuri/AcousticDNA/pkg/models"
 )
 
+// Fingerprint hashes peaks with DefaultProfile
 func Fingerprint(peaks []Peak, songID string) map[uint32][]models.Couple {
+	return DefaultProfile().Fingerprint(peaks, songID)
+}
+
+// Fingerprint pairs each peak with up to FanOut later peaks and returns the
+// resulting hashes, each with the anchor time and songID
+func (p Profile) Fingerprint(peaks []Peak, songID string) map[uint32][]models.Couple {
 	sort.Slice(peaks, func(i, j int) bool { return peaks[i].Time < peaks[j].Time })
 
 	fp := make(map[uint32][]models.Couple)
 	for i := 0; i < len(peaks); i++ {
 		anchor := peaks[i]
 		paired := 0
-		for j := i + 1; j < len(peaks) && paired < FanOut; j++ {
+		for j := i + 1; j < len(peaks) && paired < p.FanOut; j++ {
 			target := peaks[j]
-			addr, ok := createAddress(anchor, target)
+			addr, ok := p.address(anchor, target)
 			if !ok {
 				continue
 			}
@@ -35,49 +43,11 @@ func MergeFingerprints(dst map[uint32][]models.Couple, src map[uint32][]models.C
 }
 
 func QueryFingerprints(queryPeaks []Peak, db map[uint32][]models.Couple) []models.Match {
-	sort.Slice(queryPeaks, func(i, j int) bool { return queryPeaks[i].Time < queryPeaks[j].Time })
-
-	votes := make(map[string]map[int32]int)
-
-	for i := 0; i < len(queryPeaks); i++ {
-		anchor := queryPeaks[i]
-		paired := 0
-		for j := i + 1; j < len(queryPeaks) && paired < FanOut; j++ {
-			target := queryPeaks[j]
-			addr, ok := createAddress(anchor, target)
-			if !ok {
-				continue
-			}
-			paired++
-			if bucket, ok := db[addr]; ok {
-				for _, cou := range bucket {
-					offset := int32(cou.AnchorTimeMs) - int32(math.Round(anchor.Time*1000.0))
-					m, ok := votes[cou.SongID]
-					if !ok {
-						m = make(map[int32]int)
-						votes[cou.SongID] = m
-					}
-					m[offset]++
-				}
-			}
-		}
-	}
-
-	matches := make([]models.Match, 0)
-	for songID, offsets := range votes {
-		bestOffset := int32(0)
-		bestCount := 0
-		for off, cnt := range offsets {
-			if cnt > bestCount {
-				bestCount = cnt
-				bestOffset = off
-			}
-		}
-		if bestCount > 0 {
-			matches = append(matches, models.Match{SongID: songID, OffsetMs: bestOffset, Count: bestCount})
-		}
-	}
+	return QueryHashes(Fingerprint(queryPeaks, ""), db)
+}
 
-	sort.Slice(matches, func(i, j int) bool { return matches[i].Count > matches[j].Count })
-	return matches
+// QueryHashes aligns pre-computed query hashes against db with the default
+// matcher options and returns the best alignment per song, strongest first.
+func QueryHashes(query map[uint32][]models.Couple, db map[uint32][]models.Couple) []models.Match {
+	return matcher.Match(matcher.FromCouples(query), db, matcher.DefaultOptions())
 }
@@ -4,6 +4,7 @@ import (
 	"math"
 )
 
+// Hashing parameters of DefaultProfile
 const (
 	MaxFreqBits  = 9
 	MaxDeltaBits = 14
@@ -13,7 +14,8 @@ const (
 	UseFreqIdx   = true
 )
 
-func createAddress(anchor Peak, target Peak) (uint32, bool) {
+// address packs an anchor/target pair into a hash under p's layout
+func (p Profile) address(anchor Peak, target Peak) (uint32, bool) {
 	var anchorFreqVal uint32
 	var targetFreqVal uint32
 	if UseFreqIdx {
@@ -26,12 +28,12 @@ func createAddress(anchor Peak, target Peak) (uint32, bool) {
 
 	deltaMs := uint32(math.Round((target.Time - anchor.Time) * 1000.0))
 
-	if deltaMs < MinDeltaMs || deltaMs > MaxDeltaMs {
+	if deltaMs < uint32(p.MinDeltaMs) || deltaMs > uint32(p.MaxDeltaMs) {
 		return 0, false
 	}
 
-	maxFreqMask := uint32((1 << MaxFreqBits) - 1)
-	maxDeltaMask := uint32((1 << MaxDeltaBits) - 1)
+	maxFreqMask := uint32((1 << p.FreqBits) - 1)
+	maxDeltaMask := uint32((1 << p.DeltaBits) - 1)
 
 	if anchorFreqVal > maxFreqMask || targetFreqVal > maxFreqMask {
 		return 0, false
@@ -40,8 +42,8 @@ func createAddress(anchor Peak, target Peak) (uint32, bool) {
 		return 0, false
 	}
 
-	shiftTarget := MaxDeltaBits
-	shiftAnchor := MaxDeltaBits + MaxFreqBits
+	shiftTarget := p.DeltaBits
+	shiftAnchor := p.DeltaBits + p.FreqBits
 
 	address := (anchorFreqVal << shiftAnchor) | (targetFreqVal << shiftTarget) | (deltaMs & maxDeltaMask)
 	return address, true
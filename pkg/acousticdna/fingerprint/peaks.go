@@ -13,24 +13,23 @@ type Peak struct {
 	MagDB   float64
 }
 
-func ExtractPeaks(spectrogram [][]float64, audioDuration float64, sampleRate int) []Peak {
-	if len(spectrogram) == 0 || len(spectrogram[0]) == 0 {
-		return nil
-	}
-
-	nFrames := len(spectrogram)
-	nBins := len(spectrogram[0])
-
-	freqRes := float64(sampleRate) / float64(WindowSize)
-	frameTime := float64(HopSize) / float64(sampleRate)
+const (
+	// timeNeighbour is the number of frames on each side a peak must beat
+	// without density control; the streaming Fingerprinter relies on it
+	// being 1
+	timeNeighbour = 1
+	eps           = 1e-10
+)
 
-	const (
-		freqNeighbour = 3
-		timeNeighbour = 1
-		minDbAboveAvg = 3.0
-		eps           = 1e-10
-	)
+// peakCandidate is a band maximum that passed the per-frame loudness check
+type peakCandidate struct {
+	bin   int
+	mag   float64
+	magDb float64
+}
 
+// peakBands splits the spectrum into logarithmically growing bands
+func peakBands(nBins int) [][]int {
 	bands := [][]int{{0, minInt(10, nBins)}}
 	for start := 10; start < nBins; start *= 2 {
 		end := minInt(start*2, nBins)
@@ -39,92 +38,159 @@ func ExtractPeaks(spectrogram [][]float64, audioDuration float64, sampleRate int
 			break
 		}
 	}
+	return bands
+}
 
-	peaks := make([]Peak, 0, nFrames*2)
+// frameCandidates picks the strongest bin per band and keeps those that
+// stand out from the frame's average band level by thresholdDb. Candidates
+// are returned in ascending bin order.
+func frameCandidates(frame []float64, bands [][]int, thresholdDb float64) []peakCandidate {
+	nBins := len(frame)
+
+	bandMaxMag := make([]float64, 0, len(bands))
+	bandMaxIdx := make([]int, 0, len(bands))
+	for _, b := range bands {
+		minBin := b[0]
+		maxBin := b[1]
+		if minBin >= nBins {
+			bandMaxMag = append(bandMaxMag, 0)
+			bandMaxIdx = append(bandMaxIdx, minBin)
+			continue
+		}
+		if maxBin > nBins {
+			maxBin = nBins
+		}
+		maxMag := 0.0
+		maxIdx := minBin
+		for i := minBin; i < maxBin; i++ {
+			m := frame[i]
+			if m > maxMag {
+				maxMag = m
+				maxIdx = i
+			}
+		}
+		bandMaxMag = append(bandMaxMag, maxMag)
+		bandMaxIdx = append(bandMaxIdx, maxIdx)
+	}
 
-	// For each frame, pick the strongest bin per band, then apply local checks
-	for t := 0; t < nFrames; t++ {
-		frame := spectrogram[t]
-
-		bandMaxMag := make([]float64, 0, len(bands))
-		bandMaxIdx := make([]int, 0, len(bands))
-		for _, b := range bands {
-			minBin := b[0]
-			maxBin := b[1]
-			if minBin >= nBins {
-				bandMaxMag = append(bandMaxMag, 0)
-				bandMaxIdx = append(bandMaxIdx, minBin)
+	var sumDb float64
+	for _, mag := range bandMaxMag {
+		sumDb += 20.0 * math.Log10(mag+eps)
+	}
+	avgDb := sumDb / float64(len(bandMaxMag))
+
+	candidates := make([]peakCandidate, 0, len(bands))
+	for bi, mag := range bandMaxMag {
+		if mag <= 0 {
+			continue
+		}
+		magDb := 20.0 * math.Log10(mag+eps)
+		if magDb < avgDb+thresholdDb {
+			continue
+		}
+		candidates = append(candidates, peakCandidate{bin: bandMaxIdx[bi], mag: mag, magDb: magDb})
+	}
+	return candidates
+}
+
+// isLocalMax checks that no bin within freqNeighbour bins in the surrounding
+// frames is louder than the candidate. Frames outside the spectrogram are
+// passed as nil.
+func isLocalMax(neighbours [][]float64, center int, bin int, mag float64, freqNeighbour int) bool {
+	for i, frame := range neighbours {
+		if frame == nil {
+			continue
+		}
+		for df := -freqNeighbour; df <= freqNeighbour; df++ {
+			fIdx := bin + df
+			if fIdx < 0 || fIdx >= len(frame) {
 				continue
 			}
-			if maxBin > nBins {
-				maxBin = nBins
+			if i == center && df == 0 {
+				continue
 			}
-			maxMag := 0.0
-			maxIdx := minBin
-			for i := minBin; i < maxBin; i++ {
-				m := frame[i]
-				if m > maxMag {
-					maxMag = m
-					maxIdx = i
-				}
+			if frame[fIdx] > mag {
+				return false
 			}
-			bandMaxMag = append(bandMaxMag, maxMag)
-			bandMaxIdx = append(bandMaxIdx, maxIdx)
 		}
+	}
+	return true
+}
+
+// ExtractPeaks picks peaks with DefaultProfile's thresholds at sampleRate
+func ExtractPeaks(spectrogram [][]float64, audioDuration float64, sampleRate int) []Peak {
+	return DefaultProfile().WithSampleRate(sampleRate).ExtractPeaks(spectrogram)
+}
+
+// ExtractPeaks finds the constellation points of a spectrogram made with p,
+// for a reference recording. Frames the profile gates out as silence or
+// noise get none.
+func (p Profile) ExtractPeaks(spectrogram [][]float64) []Peak {
+	return p.extractPeaks(spectrogram, p.PeakDensity)
+}
+
+// ExtractQueryPeaks is ExtractPeaks for a query, at the profile's query
+// peak density
+func (p Profile) ExtractQueryPeaks(spectrogram [][]float64) []Peak {
+	return p.extractPeaks(spectrogram, p.queryPeakDensity())
+}
 
-		var sumDb float64
-		for _, mag := range bandMaxMag {
-			sumDb += 20.0 * math.Log10(mag+eps)
+// extractPeaks picks peaks at density per second and band, or by the
+// per-frame threshold if density is 0
+func (p Profile) extractPeaks(spectrogram [][]float64, density float64) []Peak {
+	if len(spectrogram) == 0 || len(spectrogram[0]) == 0 {
+		return nil
+	}
+	if density > 0 {
+		var peaks []Peak
+		var gated GateStats
+		gate := p.newGate()
+		picker := p.newTilePicker(density, func(pk Peak) { peaks = append(peaks, pk) })
+		for _, frame := range spectrogram {
+			picker.push(frame, gate.admit(frame, &gated))
 		}
-		avgDb := sumDb / float64(len(bandMaxMag))
+		picker.flush()
+		return peaks
+	}
 
-		for bi, mag := range bandMaxMag {
-			if mag <= 0 {
-				continue
-			}
-			bin := bandMaxIdx[bi]
-			magDb := 20.0 * math.Log10(mag+eps)
+	nFrames := len(spectrogram)
+	nBins := len(spectrogram[0])
 
-			if magDb < avgDb+minDbAboveAvg {
-				continue
-			}
+	freqRes := p.freqRes()
+	frameTime := p.frameTime()
 
-			isLocalMax := true
-			for dt := -timeNeighbour; dt <= timeNeighbour; dt++ {
-				tIdx := t + dt
-				if tIdx < 0 || tIdx >= nFrames {
-					continue
-				}
-				for df := -freqNeighbour; df <= freqNeighbour; df++ {
-					fIdx := bin + df
-					if fIdx < 0 || fIdx >= nBins {
-						continue
-					}
-					if dt == 0 && df == 0 {
-						continue
-					}
-					if spectrogram[tIdx][fIdx] > mag {
-						isLocalMax = false
-						break
-					}
-				}
-				if !isLocalMax {
-					break
-				}
+	bands := peakBands(nBins)
+	gate := p.newGate()
+	var gated GateStats // Only the streaming Fingerprinter reports these
+	peaks := make([]Peak, 0, nFrames*2)
+	neighbours := make([][]float64, 2*timeNeighbour+1)
+
+	// For each frame, pick the strongest bin per band, then apply local checks
+	for t := 0; t < nFrames; t++ {
+		if !gate.admit(spectrogram[t], &gated) {
+			continue
+		}
+		for dt := -timeNeighbour; dt <= timeNeighbour; dt++ {
+			tIdx := t + dt
+			if tIdx < 0 || tIdx >= nFrames {
+				neighbours[dt+timeNeighbour] = nil
+			} else {
+				neighbours[dt+timeNeighbour] = spectrogram[tIdx]
 			}
+		}
 
-			if !isLocalMax {
+		for _, c := range frameCandidates(spectrogram[t], bands, p.PeakThresholdDb) {
+			if !isLocalMax(neighbours, timeNeighbour, c.bin, c.mag, p.PeakFreqNeighbour) {
 				continue
 			}
 
-			p := Peak{
+			peaks = append(peaks, Peak{
 				TimeIdx: t,
-				FreqIdx: bin,
+				FreqIdx: c.bin,
 				Time:    float64(t) * frameTime,
-				Freq:    float64(bin) * freqRes,
-				MagDB:   magDb,
-			}
-			peaks = append(peaks, p)
+				Freq:    float64(c.bin) * freqRes,
+				MagDB:   c.magDb,
+			})
 		}
 	}
 
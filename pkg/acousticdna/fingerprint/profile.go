@@ -0,0 +1,227 @@
+package fingerprint
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Profile holds every parameter that shapes the fingerprints. Hashes made
+// with one profile mean nothing under another, so a catalogue records the
+// profile it was built with and queries must use the same one. Change the
+// Version whenever any parameter of a named profile changes.
+type Profile struct {
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+
+	// Spectrogram
+	SampleRate int `json:"sample_rate"`
+	WindowSize int `json:"window_size"`
+	HopSize    int `json:"hop_size"`
+
+	// Peak picking: a band maximum must beat the frame's average band level
+	// by PeakThresholdDb and every bin within PeakFreqNeighbour bins in the
+	// neighbouring frames
+	PeakFreqNeighbour int     `json:"peak_freq_neighbour"`
+	PeakThresholdDb   float64 `json:"peak_threshold_db"`
+
+	// Density control replaces the threshold when PeakDensity is set: a peak
+	// must beat every bin within PeakFreqNeighbour bins and PeakTimeNeighbour
+	// frames, and each band keeps its strongest PeakDensity peaks per second
+	// in every PeakTileMs tile. Queries keep QueryPeakDensity (PeakDensity if
+	// zero), usually more, so that the peaks a reference kept are still among
+	// them when noise adds peaks of its own.
+	PeakDensity       float64 `json:"peak_density,omitempty"`
+	QueryPeakDensity  float64 `json:"query_peak_density,omitempty"`
+	PeakTileMs        int     `json:"peak_tile_ms,omitempty"`
+	PeakTimeNeighbour int     `json:"peak_time_neighbour,omitempty"`
+
+	// Gating: frames quieter than SilenceDb (dBFS, mean square) or with a
+	// spectral flatness above MaxFlatness get no peaks. Zero turns either
+	// check off, as in profiles older than gating.
+	SilenceDb   float64 `json:"silence_db,omitempty"`
+	MaxFlatness float64 `json:"max_flatness,omitempty"`
+
+	// Hashing: each anchor peak is paired with up to FanOut later peaks
+	// between MinDeltaMs and MaxDeltaMs away. A hash packs
+	// anchorFreq(FreqBits) | targetFreq(FreqBits) | deltaMs(DeltaBits).
+	FanOut     int `json:"fan_out"`
+	MinDeltaMs int `json:"min_delta_ms"`
+	MaxDeltaMs int `json:"max_delta_ms"`
+	FreqBits   int `json:"freq_bits"`
+	DeltaBits  int `json:"delta_bits"`
+}
+
+// ErrIncompatibleProfile is returned when fingerprints made with different
+// profiles are compared
+var ErrIncompatibleProfile = errors.New("incompatible fingerprint profile")
+
+// DefaultProfile is tuned for identifying songs from clips of a few seconds
+// and upwards
+func DefaultProfile() Profile {
+	return Profile{
+		Name:              "default",
+		Version:           3,
+		SampleRate:        11025,
+		WindowSize:        WindowSize,
+		HopSize:           HopSize,
+		PeakFreqNeighbour: 3,
+		PeakThresholdDb:   3.0,
+		PeakDensity:       3,
+		QueryPeakDensity:  6,
+		PeakTileMs:        1000,
+		PeakTimeNeighbour: 3,
+		SilenceDb:         -60,
+		MaxFlatness:       0.5,
+		FanOut:            FanOut,
+		MinDeltaMs:        MinDeltaMs,
+		MaxDeltaMs:        MaxDeltaMs,
+		FreqBits:          MaxFreqBits,
+		DeltaBits:         MaxDeltaBits,
+	}
+}
+
+// SpeechProfile trades frequency resolution for time resolution and peak
+// density, which suits short clips of speech better than DefaultProfile
+func SpeechProfile() Profile {
+	return Profile{
+		Name:              "speech",
+		Version:           2,
+		SampleRate:        8000,
+		WindowSize:        256,
+		HopSize:           64,
+		PeakFreqNeighbour: 2,
+		PeakThresholdDb:   2.0,
+		SilenceDb:         -60,
+		MaxFlatness:       0.5,
+		FanOut:            10,
+		MinDeltaMs:        5,
+		MaxDeltaMs:        2000,
+		FreqBits:          8,
+		DeltaBits:         11,
+	}
+}
+
+// LegacyProfile is DefaultProfile as it was before gating and density
+// control, default@1. Catalogues built before profiles were recorded used it.
+func LegacyProfile() Profile {
+	p := DefaultProfile()
+	p.Version = 1
+	p.PeakDensity = 0
+	p.QueryPeakDensity = 0
+	p.PeakTileMs = 0
+	p.PeakTimeNeighbour = 0
+	p.SilenceDb = 0
+	p.MaxFlatness = 0
+	return p
+}
+
+// Profiles lists the built-in profiles by name
+func Profiles() map[string]Profile {
+	return map[string]Profile{
+		"default": DefaultProfile(),
+		"speech":  SpeechProfile(),
+	}
+}
+
+// ID identifies the profile as name@version
+func (p Profile) ID() string {
+	return fmt.Sprintf("%s@%d", p.Name, p.Version)
+}
+
+// Validate checks that the parameters can produce well-formed hashes
+func (p Profile) Validate() error {
+	switch {
+	case p.Name == "":
+		return errors.New("profile name is empty")
+	case p.Version < 1:
+		return errors.New("profile version must be at least 1")
+	case p.SampleRate <= 0:
+		return errors.New("sample rate must be positive")
+	case p.WindowSize < 16:
+		return errors.New("window size must be at least 16 samples")
+	case p.HopSize <= 0 || p.HopSize > p.WindowSize:
+		return errors.New("hop size must be between 1 and the window size")
+	case p.PeakFreqNeighbour < 0:
+		return errors.New("peak neighbourhood can't be negative")
+	case p.PeakDensity < 0 || p.QueryPeakDensity < 0:
+		return errors.New("peak density can't be negative")
+	case p.PeakDensity > 0 && p.PeakTileMs <= 0:
+		return errors.New("peak tile length must be positive with density control")
+	case p.PeakDensity > 0 && p.PeakTimeNeighbour < 1:
+		return errors.New("peak time neighbourhood must be at least 1 frame with density control")
+	case p.SilenceDb > 0:
+		return errors.New("silence threshold must be below full scale")
+	case p.MaxFlatness < 0 || p.MaxFlatness > 1:
+		return errors.New("maximum flatness must be between 0 and 1")
+	case p.FanOut < 1:
+		return errors.New("fan-out must be at least 1")
+	case p.MinDeltaMs < 0 || p.MaxDeltaMs <= p.MinDeltaMs:
+		return errors.New("delta range must satisfy 0 <= min < max")
+	case p.FreqBits < 1 || p.DeltaBits < 1 || 2*p.FreqBits+p.DeltaBits > 32:
+		return errors.New("hash layout must fit in 32 bits")
+	case p.WindowSize/2 > 1<<p.FreqBits:
+		return fmt.Errorf("%d frequency bits can't address %d bins", p.FreqBits, p.WindowSize/2)
+	case p.MaxDeltaMs >= 1<<p.DeltaBits:
+		return fmt.Errorf("%d delta bits can't hold %dms", p.DeltaBits, p.MaxDeltaMs)
+	}
+	return nil
+}
+
+// CompatibleWith reports whether fingerprints made with p can be matched
+// against ones made with other. Both the ID and every parameter must agree;
+// the same ID with different parameters means a version bump was missed.
+func (p Profile) CompatibleWith(other Profile) error {
+	if p.ID() != other.ID() {
+		return fmt.Errorf("%w: %s vs %s", ErrIncompatibleProfile, p.ID(), other.ID())
+	}
+	if p != other {
+		return fmt.Errorf("%w: %s has different parameters on each side (bump its version when changing them)",
+			ErrIncompatibleProfile, p.ID())
+	}
+	return nil
+}
+
+// WithSampleRate returns a copy of p at another sample rate
+func (p Profile) WithSampleRate(rate int) Profile {
+	p.SampleRate = rate
+	return p
+}
+
+// queryPeakDensity is the peak density of queries, zero without density
+// control
+func (p Profile) queryPeakDensity() float64 {
+	if p.QueryPeakDensity > 0 && p.PeakDensity > 0 {
+		return p.QueryPeakDensity
+	}
+	return p.PeakDensity
+}
+
+// freqRes is the width of one frequency bin in Hz
+func (p Profile) freqRes() float64 {
+	return float64(p.SampleRate) / float64(p.WindowSize)
+}
+
+// frameTime is the time between frames in seconds
+func (p Profile) frameTime() float64 {
+	return float64(p.HopSize) / float64(p.SampleRate)
+}
+
+// ValidHash performs a lightweight check that hash could have been made with p
+func (p Profile) ValidHash(hash uint32) bool {
+	deltaMask := uint32(1)<<p.DeltaBits - 1
+	freqMask := uint32(1)<<p.FreqBits - 1
+
+	delta := hash & deltaMask
+	targetFreq := (hash >> p.DeltaBits) & freqMask
+	anchorFreq := (hash >> (p.DeltaBits + p.FreqBits)) & freqMask
+	rest := uint64(hash) >> (2*p.FreqBits + p.DeltaBits)
+
+	if delta < uint32(p.MinDeltaMs) || delta > uint32(p.MaxDeltaMs) {
+		return false
+	}
+	// Both frequencies being 0 indicates corruption
+	if anchorFreq == 0 && targetFreq == 0 {
+		return false
+	}
+	return rest == 0
+}
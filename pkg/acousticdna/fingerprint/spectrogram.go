@@ -9,6 +9,7 @@ import (
 	"github.com/mjibson/go-dsp/fft"
 )
 
+// STFT parameters of DefaultProfile
 const (
 	WindowSize = 1024
 	HopSize    = 256
@@ -121,3 +122,11 @@ func ComputeSpectrogramFromSamples(samples []float64, sampleRate, windowSizeArg,
 	}
 	return spectrogram, nil
 }
+
+// Spectrogram computes the magnitude STFT of mono samples at p's sample rate
+func (p Profile) Spectrogram(samples []float64) ([][]float64, error) {
+	if len(samples) < p.WindowSize {
+		return nil, errors.New("audio too short for window size")
+	}
+	return STFT(samples, p.SampleRate, p.WindowSize, p.HopSize, Hamming(p.WindowSize))
+}
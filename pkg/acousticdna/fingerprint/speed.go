@@ -0,0 +1,30 @@
+package fingerprint
+
+import "math"
+
+// ScalePeaks maps peaks of audio played back at speed (1.05 = 5% fast) onto
+// the timeline of the original recording, so they hash like the reference.
+// A plain speed change (vinyl, resampling) also shifts pitch, which is
+// undone too unless preservePitch says the source was time-stretched only.
+// Times are snapped to the frame grid the reference was hashed on.
+func (p Profile) ScalePeaks(peaks []Peak, speed float64, preservePitch bool) []Peak {
+	freqRes := p.freqRes()
+	frameTime := p.frameTime()
+
+	out := make([]Peak, 0, len(peaks))
+	for _, pk := range peaks {
+		t := int(math.Round(float64(pk.TimeIdx) * speed))
+		f := pk.FreqIdx
+		if !preservePitch {
+			f = int(math.Round(float64(f) / speed))
+		}
+		out = append(out, Peak{
+			TimeIdx: t,
+			FreqIdx: f,
+			Time:    float64(t) * frameTime,
+			Freq:    float64(f) * freqRes,
+			MagDB:   pk.MagDB,
+		})
+	}
+	return out
+}
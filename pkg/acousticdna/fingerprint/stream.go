@@ -0,0 +1,291 @@
+package fingerprint
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"time"
+)
+
+// HashFunc receives each hash as soon as both of its peaks are known
+type HashFunc func(hash uint32, anchorTimeMs uint32)
+
+// PeakFunc receives each peak once its neighbourhood has been checked
+type PeakFunc func(p Peak)
+
+// StreamStats summarises a finished Fingerprinter run
+type StreamStats struct {
+	Samples int64
+	Frames  int
+	Peaks   int
+	Hashes  int
+
+	// Gated counts the frames left without peaks as silence or noise
+	Gated GateStats
+
+	// Time spent computing spectra, picking peaks and hashing them
+	STFTTime time.Duration
+	PeakTime time.Duration
+	HashTime time.Duration
+}
+
+// DurationSec returns the length of the consumed audio in seconds
+func (s StreamStats) DurationSec(sampleRate int) float64 {
+	if sampleRate <= 0 {
+		return 0
+	}
+	return float64(s.Samples) / float64(sampleRate)
+}
+
+// Fingerprinter runs the STFT, peak picking and hashing incrementally over a
+// stream of mono samples. Memory use is bounded by the hash pairing window
+// (MaxDeltaMs) rather than by the length of the input, and the emitted
+// hashes are the same as running ExtractPeaks and Fingerprint on the whole
+// signal at once.
+type Fingerprinter struct {
+	profile   Profile
+	window    []float64
+	bands     [][]int
+	gate      frameGate
+	picker    *tilePicker // With density control only
+	freqRes   float64
+	frameTime float64
+
+	// OnPeak, if set, is called for every accepted peak in time order
+	OnPeak PeakFunc
+
+	onHash HashFunc
+
+	buf []float64 // samples not yet consumed by a full frame
+
+	// The local-maximum check needs the previous and next frame, so the
+	// current frame's candidates are held back until the next one arrives.
+	prev, cur  []float64
+	curCands   []peakCandidate
+	curTimeIdx int
+	nextIdx    int
+
+	anchors []pendingAnchor
+	stats   StreamStats
+	flushed bool
+}
+
+// pendingAnchor is a peak still waiting for its fan-out of target peaks
+type pendingAnchor struct {
+	peak   Peak
+	paired int
+}
+
+// NewFingerprinter creates a streaming fingerprinter for mono audio at
+// sampleRate using DefaultProfile. onHash may be nil when only peaks are of
+// interest.
+func NewFingerprinter(sampleRate int, onHash HashFunc) *Fingerprinter {
+	return DefaultProfile().WithSampleRate(sampleRate).NewFingerprinter(onHash)
+}
+
+// NewFingerprinter creates a streaming fingerprinter for a reference
+// recording in mono at p's sample rate. onHash may be nil when only peaks
+// are of interest.
+func (p Profile) NewFingerprinter(onHash HashFunc) *Fingerprinter {
+	return p.newFingerprinter(onHash, p.PeakDensity)
+}
+
+// NewQueryFingerprinter is NewFingerprinter for a query, at the profile's
+// query peak density
+func (p Profile) NewQueryFingerprinter(onHash HashFunc) *Fingerprinter {
+	return p.newFingerprinter(onHash, p.queryPeakDensity())
+}
+
+func (p Profile) newFingerprinter(onHash HashFunc, density float64) *Fingerprinter {
+	f := &Fingerprinter{
+		profile:    p,
+		window:     Hamming(p.WindowSize),
+		bands:      peakBands(p.WindowSize / 2),
+		gate:       p.newGate(),
+		freqRes:    p.freqRes(),
+		frameTime:  p.frameTime(),
+		onHash:     onHash,
+		curTimeIdx: -1,
+	}
+	if density > 0 {
+		f.picker = p.newTilePicker(density, f.emitPeak)
+	}
+	return f
+}
+
+// Write feeds mono samples in [-1, 1] into the pipeline
+func (f *Fingerprinter) Write(samples []float64) {
+	if f.flushed {
+		return
+	}
+	f.stats.Samples += int64(len(samples))
+	f.buf = append(f.buf, samples...)
+
+	consumed := 0
+	ws, hs := f.profile.WindowSize, f.profile.HopSize
+	for consumed+ws <= len(f.buf) {
+		f.processFrame(f.buf[consumed : consumed+ws])
+		consumed += hs
+	}
+
+	if consumed > 0 {
+		f.buf = append(f.buf[:0], f.buf[consumed:]...)
+	}
+}
+
+// Flush finalises the last frame and emits the remaining hashes.
+// The Fingerprinter can't be written to afterwards.
+func (f *Fingerprinter) Flush() StreamStats {
+	if f.flushed {
+		return f.stats
+	}
+	f.flushed = true
+
+	start := time.Now()
+	if f.picker != nil {
+		f.picker.flush()
+	}
+	f.finishFrame(nil)
+	f.stats.PeakTime += time.Since(start)
+	f.anchors = nil
+	return f.stats
+}
+
+// Stats returns the statistics of the samples written so far
+func (f *Fingerprinter) Stats() StreamStats {
+	return f.stats
+}
+
+// Run reads signed 16-bit little-endian mono PCM from r until EOF and
+// returns the stream statistics.
+func (f *Fingerprinter) Run(r io.Reader) (StreamStats, error) {
+	raw := make([]byte, 32*1024)
+	samples := make([]float64, len(raw)/2)
+	carry := 0
+
+	for {
+		n, err := r.Read(raw[carry:])
+		n += carry
+
+		frames := n / 2
+		for i := 0; i < frames; i++ {
+			samples[i] = float64(int16(binary.LittleEndian.Uint16(raw[2*i:]))) / 32768.0
+		}
+		f.Write(samples[:frames])
+
+		// Keep an odd trailing byte for the next read
+		carry = n % 2
+		if carry == 1 {
+			raw[0] = raw[n-1]
+		}
+
+		if errors.Is(err, io.EOF) {
+			return f.Flush(), nil
+		}
+		if err != nil {
+			return f.stats, err
+		}
+	}
+}
+
+// processFrame computes one spectrum and advances the peak pipeline
+func (f *Fingerprinter) processFrame(samples []float64) {
+	start := time.Now()
+	frame := make([]float64, f.profile.WindowSize)
+	for i := range frame {
+		frame[i] = samples[i] * f.window[i]
+	}
+	mag := MagnitudeSpectrum(FFTReal(frame))
+	spectrum := time.Now()
+	f.stats.STFTTime += spectrum.Sub(start)
+	// Peak time includes the hashing of new peaks, which emitPeak moves
+	// over to hash time
+	defer func() { f.stats.PeakTime += time.Since(spectrum) }()
+
+	if f.picker != nil {
+		f.picker.push(mag, f.gate.admit(mag, &f.stats.Gated))
+		f.stats.Frames++
+		return
+	}
+
+	f.finishFrame(mag)
+
+	f.prev, f.cur = f.cur, mag
+	f.curCands = nil
+	if f.gate.admit(mag, &f.stats.Gated) {
+		f.curCands = frameCandidates(mag, f.bands, f.profile.PeakThresholdDb)
+	}
+	f.curTimeIdx = f.nextIdx
+	f.nextIdx++
+	f.stats.Frames++
+}
+
+// finishFrame runs the local-maximum check for the held-back frame now that
+// its successor (or the end of the stream, when next is nil) is known.
+func (f *Fingerprinter) finishFrame(next []float64) {
+	if f.curTimeIdx < 0 {
+		return
+	}
+
+	neighbours := [][]float64{f.prev, f.cur, next}
+	for _, c := range f.curCands {
+		if !isLocalMax(neighbours, 1, c.bin, c.mag, f.profile.PeakFreqNeighbour) {
+			continue
+		}
+		f.emitPeak(Peak{
+			TimeIdx: f.curTimeIdx,
+			FreqIdx: c.bin,
+			Time:    float64(f.curTimeIdx) * f.frameTime,
+			Freq:    float64(c.bin) * f.freqRes,
+			MagDB:   c.magDb,
+		})
+	}
+	f.curCands = nil
+}
+
+// emitPeak pairs a new peak with every pending anchor, then queues it as an anchor itself
+func (f *Fingerprinter) emitPeak(p Peak) {
+	f.stats.Peaks++
+	if f.OnPeak != nil {
+		f.OnPeak(p)
+	}
+	start := time.Now()
+	defer func() {
+		d := time.Since(start)
+		f.stats.HashTime += d
+		f.stats.PeakTime -= d
+	}()
+
+	done := 0
+	for i := range f.anchors {
+		a := &f.anchors[i]
+		if a.paired >= f.profile.FanOut {
+			continue
+		}
+		if math.Round((p.Time-a.peak.Time)*1000.0) > float64(f.profile.MaxDeltaMs) {
+			// Later peaks are even further away, so this anchor can never pair again
+			a.paired = f.profile.FanOut
+			continue
+		}
+		addr, ok := f.profile.address(a.peak, p)
+		if !ok {
+			continue
+		}
+		a.paired++
+		f.stats.Hashes++
+		if f.onHash != nil {
+			f.onHash(addr, uint32(math.Round(a.peak.Time*1000.0)))
+		}
+	}
+
+	// Anchors complete in roughly time order; drop the finished prefix
+	for done < len(f.anchors) && f.anchors[done].paired >= f.profile.FanOut {
+		done++
+	}
+	if done > 0 {
+		f.anchors = append(f.anchors[:0], f.anchors[done:]...)
+	}
+
+	f.anchors = append(f.anchors, pendingAnchor{peak: p})
+}
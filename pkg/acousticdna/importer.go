@@ -0,0 +1,540 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+package acousticdna
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/audio"
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/storage"
+	"github.com/himanishpuri/AcousticDNA/pkg/logger"
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// ImportItem is one file to add to the catalogue. Empty Title and Artist
+// are read from the file's tags.
+type ImportItem struct {
+	Path      string `json:"path"`
+	Title     string `json:"title,omitempty"`
+	Artist    string `json:"artist,omitempty"`
+	YouTubeID string `json:"youtube_id,omitempty"`
+}
+
+// ImportStatus is the outcome of importing one file
+type ImportStatus string
+
+const (
+	ImportAdded     ImportStatus = "added"
+	ImportDuplicate ImportStatus = "duplicate"
+	ImportFailed    ImportStatus = "failed"
+)
+
+// ImportResult reports what happened to one file
+type ImportResult struct {
+	Item   ImportItem
+	Status ImportStatus
+	SongID string
+	Err    error
+}
+
+// ImportSummary totals an import run. Resumed counts the files a previous
+// run had already finished according to the checkpoint.
+type ImportSummary struct {
+	Total      int
+	Added      int
+	Duplicates int
+	Failed     int
+	Resumed    int
+	Failures   []ImportResult
+	Elapsed    time.Duration
+}
+
+// ImportConfig tunes an Importer
+type ImportConfig struct {
+	// Workers is the number of files decoded and fingerprinted at once.
+	// Storage is always written by a single goroutine.
+	Workers int
+
+	// CheckpointPath, if set, records every finished file so that a later
+	// run with the same checkpoint skips them
+	CheckpointPath string
+
+	// OnResult, if set, is called from the writer goroutine after each file
+	// with the number of files finished so far
+	OnResult func(res ImportResult, done, total int)
+
+	Logger Logger
+}
+
+type ImportOption func(*ImportConfig)
+
+func WithImportWorkers(n int) ImportOption {
+	return func(c *ImportConfig) {
+		c.Workers = n
+	}
+}
+
+func WithImportCheckpoint(path string) ImportOption {
+	return func(c *ImportConfig) {
+		c.CheckpointPath = path
+	}
+}
+
+func WithImportProgress(fn func(res ImportResult, done, total int)) ImportOption {
+	return func(c *ImportConfig) {
+		c.OnResult = fn
+	}
+}
+
+func WithImportLogger(log Logger) ImportOption {
+	return func(c *ImportConfig) {
+		c.Logger = log
+	}
+}
+
+func defaultImportConfig() *ImportConfig {
+	return &ImportConfig{
+		Workers: 4,
+	}
+}
+
+// Importer adds many files to the catalogue in one go. Files are decoded
+// and fingerprinted by a bounded pool of workers while a single writer
+// registers them, so the storage backend never sees concurrent writes.
+// Songs whose title and artist are already catalogued are skipped.
+type Importer struct {
+	svc    Service
+	config *ImportConfig
+	log    Logger
+}
+
+func NewImporter(svc Service, opts ...ImportOption) *Importer {
+	cfg := defaultImportConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = logger.GetLogger()
+	}
+
+	return &Importer{
+		svc:    svc,
+		config: cfg,
+		log:    cfg.Logger,
+	}
+}
+
+// importCheckpoint is one line of the checkpoint file
+type importCheckpoint struct {
+	Path   string       `json:"path"`
+	Status ImportStatus `json:"status"`
+	SongID string       `json:"song_id,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// fingerprinted is a worker's output for one file
+type fingerprinted struct {
+	item ImportItem
+	tags models.Song // metadata from the file's tags
+	fp   *models.SongFingerprints
+	dup  bool
+	err  error
+}
+
+// Run imports items and returns a summary. Files that fail are reported
+// and skipped; Run itself only fails if the checkpoint or the catalogue
+// can't be read, or when ctx is cancelled, in which case the summary
+// covers the files finished so far.
+func (im *Importer) Run(ctx context.Context, items []ImportItem) (ImportSummary, error) {
+	started := time.Now()
+	summary := ImportSummary{Total: len(items)}
+
+	finished, err := readImportCheckpoint(im.config.CheckpointPath)
+	if err != nil {
+		return summary, err
+	}
+	pending := make([]ImportItem, 0, len(items))
+	for _, item := range items {
+		if finished[item.Path] {
+			summary.Resumed++
+			continue
+		}
+		pending = append(pending, item)
+	}
+	if summary.Resumed > 0 {
+		im.log.Infof("Resuming import: %d of %d files already done", summary.Resumed, len(items))
+	}
+
+	var checkpoint *os.File
+	if im.config.CheckpointPath != "" {
+		checkpoint, err = os.OpenFile(im.config.CheckpointPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return summary, fmt.Errorf("opening checkpoint: %w", err)
+		}
+		defer checkpoint.Close()
+	}
+
+	songs, err := im.svc.ListSongs()
+	if err != nil {
+		return summary, fmt.Errorf("listing songs: %w", err)
+	}
+	existing := make(map[string]bool, len(songs))
+	for _, song := range songs {
+		existing[storage.SongKey(song.Title, song.Artist)] = true
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan ImportItem)
+	results := make(chan fingerprinted, im.config.Workers)
+
+	go func() {
+		defer close(jobs)
+		for _, item := range pending {
+			select {
+			case jobs <- item:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < im.config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range jobs {
+				res := im.fingerprint(ctx, item, existing)
+				select {
+				case results <- res:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// This goroutine is the only writer, to storage and to the checkpoint
+	added := make(map[string]bool)
+	done := summary.Resumed
+	for fpd := range results {
+		res := ImportResult{Item: fpd.item}
+		key := storage.SongKey(fpd.item.Title, fpd.item.Artist)
+		switch {
+		case fpd.err != nil:
+			res.Status, res.Err = ImportFailed, fpd.err
+		case fpd.dup || added[key]:
+			res.Status = ImportDuplicate
+		default:
+			song := models.Song{Title: fpd.item.Title, Artist: fpd.item.Artist, YouTubeID: fpd.item.YouTubeID}
+			fillSong(&song, fpd.tags)
+			res.SongID, res.Err = im.svc.StoreSong(song, fpd.fp)
+			switch {
+			case errors.Is(res.Err, ErrSongExists):
+				// Catalogued since the import started
+				res.Status, res.Err = ImportDuplicate, nil
+			case res.Err != nil:
+				res.Status = ImportFailed
+			default:
+				res.Status = ImportAdded
+				added[key] = true
+			}
+		}
+
+		if ctx.Err() != nil && errors.Is(res.Err, ctx.Err()) {
+			// Interrupted rather than failed; leave it for the next run
+			continue
+		}
+
+		switch res.Status {
+		case ImportAdded:
+			summary.Added++
+		case ImportDuplicate:
+			summary.Duplicates++
+		case ImportFailed:
+			summary.Failed++
+			summary.Failures = append(summary.Failures, res)
+			im.log.Warnf("Import of %s failed: %v", res.Item.Path, res.Err)
+		}
+
+		if checkpoint != nil {
+			if err := writeImportCheckpoint(checkpoint, res); err != nil {
+				cancel()
+				for range results {
+				}
+				return summary, fmt.Errorf("writing checkpoint: %w", err)
+			}
+		}
+
+		done++
+		if im.config.OnResult != nil {
+			im.config.OnResult(res, done, len(items))
+		}
+	}
+
+	summary.Elapsed = time.Since(started)
+	return summary, ctx.Err()
+}
+
+// fingerprint fills in missing tags and fingerprints one file, unless its
+// title and artist show it is already catalogued
+func (im *Importer) fingerprint(ctx context.Context, item ImportItem, existing map[string]bool) fingerprinted {
+	var tags models.Song
+	if meta, err := audio.ReadMetadata(ctx, item.Path); err == nil {
+		tags = SongFromTags(meta)
+	}
+	if item.Title == "" || item.Artist == "" {
+		fillFromTags(&item, tags)
+	}
+	if existing[storage.SongKey(item.Title, item.Artist)] {
+		return fingerprinted{item: item, dup: true}
+	}
+
+	f, err := os.Open(item.Path)
+	if err != nil {
+		return fingerprinted{item: item, err: err}
+	}
+	defer f.Close()
+
+	fp, err := im.svc.FingerprintReader(ctx, f)
+	return fingerprinted{item: item, tags: tags, fp: fp, err: err}
+}
+
+// fillFromTags completes an item's title and artist from the file's tags,
+// then from an "Artist - Title" file name, then from the bare file name
+func fillFromTags(item *ImportItem, tags models.Song) {
+	if item.Title == "" {
+		item.Title = tags.Title
+	}
+	if item.Artist == "" {
+		item.Artist = tags.Artist
+	}
+
+	stem := strings.TrimSuffix(filepath.Base(item.Path), filepath.Ext(item.Path))
+	if artist, title, ok := strings.Cut(stem, " - "); ok {
+		if item.Artist == "" {
+			item.Artist = strings.TrimSpace(artist)
+		}
+		if item.Title == "" {
+			item.Title = strings.TrimSpace(title)
+		}
+	}
+	if item.Title == "" {
+		item.Title = stem
+	}
+	if item.Artist == "" {
+		item.Artist = "Unknown Artist"
+	}
+}
+
+// readImportCheckpoint returns the paths a previous run finished. Failed
+// files are not finished; they are retried.
+func readImportCheckpoint(path string) (map[string]bool, error) {
+	finished := make(map[string]bool)
+	if path == "" {
+		return finished, nil
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return finished, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening checkpoint: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var line importCheckpoint
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			// A crash can leave a torn last line
+			continue
+		}
+		if line.Status == ImportFailed {
+			delete(finished, line.Path)
+		} else {
+			finished[line.Path] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading checkpoint: %w", err)
+	}
+	return finished, nil
+}
+
+func writeImportCheckpoint(f *os.File, res ImportResult) error {
+	line := importCheckpoint{Path: res.Item.Path, Status: res.Status, SongID: res.SongID}
+	if res.Err != nil {
+		line.Error = res.Err.Error()
+	}
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// importExtensions are the file types picked up when importing a directory
+var importExtensions = map[string]bool{
+	".wav": true, ".flac": true, ".mp3": true, ".ogg": true, ".oga": true,
+	".opus": true, ".m4a": true, ".aac": true, ".wma": true, ".aiff": true, ".aif": true,
+}
+
+// LoadImportItems lists the files to import from source: a directory,
+// walked recursively for audio files, or a manifest. A .csv manifest has a
+// header row naming at least a path column, plus optional title, artist
+// and youtube_id columns; a .jsonl manifest has one ImportItem per line.
+// Relative manifest paths are resolved against the manifest's directory.
+func LoadImportItems(source string) ([]ImportItem, error) {
+	// Absolute paths keep checkpoints valid from any working directory
+	source, err := filepath.Abs(source)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return walkImportDir(source)
+	}
+
+	f, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var items []ImportItem
+	switch strings.ToLower(filepath.Ext(source)) {
+	case ".csv":
+		items, err = readCSVManifest(f)
+	case ".jsonl", ".ndjson":
+		items, err = readJSONLManifest(f)
+	default:
+		return nil, fmt.Errorf("unsupported manifest %s (use a directory, .csv or .jsonl)", source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest %s: %w", source, err)
+	}
+
+	base := filepath.Dir(source)
+	for i := range items {
+		if items[i].Path == "" {
+			return nil, fmt.Errorf("manifest %s: entry %d has no path", source, i+1)
+		}
+		if !filepath.IsAbs(items[i].Path) {
+			items[i].Path = filepath.Join(base, items[i].Path)
+		}
+	}
+	return items, nil
+}
+
+func walkImportDir(root string) ([]ImportItem, error) {
+	var items []ImportItem
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if importExtensions[strings.ToLower(filepath.Ext(path))] {
+			items = append(items, ImportItem{Path: path})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Path < items[j].Path })
+	return items, nil
+}
+
+func readCSVManifest(r io.Reader) ([]ImportItem, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	col := make(map[string]int)
+	for i, name := range header {
+		col[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := col["path"]; !ok {
+		return nil, errors.New("header has no path column")
+	}
+	field := func(rec []string, name string) string {
+		if i, ok := col[name]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	var items []ImportItem
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return items, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, ImportItem{
+			Path:      field(rec, "path"),
+			Title:     field(rec, "title"),
+			Artist:    field(rec, "artist"),
+			YouTubeID: field(rec, "youtube_id"),
+		})
+	}
+}
+
+func readJSONLManifest(r io.Reader) ([]ImportItem, error) {
+	var items []ImportItem
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var item ImportItem
+		if err := json.Unmarshal([]byte(line), &item); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		items = append(items, item)
+	}
+	return items, scanner.Err()
+}
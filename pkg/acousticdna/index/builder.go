@@ -0,0 +1,259 @@
+package index
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// Source is a catalogue that can be compiled into an index
+type Source interface {
+	ListSongs() ([]models.Song, error)
+	ForEachFingerprint(fn func(hash uint32, c models.Couple) error) error
+}
+
+// entry is one couple with the song replaced by its compact ID
+type entry struct {
+	hash   uint32
+	song   uint32
+	anchor uint32
+}
+
+// Builder collects songs and fingerprints and writes them out as an index.
+// Everything is held in memory (12 bytes per fingerprint) until WriteTo.
+type Builder struct {
+	songs   []models.Song
+	songIdx map[string]uint32
+	counts  []uint64
+	entries []entry
+	meta    map[string]string
+}
+
+func NewBuilder() *Builder {
+	return &Builder{songIdx: make(map[string]uint32), meta: make(map[string]string)}
+}
+
+// SetMeta records a catalogue setting, readable through Index.GetMeta
+func (b *Builder) SetMeta(key, value string) {
+	b.meta[key] = value
+}
+
+// AddSong registers a song; fingerprints can only refer to added songs
+func (b *Builder) AddSong(song models.Song) {
+	if _, ok := b.songIdx[song.ID]; ok {
+		return
+	}
+	b.songIdx[song.ID] = uint32(len(b.songs))
+	b.songs = append(b.songs, song)
+	b.counts = append(b.counts, 0)
+}
+
+// Add records one fingerprint
+func (b *Builder) Add(hash uint32, c models.Couple) error {
+	idx, ok := b.songIdx[c.SongID]
+	if !ok {
+		return fmt.Errorf("fingerprint %#x refers to unknown song %s", hash, c.SongID)
+	}
+	b.entries = append(b.entries, entry{hash: hash, song: idx, anchor: c.AnchorTimeMs})
+	b.counts[idx]++
+	return nil
+}
+
+// AddSource copies every song and fingerprint of src into the builder
+func (b *Builder) AddSource(src Source) error {
+	songs, err := src.ListSongs()
+	if err != nil {
+		return fmt.Errorf("listing songs: %w", err)
+	}
+	for _, song := range songs {
+		b.AddSong(song)
+	}
+	return src.ForEachFingerprint(b.Add)
+}
+
+// WriteTo sorts the collected fingerprints and writes the index to w
+func (b *Builder) WriteTo(w io.Writer) (int64, error) {
+	sort.Slice(b.entries, func(i, j int) bool {
+		x, y := b.entries[i], b.entries[j]
+		if x.hash != y.hash {
+			return x.hash < y.hash
+		}
+		if x.song != y.song {
+			return x.song < y.song
+		}
+		return x.anchor < y.anchor
+	})
+
+	// Distinct keys and their postings
+	var keys []uint32
+	var postings []byte
+	postingOffs := []uint64{0}
+	var buf [binary.MaxVarintLen64]byte
+	putUvarint := func(v uint64) {
+		n := binary.PutUvarint(buf[:], v)
+		postings = append(postings, buf[:n]...)
+	}
+
+	for start := 0; start < len(b.entries); {
+		hash := b.entries[start].hash
+		end := start
+		for end < len(b.entries) && b.entries[end].hash == hash {
+			end++
+		}
+
+		putUvarint(uint64(end - start))
+		var prevSong, prevAnchor uint32
+		for _, e := range b.entries[start:end] {
+			if e.song != prevSong {
+				prevAnchor = 0
+			}
+			putUvarint(uint64(e.song - prevSong))
+			putUvarint(uint64(e.anchor - prevAnchor))
+			prevSong, prevAnchor = e.song, e.anchor
+		}
+
+		keys = append(keys, hash)
+		postingOffs = append(postingOffs, uint64(len(postings)))
+		start = end
+	}
+
+	bits := bucketBitsFor(len(keys))
+	dir := make([]uint32, (1<<bits)+1)
+	k := 0
+	for bucket := range dir {
+		for k < len(keys) && uint64(keys[k])>>(32-bits) < uint64(bucket) {
+			k++
+		}
+		dir[bucket] = uint32(k)
+	}
+
+	var songs []byte
+	putString := func(s string) {
+		songs = binary.AppendUvarint(songs, uint64(len(s)))
+		songs = append(songs, s...)
+	}
+	for i, song := range b.songs {
+		putString(song.ID)
+		putString(song.Title)
+		putString(song.Artist)
+		putString(song.YouTubeID)
+		songs = binary.AppendUvarint(songs, uint64(song.DurationMs))
+		songs = binary.AppendUvarint(songs, b.counts[i])
+		extras, err := json.Marshal(extrasOf(song))
+		if err != nil {
+			return 0, fmt.Errorf("encoding song %s: %w", song.ID, err)
+		}
+		putString(string(extras))
+	}
+
+	metaKeys := make([]string, 0, len(b.meta))
+	for k := range b.meta {
+		metaKeys = append(metaKeys, k)
+	}
+	sort.Strings(metaKeys)
+	meta := binary.AppendUvarint(nil, uint64(len(metaKeys)))
+	for _, k := range metaKeys {
+		for _, str := range []string{k, b.meta[k]} {
+			meta = binary.AppendUvarint(meta, uint64(len(str)))
+			meta = append(meta, str...)
+		}
+	}
+
+	_, _, postingsOff := sectionOffsets(bits, uint64(len(keys)))
+	songsOff := postingsOff + uint64(len(postings))
+	total := songsOff + uint64(len(songs)) + uint64(len(meta))
+
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	binary.LittleEndian.PutUint32(header[8:], formatVersion)
+	binary.LittleEndian.PutUint32(header[12:], uint32(bits))
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(b.songs)))
+	binary.LittleEndian.PutUint32(header[20:], uint32(len(meta)))
+	binary.LittleEndian.PutUint64(header[24:], uint64(len(keys)))
+	binary.LittleEndian.PutUint64(header[32:], uint64(len(b.entries)))
+	binary.LittleEndian.PutUint64(header[40:], postingsOff)
+	binary.LittleEndian.PutUint64(header[48:], songsOff)
+	binary.LittleEndian.PutUint64(header[56:], total)
+
+	bw := bufio.NewWriterSize(w, 1<<20)
+	cw := &countingWriter{w: bw}
+	cw.Write(header)
+	for _, v := range dir {
+		binary.Write(cw, binary.LittleEndian, v)
+	}
+	binary.Write(cw, binary.LittleEndian, keys)
+	binary.Write(cw, binary.LittleEndian, postingOffs)
+	cw.Write(postings)
+	cw.Write(songs)
+	cw.Write(meta)
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	if err := bw.Flush(); err != nil {
+		return cw.n, err
+	}
+	return cw.n, nil
+}
+
+// WriteFile writes the index to path atomically
+func (b *Builder) WriteFile(path string) (Stats, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return Stats{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := b.WriteTo(tmp)
+	if err != nil {
+		tmp.Close()
+		return Stats{}, fmt.Errorf("writing index: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return Stats{}, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return Stats{}, err
+	}
+
+	return Stats{
+		Songs:     len(b.songs),
+		Hashes:    countKeys(b.entries),
+		Couples:   len(b.entries),
+		SizeBytes: n,
+	}, nil
+}
+
+// countKeys counts distinct hashes in sorted entries
+func countKeys(entries []entry) int {
+	n := 0
+	for i := range entries {
+		if i == 0 || entries[i].hash != entries[i-1].hash {
+			n++
+		}
+	}
+	return n
+}
+
+// countingWriter remembers the first error so writes can be chained
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
@@ -0,0 +1,124 @@
+// Package index implements a compact, read-only fingerprint index file.
+//
+// The catalogue is compiled once (see Builder) and then memory-mapped, so a
+// lookup is a binary search plus a few varint decodes instead of a database
+// query. All integers are little-endian.
+//
+//	header      64 bytes, see below
+//	directory   (1<<bucketBits)+1 uint32: first key index of each bucket,
+//	            where a hash's bucket is its top bucketBits bits
+//	keys        keyCount uint32 hashes, sorted ascending
+//	postingOffs keyCount+1 uint64 offsets into the postings section
+//	postings    per key: uvarint count, then count (songDelta, anchorDelta)
+//	            uvarint pairs sorted by song then anchor time. songDelta is
+//	            relative to the previous entry's song; anchorDelta is relative
+//	            to the previous anchor of the same song, or absolute when the
+//	            song changes.
+//	songs       songCount records of uvarint-prefixed id, title, artist and
+//	            youtube ID strings, then uvarint duration (ms) and fingerprint
+//	            count. From version 3 each record ends with a uvarint-prefixed
+//	            JSON object of the remaining metadata (album, ISRC, tags...).
+//	            A song's position in this table is its compact ID.
+//	meta        (version 2) uvarint count, then uvarint-prefixed key and
+//	            value strings: the catalogue settings, such as the
+//	            fingerprint profile. It ends the file.
+//
+// Header layout:
+//
+//	0   magic "ADNAIDX\x00"
+//	8   uint32 format version
+//	12  uint32 bucketBits
+//	16  uint32 songCount
+//	20  uint32 meta section length (version 2; reserved in version 1)
+//	24  uint64 keyCount
+//	32  uint64 coupleCount
+//	40  uint64 postings section offset
+//	48  uint64 songs section offset
+//	56  uint64 total file size
+package index
+
+import (
+	"errors"
+	"time"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+const (
+	magic         = "ADNAIDX\x00"
+	formatVersion = 3
+	headerSize    = 64
+
+	minBucketBits = 4
+	maxBucketBits = 22
+)
+
+var (
+	// ErrReadOnly is returned by the Storage write methods of an Index
+	ErrReadOnly = errors.New("fingerprint index is read-only")
+
+	// ErrCorrupt is returned when a file isn't a valid index
+	ErrCorrupt = errors.New("corrupt fingerprint index")
+)
+
+// Stats describes the contents of an index file
+type Stats struct {
+	Songs     int
+	Hashes    int
+	Couples   int
+	SizeBytes int64
+}
+
+// bucketBitsFor sizes the directory to roughly eight keys per bucket
+func bucketBitsFor(keyCount int) uint {
+	bits := uint(minBucketBits)
+	for bits < maxBucketBits && (1<<bits)*8 < keyCount {
+		bits++
+	}
+	return bits
+}
+
+// sectionOffsets returns where the directory-derived sections start
+func sectionOffsets(bucketBits uint, keyCount uint64) (keysOff, postingOffsOff, postingsOff uint64) {
+	keysOff = headerSize + 4*(uint64(1)<<bucketBits+1)
+	postingOffsOff = keysOff + 4*keyCount
+	postingsOff = postingOffsOff + 8*(keyCount+1)
+	return keysOff, postingOffsOff, postingsOff
+}
+
+// songExtras is the JSON tail of a version 3 song record. New metadata can
+// be added here without changing the format version.
+type songExtras struct {
+	CreatedAt   time.Time         `json:"created_at,omitzero"`
+	SpotifyID   string            `json:"spotify_id,omitempty"`
+	Album       string            `json:"album,omitempty"`
+	ISRC        string            `json:"isrc,omitempty"`
+	Year        int               `json:"year,omitempty"`
+	Genre       string            `json:"genre,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	ExternalIDs map[string]string `json:"external_ids,omitempty"`
+}
+
+func extrasOf(song models.Song) songExtras {
+	return songExtras{
+		CreatedAt:   song.CreatedAt,
+		SpotifyID:   song.SpotifyID,
+		Album:       song.Album,
+		ISRC:        song.ISRC,
+		Year:        song.Year,
+		Genre:       song.Genre,
+		Tags:        song.Tags,
+		ExternalIDs: song.ExternalIDs,
+	}
+}
+
+func (e songExtras) apply(song *models.Song) {
+	song.CreatedAt = e.CreatedAt
+	song.SpotifyID = e.SpotifyID
+	song.Album = e.Album
+	song.ISRC = e.ISRC
+	song.Year = e.Year
+	song.Genre = e.Genre
+	song.Tags = e.Tags
+	song.ExternalIDs = e.ExternalIDs
+}
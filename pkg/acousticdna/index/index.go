@@ -0,0 +1,412 @@
+package index
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/storage"
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// Index is a memory-mapped fingerprint index. It implements the read side of
+// acousticdna.Storage; the write methods return ErrReadOnly. An Index is
+// immutable and safe for concurrent use.
+type Index struct {
+	data  []byte
+	unmap func() error
+
+	bits        uint
+	keyCount    uint64
+	coupleCount uint64
+	dir         []byte
+	keys        []byte
+	postingOffs []byte
+	postings    []byte
+
+	songs  []models.Song
+	counts []int
+	byID   map[string]int
+	meta   map[string]string
+}
+
+// Open maps the index file at path
+func Open(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	data, unmap, err := mapFile(f, int(info.Size()))
+	if err != nil {
+		return nil, fmt.Errorf("mapping index: %w", err)
+	}
+
+	ix := &Index{data: data, unmap: unmap}
+	if err := ix.parse(); err != nil {
+		unmap()
+		return nil, err
+	}
+	return ix, nil
+}
+
+// parse validates the header and slices the sections out of the mapping
+func (ix *Index) parse() error {
+	d := ix.data
+	if len(d) < headerSize || string(d[:8]) != magic {
+		return fmt.Errorf("%w: bad magic", ErrCorrupt)
+	}
+	version := binary.LittleEndian.Uint32(d[8:])
+	if version < 1 || version > formatVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrCorrupt, version)
+	}
+
+	ix.bits = uint(binary.LittleEndian.Uint32(d[12:]))
+	songCount := binary.LittleEndian.Uint32(d[16:])
+	ix.keyCount = binary.LittleEndian.Uint64(d[24:])
+	ix.coupleCount = binary.LittleEndian.Uint64(d[32:])
+	postingsOff := binary.LittleEndian.Uint64(d[40:])
+	songsOff := binary.LittleEndian.Uint64(d[48:])
+	total := binary.LittleEndian.Uint64(d[56:])
+
+	// Version 1 files have no meta section
+	var metaLen uint64
+	if version >= 2 {
+		metaLen = uint64(binary.LittleEndian.Uint32(d[20:]))
+	}
+
+	if ix.bits < minBucketBits || ix.bits > maxBucketBits || total != uint64(len(d)) {
+		return fmt.Errorf("%w: bad header", ErrCorrupt)
+	}
+	keysOff, postingOffsOff, wantPostingsOff := sectionOffsets(ix.bits, ix.keyCount)
+	if postingsOff != wantPostingsOff || postingsOff > songsOff || songsOff+metaLen > total {
+		return fmt.Errorf("%w: bad section offsets", ErrCorrupt)
+	}
+	metaOff := total - metaLen
+
+	ix.dir = d[headerSize:keysOff]
+	ix.keys = d[keysOff:postingOffsOff]
+	ix.postingOffs = d[postingOffsOff:postingsOff]
+	ix.postings = d[postingsOff:songsOff]
+
+	if err := ix.parseSongs(d[songsOff:metaOff], int(songCount), version); err != nil {
+		return err
+	}
+	return ix.parseMeta(d[metaOff:])
+}
+
+// parseMeta reads the key/value section; it is empty in version 1 files
+func (ix *Index) parseMeta(b []byte) error {
+	ix.meta = make(map[string]string)
+	if len(b) == 0 {
+		return nil
+	}
+
+	next := func() (string, error) {
+		n, k := binary.Uvarint(b)
+		if k <= 0 || n > uint64(len(b)-k) {
+			return "", fmt.Errorf("%w: truncated meta section", ErrCorrupt)
+		}
+		s := string(b[k : k+int(n)])
+		b = b[k+int(n):]
+		return s, nil
+	}
+
+	count, n := binary.Uvarint(b)
+	if n <= 0 {
+		return fmt.Errorf("%w: truncated meta section", ErrCorrupt)
+	}
+	b = b[n:]
+	for i := uint64(0); i < count; i++ {
+		key, err := next()
+		if err != nil {
+			return err
+		}
+		value, err := next()
+		if err != nil {
+			return err
+		}
+		ix.meta[key] = value
+	}
+	return nil
+}
+
+// parseSongs reads the song table; records carry no extra metadata before
+// version 3
+func (ix *Index) parseSongs(b []byte, count int, version uint32) error {
+	ix.songs = make([]models.Song, 0, count)
+	ix.counts = make([]int, 0, count)
+	ix.byID = make(map[string]int, count)
+
+	readUvarint := func() (uint64, error) {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return 0, fmt.Errorf("%w: truncated song table", ErrCorrupt)
+		}
+		b = b[n:]
+		return v, nil
+	}
+	readString := func() (string, error) {
+		n, err := readUvarint()
+		if err != nil {
+			return "", err
+		}
+		if n > uint64(len(b)) {
+			return "", fmt.Errorf("%w: truncated song table", ErrCorrupt)
+		}
+		s := string(b[:n])
+		b = b[n:]
+		return s, nil
+	}
+
+	for i := 0; i < count; i++ {
+		var song models.Song
+		var err error
+		for _, field := range []*string{&song.ID, &song.Title, &song.Artist, &song.YouTubeID} {
+			if *field, err = readString(); err != nil {
+				return err
+			}
+		}
+		duration, err := readUvarint()
+		if err != nil {
+			return err
+		}
+		fpCount, err := readUvarint()
+		if err != nil {
+			return err
+		}
+		song.DurationMs = int(duration)
+		if version >= 3 {
+			raw, err := readString()
+			if err != nil {
+				return err
+			}
+			var extras songExtras
+			if err := json.Unmarshal([]byte(raw), &extras); err != nil {
+				return fmt.Errorf("%w: song %s: %v", ErrCorrupt, song.ID, err)
+			}
+			extras.apply(&song)
+		}
+
+		ix.byID[song.ID] = len(ix.songs)
+		ix.songs = append(ix.songs, song)
+		ix.counts = append(ix.counts, int(fpCount))
+	}
+	return nil
+}
+
+// Stats summarises the index
+func (ix *Index) Stats() Stats {
+	return Stats{
+		Songs:     len(ix.songs),
+		Hashes:    int(ix.keyCount),
+		Couples:   int(ix.coupleCount),
+		SizeBytes: int64(len(ix.data)),
+	}
+}
+
+// SizeBytes returns the size of the index file
+func (ix *Index) SizeBytes() (int64, error) {
+	return int64(len(ix.data)), nil
+}
+
+// find returns the key position of hash
+func (ix *Index) find(hash uint32) (int, bool) {
+	bucket := uint64(hash) >> (32 - ix.bits)
+	lo := int(binary.LittleEndian.Uint32(ix.dir[4*bucket:]))
+	hi := int(binary.LittleEndian.Uint32(ix.dir[4*(bucket+1):]))
+
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return binary.LittleEndian.Uint32(ix.keys[4*(lo+i):]) >= hash
+	})
+	if i < hi && binary.LittleEndian.Uint32(ix.keys[4*i:]) == hash {
+		return i, true
+	}
+	return 0, false
+}
+
+// appendCouples decodes the postings of key i onto out
+func (ix *Index) appendCouples(out []models.Couple, i int) ([]models.Couple, error) {
+	start := binary.LittleEndian.Uint64(ix.postingOffs[8*i:])
+	end := binary.LittleEndian.Uint64(ix.postingOffs[8*(i+1):])
+	if start > end || end > uint64(len(ix.postings)) {
+		return out, fmt.Errorf("%w: bad posting offsets", ErrCorrupt)
+	}
+	p := ix.postings[start:end]
+
+	next := func() (uint64, error) {
+		v, n := binary.Uvarint(p)
+		if n <= 0 {
+			return 0, fmt.Errorf("%w: truncated postings", ErrCorrupt)
+		}
+		p = p[n:]
+		return v, nil
+	}
+
+	count, err := next()
+	if err != nil {
+		return out, err
+	}
+	var song, anchor uint64
+	for j := uint64(0); j < count; j++ {
+		songDelta, err := next()
+		if err != nil {
+			return out, err
+		}
+		anchorDelta, err := next()
+		if err != nil {
+			return out, err
+		}
+		if songDelta != 0 {
+			anchor = 0
+		}
+		song += songDelta
+		anchor += anchorDelta
+		if song >= uint64(len(ix.songs)) {
+			return out, fmt.Errorf("%w: song reference out of range", ErrCorrupt)
+		}
+		out = append(out, models.Couple{SongID: ix.songs[song].ID, AnchorTimeMs: uint32(anchor)})
+	}
+	return out, nil
+}
+
+func (ix *Index) GetCouplesByHash(hash uint32) ([]models.Couple, error) {
+	if ix.data == nil {
+		return nil, storage.ErrClosed
+	}
+	i, ok := ix.find(hash)
+	if !ok {
+		return []models.Couple{}, nil
+	}
+	return ix.appendCouples(nil, i)
+}
+
+func (ix *Index) GetCouplesByHashes(hashes []uint32) (map[uint32][]models.Couple, error) {
+	if ix.data == nil {
+		return nil, storage.ErrClosed
+	}
+	result := make(map[uint32][]models.Couple)
+	for _, h := range hashes {
+		if _, done := result[h]; done {
+			continue
+		}
+		i, ok := ix.find(h)
+		if !ok {
+			continue
+		}
+		couples, err := ix.appendCouples(nil, i)
+		if err != nil {
+			return nil, err
+		}
+		result[h] = couples
+	}
+	return result, nil
+}
+
+func (ix *Index) GetSongByID(songID string) (*models.Song, error) {
+	if ix.data == nil {
+		return nil, storage.ErrClosed
+	}
+	i, ok := ix.byID[songID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", storage.ErrSongNotFound, songID)
+	}
+	song := ix.songs[i].Clone()
+	return &song, nil
+}
+
+func (ix *Index) GetFingerprintCount(songID string) (int, error) {
+	if ix.data == nil {
+		return 0, storage.ErrClosed
+	}
+	i, ok := ix.byID[songID]
+	if !ok {
+		return 0, nil
+	}
+	return ix.counts[i], nil
+}
+
+func (ix *Index) ListSongs() ([]models.Song, error) {
+	if ix.data == nil {
+		return nil, storage.ErrClosed
+	}
+	songs := make([]models.Song, len(ix.songs))
+	for i, song := range ix.songs {
+		songs[i] = song.Clone()
+	}
+	return songs, nil
+}
+
+func (ix *Index) QuerySongs(q models.SongQuery) (*models.SongPage, error) {
+	songs, err := ix.ListSongs()
+	if err != nil {
+		return nil, err
+	}
+	return storage.SelectSongs(songs, q)
+}
+
+// ForEachFingerprint walks every stored couple in hash order, so an index
+// can itself be the Source of a rebuild
+func (ix *Index) ForEachFingerprint(fn func(hash uint32, c models.Couple) error) error {
+	if ix.data == nil {
+		return storage.ErrClosed
+	}
+	var buf []models.Couple
+	for i := 0; i < int(ix.keyCount); i++ {
+		hash := binary.LittleEndian.Uint32(ix.keys[4*i:])
+		var err error
+		if buf, err = ix.appendCouples(buf[:0], i); err != nil {
+			return err
+		}
+		for _, c := range buf {
+			if err := fn(hash, c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (ix *Index) GetMeta(key string) (string, error) {
+	if ix.data == nil {
+		return "", storage.ErrClosed
+	}
+	return ix.meta[key], nil
+}
+
+func (ix *Index) SetMeta(key, value string) error {
+	return ErrReadOnly
+}
+
+func (ix *Index) RegisterSong(title, artist, youtubeID string, durationMs int) (string, bool, error) {
+	return "", false, ErrReadOnly
+}
+
+func (ix *Index) StoreFingerprints(fingerprints map[uint32][]models.Couple) error {
+	return ErrReadOnly
+}
+
+func (ix *Index) DeleteSongByID(songID string) error {
+	return ErrReadOnly
+}
+
+func (ix *Index) UpdateSong(song *models.Song) error {
+	return ErrReadOnly
+}
+
+// Close unmaps the file. The Index must not be used afterwards.
+func (ix *Index) Close() error {
+	if ix.data == nil {
+		return nil
+	}
+	ix.data = nil
+	return ix.unmap()
+}
@@ -2,22 +2,37 @@ package acousticdna
 
 import (
 	"context"
+	"io"
 
 	"github.com/himanishpuri/AcousticDNA/pkg/models"
 )
 
 type Service interface {
 	AddSong(ctx context.Context, audioPath, title, artist, youtubeID string) (string, error)
+	AddSongReader(ctx context.Context, r io.Reader, title, artist, youtubeID string) (string, error)
+	FingerprintReader(ctx context.Context, r io.Reader) (*models.SongFingerprints, error)
+	StoreSong(song models.Song, fp *models.SongFingerprints) (string, error)
 	MatchSong(ctx context.Context, audioPath string) ([]models.MatchResult, error)
-	MatchHashes(ctx context.Context, hashes map[uint32]uint32) ([]models.MatchResult, error)
+	MatchReader(ctx context.Context, r io.Reader) ([]models.MatchResult, error)
+	MatchReaderWithDiagnostics(ctx context.Context, r io.Reader) ([]models.MatchResult, *models.QueryDiagnostics, error)
+	MatchHashes(ctx context.Context, profile FingerprintProfile, query []models.HashPair) ([]models.MatchResult, error)
+	AnalyzeTimeline(ctx context.Context, r io.Reader, opts ...TimelineOption) (*models.Timeline, error)
+	FindDuplicates(ctx context.Context, opts ...DuplicateOption) ([]models.DuplicateCluster, error)
+	MergeDuplicates(cluster models.DuplicateCluster) (string, error)
+	Profile() FingerprintProfile
 	GetSongByID(songID string) (*models.Song, error)
 	ListSongs() ([]models.Song, error)
+	QuerySongs(q models.SongQuery) (*models.SongPage, error)
+	UpdateSong(songID string, update models.SongUpdate) (*models.Song, error)
 	DeleteSong(songID string) error
 	Close() error
 }
 
 type Storage interface {
-	RegisterSong(title, artist, youtubeID string, durationMs int) (string, error)
+	// RegisterSong returns the ID of the song with title and artist, adding
+	// it if there is none; created tells which. An existing song only gets
+	// a missing YouTube ID filled in.
+	RegisterSong(title, artist, youtubeID string, durationMs int) (id string, created bool, err error)
 	StoreFingerprints(fingerprints map[uint32][]models.Couple) error
 	GetCouplesByHash(hash uint32) ([]models.Couple, error)
 	GetCouplesByHashes(hashes []uint32) (map[uint32][]models.Couple, error)
@@ -25,9 +40,46 @@ type Storage interface {
 	GetSongByID(songID string) (*models.Song, error)
 	GetFingerprintCount(songID string) (int, error)
 	ListSongs() ([]models.Song, error)
+	QuerySongs(q models.SongQuery) (*models.SongPage, error)
+
+	// UpdateSong replaces the metadata of the song with song.ID; its duration
+	// and fingerprints are kept
+	UpdateSong(song *models.Song) error
+
+	// GetMeta returns a catalogue-wide setting, or "" when it was never set
+	GetMeta(key string) (string, error)
+	SetMeta(key, value string) error
+
 	Close() error
 }
 
+// JobStore persists background ingestion jobs. The writable built-in
+// backends implement it alongside Storage.
+type JobStore interface {
+	SaveJob(job *models.Job) error
+	GetJob(id string) (*models.Job, error)
+	ListJobs() ([]models.Job, error)
+	DeleteJob(id string) error
+}
+
+// KeyStore persists the server's API keys. The writable built-in backends
+// implement it alongside Storage.
+type KeyStore interface {
+	// SaveAPIKey inserts key or replaces the stored copy
+	SaveAPIKey(key *models.APIKey) error
+	GetAPIKey(id string) (*models.APIKey, error)
+	// FindAPIKey returns the key with the given hash, revoked or not
+	FindAPIKey(hash string) (*models.APIKey, error)
+	// ListAPIKeys returns every key, oldest first
+	ListAPIKeys() ([]models.APIKey, error)
+}
+
+// SizeReporter tells how much space a catalogue takes. The built-in
+// backends that keep it on disk implement it alongside Storage.
+type SizeReporter interface {
+	SizeBytes() (int64, error)
+}
+
 type Logger interface {
 	Infof(format string, args ...any)
 	Warnf(format string, args ...any)
@@ -0,0 +1,614 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+package acousticdna
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/audio"
+	"github.com/himanishpuri/AcousticDNA/pkg/logger"
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+	"github.com/himanishpuri/AcousticDNA/pkg/utils"
+)
+
+var (
+	// ErrJobQueueFull is returned by Submit when MaxQueued jobs are waiting
+	ErrJobQueueFull = errors.New("job queue is full")
+
+	// ErrJobFinished is returned when cancelling a job that already ended
+	ErrJobFinished = errors.New("job has already finished")
+)
+
+// JobConfig tunes a JobQueue
+type JobConfig struct {
+	// Workers is how many jobs run at once
+	Workers int
+
+	// MaxQueued is how many jobs may wait before Submit refuses more
+	MaxQueued int
+
+	// SpoolDir holds uploads until their job has run. It should survive a
+	// restart for queued file jobs to resume.
+	SpoolDir string
+
+	// TempDir is scratch space for downloads and conversions
+	TempDir string
+
+	// Timeout bounds a single job
+	Timeout time.Duration
+
+	// Retention is how long finished jobs stay queryable
+	Retention time.Duration
+
+	Logger Logger
+}
+
+type JobOption func(*JobConfig)
+
+func WithJobWorkers(n int) JobOption {
+	return func(c *JobConfig) {
+		if n > 0 {
+			c.Workers = n
+		}
+	}
+}
+
+func WithJobQueueLimit(n int) JobOption {
+	return func(c *JobConfig) {
+		if n > 0 {
+			c.MaxQueued = n
+		}
+	}
+}
+
+// WithJobDirs sets where uploads are spooled and where jobs do their work
+func WithJobDirs(spoolDir, tempDir string) JobOption {
+	return func(c *JobConfig) {
+		if spoolDir != "" {
+			c.SpoolDir = spoolDir
+		}
+		if tempDir != "" {
+			c.TempDir = tempDir
+		}
+	}
+}
+
+func WithJobTimeout(d time.Duration) JobOption {
+	return func(c *JobConfig) {
+		if d > 0 {
+			c.Timeout = d
+		}
+	}
+}
+
+func WithJobRetention(d time.Duration) JobOption {
+	return func(c *JobConfig) {
+		if d > 0 {
+			c.Retention = d
+		}
+	}
+}
+
+func WithJobLogger(log Logger) JobOption {
+	return func(c *JobConfig) {
+		c.Logger = log
+	}
+}
+
+func defaultJobConfig() *JobConfig {
+	return &JobConfig{
+		Workers:   2,
+		MaxQueued: 100,
+		SpoolDir:  filepath.Join(os.TempDir(), "acousticdna-jobs"),
+		TempDir:   os.TempDir(),
+		Timeout:   30 * time.Minute,
+		Retention: 24 * time.Hour,
+	}
+}
+
+// JobQueue adds songs in the background. Jobs are persisted in a JobStore
+// as they move through their stages, so a restarted queue picks up the ones
+// that were waiting or interrupted.
+type JobQueue struct {
+	svc   Service
+	store JobStore
+	cfg   *JobConfig
+	log   Logger
+
+	mu      sync.Mutex
+	pending []string // queued job IDs, oldest first
+	running map[string]*runningJob
+	wake    chan struct{}
+	drain   bool // Set by StopStarting; no more jobs are started
+
+	stop context.CancelFunc
+	wg   sync.WaitGroup
+}
+
+type runningJob struct {
+	cancel   context.CancelFunc
+	canceled bool
+	done     chan struct{}
+}
+
+func NewJobQueue(svc Service, store JobStore, opts ...JobOption) *JobQueue {
+	cfg := defaultJobConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = logger.GetLogger()
+	}
+
+	return &JobQueue{
+		svc:     svc,
+		store:   store,
+		cfg:     cfg,
+		log:     cfg.Logger,
+		running: make(map[string]*runningJob),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Start drops expired jobs, re-queues unfinished ones and starts the
+// workers. They run until ctx is cancelled or Close is called.
+func (q *JobQueue) Start(ctx context.Context) error {
+	if err := utils.MakeDir(q.cfg.SpoolDir); err != nil {
+		return fmt.Errorf("creating spool directory: %w", err)
+	}
+
+	jobs, err := q.store.ListJobs()
+	if err != nil {
+		return fmt.Errorf("loading jobs: %w", err)
+	}
+
+	resumed := 0
+	for i := range jobs {
+		job := &jobs[i]
+		if job.Status.Done() {
+			if time.Since(job.UpdatedAt) > q.cfg.Retention {
+				q.forget(job)
+			}
+			continue
+		}
+
+		// Whatever a job was doing when the process stopped starts over
+		job.Status, job.Stage = models.JobQueued, ""
+		if job.Kind == models.JobFromFile {
+			if _, err := os.Stat(job.Source); err != nil {
+				q.finish(job, models.JobFailed, "uploaded audio is gone: "+err.Error())
+				continue
+			}
+		}
+		if err := q.save(job); err != nil {
+			return err
+		}
+		q.pending = append(q.pending, job.ID)
+		resumed++
+	}
+	if resumed > 0 {
+		q.log.Infof("Resuming %d unfinished job(s)", resumed)
+	}
+
+	ctx, q.stop = context.WithCancel(ctx)
+	for i := 0; i < q.cfg.Workers; i++ {
+		q.wg.Add(1)
+		go q.work(ctx)
+	}
+	q.wg.Add(1)
+	go q.expire(ctx)
+	q.notify()
+	return nil
+}
+
+// expire periodically deletes finished jobs older than the retention period
+func (q *JobQueue) expire(ctx context.Context) {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		jobs, err := q.store.ListJobs()
+		if err != nil {
+			q.log.Warnf("Listing jobs to expire: %v", err)
+			continue
+		}
+		for i := range jobs {
+			if jobs[i].Status.Done() && time.Since(jobs[i].UpdatedAt) > q.cfg.Retention {
+				q.forget(&jobs[i])
+			}
+		}
+	}
+}
+
+// Close stops the workers. Running jobs are interrupted and left queued, to
+// be resumed by the next Start.
+func (q *JobQueue) Close() {
+	if q.stop != nil {
+		q.stop()
+	}
+	q.wg.Wait()
+}
+
+// StopStarting stops the workers taking up queued jobs; running jobs carry
+// on. Jobs queued from then on wait for the next Start.
+func (q *JobQueue) StopStarting() {
+	q.mu.Lock()
+	q.drain = true
+	q.mu.Unlock()
+}
+
+// Drain stops starting queued jobs and waits for running ones to finish,
+// then closes the queue. If ctx ends first the jobs still running are
+// interrupted as by Close and ctx's error is returned. Jobs that were never
+// started stay queued for the next Start.
+func (q *JobQueue) Drain(ctx context.Context) error {
+	q.StopStarting()
+	q.mu.Lock()
+	running := make([]*runningJob, 0, len(q.running))
+	for _, run := range q.running {
+		running = append(running, run)
+	}
+	q.mu.Unlock()
+
+	if len(running) > 0 {
+		q.log.Infof("Waiting for %d running job(s) to finish", len(running))
+	}
+	for _, run := range running {
+		select {
+		case <-run.done:
+		case <-ctx.Done():
+			q.Close()
+			return ctx.Err()
+		}
+	}
+	q.Close()
+	return nil
+}
+
+// SubmitFile spools an uploaded recording and queues it to be added. name
+// is the upload's file name, kept for its extension.
+func (q *JobQueue) SubmitFile(r io.Reader, name, title, artist, youtubeID string) (*models.Job, error) {
+	if err := q.checkCapacity(); err != nil {
+		return nil, err
+	}
+
+	job := q.newJob(models.JobFromFile, title, artist, youtubeID)
+	job.Source = filepath.Join(q.cfg.SpoolDir, job.ID+filepath.Ext(name))
+
+	f, err := os.Create(job.Source)
+	if err != nil {
+		return nil, fmt.Errorf("spooling upload: %w", err)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(job.Source)
+		return nil, fmt.Errorf("spooling upload: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(job.Source)
+		return nil, fmt.Errorf("spooling upload: %w", err)
+	}
+
+	if err := q.enqueue(job); err != nil {
+		os.Remove(job.Source)
+		return nil, err
+	}
+	return job, nil
+}
+
+// SubmitYouTube queues a YouTube video to be downloaded and added. Missing
+// title and artist are taken from the video's metadata.
+func (q *JobQueue) SubmitYouTube(url, title, artist string) (*models.Job, error) {
+	if err := q.checkCapacity(); err != nil {
+		return nil, err
+	}
+
+	youtubeID, err := utils.ExtractYouTubeID(url)
+	if err != nil {
+		q.log.Warnf("Failed to extract YouTube ID: %v", err)
+		youtubeID = ""
+	}
+	job := q.newJob(models.JobFromYouTube, title, artist, youtubeID)
+	job.Source = url
+
+	if err := q.enqueue(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (q *JobQueue) Get(id string) (*models.Job, error) {
+	return q.store.GetJob(id)
+}
+
+// List returns the jobs still kept, oldest first
+func (q *JobQueue) List() ([]models.Job, error) {
+	return q.store.ListJobs()
+}
+
+// Cancel stops a job. A queued job is dropped at once; a running one is
+// interrupted and Cancel waits for it to wind down. It returns the job as
+// it ended.
+func (q *JobQueue) Cancel(id string) (*models.Job, error) {
+	// Only the queue's own state is read under the lock; the store is
+	// consulted after, so a slow store doesn't hold up the workers
+	q.mu.Lock()
+	if run, ok := q.running[id]; ok {
+		run.canceled = true
+		run.cancel()
+		q.mu.Unlock()
+		<-run.done
+		return q.store.GetJob(id)
+	}
+	queuedAt := slices.Index(q.pending, id)
+	if queuedAt >= 0 {
+		q.pending = slices.Delete(q.pending, queuedAt, queuedAt+1)
+	}
+	q.mu.Unlock()
+
+	job, err := q.store.GetJob(id)
+	if err != nil {
+		if queuedAt >= 0 {
+			// Leave the job queued where it was
+			q.mu.Lock()
+			q.pending = slices.Insert(q.pending, min(queuedAt, len(q.pending)), id)
+			q.mu.Unlock()
+			q.notify()
+		}
+		return nil, err
+	}
+	if job.Status.Done() {
+		return job, ErrJobFinished
+	}
+
+	q.finish(job, models.JobCanceled, "")
+	q.log.Infof("Canceled queued job %s", id)
+	return job, nil
+}
+
+func (q *JobQueue) newJob(kind models.JobKind, title, artist, youtubeID string) *models.Job {
+	now := time.Now().UTC()
+	return &models.Job{
+		ID:        utils.GenerateUUID(),
+		Kind:      kind,
+		Status:    models.JobQueued,
+		Title:     title,
+		Artist:    artist,
+		YouTubeID: youtubeID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// checkCapacity refuses a submission early, before an upload is spooled.
+// enqueue checks again, since other submissions may have filled the queue
+// in the meantime.
+func (q *JobQueue) checkCapacity() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) >= q.cfg.MaxQueued {
+		return ErrJobQueueFull
+	}
+	return nil
+}
+
+// enqueue saves a job and appends it to the queue. The capacity check,
+// save and append happen under one lock, so concurrent submissions can't
+// overfill the queue.
+func (q *JobQueue) enqueue(job *models.Job) error {
+	q.mu.Lock()
+	if len(q.pending) >= q.cfg.MaxQueued {
+		q.mu.Unlock()
+		return ErrJobQueueFull
+	}
+	if err := q.save(job); err != nil {
+		q.mu.Unlock()
+		return err
+	}
+	q.pending = append(q.pending, job.ID)
+	q.mu.Unlock()
+	q.notify()
+
+	q.log.Infof("Queued %s job %s", job.Kind, job.ID)
+	return nil
+}
+
+func (q *JobQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next takes the oldest pending job and marks it running
+func (q *JobQueue) next(ctx context.Context) (string, context.Context, *runningJob) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 || q.drain {
+		return "", nil, nil
+	}
+	id := q.pending[0]
+	q.pending = q.pending[1:]
+	if len(q.pending) > 0 {
+		// Let another idle worker pick up the rest
+		q.notify()
+	}
+
+	jobCtx, cancel := context.WithTimeout(ctx, q.cfg.Timeout)
+	run := &runningJob{cancel: cancel, done: make(chan struct{})}
+	q.running[id] = run
+	return id, jobCtx, run
+}
+
+func (q *JobQueue) work(ctx context.Context) {
+	defer q.wg.Done()
+
+	for {
+		id, jobCtx, run := q.next(ctx)
+		if run == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.wake:
+				continue
+			}
+		}
+
+		q.process(ctx, jobCtx, id, run)
+		run.cancel()
+
+		q.mu.Lock()
+		delete(q.running, id)
+		q.mu.Unlock()
+		close(run.done)
+	}
+}
+
+func (q *JobQueue) process(ctx, jobCtx context.Context, id string, run *runningJob) {
+	job, err := q.store.GetJob(id)
+	if err != nil {
+		q.log.Errorf("Loading job %s: %v", id, err)
+		return
+	}
+
+	job.Status = models.JobRunning
+	if err := q.save(job); err != nil {
+		q.log.Errorf("%v", err)
+		return
+	}
+
+	songID, err := q.run(jobCtx, job)
+
+	q.mu.Lock()
+	canceled := run.canceled
+	q.mu.Unlock()
+
+	switch {
+	case err == nil:
+		job.SongID, job.Stage = songID, ""
+		q.finish(job, models.JobSucceeded, "")
+		q.log.Infof("Job %s added %s by %s (ID: %s)", job.ID, job.Title, job.Artist, songID)
+	case canceled:
+		q.finish(job, models.JobCanceled, "")
+		q.log.Infof("Canceled running job %s", job.ID)
+	case ctx.Err() != nil:
+		// Shutting down: leave the job for the next Start
+		job.Status, job.Stage = models.JobQueued, ""
+		if err := q.save(job); err != nil {
+			q.log.Errorf("%v", err)
+		}
+	default:
+		q.finish(job, models.JobFailed, err.Error())
+		q.log.Errorf("Job %s failed: %v", job.ID, err)
+	}
+}
+
+// run takes a job through its stages and returns the stored song's ID
+func (q *JobQueue) run(ctx context.Context, job *models.Job) (string, error) {
+	workDir, err := os.MkdirTemp(q.cfg.TempDir, "acousticdna-job-*")
+	if err != nil {
+		return "", fmt.Errorf("creating work directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	rate := q.svc.Profile().SampleRate
+	source := job.Source
+	var song models.Song
+	if job.Kind == models.JobFromYouTube {
+		q.setStage(job, models.StageDownloading)
+		path, meta, err := audio.DownloadYouTubeAudio(ctx, job.Source, workDir, rate)
+		if err != nil {
+			return "", fmt.Errorf("downloading YouTube video: %w", err)
+		}
+		source = path
+		song = SongFromYouTube(meta)
+
+		if job.Title == "" {
+			job.Title = meta.Title
+		}
+		if job.Artist == "" {
+			job.Artist = meta.Artist
+		}
+		if job.Title == "" || job.Artist == "" {
+			return "", errors.New("could not determine title or artist from YouTube metadata; provide them explicitly")
+		}
+	} else if meta, err := audio.ReadMetadata(ctx, source); err == nil {
+		song = SongFromTags(meta)
+	}
+
+	// The source is decoded as it is fingerprinted, with no converted copy
+	q.setStage(job, models.StageFingerprinting)
+	f, err := os.Open(source)
+	if err != nil {
+		return "", fmt.Errorf("opening audio: %w", err)
+	}
+	fp, err := q.svc.FingerprintReader(ctx, f)
+	f.Close()
+	if err != nil {
+		return "", err
+	}
+
+	// Storing is not interruptible, so honour a cancel that came in while
+	// fingerprinting finished
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	q.setStage(job, models.StageStoring)
+	song.Title, song.Artist = job.Title, job.Artist
+	if job.YouTubeID != "" {
+		song.YouTubeID = job.YouTubeID
+	}
+	return q.svc.StoreSong(song, fp)
+}
+
+func (q *JobQueue) setStage(job *models.Job, stage models.JobStage) {
+	job.Stage = stage
+	if err := q.save(job); err != nil {
+		q.log.Warnf("%v", err)
+	}
+}
+
+// finish records how a job ended and drops its spooled upload
+func (q *JobQueue) finish(job *models.Job, status models.JobStatus, errMsg string) {
+	job.Status, job.Error = status, errMsg
+	if err := q.save(job); err != nil {
+		q.log.Errorf("%v", err)
+	}
+	if job.Kind == models.JobFromFile {
+		os.Remove(job.Source)
+	}
+}
+
+// forget deletes an expired job and anything it left behind
+func (q *JobQueue) forget(job *models.Job) {
+	if err := q.store.DeleteJob(job.ID); err != nil {
+		q.log.Warnf("Deleting expired job %s: %v", job.ID, err)
+	}
+	if job.Kind == models.JobFromFile {
+		os.Remove(job.Source)
+	}
+}
+
+func (q *JobQueue) save(job *models.Job) error {
+	job.UpdatedAt = time.Now().UTC()
+	if err := q.store.SaveJob(job); err != nil {
+		return fmt.Errorf("saving job %s: %w", job.ID, err)
+	}
+	return nil
+}
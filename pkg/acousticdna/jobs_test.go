@@ -0,0 +1,212 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+package acousticdna
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+func newTestJobQueue(t *testing.T, stor Storage, jobs JobStore, opts ...JobOption) *JobQueue {
+	t.Helper()
+	opts = append([]JobOption{WithJobDirs(t.TempDir(), t.TempDir())}, opts...)
+	return NewJobQueue(newTestService(t, stor), jobs, opts...)
+}
+
+// slowJobStore takes a while to save a job, as a database would
+type slowJobStore struct {
+	JobStore
+}
+
+func (s slowJobStore) SaveJob(job *models.Job) error {
+	time.Sleep(5 * time.Millisecond)
+	return s.JobStore.SaveJob(job)
+}
+
+func TestJobQueueLimitHoldsUnderConcurrentSubmits(t *testing.T) {
+	const limit = 5
+	stor := NewMemoryStorage()
+	q := newTestJobQueue(t, stor, slowJobStore{stor.(JobStore)}, WithJobQueueLimit(limit))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	start := make(chan struct{})
+	queued := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			var err error
+			if i%2 == 0 {
+				_, err = q.SubmitYouTube("https://www.youtube.com/watch?v=dQw4w9WgXcQ", "Song", "Artist")
+			} else {
+				_, err = q.SubmitFile(strings.NewReader("audio"), "song.wav", "Song", "Artist", "")
+			}
+			switch {
+			case err == nil:
+				mu.Lock()
+				queued++
+				mu.Unlock()
+			case !errors.Is(err, ErrJobQueueFull):
+				t.Errorf("submit: %v", err)
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	if queued != limit {
+		t.Errorf("%d jobs queued, want the limit of %d", queued, limit)
+	}
+	if len(q.pending) != limit {
+		t.Errorf("%d jobs pending, want %d", len(q.pending), limit)
+	}
+	spooled, err := os.ReadDir(q.cfg.SpoolDir)
+	if err != nil {
+		t.Fatalf("reading spool: %v", err)
+	}
+	for _, e := range spooled {
+		found := false
+		for _, id := range q.pending {
+			if strings.HasPrefix(e.Name(), id) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("upload of a refused job left in the spool: %s", e.Name())
+		}
+	}
+}
+
+func TestJobQueueAddsUpload(t *testing.T) {
+	stor := NewMemoryStorage()
+	q := newTestJobQueue(t, stor, stor.(JobStore))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := q.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer q.Close()
+
+	f, err := os.Open("../../test/testCroppedAudio/moosy_test.wav")
+	if err != nil {
+		t.Fatalf("opening fixture: %v", err)
+	}
+	defer f.Close()
+	job, err := q.SubmitFile(f, "moosy_test.wav", "Moosy", "Artist", "")
+	if err != nil {
+		t.Fatalf("SubmitFile: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Minute)
+	for !job.Status.Done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("job still %s/%s after a minute", job.Status, job.Stage)
+		}
+		time.Sleep(20 * time.Millisecond)
+		if job, err = q.Get(job.ID); err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+	}
+	if job.Status != models.JobSucceeded {
+		t.Fatalf("job ended %s: %s", job.Status, job.Error)
+	}
+	if n, err := stor.GetFingerprintCount(job.SongID); err != nil || n == 0 {
+		t.Errorf("stored song has %d fingerprints, %v", n, err)
+	}
+	if _, err := os.Stat(job.Source); !os.IsNotExist(err) {
+		t.Errorf("spooled upload not removed: %v", err)
+	}
+}
+
+// stalledJobStore holds every GetJob until release is closed
+type stalledJobStore struct {
+	JobStore
+	fetching chan struct{}
+	release  chan struct{}
+}
+
+func (s stalledJobStore) GetJob(id string) (*models.Job, error) {
+	s.fetching <- struct{}{}
+	<-s.release
+	return s.JobStore.GetJob(id)
+}
+
+func TestJobQueueCancelDoesNotHoldLockOverStore(t *testing.T) {
+	stor := NewMemoryStorage()
+	jobs := stalledJobStore{stor.(JobStore), make(chan struct{}, 1), make(chan struct{})}
+	q := newTestJobQueue(t, stor, jobs)
+
+	job, err := q.SubmitYouTube("https://www.youtube.com/watch?v=dQw4w9WgXcQ", "Song", "Artist")
+	if err != nil {
+		t.Fatalf("SubmitYouTube: %v", err)
+	}
+	canceled := make(chan error, 1)
+	go func() {
+		_, err := q.Cancel(job.ID)
+		canceled <- err
+	}()
+	<-jobs.fetching
+
+	// The store is stuck answering Cancel; submissions must still get through
+	submitted := make(chan error, 1)
+	go func() {
+		_, err := q.SubmitYouTube("https://www.youtube.com/watch?v=dQw4w9WgXcQ", "Other", "Artist")
+		submitted <- err
+	}()
+	select {
+	case err := <-submitted:
+		if err != nil {
+			t.Errorf("SubmitYouTube: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SubmitYouTube blocked behind Cancel's store lookup")
+	}
+
+	close(jobs.release)
+	if err := <-canceled; err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if job, err = stor.(JobStore).GetJob(job.ID); err != nil || job.Status != models.JobCanceled {
+		t.Errorf("canceled job: %+v, %v", job, err)
+	}
+	if len(q.pending) != 1 {
+		t.Errorf("%d jobs pending, want the later one", len(q.pending))
+	}
+}
+
+func TestJobQueueStopStartingLeavesJobsQueued(t *testing.T) {
+	stor := NewMemoryStorage()
+	q := newTestJobQueue(t, stor, stor.(JobStore))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := q.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer q.Close()
+
+	q.StopStarting()
+	job, err := q.SubmitFile(strings.NewReader("audio"), "song.wav", "Song", "Artist", "")
+	if err != nil {
+		t.Fatalf("SubmitFile: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := q.Drain(ctx); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	if job, err = q.Get(job.ID); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if job.Status != models.JobQueued {
+		t.Errorf("job submitted after StopStarting is %s, want it left queued", job.Status)
+	}
+}
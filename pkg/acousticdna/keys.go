@@ -0,0 +1,99 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+package acousticdna
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+	"github.com/himanishpuri/AcousticDNA/pkg/utils"
+)
+
+// APIKeyPrefix starts every API key, so that keys stand out in
+// configuration files and to secret scanners
+const APIKeyPrefix = "adna_"
+
+// apiKeyShownChars is how much of a key is kept in the clear to tell keys
+// apart in listings
+const apiKeyShownChars = len(APIKeyPrefix) + 6
+
+// ErrInvalidAPIKey is returned by AuthenticateAPIKey for a key that is
+// unknown or revoked
+var ErrInvalidAPIKey = errors.New("invalid or revoked API key")
+
+// CreateAPIKey generates a key for role and stores its hash. The returned
+// key is not stored anywhere and can't be shown again.
+func CreateAPIKey(store KeyStore, name string, role models.Role) (string, *models.APIKey, error) {
+	if !role.Valid() {
+		return "", nil, fmt.Errorf("unknown role %q", role)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, fmt.Errorf("generating API key: %w", err)
+	}
+	key := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	stored := &models.APIKey{
+		ID:        utils.GenerateUUID(),
+		Name:      name,
+		Role:      role,
+		Prefix:    key[:apiKeyShownChars],
+		Hash:      HashAPIKey(key),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := store.SaveAPIKey(stored); err != nil {
+		return "", nil, err
+	}
+	return key, stored, nil
+}
+
+// RevokeAPIKey stops the key with id from authenticating. Revoking a key
+// twice keeps the first revocation time.
+func RevokeAPIKey(store KeyStore, id string) (*models.APIKey, error) {
+	key, err := store.GetAPIKey(id)
+	if err != nil {
+		return nil, err
+	}
+	if key.Revoked() {
+		return key, nil
+	}
+	key.RevokedAt = time.Now().UTC()
+	if err := store.SaveAPIKey(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// AuthenticateAPIKey returns the stored key matching key if it is valid
+func AuthenticateAPIKey(store KeyStore, key string) (*models.APIKey, error) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	stored, err := store.FindAPIKey(HashAPIKey(key))
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stored.Revoked() {
+		return nil, ErrInvalidAPIKey
+	}
+	return stored, nil
+}
+
+// HashAPIKey returns the form a key is stored in. Keys are 256 random bits,
+// so a fast hash is as good as a password hash and keeps lookups cheap.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
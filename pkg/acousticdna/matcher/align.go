@@ -0,0 +1,279 @@
+// Package matcher turns hash hits between a query and the catalogue into
+// ranked song matches. Each song's hits are aligned in time with an offset
+// histogram; when enabled, a small range of playback speeds is searched as
+// well so sped-up or slowed-down sources still line up. The aligned songs
+// are then scored, filtered and sorted (see Matcher).
+package matcher
+
+import (
+	"math"
+	"sort"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// Hit is a hash found in both the query and a reference song
+type Hit struct {
+	QueryMs uint32
+	RefMs   uint32
+}
+
+// Options tune how hits are aligned
+type Options struct {
+	// ToleranceMs is the width of an offset histogram bin. The votes of the
+	// winning bin and both neighbours are summed, so offsets split by
+	// rounding jitter still add up.
+	ToleranceMs int32
+
+	// MaxSpeedDeviation is the largest playback speed change searched for,
+	// e.g. 0.05 for ±5%. Zero only considers the original speed.
+	MaxSpeedDeviation float64
+
+	// SpeedCandidates limits the speed search to the songs with the most
+	// raw hits; the rest are aligned at the original speed only
+	SpeedCandidates int
+
+	// Scorer computes each result's confidence from its counts alone; nil
+	// reports the match probability as a percentage instead
+	Scorer Scorer
+
+	// FalsePositiveRate is the share of queries of uncatalogued audio that
+	// may be reported as matched; see Result.Matched
+	FalsePositiveRate float64
+
+	// SortBy orders the results; ties fall back to score, then song ID
+	SortBy SortKey
+
+	// TopK keeps only the best K results; zero keeps all
+	TopK int
+
+	// MinScore and MinConfidence drop results below either cutoff
+	MinScore      int
+	MinConfidence float64
+
+	// SegmentGapMs is the longest stretch of query without aligned hits
+	// that a reported segment may span
+	SegmentGapMs int
+}
+
+func DefaultOptions() Options {
+	return Options{
+		ToleranceMs:       25,
+		MaxSpeedDeviation: 0.05,
+		SpeedCandidates:   20,
+		FalsePositiveRate: DefaultFalsePositiveRate,
+		SortBy:            SortByScore,
+		MinConfidence:     1,
+		SegmentGapMs:      2000,
+	}
+}
+
+const (
+	// maxSpeedSteps caps the speed grid on each side of 1.0
+	maxSpeedSteps = 100
+
+	// minHitsForFit is the fewest aligned hits a slope is fitted to
+	minHitsForFit = 8
+)
+
+// Collect gathers the hits of every query hash against the reference
+// buckets in db, grouped by song
+func Collect(query Query, db map[uint32][]models.Couple) map[string][]Hit {
+	hits := make(map[string][]Hit)
+	for _, q := range query {
+		for _, ref := range db[q.Hash] {
+			hits[ref.SongID] = append(hits[ref.SongID], Hit{QueryMs: q.AnchorTimeMs, RefMs: ref.AnchorTimeMs})
+		}
+	}
+	return hits
+}
+
+// Match aligns the query against the buckets in db and returns the best
+// alignment per song, strongest first. No cutoffs are applied; see Matcher.
+func Match(query Query, db map[uint32][]models.Couple, opts Options) []models.Match {
+	return Score(Collect(query, db), opts)
+}
+
+// Score aligns each song's hits and returns one match per song, strongest first
+func Score(hits map[string][]Hit, opts Options) []models.Match {
+	if opts.ToleranceMs < 1 {
+		opts.ToleranceMs = 1
+	}
+
+	// Only the strongest candidates are worth the cost of a speed search
+	speedSearch := make(map[string]bool)
+	if opts.MaxSpeedDeviation > 0 && opts.SpeedCandidates > 0 {
+		ids := make([]string, 0, len(hits))
+		for id, h := range hits {
+			if len(h) >= minHitsForFit {
+				ids = append(ids, id)
+			}
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			if len(hits[ids[i]]) != len(hits[ids[j]]) {
+				return len(hits[ids[i]]) > len(hits[ids[j]])
+			}
+			return ids[i] < ids[j]
+		})
+		if len(ids) > opts.SpeedCandidates {
+			ids = ids[:opts.SpeedCandidates]
+		}
+		for _, id := range ids {
+			speedSearch[id] = true
+		}
+	}
+
+	matches := make([]models.Match, 0, len(hits))
+	for songID, songHits := range hits {
+		a := align(songHits, opts, speedSearch[songID])
+		if a.count == 0 {
+			continue
+		}
+		matches = append(matches, models.Match{
+			SongID:     songID,
+			OffsetMs:   int32(math.Round(a.offset)),
+			Count:      a.count,
+			SpeedRatio: a.speed,
+		})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Count != matches[j].Count {
+			return matches[i].Count > matches[j].Count
+		}
+		return matches[i].SongID < matches[j].SongID
+	})
+	return matches
+}
+
+// alignment is the time correspondence refMs ≈ speed*queryMs + offset
+type alignment struct {
+	count  int
+	offset float64
+	speed  float64
+}
+
+// align finds the alignment that the most hits agree with
+func align(hits []Hit, opts Options, searchSpeed bool) alignment {
+	tol := float64(opts.ToleranceMs)
+
+	speeds := []float64{1}
+	if searchSpeed {
+		speeds = speedGrid(hits, tol, opts.MaxSpeedDeviation)
+	}
+
+	best := alignment{speed: 1}
+	for _, s := range speeds {
+		count, center := bestBin(hits, s, tol)
+		if count > best.count || (count == best.count && math.Abs(s-1) < math.Abs(best.speed-1)) {
+			best = alignment{count: count, offset: center, speed: s}
+		}
+	}
+	if best.count == 0 {
+		return best
+	}
+
+	if searchSpeed && best.count >= minHitsForFit {
+		if fitted, ok := fitLine(hits, best, tol, opts.MaxSpeedDeviation); ok && fitted.count >= best.count {
+			best = fitted
+		}
+	}
+
+	// Report the mean offset of the agreeing hits rather than the bin centre
+	var sum float64
+	n := 0
+	for _, h := range hits {
+		r := float64(h.RefMs) - best.speed*float64(h.QueryMs)
+		if math.Abs(r-best.offset) <= 1.5*tol {
+			sum += r
+			n++
+		}
+	}
+	if n > 0 {
+		best.offset = sum / float64(n)
+	}
+	return best
+}
+
+// speedGrid lists the speeds to try, spaced so that neighbouring speeds
+// drift apart by about one bin over the span of the query
+func speedGrid(hits []Hit, tol, maxDev float64) []float64 {
+	minQ, maxQ := hits[0].QueryMs, hits[0].QueryMs
+	for _, h := range hits {
+		if h.QueryMs < minQ {
+			minQ = h.QueryMs
+		}
+		if h.QueryMs > maxQ {
+			maxQ = h.QueryMs
+		}
+	}
+	span := float64(maxQ - minQ)
+	if span <= tol {
+		return []float64{1}
+	}
+
+	// A whole number of steps, so the grid ends exactly at ±maxDev
+	steps := min(int(math.Ceil(maxDev*span/tol)), maxSpeedSteps)
+	step := maxDev / float64(steps)
+
+	speeds := make([]float64, 0, 2*steps+1)
+	speeds = append(speeds, 1)
+	for k := 1; k <= steps; k++ {
+		speeds = append(speeds, 1+float64(k)*step, 1-float64(k)*step)
+	}
+	return speeds
+}
+
+// bestBin histograms refMs - speed*queryMs into bins of width tol and
+// returns the largest three-bin sum and the centre of that window
+func bestBin(hits []Hit, speed, tol float64) (int, float64) {
+	bins := make(map[int64]int, len(hits))
+	for _, h := range hits {
+		r := float64(h.RefMs) - speed*float64(h.QueryMs)
+		bins[int64(math.Floor(r/tol))]++
+	}
+
+	bestCount := 0
+	var bestBin int64
+	for b := range bins {
+		count := bins[b-1] + bins[b] + bins[b+1]
+		if count > bestCount || (count == bestCount && b < bestBin) {
+			bestCount = count
+			bestBin = b
+		}
+	}
+	return bestCount, (float64(bestBin) + 0.5) * tol
+}
+
+// fitLine refines a grid alignment with a least-squares fit through the
+// hits that agree with it, then recounts agreement with the fitted line
+func fitLine(hits []Hit, a alignment, tol, maxDev float64) (alignment, bool) {
+	var n, sq, sr, sqq, sqr float64
+	for _, h := range hits {
+		q, ref := float64(h.QueryMs), float64(h.RefMs)
+		if math.Abs(ref-a.speed*q-a.offset) > 1.5*tol {
+			continue
+		}
+		n++
+		sq += q
+		sr += ref
+		sqq += q * q
+		sqr += q * ref
+	}
+	den := n*sqq - sq*sq
+	if n < minHitsForFit || den == 0 {
+		return a, false
+	}
+
+	// Jitter can tip a fit at the edge of the range just past it
+	speed := math.Max(1-maxDev, math.Min(1+maxDev, (n*sqr-sq*sr)/den))
+	offset := (sr - speed*sq) / n
+
+	count := 0
+	for _, h := range hits {
+		if math.Abs(float64(h.RefMs)-speed*float64(h.QueryMs)-offset) <= 1.5*tol {
+			count++
+		}
+	}
+	return alignment{count: count, offset: offset, speed: speed}, true
+}
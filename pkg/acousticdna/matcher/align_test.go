@@ -0,0 +1,72 @@
+package matcher
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+// stretchedHits lines n query times spread over 10s up with a reference
+// played at speed, offset by offsetMs, with jitter of a few ms, among as
+// many hits at random offsets
+func stretchedHits(rng *rand.Rand, n int, speed, offsetMs float64) []Hit {
+	hits := make([]Hit, 0, 2*n)
+	for i := 0; i < n; i++ {
+		q := rng.Float64() * 10000
+		ref := speed*q + offsetMs + rng.Float64()*10 - 5
+		hits = append(hits, Hit{QueryMs: uint32(q), RefMs: uint32(ref)})
+	}
+	for i := 0; i < n; i++ {
+		hits = append(hits, Hit{QueryMs: uint32(rng.Float64() * 10000), RefMs: uint32(rng.Float64() * 200000)})
+	}
+	return hits
+}
+
+func TestScoreRecoversSpeedRatio(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	opts := DefaultOptions()
+	for _, speed := range []float64{0.95, 0.97, 1, 1.02, 1.05} {
+		hits := stretchedHits(rng, 200, speed, 60000)
+		matches := Score(map[string][]Hit{"song": hits}, opts)
+		if len(matches) != 1 {
+			t.Fatalf("speed %g: %d matches", speed, len(matches))
+		}
+		m := matches[0]
+		if math.Abs(m.SpeedRatio-speed) > 0.001 {
+			t.Errorf("speed %g: fitted %g", speed, m.SpeedRatio)
+		}
+		if math.Abs(float64(m.OffsetMs)-60000) > float64(opts.ToleranceMs) {
+			t.Errorf("speed %g: offset %dms, want 60000ms", speed, m.OffsetMs)
+		}
+		if m.Count < 190 {
+			t.Errorf("speed %g: %d of 200 stretched hits aligned", speed, m.Count)
+		}
+	}
+}
+
+func TestScoreWithoutSpeedSearch(t *testing.T) {
+	// At 4% over 10s the stretched hits drift 400ms, far wider than a bin,
+	// so without the speed search only a sliver of them lines up
+	hits := stretchedHits(rand.New(rand.NewPCG(3, 4)), 200, 1.04, 60000)
+	opts := DefaultOptions()
+	opts.MaxSpeedDeviation = 0
+	m := Score(map[string][]Hit{"song": hits}, opts)[0]
+	if m.SpeedRatio != 1 {
+		t.Errorf("speed %g without a speed search", m.SpeedRatio)
+	}
+	if m.Count > 50 {
+		t.Errorf("%d of 200 stretched hits aligned at the original speed", m.Count)
+	}
+}
+
+func TestScoreIgnoresSpeedsOutOfRange(t *testing.T) {
+	// A 10% stretch is beyond the ±5% searched
+	hits := stretchedHits(rand.New(rand.NewPCG(5, 6)), 200, 1.10, 60000)
+	m := Score(map[string][]Hit{"song": hits}, DefaultOptions())[0]
+	if math.Abs(m.SpeedRatio-1) > 0.05+1e-9 {
+		t.Errorf("fitted speed %g outside ±5%%", m.SpeedRatio)
+	}
+	if m.Count > 50 {
+		t.Errorf("%d of 200 hits at 10%% aligned", m.Count)
+	}
+}
@@ -0,0 +1,248 @@
+package matcher
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// Catalogue is the part of a fingerprint store the matcher reads from
+type Catalogue interface {
+	GetCouplesByHashes(hashes []uint32) (map[uint32][]models.Couple, error)
+	GetFingerprintCount(songID string) (int, error)
+}
+
+// SortKey orders ranked results
+type SortKey int
+
+const (
+	// SortByScore ranks by the number of aligned hashes
+	SortByScore SortKey = iota
+	// SortByConfidence ranks by the scorer's confidence
+	SortByConfidence
+)
+
+// Result is an aligned song with its confidence and where the alignment holds
+type Result struct {
+	models.Match
+	Confidence float64
+
+	// Probability (0-1) is the chance that the alignment is neither
+	// coincidence nor outdone by another song. Matched is set on the one
+	// result, if any, whose chance of being wrong is within the configured
+	// false-positive rate.
+	Probability float64
+	Matched     bool
+
+	Segments []models.Segment
+	Density  []int
+
+	// pNoise is the chance of the alignment being coincidence, and
+	// pConfuse the chance that another song is as good
+	pNoise   float64
+	pConfuse float64
+}
+
+// Stats describes the work done for a query
+type Stats struct {
+	Lookup time.Duration // Fetching the query's hash buckets from the catalogue
+	// Voting is the time spent aligning, scoring and ranking the hits,
+	// including the fingerprint counts ranking looks up
+	Voting     time.Duration
+	Candidates int // Songs sharing a hash with the query
+}
+
+// Matcher looks query hashes up in a catalogue, aligns them and ranks the
+// songs found. It holds no state between calls and is safe for concurrent use
+// if the catalogue is.
+type Matcher struct {
+	cat  Catalogue
+	opts Options
+}
+
+func New(cat Catalogue, opts Options) *Matcher {
+	if opts.FalsePositiveRate <= 0 {
+		opts.FalsePositiveRate = DefaultFalsePositiveRate
+	}
+	return &Matcher{cat: cat, opts: opts}
+}
+
+// Options returns the options the matcher was created with
+func (m *Matcher) Options() Options {
+	return m.opts
+}
+
+// Match identifies the query against the catalogue
+func (m *Matcher) Match(q Query) ([]Result, error) {
+	return m.MatchScaled(q, 1)
+}
+
+// MatchScaled identifies a query whose anchor times have been stretched by
+// scale, as when a query is re-hashed at a hypothesised playback speed.
+// Speed ratios, segments and density are reported against the original,
+// unstretched query.
+func (m *Matcher) MatchScaled(q Query, scale float64) ([]Result, error) {
+	return m.MatchTimed(q, scale, &Stats{})
+}
+
+// MatchTimed is MatchScaled that adds the time spent to stats, and raises
+// its candidates to those of this query if there are more
+func (m *Matcher) MatchTimed(q Query, scale float64, stats *Stats) ([]Result, error) {
+	if len(q) == 0 {
+		return []Result{}, nil
+	}
+
+	start := time.Now()
+	db, err := m.cat.GetCouplesByHashes(q.Hashes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve fingerprints from database: %w", err)
+	}
+	lookedUp := time.Now()
+	stats.Lookup += lookedUp.Sub(start)
+	defer func() { stats.Voting += time.Since(lookedUp) }()
+
+	var queryEnd uint32
+	for _, p := range q {
+		if p.AnchorTimeMs > queryEnd {
+			queryEnd = p.AnchorTimeMs
+		}
+	}
+
+	hits := Collect(q, db)
+	stats.Candidates = max(stats.Candidates, len(hits))
+	results, err := m.Rank(Score(hits, m.opts), hits, len(q), queryEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	queryEnd = uint32(math.Round(float64(queryEnd) / scale))
+
+	for i := range results {
+		r := &results[i]
+		r.Segments, r.Density = describe(hits[r.SongID], r.Match, scale, queryEnd, m.opts)
+		r.SpeedRatio *= scale
+	}
+	return results, nil
+}
+
+// Rank scores aligned matches for a query of queryCount hashes spanning
+// queryMs, given each song's hits. It drops those below the cutoffs, sorts
+// them and keeps the top K.
+//
+// Each match is judged twice: its peak against the background of the
+// song's own hits, and against the strongest other song. A peak that chance
+// explains, or a song barely ahead of a convincing rival, gets a low
+// probability.
+func (m *Matcher) Rank(matches []models.Match, hits map[string][]Hit, queryCount int, queryMs uint32) ([]Result, error) {
+	sig := significance{
+		tol:        float64(max(m.opts.ToleranceMs, 1)),
+		maxDev:     m.opts.MaxSpeedDeviation,
+		queryCount: queryCount,
+		queryMs:    float64(queryMs),
+		candidates: len(hits),
+	}
+
+	type judged struct {
+		match    models.Match
+		refCount int
+		pNoise   float64
+	}
+	// The strongest two are judged whatever their score, since every other
+	// match is compared with one of them
+	order := make([]int, len(matches))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return matches[order[a]].Count > matches[order[b]].Count })
+
+	candidates := make([]judged, 0, len(matches))
+	for rank, i := range order {
+		match := matches[i]
+		// The score cutoff is free, so apply it before the catalogue lookup
+		if match.Count < m.opts.MinScore && rank >= 2 {
+			continue
+		}
+
+		refCount, err := m.cat.GetFingerprintCount(match.SongID)
+		if err != nil {
+			return nil, fmt.Errorf("counting fingerprints of %s: %w", match.SongID, err)
+		}
+		candidates = append(candidates, judged{
+			match:    match,
+			refCount: refCount,
+			pNoise:   sig.pNoise(hits[match.SongID], match.Count, float64(match.OffsetMs), match.SpeedRatio, refCount),
+		})
+	}
+
+	results := make([]Result, 0, len(candidates))
+	for i, c := range candidates {
+		if c.match.Count < m.opts.MinScore {
+			continue
+		}
+
+		rival := 0
+		if i == 0 {
+			rival = 1
+		}
+		r := Result{Match: c.match, pNoise: c.pNoise}
+		if rival < len(candidates) {
+			r.pConfuse = pConfusion(c.match.Count, candidates[rival].match.Count, candidates[rival].pNoise)
+		}
+		if m.opts.Scorer != nil {
+			r.Confidence = m.opts.Scorer(c.match.Count, queryCount, c.refCount)
+		}
+		if m.judge(&r) {
+			results = append(results, r)
+		}
+	}
+	m.sort(results)
+
+	if m.opts.TopK > 0 && len(results) > m.opts.TopK {
+		results = results[:m.opts.TopK]
+	}
+	return results, nil
+}
+
+// judge derives r's probability and decision from its p-values, and its
+// confidence unless a Scorer set it. It reports whether r passes the
+// confidence cutoff.
+func (m *Matcher) judge(r *Result) bool {
+	r.Probability = (1 - r.pNoise) * (1 - r.pConfuse)
+	r.Matched = 1-r.Probability <= m.opts.FalsePositiveRate
+	if m.opts.Scorer == nil {
+		r.Confidence = 100 * r.Probability
+	}
+	return r.Confidence >= m.opts.MinConfidence
+}
+
+func (m *Matcher) sort(results []Result) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if m.opts.SortBy == SortByConfidence && a.Confidence != b.Confidence {
+			return a.Confidence > b.Confidence
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.SongID < b.SongID
+	})
+}
+
+// Retried re-judges results that were kept as the best of several attempts
+// at the same query, such as re-hashing it at other playback speeds. Each
+// attempt is another chance for noise to line up, so the results' chance
+// of being coincidence is that of the best of tries.
+func (m *Matcher) Retried(results []Result, tries int) []Result {
+	kept := results[:0]
+	for _, r := range results {
+		r.pNoise = atLeastOnce(r.pNoise, float64(tries))
+		if m.judge(&r) {
+			kept = append(kept, r)
+		}
+	}
+	m.sort(kept)
+	return kept
+}
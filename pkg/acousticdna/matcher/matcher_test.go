@@ -0,0 +1,177 @@
+package matcher
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// memCatalogue is a Catalogue of songs held as hash pairs
+type memCatalogue struct {
+	songs map[string][]models.HashPair
+	index map[uint32][]models.Couple
+}
+
+func (c *memCatalogue) add(songID string, pairs []models.HashPair) {
+	c.songs[songID] = pairs
+	for _, p := range pairs {
+		c.index[p.Hash] = append(c.index[p.Hash], models.Couple{SongID: songID, AnchorTimeMs: p.AnchorTimeMs})
+	}
+}
+
+func (c *memCatalogue) GetCouplesByHashes(hashes []uint32) (map[uint32][]models.Couple, error) {
+	out := make(map[uint32][]models.Couple, len(hashes))
+	for _, h := range hashes {
+		if couples, ok := c.index[h]; ok {
+			out[h] = couples
+		}
+	}
+	return out, nil
+}
+
+func (c *memCatalogue) GetFingerprintCount(songID string) (int, error) {
+	return len(c.songs[songID]), nil
+}
+
+// Hashes are drawn from a small space so that unrelated audio shares
+// plenty of them with the catalogue, as real fingerprints do
+const testHashSpace = 1 << 16
+
+// randomPairs is n hashes at random times over ms
+func randomPairs(rng *rand.Rand, n int, ms uint32) []models.HashPair {
+	pairs := make([]models.HashPair, n)
+	for i := range pairs {
+		pairs[i] = models.HashPair{Hash: rng.Uint32N(testHashSpace), AnchorTimeMs: rng.Uint32N(ms)}
+	}
+	return pairs
+}
+
+// testCatalogue is 20 three-minute songs of 30 hashes a second
+func testCatalogue(rng *rand.Rand) *memCatalogue {
+	cat := &memCatalogue{songs: map[string][]models.HashPair{}, index: map[uint32][]models.Couple{}}
+	for i := 0; i < 20; i++ {
+		cat.add(fmt.Sprintf("song-%02d", i), randomPairs(rng, 5400, 180000))
+	}
+	return cat
+}
+
+// excerpt is the pairs of a song anchored in [fromMs, fromMs+10s), shifted
+// to start at zero, with as many unrelated pairs mixed in
+func excerpt(rng *rand.Rand, song []models.HashPair, fromMs uint32) Query {
+	var q Query
+	for _, p := range song {
+		if p.AnchorTimeMs >= fromMs && p.AnchorTimeMs < fromMs+10000 {
+			q = append(q, models.HashPair{Hash: p.Hash, AnchorTimeMs: p.AnchorTimeMs - fromMs})
+		}
+	}
+	return append(q, randomPairs(rng, len(q), 10000)...)
+}
+
+func TestMatchFindsExcerpt(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	cat := testCatalogue(rng)
+	results, err := New(cat, DefaultOptions()).Match(excerpt(rng, cat.songs["song-07"], 60000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) == 0 || results[0].SongID != "song-07" {
+		t.Fatalf("results %+v, want song-07 first", results)
+	}
+	best := results[0]
+	if !best.Matched || best.Probability < 0.99 {
+		t.Errorf("excerpt: matched %v, probability %g", best.Matched, best.Probability)
+	}
+	if best.OffsetMs < 59975 || best.OffsetMs > 60025 {
+		t.Errorf("excerpt at 60s aligned at %dms", best.OffsetMs)
+	}
+	for _, r := range results[1:] {
+		if r.Matched {
+			t.Errorf("%s matched alongside song-07 (probability %g)", r.SongID, r.Probability)
+		}
+	}
+}
+
+func TestMatchRejectsUncataloguedQueries(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	cat := testCatalogue(rng)
+	m := New(cat, DefaultOptions())
+
+	// Queries of audio that isn't in the catalogue still hit it hundreds of
+	// times; at the default 1% false-positive rate barely any may match
+	const queries = 200
+	matched, hits := 0, 0
+	for i := 0; i < queries; i++ {
+		q := Query(randomPairs(rng, 300, 10000))
+		db, _ := cat.GetCouplesByHashes(q.Hashes())
+		for _, couples := range db {
+			hits += len(couples)
+		}
+		results, err := m.Match(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range results {
+			if r.Probability < 0 || r.Probability > 1 {
+				t.Fatalf("probability %g", r.Probability)
+			}
+			if r.Matched {
+				matched++
+			}
+		}
+	}
+	if hits < 100*queries {
+		t.Fatalf("only %d chance hits per query; the null test needs more", hits/queries)
+	}
+	if matched > 5 {
+		t.Errorf("%d of %d uncatalogued queries matched", matched, queries)
+	}
+}
+
+func TestMatchRefusesToChooseBetweenCopies(t *testing.T) {
+	// A song catalogued twice aligns equally well with both copies, so
+	// neither can be named with confidence
+	rng := rand.New(rand.NewPCG(5, 6))
+	cat := testCatalogue(rng)
+	cat.add("song-07-copy", cat.songs["song-07"])
+	results, err := New(cat, DefaultOptions()).Match(excerpt(rng, cat.songs["song-07"], 60000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) < 2 {
+		t.Fatalf("%d results, want both copies", len(results))
+	}
+	for _, r := range results {
+		if r.Matched {
+			t.Errorf("%s matched with probability %g", r.SongID, r.Probability)
+		}
+	}
+	if results[0].Probability > 0.6 {
+		t.Errorf("probability %g for one of two identical songs", results[0].Probability)
+	}
+}
+
+func TestMatchBoundsDensity(t *testing.T) {
+	// One hash claiming to be anchored 49 days in mustn't size the density
+	rng := rand.New(rand.NewPCG(7, 8))
+	cat := testCatalogue(rng)
+	q := excerpt(rng, cat.songs["song-07"], 60000)
+	q = append(q, models.HashPair{Hash: q[0].Hash, AnchorTimeMs: math.MaxUint32})
+	results, err := New(cat, DefaultOptions()).Match(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) == 0 || results[0].SongID != "song-07" {
+		t.Fatalf("results %+v, want song-07 first", results)
+	}
+	for _, r := range results {
+		if len(r.Density) > maxDensitySeconds+1 {
+			t.Errorf("%s: density of %d seconds", r.SongID, len(r.Density))
+		}
+	}
+	if d := results[0].Density; len(d) < 10 || d[5] == 0 {
+		t.Errorf("excerpt density %v", d[:min(len(d), 12)])
+	}
+}
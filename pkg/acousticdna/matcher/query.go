@@ -0,0 +1,55 @@
+package matcher
+
+import (
+	"sort"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// Query is the hashes of a recording to identify, each with the time of its
+// anchor peak. The same hash may appear several times at different anchor
+// times, and every occurrence votes.
+type Query []models.HashPair
+
+// FromCouples flattens fingerprinter output into a query ordered by anchor
+// time, then hash
+func FromCouples(fps map[uint32][]models.Couple) Query {
+	q := make(Query, 0, len(fps))
+	for hash, couples := range fps {
+		for _, c := range couples {
+			q = append(q, models.HashPair{Hash: hash, AnchorTimeMs: c.AnchorTimeMs})
+		}
+	}
+	sort.Slice(q, func(i, j int) bool {
+		if q[i].AnchorTimeMs != q[j].AnchorTimeMs {
+			return q[i].AnchorTimeMs < q[j].AnchorTimeMs
+		}
+		return q[i].Hash < q[j].Hash
+	})
+	return q
+}
+
+// Hashes returns the distinct hashes of the query, for the catalogue lookup
+func (q Query) Hashes() []uint32 {
+	seen := make(map[uint32]struct{}, len(q))
+	hashes := make([]uint32, 0, len(q))
+	for _, p := range q {
+		if _, ok := seen[p.Hash]; ok {
+			continue
+		}
+		seen[p.Hash] = struct{}{}
+		hashes = append(hashes, p.Hash)
+	}
+	return hashes
+}
+
+// Between returns the pairs anchored in [fromMs, toMs). q must be in time
+// order, as FromCouples returns it; the result shares q's backing array.
+func (q Query) Between(fromMs, toMs uint32) Query {
+	lo := sort.Search(len(q), func(i int) bool { return q[i].AnchorTimeMs >= fromMs })
+	hi := sort.Search(len(q), func(i int) bool { return q[i].AnchorTimeMs >= toMs })
+	if hi < lo {
+		hi = lo
+	}
+	return q[lo:hi]
+}
@@ -0,0 +1,59 @@
+package matcher
+
+import "math"
+
+// Scorer turns the number of aligned hashes into a confidence percentage
+// (0-100), given the size of the query and of the matched song
+type Scorer func(aligned, queryCount, refCount int) float64
+
+// SigmoidScorer measures the aligned hashes against the smaller of the query
+// and the song, so short clips of long songs are judged fairly, and maps
+// that ratio through a logistic curve:
+//   - below 5% aligned: very low confidence (0-20%)
+//   - 5-20% aligned: medium confidence (20-70%)
+//   - above 20% aligned: high confidence (70-100%)
+//
+// Fewer than five aligned hashes are penalised as statistically unreliable.
+// Its constants are hand-tuned; without a Scorer the matcher reports the
+// match probability instead.
+func SigmoidScorer(aligned, queryCount, refCount int) float64 {
+	if aligned == 0 || queryCount == 0 || refCount == 0 {
+		return 0.0
+	}
+
+	minCount := queryCount
+	if refCount < minCount {
+		minCount = refCount
+	}
+	ratio := float64(aligned) / float64(minCount)
+
+	const (
+		// Steepness of the sigmoid curve
+		steepness = 20.0
+		// Midpoint of the sigmoid (50% confidence point)
+		midpoint = 0.15 // 15% match ratio gives 50% confidence
+	)
+
+	confidence := 100.0 / (1.0 + math.Exp(-steepness*(ratio-midpoint)))
+
+	// Boost confidence for very strong matches (> 30% overlap)
+	if ratio > 0.30 {
+		boost := (ratio - 0.30) * 50
+		confidence = math.Min(100.0, confidence+boost)
+	}
+
+	// Statistical significance filter: very low match counts are unreliable
+	if aligned < 5 {
+		confidence *= float64(aligned) / 5.0
+	}
+
+	return confidence
+}
+
+// RatioScorer reports the share of the query's hashes that aligned
+func RatioScorer(aligned, queryCount, refCount int) float64 {
+	if queryCount == 0 {
+		return 0
+	}
+	return math.Min(100, 100*float64(aligned)/float64(queryCount))
+}
@@ -0,0 +1,80 @@
+package matcher
+
+import (
+	"math"
+	"sort"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// minSegmentHits is the fewest aligned hits reported as a segment; fewer
+// are indistinguishable from chance agreement
+const minSegmentHits = 3
+
+// maxDensitySeconds bounds the density reported, whatever anchor times a
+// query claims; later hits are left out of it
+const maxDensitySeconds = 3600
+
+// describe lays out where the hits that agree with match fall. Hit query
+// times run at scale times the original query, match's offset and speed
+// are in that same timeline, and the result is in the original one.
+// Density has one entry per second of a query lasting queryEndMs, up to
+// maxDensitySeconds.
+func describe(hits []Hit, match models.Match, scale float64, queryEndMs uint32, opts Options) ([]models.Segment, []int) {
+	tol := float64(opts.ToleranceMs)
+	if tol < 1 {
+		tol = 1
+	}
+	gap := opts.SegmentGapMs
+	if gap <= 0 {
+		gap = DefaultOptions().SegmentGapMs
+	}
+
+	aligned := make([]Hit, 0, match.Count)
+	for _, h := range hits {
+		r := float64(h.RefMs) - match.SpeedRatio*float64(h.QueryMs)
+		if math.Abs(r-float64(match.OffsetMs)) <= 1.5*tol {
+			aligned = append(aligned, Hit{QueryMs: uint32(math.Round(float64(h.QueryMs) / scale)), RefMs: h.RefMs})
+		}
+	}
+	sort.Slice(aligned, func(i, j int) bool { return aligned[i].QueryMs < aligned[j].QueryMs })
+
+	density := make([]int, min(queryEndMs/1000, maxDensitySeconds)+1)
+	for _, h := range aligned {
+		if sec := int(h.QueryMs / 1000); sec < len(density) {
+			density[sec]++
+		}
+	}
+
+	var segments []models.Segment
+	flush := func(run []Hit) {
+		if len(run) < minSegmentHits {
+			return
+		}
+		seg := models.Segment{
+			QueryStartMs: run[0].QueryMs,
+			QueryEndMs:   run[len(run)-1].QueryMs,
+			RefStartMs:   run[0].RefMs,
+			RefEndMs:     run[0].RefMs,
+			Count:        len(run),
+		}
+		for _, h := range run {
+			if h.RefMs < seg.RefStartMs {
+				seg.RefStartMs = h.RefMs
+			}
+			if h.RefMs > seg.RefEndMs {
+				seg.RefEndMs = h.RefMs
+			}
+		}
+		segments = append(segments, seg)
+	}
+
+	start := 0
+	for i := 1; i <= len(aligned); i++ {
+		if i == len(aligned) || int(aligned[i].QueryMs-aligned[i-1].QueryMs) > gap {
+			flush(aligned[start:i])
+			start = i
+		}
+	}
+	return segments, density
+}
@@ -0,0 +1,191 @@
+package matcher
+
+import "math"
+
+// DefaultFalsePositiveRate is the share of uncatalogued queries that may be
+// reported as matched
+const DefaultFalsePositiveRate = 0.01
+
+// significance judges aligned peaks against chance. A query unrelated to a
+// song still shares some hashes with it, and those hits spread over every
+// offset the query could take in the song. Music repeats itself, so they
+// bunch up rather than land independently. The song's own hits away from
+// the peak are therefore taken as the background: the number of hits per
+// alignment window is modelled with the mean and spread seen there, and
+// the chance that the fullest window, over every position, speed and
+// candidate song, holds as many hits as the peak is the peak's p-value.
+type significance struct {
+	tol        float64
+	maxDev     float64
+	queryCount int
+	queryMs    float64
+	candidates int
+}
+
+// pNoise returns the probability that a peak of count hits at offset and
+// speed arises by chance among hits, the song's hits with a query, for a
+// song of refCount hashes
+func (s significance) pNoise(hits []Hit, count int, offset, speed float64, refCount int) float64 {
+	if count == 0 || len(hits) == 0 {
+		return 1
+	}
+	window := 3 * s.tol
+
+	// One query peak anchors several hashes, and when it coincides with the
+	// song so do most of them, so hits are counted once per query time
+	type anchor struct {
+		bin     int64
+		queryMs uint32
+	}
+	seen := make(map[anchor]bool)
+	bins := make(map[int64]int)
+	peakAnchors := make(map[uint32]bool)
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, h := range hits {
+		r := float64(h.RefMs) - speed*float64(h.QueryMs)
+		lo, hi = math.Min(lo, r), math.Max(hi, r)
+		if math.Abs(r-offset) <= window/2 {
+			peakAnchors[h.QueryMs] = true
+		}
+		a := anchor{int64(math.Floor(r / window)), h.QueryMs}
+		if !seen[a] {
+			seen[a] = true
+			bins[a.bin]++
+		}
+	}
+	count = min(count, len(peakAnchors))
+
+	// The offsets the query could take span the song plus the query. The
+	// song's length is estimated from its hash count at the query's hash
+	// density; the observed spread of offsets is used if it is wider.
+	span := hi - lo
+	if s.queryCount > 0 && s.queryMs > 0 {
+		span = math.Max(span, float64(refCount)*s.queryMs/float64(s.queryCount)+s.queryMs)
+	}
+	span = math.Max(span, 4*window)
+
+	// Background windows leave out the peak and its neighbours
+	peak := int64(math.Floor(offset / window))
+	var sum, sumSq float64
+	for b, c := range bins {
+		if b >= peak-1 && b <= peak+1 {
+			continue
+		}
+		sum += float64(c)
+		sumSq += float64(c * c)
+	}
+	n := span/window - 3
+	mean := sum / n
+	variance := sumSq/n - mean*mean
+
+	// With few hits the background is too sparse to go by, so it is never
+	// taken as quieter than all hits spread evenly
+	mean = math.Max(mean, float64(len(seen))*window/span)
+	variance = math.Max(variance, mean)
+
+	// The peak is the best of windows sliding in steps of tol
+	positions := span / s.tol
+	if s.maxDev > 0 && len(hits) >= minHitsForFit {
+		positions *= float64(len(speedGrid(hits, s.tol, s.maxDev)))
+	}
+
+	pWindow := countTail(mean, variance, count)
+	return atLeastOnce(atLeastOnce(pWindow, positions), float64(s.candidates))
+}
+
+// pConfusion returns the probability that a song with count aligned hits is
+// not really better than a rival with rivalCount hits whose own peak has
+// p-value rivalNoise. If both were equally good, each aligned hit would be
+// as likely to fall to either, so this is a one-sided sign test, discounted
+// by the chance that the rival is noise.
+func pConfusion(count, rivalCount int, rivalNoise float64) float64 {
+	return (1 - rivalNoise) * binomialHalfTail(count+rivalCount, count)
+}
+
+// atLeastOnce returns the probability that an event of probability p
+// happens at least once in n independent tries
+func atLeastOnce(p, n float64) float64 {
+	if p >= 1 {
+		return 1
+	}
+	return -math.Expm1(n * math.Log1p(-p))
+}
+
+// countTail returns P(X >= k) for a count X with the given mean and
+// variance: negative binomial when overdispersed, Poisson otherwise
+func countTail(mean, variance float64, k int) float64 {
+	if variance <= mean*(1+1e-9) {
+		return poissonTail(mean, k)
+	}
+	return negBinomialTail(mean*mean/(variance-mean), mean/variance, k)
+}
+
+// negBinomialTail returns P(X >= k) for X ~ NB(r, p), the number of
+// failures before the r-th success at success probability p
+func negBinomialTail(r, p float64, k int) float64 {
+	if k <= 0 {
+		return 1
+	}
+	logPmf := func(i int) float64 {
+		a, _ := math.Lgamma(float64(i) + r)
+		b, _ := math.Lgamma(r)
+		c, _ := math.Lgamma(float64(i) + 1)
+		return a - b - c + r*math.Log(p) + float64(i)*math.Log1p(-p)
+	}
+
+	// Terms shrink by about 1-p each past the mode, so the tail converges
+	term := math.Exp(logPmf(k))
+	var sum float64
+	for i := k; term > sum*1e-15 && i < k+100000; i++ {
+		sum += term
+		term *= (1 - p) * (float64(i) + r) / float64(i+1)
+	}
+	return math.Min(1, sum)
+}
+
+// poissonTail returns P(X >= k) for X ~ Poisson(lambda)
+func poissonTail(lambda float64, k int) float64 {
+	if k <= 0 {
+		return 1
+	}
+	if lambda <= 0 {
+		return 0
+	}
+	if lambda >= float64(k) {
+		// Most of the mass is in the tail; sum the head instead
+		var head float64
+		term := math.Exp(-lambda)
+		for i := 0; i < k; i++ {
+			head += term
+			term *= lambda / float64(i+1)
+		}
+		return math.Max(0, 1-head)
+	}
+
+	lg, _ := math.Lgamma(float64(k) + 1)
+	term := math.Exp(float64(k)*math.Log(lambda) - lambda - lg)
+	var sum float64
+	for i := k; term > sum*1e-15; i++ {
+		sum += term
+		term *= lambda / float64(i+1)
+	}
+	return math.Min(1, sum)
+}
+
+// binomialHalfTail returns P(X >= k) for X ~ Binomial(n, 1/2)
+func binomialHalfTail(n, k int) float64 {
+	if k <= 0 {
+		return 1
+	}
+	if k > n {
+		return 0
+	}
+	lgN, _ := math.Lgamma(float64(n) + 1)
+	var sum float64
+	for i := k; i <= n; i++ {
+		lgI, _ := math.Lgamma(float64(i) + 1)
+		lgRest, _ := math.Lgamma(float64(n-i) + 1)
+		sum += math.Exp(lgN - lgI - lgRest - float64(n)*math.Ln2)
+	}
+	return math.Min(1, sum)
+}
@@ -0,0 +1,393 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+package acousticdna
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/audio"
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/fingerprint"
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/matcher"
+	"github.com/himanishpuri/AcousticDNA/pkg/logger"
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// MonitorEventType identifies what changed on a monitored stream
+type MonitorEventType string
+
+const (
+	TrackStarted MonitorEventType = "track_started"
+	TrackEnded   MonitorEventType = "track_ended"
+)
+
+// MonitorEvent reports a catalogue track starting or ending on a monitored
+// stream. Times are milliseconds from the start of the stream.
+type MonitorEvent struct {
+	Type    MonitorEventType
+	Match   models.MatchResult
+	StartMs int64
+	EndMs   int64 // only set for TrackEnded
+}
+
+// MonitorConfig tunes a Monitor. Audio is fingerprinted with the service's
+// profile, at its sample rate.
+type MonitorConfig struct {
+	// Window is how much recent audio each query looks at and Interval how
+	// much stream time passes between queries
+	Window   time.Duration
+	Interval time.Duration
+
+	// A query result only counts as a sighting above both thresholds
+	MinScore      int
+	MinConfidence float64
+
+	// ConfirmAfter consecutive sightings with a consistent offset start a
+	// track; EndAfter consecutive queries without it end the track
+	ConfirmAfter int
+	EndAfter     int
+
+	// OffsetToleranceMs is how far the song-to-stream offset may drift
+	// between queries while still counting as the same playback
+	OffsetToleranceMs int32
+
+	Logger Logger
+}
+
+type MonitorOption func(*MonitorConfig)
+
+func WithMonitorWindow(window, interval time.Duration) MonitorOption {
+	return func(c *MonitorConfig) {
+		c.Window = window
+		c.Interval = interval
+	}
+}
+
+func WithMonitorThresholds(minScore int, minConfidence float64) MonitorOption {
+	return func(c *MonitorConfig) {
+		c.MinScore = minScore
+		c.MinConfidence = minConfidence
+	}
+}
+
+func WithMonitorConfirmation(confirmAfter, endAfter int) MonitorOption {
+	return func(c *MonitorConfig) {
+		c.ConfirmAfter = confirmAfter
+		c.EndAfter = endAfter
+	}
+}
+
+func WithMonitorLogger(log Logger) MonitorOption {
+	return func(c *MonitorConfig) {
+		c.Logger = log
+	}
+}
+
+func defaultMonitorConfig() *MonitorConfig {
+	return &MonitorConfig{
+		Window:            10 * time.Second,
+		Interval:          5 * time.Second,
+		MinScore:          20,
+		MinConfidence:     30,
+		ConfirmAfter:      2,
+		EndAfter:          2,
+		OffsetToleranceMs: 250,
+	}
+}
+
+// Monitor recognises catalogue tracks in a continuous audio stream. It keeps
+// the peaks of a rolling window, re-queries the service every Interval and
+// turns the results into track started/ended events once the match offset
+// has stayed consistent.
+type Monitor struct {
+	svc    Service
+	config *MonitorConfig
+	log    Logger
+
+	peaks     []fingerprint.Peak
+	current   *monitorTrack
+	candidate *monitorTrack
+	err       error
+}
+
+// monitorTrack is a playback that has been seen at a stable offset
+type monitorTrack struct {
+	match      models.MatchResult
+	startMs    int64
+	lastSeenMs int64
+	songEndMs  int64 // where the song runs out in stream time, if known
+	hits       int
+	misses     int
+}
+
+// NewMonitor creates a monitor that matches against svc. The sample rate must
+// be the one the catalogue was fingerprinted with.
+func NewMonitor(svc Service, opts ...MonitorOption) *Monitor {
+	cfg := defaultMonitorConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = logger.GetLogger()
+	}
+
+	return &Monitor{
+		svc:    svc,
+		config: cfg,
+		log:    cfg.Logger,
+	}
+}
+
+// Run consumes the encoded audio stream r in the background and returns a
+// channel of track events. The channel is closed when r is exhausted or ctx
+// is cancelled, after which Err reports what stopped the monitor.
+// A Monitor must not be run more than once.
+func (m *Monitor) Run(ctx context.Context, r io.Reader) <-chan MonitorEvent {
+	events := make(chan MonitorEvent, 16)
+	go func() {
+		defer close(events)
+		m.err = m.run(ctx, r, events)
+	}()
+	return events
+}
+
+// Err returns the error that stopped the monitor, or nil if the stream ended
+// normally. It is only meaningful once the event channel has been closed.
+func (m *Monitor) Err() error {
+	return m.err
+}
+
+func (m *Monitor) run(ctx context.Context, r io.Reader, events chan<- MonitorEvent) error {
+	profile := m.svc.Profile()
+	sampleRate := profile.SampleRate
+	if m.config.Window <= 0 || m.config.Interval <= 0 {
+		return errors.New("monitor window and interval must be positive")
+	}
+
+	pcm, err := audio.NewPCMStream(ctx, r, sampleRate)
+	if err != nil {
+		return fmt.Errorf("audio decoding failed: %w", err)
+	}
+	defer pcm.Close()
+
+	emit := func(ev MonitorEvent) error {
+		select {
+		case events <- ev:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	fp := profile.NewQueryFingerprinter(nil)
+	fp.OnPeak = func(p fingerprint.Peak) {
+		m.peaks = append(m.peaks, p)
+	}
+
+	src := &contextReader{ctx: ctx, r: pcm}
+	raw := make([]byte, 4096)
+	samples := make([]float64, len(raw)/2)
+
+	intervalSamples := int64(m.config.Interval.Seconds() * float64(sampleRate))
+	if intervalSamples < 1 {
+		intervalSamples = 1
+	}
+	next := intervalSamples
+	var total, lastQuery int64
+
+	for {
+		n, rerr := io.ReadFull(src, raw)
+		frames := n / 2
+		for i := 0; i < frames; i++ {
+			samples[i] = float64(int16(binary.LittleEndian.Uint16(raw[2*i:]))) / 32768.0
+		}
+		fp.Write(samples[:frames])
+		total += int64(frames)
+
+		if total >= next {
+			if err := m.query(ctx, total*1000/int64(sampleRate), emit); err != nil {
+				return err
+			}
+			lastQuery = total
+			for next <= total {
+				next += intervalSamples
+			}
+		}
+
+		if errors.Is(rerr, io.EOF) || errors.Is(rerr, io.ErrUnexpectedEOF) {
+			break
+		}
+		if rerr != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("reading audio stream: %w", rerr)
+		}
+	}
+
+	fp.Flush()
+	endMs := total * 1000 / int64(sampleRate)
+	if total > lastQuery {
+		if err := m.query(ctx, endMs, emit); err != nil {
+			return err
+		}
+	}
+
+	// Whatever was still playing ends with the stream
+	if m.current != nil {
+		end := m.current.lastSeenMs
+		if m.current.misses == 0 {
+			end = endMs
+		}
+		return m.endCurrent(end, emit)
+	}
+	return nil
+}
+
+// query matches the current window and advances the track state machine
+func (m *Monitor) query(ctx context.Context, nowMs int64, emit func(MonitorEvent) error) error {
+	// Drop peaks that have slid out of the window
+	cutoff := float64(nowMs)/1000.0 - m.config.Window.Seconds()
+	drop := 0
+	for drop < len(m.peaks) && m.peaks[drop].Time < cutoff {
+		drop++
+	}
+	m.peaks = append(m.peaks[:0], m.peaks[drop:]...)
+
+	// Anchor times stay relative to the start of the stream, so a track that
+	// keeps playing keeps the same offset from one query to the next
+	profile := m.svc.Profile()
+	query := matcher.FromCouples(profile.Fingerprint(m.peaks, ""))
+
+	var best *models.MatchResult
+	if len(query) > 0 {
+		results, err := m.svc.MatchHashes(ctx, profile, query)
+		if err != nil {
+			return fmt.Errorf("matching window at %dms: %w", nowMs, err)
+		}
+		for i := range results {
+			res := &results[i]
+			if res.Score < m.config.MinScore || res.Confidence < m.config.MinConfidence {
+				continue
+			}
+			if best == nil || res.Score > best.Score {
+				best = res
+			}
+		}
+	}
+
+	if best != nil {
+		m.log.Debugf("Monitor @%dms: %s (score %d, offset %dms)", nowMs, best.SongID, best.Score, best.OffsetMs)
+	} else {
+		m.log.Debugf("Monitor @%dms: no match", nowMs)
+	}
+
+	return m.update(best, nowMs, emit)
+}
+
+// update feeds one query result into the started/ended state machine
+func (m *Monitor) update(best *models.MatchResult, nowMs int64, emit func(MonitorEvent) error) error {
+	if m.current != nil {
+		if best != nil && m.sameTrack(m.current.match, *best) {
+			m.current.match = *best
+			m.current.lastSeenMs = nowMs
+			m.current.misses = 0
+			m.candidate = nil
+			return nil
+		}
+		m.current.misses++
+	}
+
+	switch {
+	case best == nil:
+		m.candidate = nil
+	case m.candidate != nil && m.sameTrack(m.candidate.match, *best):
+		m.candidate.match = *best
+		m.candidate.lastSeenMs = nowMs
+		m.candidate.hits++
+	default:
+		m.candidate = &monitorTrack{
+			match:      *best,
+			startMs:    m.estimateStart(*best, nowMs),
+			lastSeenMs: nowMs,
+			hits:       1,
+		}
+	}
+
+	confirmed := m.candidate != nil && m.candidate.hits >= m.config.ConfirmAfter
+
+	if m.current != nil && (confirmed || m.current.misses >= m.config.EndAfter) {
+		end := m.current.lastSeenMs
+		if confirmed && m.candidate.startMs > m.current.startMs && m.candidate.startMs < end {
+			// The windows overlap around a transition; the new track's
+			// alignment pins down the boundary more precisely
+			end = m.candidate.startMs
+		}
+		if err := m.endCurrent(end, emit); err != nil {
+			return err
+		}
+	}
+
+	if confirmed {
+		m.current, m.candidate = m.candidate, nil
+		if song, err := m.svc.GetSongByID(m.current.match.SongID); err == nil && song.DurationMs > 0 {
+			m.current.songEndMs = -int64(m.current.match.OffsetMs) + int64(song.DurationMs)
+		}
+		return emit(MonitorEvent{
+			Type:    TrackStarted,
+			Match:   m.current.match,
+			StartMs: m.current.startMs,
+		})
+	}
+	return nil
+}
+
+func (m *Monitor) endCurrent(endMs int64, emit func(MonitorEvent) error) error {
+	track := m.current
+	m.current = nil
+	// The window keeps hearing a track for a while after it stops, so don't
+	// let it run past the end of the recording
+	if track.songEndMs > 0 && endMs > track.songEndMs {
+		endMs = track.songEndMs
+	}
+	if endMs < track.startMs {
+		endMs = track.startMs
+	}
+	return emit(MonitorEvent{
+		Type:    TrackEnded,
+		Match:   track.match,
+		StartMs: track.startMs,
+		EndMs:   endMs,
+	})
+}
+
+// estimateStart places the start of a newly seen track. The offset says where
+// the song's beginning lines up with the stream; when the stream joined the
+// song part-way through, the start of the first window that saw it is used.
+func (m *Monitor) estimateStart(match models.MatchResult, nowMs int64) int64 {
+	start := -int64(match.OffsetMs)
+	if windowStart := nowMs - m.config.Window.Milliseconds(); start < windowStart {
+		start = windowStart
+	}
+	if start < 0 {
+		start = 0
+	}
+	return start
+}
+
+func (m *Monitor) sameTrack(a, b models.MatchResult) bool {
+	if a.SongID != b.SongID {
+		return false
+	}
+	diff := a.OffsetMs - b.OffsetMs
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= m.config.OffsetToleranceMs
+}
@@ -0,0 +1,59 @@
+package acousticdna
+
+import (
+	"time"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/fingerprint"
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/matcher"
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// Operations a PipelineStats can describe
+const (
+	OpIngest      = "ingest"       // Fingerprinting a song for the catalogue
+	OpMatch       = "match"        // Matching encoded audio
+	OpMatchHashes = "match_hashes" // Matching pre-computed hashes
+)
+
+// PipelineStats describes one run of the fingerprinting and matching
+// pipeline. Stages an operation doesn't go through stay zero.
+type PipelineStats struct {
+	Operation string
+
+	// Time spent in each stage. Decoding covers the built-in decoders,
+	// ffmpeg and resampling.
+	Decode         time.Duration
+	STFT           time.Duration
+	PeakExtraction time.Duration
+	Hashing        time.Duration
+	Lookup         time.Duration
+	Voting         time.Duration
+
+	Peaks      int
+	Hashes     int
+	Candidates int  // Songs sharing a hash with a query
+	Matched    bool // Whether a query's top result was a match
+}
+
+// PipelineObserver receives the statistics of every ingestion and match a
+// service runs, e.g. to export them as metrics. It must be safe for
+// concurrent use.
+type PipelineObserver interface {
+	ObservePipeline(stats PipelineStats)
+}
+
+// addStream fills in the stages a Fingerprinter runs
+func (p *PipelineStats) addStream(stats fingerprint.StreamStats) {
+	p.STFT += stats.STFTTime
+	p.PeakExtraction += stats.PeakTime
+	p.Hashing += stats.HashTime
+	p.Peaks += stats.Peaks
+}
+
+// addMatch fills in the stages a Matcher runs
+func (p *PipelineStats) addMatch(stats matcher.Stats, results []models.MatchResult) {
+	p.Lookup += stats.Lookup
+	p.Voting += stats.Voting
+	p.Candidates = max(p.Candidates, stats.Candidates)
+	p.Matched = len(results) > 0 && results[0].Matched
+}
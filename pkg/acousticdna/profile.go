@@ -0,0 +1,99 @@
+package acousticdna
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/fingerprint"
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/index"
+)
+
+// FingerprintProfile holds the parameters that shape fingerprints; see
+// fingerprint.Profile
+type FingerprintProfile = fingerprint.Profile
+
+// ErrIncompatibleProfile is returned when a query or a new song was
+// fingerprinted with a different profile than the catalogue
+var ErrIncompatibleProfile = fingerprint.ErrIncompatibleProfile
+
+// ProfileMetaKey is the storage meta key holding the catalogue's profile
+const ProfileMetaKey = "fingerprint_profile"
+
+// StoredProfile returns the profile a catalogue was built with. ok is false
+// when none has been recorded yet.
+func StoredProfile(stor Storage) (p FingerprintProfile, ok bool, err error) {
+	raw, err := stor.GetMeta(ProfileMetaKey)
+	if err != nil {
+		return p, false, fmt.Errorf("reading fingerprint profile: %w", err)
+	}
+	if raw == "" {
+		return p, false, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &p); err != nil {
+		return p, false, fmt.Errorf("decoding fingerprint profile: %w", err)
+	}
+	return p, true, nil
+}
+
+// SaveProfile records p as the profile of the catalogue in stor
+func SaveProfile(stor Storage, p FingerprintProfile) error {
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return stor.SetMeta(ProfileMetaKey, string(raw))
+}
+
+// resolveProfile settles which profile the service runs with and which one
+// the catalogue was built with. A catalogue that has recorded a profile
+// keeps it; if another one was asked for explicitly, adds and matches are
+// refused later on, unless the catalogue is still empty and can switch. A
+// catalogue without a profile is stamped with the requested one, or else
+// the default profile at the configured sample rate. If it already holds
+// songs, they were fingerprinted before profiles existed, with what is now
+// the legacy profile.
+func resolveProfile(stor Storage, cfg *Config, log Logger) (profile, stored FingerprintProfile, err error) {
+	stored, hasStored, err := StoredProfile(stor)
+	if err != nil {
+		return profile, stored, err
+	}
+
+	switch {
+	case cfg.Profile != nil:
+		profile = *cfg.Profile
+	case hasStored:
+		profile = stored
+		if cfg.SampleRate != stored.SampleRate {
+			log.Warnf("Catalogue was fingerprinted at %d Hz; using that instead of %d Hz", stored.SampleRate, cfg.SampleRate)
+		}
+	default:
+		songs, err := stor.ListSongs()
+		if err != nil {
+			return profile, stored, fmt.Errorf("listing songs: %w", err)
+		}
+		profile = fingerprint.DefaultProfile().WithSampleRate(cfg.SampleRate)
+		if len(songs) > 0 {
+			profile = fingerprint.LegacyProfile().WithSampleRate(cfg.SampleRate)
+		}
+	}
+	if err := profile.Validate(); err != nil {
+		return profile, stored, fmt.Errorf("invalid fingerprint profile %s: %w", profile.ID(), err)
+	}
+
+	if hasStored && profile.CompatibleWith(stored) != nil {
+		songs, err := stor.ListSongs()
+		if err != nil {
+			return profile, stored, fmt.Errorf("listing songs: %w", err)
+		}
+		hasStored = len(songs) > 0
+	}
+
+	if !hasStored {
+		if err := SaveProfile(stor, profile); err != nil && !errors.Is(err, index.ErrReadOnly) {
+			return profile, stored, fmt.Errorf("recording fingerprint profile: %w", err)
+		}
+		stored = profile
+	}
+	return profile, stored, nil
+}
@@ -5,19 +5,33 @@ package acousticdna
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"math"
+	"os"
+	"slices"
+	"sort"
+	"time"
 
 	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/audio"
 	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/fingerprint"
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/index"
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/matcher"
 	"github.com/himanishpuri/AcousticDNA/pkg/logger"
 	"github.com/himanishpuri/AcousticDNA/pkg/models"
 )
 
 type acousticService struct {
 	storage Storage
+	matcher *matcher.Matcher
 	log     Logger
 	config  *Config
+
+	// profile is what this service fingerprints with; stored is what the
+	// catalogue was built with. They differ only when a profile was forced.
+	profile FingerprintProfile
+	stored  FingerprintProfile
 }
 
 func NewService(opts ...Option) (Service, error) {
@@ -35,64 +49,136 @@ func NewService(opts ...Option) (Service, error) {
 	if cfg.Storage != nil {
 		stor = cfg.Storage
 	} else {
-		stor, err = NewSQLiteStorage(cfg.DBPath)
+		dsn := cfg.DSN
+		if dsn == "" {
+			dsn = cfg.DBPath
+		}
+		stor, err = OpenStorage(dsn)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create storage: %w", err)
 		}
 	}
 
+	profile, stored, err := resolveProfile(stor, cfg, cfg.Logger)
+	if err != nil {
+		stor.Close()
+		return nil, err
+	}
+	if err := profile.CompatibleWith(stored); err != nil {
+		cfg.Logger.Warnf("Catalogue was built with profile %s; adding and matching with %s will be refused", stored.ID(), profile.ID())
+	}
+
 	return &acousticService{
 		storage: stor,
+		matcher: matcher.New(stor, cfg.Match),
 		log:     cfg.Logger,
 		config:  cfg,
+		profile: profile,
+		stored:  stored,
 	}, nil
 }
 
+// Profile returns the fingerprint profile the service works with
+func (s *acousticService) Profile() FingerprintProfile {
+	return s.profile
+}
+
+// checkProfile refuses fingerprints made with p unless the catalogue uses
+// the same profile
+func (s *acousticService) checkProfile(p FingerprintProfile) error {
+	if err := p.CompatibleWith(s.stored); err != nil {
+		return fmt.Errorf("catalogue uses %s: %w", s.stored.ID(), err)
+	}
+	return nil
+}
+
+// AddSong fingerprints the audio file at audioPath and stores it in the catalogue.
+// Album, genre, year and ISRC are taken from the file's tags.
 func (s *acousticService) AddSong(ctx context.Context, audioPath, title, artist, youtubeID string) (string, error) {
-	s.log.Infof("Processing song: %s by %s", title, artist)
+	f, err := os.Open(audioPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open audio file: %w", err)
+	}
+	defer f.Close()
 
-	wavPath, err := audio.ConvertToMonoWAV(ctx, audioPath, s.config.TempDir, audio.ConvertWAVConfig{
-		SampleRate: s.config.SampleRate,
-	})
+	song := models.Song{Title: title, Artist: artist, YouTubeID: youtubeID}
+	if meta, err := audio.ReadMetadata(ctx, audioPath); err == nil {
+		fillSong(&song, SongFromTags(meta))
+	}
+
+	s.log.Infof("Processing song: %s by %s", song.Title, song.Artist)
+	fp, err := s.FingerprintReader(ctx, f)
 	if err != nil {
-		return "", fmt.Errorf("audio conversion failed: %w", err)
+		return "", err
 	}
+	return s.StoreSong(song, fp)
+}
+
+// AddSongReader fingerprints an encoded audio stream and stores it in the catalogue.
+// The audio is decoded and hashed incrementally, so no temporary files are written.
+func (s *acousticService) AddSongReader(ctx context.Context, r io.Reader, title, artist, youtubeID string) (string, error) {
+	s.log.Infof("Processing song: %s by %s", title, artist)
 
-	samples, sampleRate, err := audio.ReadWavAsFloat64(wavPath)
+	fp, err := s.FingerprintReader(ctx, r)
 	if err != nil {
-		return "", fmt.Errorf("failed to read WAV file: %w", err)
+		return "", err
 	}
+	return s.StoreSong(models.Song{Title: title, Artist: artist, YouTubeID: youtubeID}, fp)
+}
 
-	spec, _, err := fingerprint.ComputeSpectrogram(wavPath, 0, 0)
+// FingerprintReader fingerprints an encoded audio stream without storing it,
+// so that decoding can run in parallel with a single writer calling StoreSong.
+func (s *acousticService) FingerprintReader(ctx context.Context, r io.Reader) (*models.SongFingerprints, error) {
+	if err := s.checkProfile(s.profile); err != nil {
+		return nil, err
+	}
+
+	pipeline := PipelineStats{Operation: OpIngest}
+	fps, stats, err := s.fingerprintStream(ctx, r, s.profile.NewFingerprinter, nil, &pipeline)
 	if err != nil {
-		return "", fmt.Errorf("spectrogram generation failed: %w", err)
+		return nil, err
 	}
+	s.log.Infof("Extracted %d peaks", stats.Peaks)
+	pipeline.Hashes = stats.Hashes
+	s.observe(pipeline)
+
+	return &models.SongFingerprints{
+		DurationMs: int(stats.DurationSec(s.profile.SampleRate) * 1000),
+		Hashes:     fps,
+	}, nil
+}
 
-	duration := float64(len(samples)) / float64(sampleRate)
-	peaks := fingerprint.ExtractPeaks(spec, duration, sampleRate)
-	s.log.Infof("Extracted %d peaks", len(peaks))
+// StoreSong registers a song and stores fingerprints made by FingerprintReader.
+// A song whose title and artist are already catalogued is rejected with an
+// error wrapping ErrSongExists, along with the existing song's ID; its
+// fingerprints are left as they are.
+func (s *acousticService) StoreSong(song models.Song, fp *models.SongFingerprints) (string, error) {
+	if err := s.checkProfile(s.profile); err != nil {
+		return "", err
+	}
 
-	songID, err := s.storage.RegisterSong(title, artist, youtubeID, int(duration*1000))
+	songID, created, err := s.storage.RegisterSong(song.Title, song.Artist, song.YouTubeID, fp.DurationMs)
 	if err != nil {
 		return "", fmt.Errorf("failed to register song: %w", err)
 	}
+	if !created {
+		return songID, fmt.Errorf("%w: %s - %s (ID: %s)", ErrSongExists, song.Artist, song.Title, songID)
+	}
 
-	fps := fingerprint.Fingerprint(peaks, songID)
-	s.log.Infof("Generated %d unique hashes", len(fps))
+	// Only the song registered here is rolled back
+	if err := s.fillMetadata(songID, song); err != nil {
+		s.storage.DeleteSongByID(songID)
+		return "", err
+	}
 
-	storageFPs := make(map[uint32][]models.Couple)
-	for hash, modelCouples := range fps {
-		couples := make([]models.Couple, len(modelCouples))
-		for i, mc := range modelCouples {
-			couples[i] = models.Couple{
-				SongID:       mc.SongID,
-				AnchorTimeMs: mc.AnchorTimeMs,
-			}
+	for _, couples := range fp.Hashes {
+		for i := range couples {
+			couples[i].SongID = songID
 		}
-		storageFPs[hash] = couples
 	}
+	s.log.Infof("Generated %d unique hashes", len(fp.Hashes))
 
-	if err := s.storage.StoreFingerprints(storageFPs); err != nil {
+	if err := s.storage.StoreFingerprints(fp.Hashes); err != nil {
 		s.storage.DeleteSongByID(songID)
 		return "", fmt.Errorf("failed to store fingerprints: %w", err)
 	}
@@ -101,162 +187,442 @@ func (s *acousticService) AddSong(ctx context.Context, audioPath, title, artist,
 	return songID, nil
 }
 
+// fillMetadata completes a registered song's metadata from song
+func (s *acousticService) fillMetadata(songID string, song models.Song) error {
+	stored, err := s.storage.GetSongByID(songID)
+	if err != nil {
+		return fmt.Errorf("failed to read registered song: %w", err)
+	}
+	if !fillSong(stored, song) {
+		return nil
+	}
+	if err := s.storage.UpdateSong(stored); err != nil {
+		return fmt.Errorf("failed to store song metadata: %w", err)
+	}
+	return nil
+}
+
+// MatchSong identifies the audio file at audioPath against the catalogue.
 func (s *acousticService) MatchSong(ctx context.Context, audioPath string) ([]models.MatchResult, error) {
 	s.log.Infof("Matching audio: %s", audioPath)
 
-	wavPath, err := audio.ConvertToMonoWAV(ctx, audioPath, s.config.TempDir, audio.ConvertWAVConfig{
-		SampleRate: s.config.SampleRate,
-	})
+	f, err := os.Open(audioPath)
 	if err != nil {
-		return nil, fmt.Errorf("audio conversion failed: %w", err)
+		return nil, fmt.Errorf("failed to open audio file: %w", err)
 	}
+	defer f.Close()
 
-	samples, sampleRate, err := audio.ReadWavAsFloat64(wavPath)
+	return s.MatchReader(ctx, f)
+}
+
+// MatchReader identifies an encoded audio stream against the catalogue.
+func (s *acousticService) MatchReader(ctx context.Context, r io.Reader) ([]models.MatchResult, error) {
+	results, _, err := s.MatchReaderWithDiagnostics(ctx, r)
+	return results, err
+}
+
+// MatchReaderWithDiagnostics is MatchReader that also describes how the
+// query was fingerprinted, e.g. how much of it was skipped as silence or noise.
+func (s *acousticService) MatchReaderWithDiagnostics(ctx context.Context, r io.Reader) ([]models.MatchResult, *models.QueryDiagnostics, error) {
+	if err := s.checkProfile(s.profile); err != nil {
+		return nil, nil, err
+	}
+
+	var peaks []fingerprint.Peak
+	pipeline := PipelineStats{Operation: OpMatch}
+	queryFPs, stats, err := s.fingerprintStream(ctx, r, s.profile.NewQueryFingerprinter, func(p fingerprint.Peak) {
+		peaks = append(peaks, p)
+	}, &pipeline)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read WAV file: %w", err)
+		return nil, nil, err
+	}
+	s.log.Infof("Query has %d peaks", stats.Peaks)
+
+	query := matcher.FromCouples(queryFPs)
+	s.log.Infof("Generated %d query hashes", len(query))
+	diag := &models.QueryDiagnostics{
+		DurationMs:   int(stats.DurationSec(s.profile.SampleRate) * 1000),
+		Frames:       stats.Frames,
+		ZeroFrames:   stats.Gated.ZeroFrames,
+		SilentFrames: stats.Gated.SilentFrames,
+		NoisyFrames:  stats.Gated.NoisyFrames,
+		Peaks:        stats.Peaks,
+		Hashes:       len(query),
 	}
 
-	spec, _, err := fingerprint.ComputeSpectrogram(wavPath, 0, 0)
+	var matchStats matcher.Stats
+	matches, err := s.matcher.MatchTimed(query, 1, &matchStats)
 	if err != nil {
-		return nil, fmt.Errorf("spectrogram generation failed: %w", err)
+		return nil, nil, err
 	}
 
-	duration := float64(len(samples)) / float64(sampleRate)
-	queryPeaks := fingerprint.ExtractPeaks(spec, duration, sampleRate)
-	s.log.Infof("Query has %d peaks", len(queryPeaks))
+	// A speed change that also shifts pitch moves the hashed frequencies and
+	// time deltas, which no alignment can recover. If nothing convincing was
+	// found, re-hash the peaks as if the query had been played back at
+	// nearby speeds; the matcher's slope fit covers the gaps between them.
+	if s.config.Match.MaxSpeedDeviation > 0 && !convincing(matches) {
+		if matches, err = s.matchSpeedHypotheses(ctx, peaks, matches, &matchStats); err != nil {
+			return nil, nil, err
+		}
+	}
+	s.log.Infof("Found %d candidate matches", len(matches))
 
-	queryFPs := fingerprint.Fingerprint(queryPeaks, "")
-	s.log.Infof("Generated %d query hashes", len(queryFPs))
+	results := s.buildResults(matches)
+	s.log.Infof("Returning %d matches", len(results))
+	pipeline.Hashes = len(query)
+	pipeline.addMatch(matchStats, results)
+	s.observe(pipeline)
+	return results, diag, nil
+}
 
-	hashList := make([]uint32, 0, len(queryFPs))
-	for hash := range queryFPs {
-		hashList = append(hashList, hash)
+// AnalyzeTimeline finds every catalogue track in a long recording, such as a
+// DJ mix or a podcast. The recording is fingerprinted once; overlapping
+// windows of its hashes are then matched on their own, sightings of the same
+// playback are chained together, and each resulting span is scored as a
+// whole. Tracks that overlap in a crossfade are both reported.
+func (s *acousticService) AnalyzeTimeline(ctx context.Context, r io.Reader, opts ...TimelineOption) (*models.Timeline, error) {
+	cfg := defaultTimelineConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.Window <= 0 || cfg.Hop <= 0 {
+		return nil, errors.New("timeline window and hop must be positive")
+	}
+	if err := s.checkProfile(s.profile); err != nil {
+		return nil, err
 	}
 
-	dbMap, err := s.storage.GetCouplesByHashes(hashList)
+	fps, stats, err := s.fingerprintStream(ctx, r, s.profile.NewQueryFingerprinter, nil, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve fingerprints from database: %w", err)
+		return nil, err
 	}
-	s.log.Infof("Retrieved couples for %d/%d hashes", len(dbMap), len(queryFPs))
-
-	matches := fingerprint.QueryFingerprints(queryPeaks, dbMap)
-	s.log.Infof("Found %d candidate matches", len(matches))
+	query := matcher.FromCouples(fps)
+	durationMs := int64(stats.DurationSec(s.profile.SampleRate) * 1000)
+	s.log.Infof("Analyzing %s of audio (%d query hashes)", time.Duration(durationMs)*time.Millisecond, len(query))
+
+	windowMs, hopMs := cfg.Window.Milliseconds(), cfg.Hop.Milliseconds()
+	var sightings []timelineSighting
+	for start := int64(0); start < durationMs; start += hopMs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 
-	results := make([]models.MatchResult, 0, len(matches))
-	for _, match := range matches {
-		song, err := s.GetSongByID(match.SongID)
+		// Anchor times stay relative to the start of the recording, so one
+		// playback keeps the same offset in every window
+		found, err := s.windowSightings(query.Between(uint32(start), uint32(start+windowMs)), cfg)
 		if err != nil {
-			s.log.Warnf("Failed to get song %d: %v", match.SongID, err)
+			return nil, fmt.Errorf("matching window at %dms: %w", start, err)
+		}
+		sightings = append(sightings, found...)
+
+		if start+windowMs >= durationMs {
+			break
+		}
+	}
+
+	timeline := &models.Timeline{DurationMs: durationMs, Tracks: []models.TimelineTrack{}}
+	for _, span := range mergeSightings(sightings, cfg) {
+		if span.windows < cfg.MinWindows {
 			continue
 		}
 
-		// Get database song's fingerprint count for better confidence calculation
-		dbFingerprintCount, err := s.storage.GetFingerprintCount(match.SongID)
+		// Score the span as a whole, which also pins down its boundaries
+		results, err := s.matcher.Match(query.Between(uint32(span.startMs), uint32(span.endMs)+1))
 		if err != nil {
-			s.log.Warnf("Failed to get fingerprint count for song %d: %v", match.SongID, err)
-			dbFingerprintCount = len(queryFPs)
+			return nil, fmt.Errorf("scoring %s at %dms: %w", span.songID, span.startMs, err)
+		}
+		var best []matcher.Result
+		for _, res := range results {
+			if res.SongID == span.songID && len(res.Segments) > 0 {
+				best = []matcher.Result{res}
+				break
+			}
+		}
+		built := s.buildResults(best)
+		if len(built) == 0 {
+			continue
 		}
 
-		confidence := s.calculateConfidence(match.Count, len(queryFPs), dbFingerprintCount)
-
-		results = append(results, models.MatchResult{
-			SongID:     match.SongID,
-			Title:      song.Title,
-			Artist:     song.Artist,
-			YouTubeID:  song.YouTubeID,
-			Score:      match.Count,
-			OffsetMs:   match.OffsetMs,
-			Confidence: confidence,
+		match := built[0]
+		match.Density = nil
+		first, last := match.Segments[0], match.Segments[len(match.Segments)-1]
+		timeline.Tracks = append(timeline.Tracks, models.TimelineTrack{
+			MatchResult: match,
+			StartMs:     int64(first.QueryStartMs),
+			EndMs:       int64(last.QueryEndMs),
+			SongStartMs: int64(first.RefStartMs),
+			Windows:     span.windows,
 		})
 	}
 
-	s.log.Infof("Returning %d matches", len(results))
-	return results, nil
+	sort.Slice(timeline.Tracks, func(i, j int) bool {
+		return timeline.Tracks[i].StartMs < timeline.Tracks[j].StartMs
+	})
+	timeline.Gaps = timelineGaps(timeline.Tracks, durationMs, cfg.MinGap)
+
+	s.log.Infof("Timeline has %d tracks and %d gaps", len(timeline.Tracks), len(timeline.Gaps))
+	return timeline, nil
 }
 
-func (s *acousticService) MatchHashes(ctx context.Context, hashes map[uint32]uint32) ([]models.MatchResult, error) {
-	s.log.Infof("Matching %d pre-computed hashes", len(hashes))
+// windowSightings matches one timeline window. The matcher aligns each song
+// only once, so a window holding the end of one playback and the start of
+// another of the same song would hide one of them; the spans already
+// explained are therefore cut out and the rest matched again.
+func (s *acousticService) windowSightings(q matcher.Query, cfg *TimelineConfig) ([]timelineSighting, error) {
+	var sightings []timelineSighting
+	for round := 0; round < maxTimelineRounds && len(q) > 0; round++ {
+		results, err := s.matcher.Match(q)
+		if err != nil {
+			return nil, err
+		}
 
-	if len(hashes) == 0 {
-		return []models.MatchResult{}, nil
+		n := len(sightings)
+		for _, res := range results {
+			if res.Count < cfg.MinScore || res.Confidence < cfg.MinConfidence || len(res.Segments) == 0 {
+				continue
+			}
+			sightings = append(sightings, timelineSighting{
+				songID:   res.SongID,
+				offsetMs: res.OffsetMs,
+				startMs:  int64(res.Segments[0].QueryStartMs),
+				endMs:    int64(res.Segments[len(res.Segments)-1].QueryEndMs),
+			})
+		}
+		if len(sightings) == n {
+			break
+		}
+
+		rest := make(matcher.Query, 0, len(q))
+		for _, p := range q {
+			explained := false
+			for _, sg := range sightings[n:] {
+				if int64(p.AnchorTimeMs) >= sg.startMs && int64(p.AnchorTimeMs) <= sg.endMs {
+					explained = true
+					break
+				}
+			}
+			if !explained {
+				rest = append(rest, p)
+			}
+		}
+		q = rest
 	}
+	return sightings, nil
+}
 
-	hashList := make([]uint32, 0, len(hashes))
-	for hash := range hashes {
-		hashList = append(hashList, hash)
+// FindDuplicates matches every song's own fingerprints against the rest of
+// the catalogue and groups songs that share audio: the same recording
+// stored twice, e.g. as "Song" and "Song (Remastered)", or an edit that
+// overlaps its original. It holds every fingerprint in memory while it
+// runs, so it is meant as an occasional maintenance pass.
+func (s *acousticService) FindDuplicates(ctx context.Context, opts ...DuplicateOption) ([]models.DuplicateCluster, error) {
+	cfg := defaultDuplicateConfig()
+	for _, opt := range opts {
+		opt(cfg)
 	}
 
-	dbMap, err := s.storage.GetCouplesByHashes(hashList)
+	source, ok := s.storage.(index.Source)
+	if !ok {
+		return nil, fmt.Errorf("storage %T can't enumerate its fingerprints", s.storage)
+	}
+	songList, err := s.storage.ListSongs()
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve fingerprints from database: %w", err)
+		return nil, fmt.Errorf("listing songs: %w", err)
+	}
+	songs := make(map[string]models.Song, len(songList))
+	for _, song := range songList {
+		songs[song.ID] = song
 	}
-	s.log.Infof("Retrieved couples for %d/%d hashes", len(dbMap), len(hashes))
 
-	// 3. Perform time-coherence voting to find matches
-	// Build offset votes: map[songID]map[offset]count
-	votes := make(map[string]map[int32]int)
+	snapshot := &catalogueSnapshot{couples: make(map[uint32][]models.Couple), counts: make(map[string]int)}
+	queries := make(map[string]matcher.Query, len(songList))
+	err = source.ForEachFingerprint(func(hash uint32, c models.Couple) error {
+		snapshot.couples[hash] = append(snapshot.couples[hash], c)
+		snapshot.counts[c.SongID]++
+		queries[c.SongID] = append(queries[c.SongID], models.HashPair{Hash: hash, AnchorTimeMs: c.AnchorTimeMs})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading fingerprints: %w", err)
+	}
+	counts := snapshot.counts
+
+	// Every candidate is wanted, not just the top results of a normal match.
+	// Stored copies play at the same speed, and skipping the speed search
+	// keeps a catalogue-wide pass affordable.
+	opt := s.matcher.Options()
+	opt.TopK, opt.MinScore, opt.MinConfidence = 0, cfg.MinScore, 0
+	opt.MaxSpeedDeviation = 0
+	m := matcher.New(snapshot, opt)
+
+	ids := make([]string, 0, len(queries))
+	for id := range queries {
+		if _, ok := songs[id]; ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
 
-	for hash, queryAnchorTime := range hashes {
-		dbCouples, exists := dbMap[hash]
-		if !exists {
-			continue
+	best := make(map[[2]string]models.DuplicatePair)
+	for _, a := range ids {
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
 
-		for _, couple := range dbCouples {
-			// Calculate time offset: dbTime - queryTime
-			offset := int32(couple.AnchorTimeMs) - int32(queryAnchorTime)
+		q := queries[a]
+		sort.Slice(q, func(i, j int) bool { return q[i].AnchorTimeMs < q[j].AnchorTimeMs })
+		results, err := m.Match(q)
+		if err != nil {
+			return nil, fmt.Errorf("matching %s: %w", a, err)
+		}
+
+		for _, res := range results {
+			b := res.SongID
+			if b == a || counts[b] == 0 {
+				continue
+			}
+			pair := models.DuplicatePair{
+				SongA:      a,
+				SongB:      b,
+				Score:      res.Count,
+				CoverageA:  math.Min(1, float64(res.Count)/float64(counts[a])),
+				CoverageB:  math.Min(1, float64(res.Count)/float64(counts[b])),
+				OffsetMs:   res.OffsetMs,
+				SpeedRatio: res.SpeedRatio,
+			}
+			pair.Overlap = math.Max(pair.CoverageA, pair.CoverageB)
+			pair.Identical = math.Min(pair.CoverageA, pair.CoverageB) >= cfg.IdenticalCoverage
+			if pair.Overlap < cfg.MinOverlap {
+				continue
+			}
 
-			songVotes := votes[couple.SongID]
-			if songVotes == nil {
-				songVotes = make(map[int32]int)
-				votes[couple.SongID] = songVotes
+			// Both directions are measured; keep the stronger
+			key := [2]string{a, b}
+			if b < a {
+				key = [2]string{b, a}
+			}
+			if prev, ok := best[key]; !ok || pair.Score > prev.Score {
+				best[key] = pair
 			}
-			songVotes[offset]++
 		}
 	}
 
-	// 4. Find the best (most voted) offset for each song
-	matches := make([]models.Match, 0)
-	for songID, offsetVotes := range votes {
-		bestOffset := int32(0)
-		bestCount := 0
+	pairs := make([]models.DuplicatePair, 0, len(best))
+	for _, p := range best {
+		pairs = append(pairs, p)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].SongA != pairs[j].SongA {
+			return pairs[i].SongA < pairs[j].SongA
+		}
+		return pairs[i].SongB < pairs[j].SongB
+	})
 
-		for offset, count := range offsetVotes {
-			if count > bestCount {
-				bestCount = count
-				bestOffset = offset
-			}
+	clusters := clusterDuplicates(pairs, songs, counts)
+	s.log.Infof("Found %d duplicate clusters among %d songs", len(clusters), len(ids))
+	return clusters, nil
+}
+
+// MergeDuplicates folds an audio-identical cluster into its first song,
+// which FindDuplicates orders to have the richest metadata. Metadata the
+// kept song lacks is taken from the others, which are then deleted along
+// with their fingerprints. It returns the kept song's ID.
+func (s *acousticService) MergeDuplicates(cluster models.DuplicateCluster) (string, error) {
+	if !cluster.Identical {
+		return "", errors.New("cluster holds songs that only partly overlap; refusing to merge")
+	}
+	if len(cluster.Songs) < 2 {
+		return "", errors.New("cluster has nothing to merge")
+	}
+
+	// The cluster's copies may be stale, so merge what is stored now
+	keep, err := s.storage.GetSongByID(cluster.Songs[0].ID)
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %w", cluster.Songs[0].ID, err)
+	}
+	changed := false
+	for _, other := range cluster.Songs[1:] {
+		stored, err := s.storage.GetSongByID(other.ID)
+		if err != nil {
+			return "", fmt.Errorf("reading %s: %w", other.ID, err)
+		}
+		if fillSong(keep, *stored) {
+			changed = true
 		}
+	}
+	if changed {
+		if err := s.storage.UpdateSong(keep); err != nil {
+			return "", fmt.Errorf("updating %s: %w", keep.ID, err)
+		}
+	}
 
-		if bestCount > 0 {
-			matches = append(matches, models.Match{
-				SongID:   songID,
-				OffsetMs: bestOffset,
-				Count:    bestCount,
-			})
+	for _, other := range cluster.Songs[1:] {
+		if err := s.storage.DeleteSongByID(other.ID); err != nil {
+			return "", fmt.Errorf("deleting %s: %w", other.ID, err)
 		}
+		s.log.Infof("Merged %s (%s - %s) into %s", other.ID, other.Artist, other.Title, keep.ID)
 	}
+	return keep.ID, nil
+}
 
-	s.log.Infof("Found %d candidate matches", len(matches))
+// speedHypothesisStep is the spacing of the playback speeds the query is
+// re-hashed at; the slope fit recovers the remaining half step
+const speedHypothesisStep = 0.01
+
+// minConvincingConfidence is the confidence above which the original-speed
+// match is accepted without trying other speeds
+const minConvincingConfidence = 50.0
+
+// convincing reports whether the strongest match is confident enough
+func convincing(matches []matcher.Result) bool {
+	return len(matches) > 0 && matches[0].Confidence >= minConvincingConfidence
+}
 
-	// 5. Convert to results with song metadata
+// matchSpeedHypotheses re-hashes the query peaks at speeds 1±step, 1±2·step
+// and so on up to the configured deviation, both with and without the pitch
+// shift a plain speed change causes, and keeps the strongest result. It
+// stops at the first convincing one. Every speed tried is another chance
+// for noise to line up, which the kept result's probability accounts for.
+func (s *acousticService) matchSpeedHypotheses(ctx context.Context, peaks []fingerprint.Peak, best []matcher.Result, stats *matcher.Stats) ([]matcher.Result, error) {
+	maxSteps := int(s.config.Match.MaxSpeedDeviation/speedHypothesisStep + 1e-9)
+	tries := 1
+	for k := 1; k <= maxSteps; k++ {
+		for _, speed := range []float64{1 + float64(k)*speedHypothesisStep, 1 - float64(k)*speedHypothesisStep} {
+			for _, preservePitch := range []bool{false, true} {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+
+				scaled := s.profile.ScalePeaks(peaks, speed, preservePitch)
+				matches, err := s.matcher.MatchTimed(matcher.FromCouples(s.profile.Fingerprint(scaled, "")), speed, stats)
+				if err != nil {
+					return nil, err
+				}
+				tries++
+
+				if len(matches) > 0 && (len(best) == 0 || matches[0].Count > best[0].Count) {
+					s.log.Debugf("Speed %.2f (keep pitch: %v) improved the best score to %d", speed, preservePitch, matches[0].Count)
+					best = matches
+					if judged := s.matcher.Retried(slices.Clone(best), tries); convincing(judged) {
+						return judged, nil
+					}
+				}
+			}
+		}
+	}
+	return s.matcher.Retried(best, tries), nil
+}
+
+// buildResults attaches song metadata to the ranked matches
+func (s *acousticService) buildResults(matches []matcher.Result) []models.MatchResult {
 	results := make([]models.MatchResult, 0, len(matches))
 	for _, match := range matches {
 		song, err := s.GetSongByID(match.SongID)
 		if err != nil {
-			s.log.Warnf("Failed to get song %d: %v", match.SongID, err)
+			s.log.Warnf("Failed to get song %s: %v", match.SongID, err)
 			continue
 		}
 
-		// Get database song's fingerprint count for confidence calculation
-		dbFingerprintCount, err := s.storage.GetFingerprintCount(match.SongID)
-		if err != nil {
-			s.log.Warnf("Failed to get fingerprint count for song %d: %v", match.SongID, err)
-			dbFingerprintCount = len(hashes) // Fallback
-		}
-
-		confidence := s.calculateConfidence(match.Count, len(hashes), dbFingerprintCount)
-
 		results = append(results, models.MatchResult{
 			SongID:     match.SongID,
 			Title:      song.Title,
@@ -264,68 +630,114 @@ func (s *acousticService) MatchHashes(ctx context.Context, hashes map[uint32]uin
 			YouTubeID:  song.YouTubeID,
 			Score:      match.Count,
 			OffsetMs:   match.OffsetMs,
-			Confidence: confidence,
+			Confidence: match.Confidence,
+			SpeedRatio: match.SpeedRatio,
+
+			Probability: match.Probability,
+			Matched:     match.Matched,
+
+			SpotifyID:   song.SpotifyID,
+			Album:       song.Album,
+			ISRC:        song.ISRC,
+			Year:        song.Year,
+			Genre:       song.Genre,
+			Tags:        song.Tags,
+			ExternalIDs: song.ExternalIDs,
+
+			Segments: match.Segments,
+			Density:  match.Density,
 		})
 	}
-
-	s.log.Infof("Returning %d matches", len(results))
-	return results, nil
+	return results
 }
 
-// calculateConfidence computes a more meaningful confidence score.
-// It considers:
-// - Match count (number of aligned fingerprints)
-// - Query size and database song size (uses smaller as reference)
-// - Sigmoid scaling to emphasize strong matches
-// - Statistical significance (minimum threshold)
-func (s *acousticService) calculateConfidence(matchCount, queryFPCount, dbFPCount int) float64 {
-	if matchCount == 0 || queryFPCount == 0 || dbFPCount == 0 {
-		return 0.0
+// fingerprintStream decodes r to mono PCM at the configured sample rate and
+// runs a fingerprinter made by newFP, the profile's reference or query one,
+// over it. The returned couples carry no song ID. onPeak, if not nil,
+// receives every peak as well, and pipeline, if not nil, the time spent.
+func (s *acousticService) fingerprintStream(ctx context.Context, r io.Reader, newFP func(fingerprint.HashFunc) *fingerprint.Fingerprinter, onPeak fingerprint.PeakFunc, pipeline *PipelineStats) (map[uint32][]models.Couple, fingerprint.StreamStats, error) {
+	start := time.Now()
+	pcm, err := audio.NewPCMStream(ctx, r, s.profile.SampleRate)
+	if err != nil {
+		return nil, fingerprint.StreamStats{}, fmt.Errorf("audio decoding failed: %w", err)
 	}
+	defer pcm.Close()
+	// Opening may have waited for an ffmpeg slot, which counts as decoding
+	opened := time.Now()
 
-	// Use the minimum fingerprint count as the reference
-	// This ensures fair comparison between short queries and long songs
-	minFPCount := queryFPCount
-	if dbFPCount < minFPCount {
-		minFPCount = dbFPCount
-	}
+	fps := make(map[uint32][]models.Couple)
+	fp := newFP(func(hash uint32, anchorTimeMs uint32) {
+		fps[hash] = append(fps[hash], models.Couple{AnchorTimeMs: anchorTimeMs})
+	})
+	fp.OnPeak = onPeak
 
-	// Base ratio: how many matched out of possible matches
-	ratio := float64(matchCount) / float64(minFPCount)
+	src := &contextReader{ctx: ctx, r: pcm}
+	stats, err := fp.Run(src)
+	if err != nil {
+		return nil, stats, fmt.Errorf("fingerprinting failed: %w", err)
+	}
+	if err := pcm.Close(); err != nil {
+		return nil, stats, fmt.Errorf("audio decoding failed: %w", err)
+	}
+	if pipeline != nil {
+		pipeline.Decode += opened.Sub(start) + src.busy
+		pipeline.addStream(stats)
+	}
+	if gated := stats.Gated; gated.Skipped() > 0 {
+		s.log.Infof("Skipped %d of %d frames: %d digital silence, %d too quiet, %d noise-like",
+			gated.Skipped(), stats.Frames, gated.ZeroFrames, gated.SilentFrames, gated.NoisyFrames)
+	}
 
-	// Apply sigmoid-like scaling to make the confidence more meaningful:
-	// - Low matches (< 5% of min): very low confidence (0-20%)
-	// - Medium matches (5-20% of min): medium confidence (20-70%)
-	// - High matches (> 20% of min): high confidence (70-100%)
+	return fps, stats, nil
+}
 
-	// Use a scaled and shifted logistic function
-	// confidence = 100 / (1 + e^(-k*(ratio - threshold)))
-	// Adjusted to give reasonable values
+// observe reports stats to the configured observer, if any
+func (s *acousticService) observe(stats PipelineStats) {
+	if s.config.Observer != nil {
+		s.config.Observer.ObservePipeline(stats)
+	}
+}
 
-	const (
-		// Steepness of the sigmoid curve
-		steepness = 20.0
-		// Midpoint of the sigmoid (50% confidence point)
-		midpoint = 0.15 // 15% match ratio gives 50% confidence
-	)
+// contextReader stops a long-running read loop once ctx is done, and
+// measures how long reading takes
+type contextReader struct {
+	ctx  context.Context
+	r    io.Reader
+	busy time.Duration
+}
 
-	// Sigmoid transformation
-	exponent := -steepness * (ratio - midpoint)
-	confidence := 100.0 / (1.0 + math.Exp(exponent))
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	n, err := c.r.Read(p)
+	c.busy += time.Since(start)
+	return n, err
+}
 
-	// Boost confidence for very strong matches (> 30% overlap)
-	if ratio > 0.30 {
-		boost := (ratio - 0.30) * 50 // Additional boost for exceptional matches
-		confidence = math.Min(100.0, confidence+boost)
+// MatchHashes identifies pre-computed query hashes, e.g. from the WASM
+// client, made with profile. A hash may occur several times at different
+// anchor times.
+func (s *acousticService) MatchHashes(ctx context.Context, profile FingerprintProfile, query []models.HashPair) ([]models.MatchResult, error) {
+	s.log.Infof("Matching %d pre-computed hashes", len(query))
+	if err := s.checkProfile(profile); err != nil {
+		return nil, err
 	}
 
-	// Statistical significance filter: very low match counts are unreliable
-	if matchCount < 5 {
-		// Penalize very low match counts
-		confidence *= float64(matchCount) / 5.0
+	var stats matcher.Stats
+	matches, err := s.matcher.MatchTimed(query, 1, &stats)
+	if err != nil {
+		return nil, err
 	}
+	s.log.Infof("Found %d candidate matches", len(matches))
 
-	return confidence
+	results := s.buildResults(matches)
+	s.log.Infof("Returning %d matches", len(results))
+	pipeline := PipelineStats{Operation: OpMatchHashes, Hashes: len(query)}
+	pipeline.addMatch(stats, results)
+	s.observe(pipeline)
+	return results, nil
 }
 
 // GetSongByID retrieves a song's metadata by its database ID.
@@ -338,6 +750,26 @@ func (s *acousticService) ListSongs() ([]models.Song, error) {
 	return s.storage.ListSongs()
 }
 
+// QuerySongs searches, filters and pages through the catalogue
+func (s *acousticService) QuerySongs(q models.SongQuery) (*models.SongPage, error) {
+	return s.storage.QuerySongs(q)
+}
+
+// UpdateSong changes a song's metadata and returns the updated song
+func (s *acousticService) UpdateSong(songID string, update models.SongUpdate) (*models.Song, error) {
+	song, err := s.storage.GetSongByID(songID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applySongUpdate(song, update); err != nil {
+		return nil, err
+	}
+	if err := s.storage.UpdateSong(song); err != nil {
+		return nil, err
+	}
+	return song, nil
+}
+
 // DeleteSong removes a song and all its fingerprints from the database.
 func (s *acousticService) DeleteSong(songID string) error {
 	return s.storage.DeleteSongByID(songID)
@@ -0,0 +1,140 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+package acousticdna
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// failingStore refuses to store fingerprints
+type failingStore struct {
+	Storage
+}
+
+var errStoreFailed = errors.New("store failed")
+
+func (failingStore) StoreFingerprints(map[uint32][]models.Couple) error {
+	return errStoreFailed
+}
+
+func newTestService(t *testing.T, stor Storage) *acousticService {
+	t.Helper()
+	svc, err := NewService(WithStorage(stor))
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	t.Cleanup(func() { svc.Close() })
+	return svc.(*acousticService)
+}
+
+func testFingerprints(n int) *models.SongFingerprints {
+	fp := &models.SongFingerprints{DurationMs: 1000, Hashes: make(map[uint32][]models.Couple)}
+	for i := 0; i < n; i++ {
+		fp.Hashes[uint32(i+1)] = []models.Couple{{AnchorTimeMs: uint32(i * 10)}}
+	}
+	return fp
+}
+
+func TestStoreSongRejectsDuplicate(t *testing.T) {
+	stor := NewMemoryStorage()
+	svc := newTestService(t, stor)
+
+	song := models.Song{Title: "Song", Artist: "Artist"}
+	id, err := svc.StoreSong(song, testFingerprints(3))
+	if err != nil {
+		t.Fatalf("StoreSong: %v", err)
+	}
+
+	again, err := svc.StoreSong(song, testFingerprints(5))
+	if !errors.Is(err, ErrSongExists) {
+		t.Fatalf("StoreSong of a catalogued song: err = %v, want ErrSongExists", err)
+	}
+	if again != id {
+		t.Errorf("StoreSong of a catalogued song returned ID %q, want existing %q", again, id)
+	}
+	if n, err := stor.GetFingerprintCount(id); err != nil || n != 3 {
+		t.Errorf("fingerprints of the existing song = %d, %v; want 3 untouched", n, err)
+	}
+}
+
+func TestStoreSongRollsBackOnlyItsOwnSong(t *testing.T) {
+	stor := NewMemoryStorage()
+	svc := newTestService(t, stor)
+
+	id, err := svc.StoreSong(models.Song{Title: "Song", Artist: "Artist"}, testFingerprints(3))
+	if err != nil {
+		t.Fatalf("StoreSong: %v", err)
+	}
+
+	svc.storage = failingStore{stor}
+	if _, err := svc.StoreSong(models.Song{Title: "Song", Artist: "Artist"}, testFingerprints(3)); !errors.Is(err, ErrSongExists) {
+		t.Fatalf("StoreSong of a catalogued song: err = %v, want ErrSongExists", err)
+	}
+	if _, err := stor.GetSongByID(id); err != nil {
+		t.Errorf("existing song was removed: %v", err)
+	}
+
+	_, err = svc.StoreSong(models.Song{Title: "New", Artist: "Artist"}, testFingerprints(3))
+	if !errors.Is(err, errStoreFailed) {
+		t.Fatalf("StoreSong with failing storage: err = %v, want %v", err, errStoreFailed)
+	}
+	songs, err := stor.ListSongs()
+	if err != nil {
+		t.Fatalf("ListSongs: %v", err)
+	}
+	if len(songs) != 1 || songs[0].ID != id {
+		t.Errorf("songs after a failed store = %+v, want only %s", songs, id)
+	}
+}
+
+func TestMergeDuplicatesKeepsMetadata(t *testing.T) {
+	stor := NewMemoryStorage()
+	svc := newTestService(t, stor)
+
+	keepID, err := svc.StoreSong(models.Song{Title: "Song", Artist: "Artist", Album: "Album"}, testFingerprints(3))
+	if err != nil {
+		t.Fatalf("StoreSong: %v", err)
+	}
+	dupID, err := svc.StoreSong(models.Song{
+		Title: "Song (Remastered)", Artist: "Artist", Album: "Other Album",
+		YouTubeID: "dQw4w9WgXcQ", ISRC: "USRC17607839", Year: 1987, Genre: "Pop",
+		Tags: []string{"80s"}, ExternalIDs: map[string]string{"musicbrainz": "mbid"},
+	}, testFingerprints(3))
+	if err != nil {
+		t.Fatalf("StoreSong: %v", err)
+	}
+
+	// Only the IDs matter; the stored songs are what gets merged
+	cluster := models.DuplicateCluster{
+		Songs:     []models.Song{{ID: keepID}, {ID: dupID}},
+		Identical: true,
+	}
+	id, err := svc.MergeDuplicates(cluster)
+	if err != nil {
+		t.Fatalf("MergeDuplicates: %v", err)
+	}
+	if id != keepID {
+		t.Errorf("MergeDuplicates kept %s, want %s", id, keepID)
+	}
+
+	kept, err := stor.GetSongByID(keepID)
+	if err != nil {
+		t.Fatalf("GetSongByID: %v", err)
+	}
+	if kept.Title != "Song" || kept.Album != "Album" {
+		t.Errorf("kept song's own metadata was overwritten: %+v", kept)
+	}
+	if kept.YouTubeID != "dQw4w9WgXcQ" || kept.ISRC != "USRC17607839" || kept.Year != 1987 || kept.Genre != "Pop" {
+		t.Errorf("kept song lacks the duplicate's metadata: %+v", kept)
+	}
+	if len(kept.Tags) != 1 || kept.ExternalIDs["musicbrainz"] != "mbid" {
+		t.Errorf("kept song lacks the duplicate's tags or external IDs: %+v", kept)
+	}
+	if _, err := stor.GetSongByID(dupID); !errors.Is(err, ErrSongNotFound) {
+		t.Errorf("duplicate still stored: err = %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+package acousticdna
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/audio"
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// ErrInvalidMetadata is returned by UpdateSong for an update that would
+// leave a song with bad metadata, such as an empty title
+var ErrInvalidMetadata = errors.New("invalid song metadata")
+
+// SongFromTags describes a song by a file's embedded tags
+func SongFromTags(meta *audio.Metadata) models.Song {
+	if meta == nil {
+		return models.Song{}
+	}
+	isrc, _ := NormalizeISRC(meta.ISRC)
+	return models.Song{
+		Title:  strings.TrimSpace(meta.Title),
+		Artist: strings.TrimSpace(meta.Artist),
+		Album:  strings.TrimSpace(meta.Album),
+		Genre:  strings.TrimSpace(meta.Genre),
+		Year:   meta.Year,
+		ISRC:   isrc,
+	}
+}
+
+// SongFromYouTube describes a song by a video's yt-dlp metadata, preferring
+// the track name YouTube Music reports over the video title
+func SongFromYouTube(meta *audio.YTMetadata) models.Song {
+	if meta == nil {
+		return models.Song{}
+	}
+	title := strings.TrimSpace(meta.Track)
+	if title == "" {
+		title = strings.TrimSpace(meta.Title)
+	}
+	return models.Song{
+		Title:     title,
+		Artist:    strings.TrimSpace(meta.Artist),
+		YouTubeID: meta.ID,
+		Album:     strings.TrimSpace(meta.Album),
+		Genre:     strings.TrimSpace(meta.Genre),
+		Year:      meta.ReleaseYear,
+	}
+}
+
+// fillSong copies src's metadata into the fields dst leaves blank and
+// reports whether anything changed. IDs and duration are never copied.
+func fillSong(dst *models.Song, src models.Song) bool {
+	changed := false
+	for _, f := range []struct{ dst, src *string }{
+		{&dst.Title, &src.Title},
+		{&dst.Artist, &src.Artist},
+		{&dst.YouTubeID, &src.YouTubeID},
+		{&dst.SpotifyID, &src.SpotifyID},
+		{&dst.Album, &src.Album},
+		{&dst.ISRC, &src.ISRC},
+		{&dst.Genre, &src.Genre},
+	} {
+		if *f.dst == "" && *f.src != "" {
+			*f.dst = *f.src
+			changed = true
+		}
+	}
+	if dst.Year == 0 && src.Year != 0 {
+		dst.Year = src.Year
+		changed = true
+	}
+	if len(dst.Tags) == 0 && len(src.Tags) > 0 {
+		dst.Tags = append([]string(nil), src.Tags...)
+		changed = true
+	}
+	for service, id := range src.ExternalIDs {
+		if _, ok := dst.ExternalIDs[service]; ok || id == "" {
+			continue
+		}
+		if dst.ExternalIDs == nil {
+			dst.ExternalIDs = make(map[string]string)
+		}
+		dst.ExternalIDs[service] = id
+		changed = true
+	}
+	return changed
+}
+
+// NormalizeISRC uppercases an ISRC and drops its hyphens and spaces, so
+// "us-rc1-76-07839" becomes "USRC17607839". An empty code is valid.
+func NormalizeISRC(isrc string) (string, error) {
+	isrc = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(isrc))
+	if isrc == "" {
+		return "", nil
+	}
+	if len(isrc) != 12 {
+		return "", fmt.Errorf("%w: ISRC %q must have 12 characters", ErrInvalidMetadata, isrc)
+	}
+	for i, r := range isrc {
+		letter := r >= 'A' && r <= 'Z'
+		digit := r >= '0' && r <= '9'
+		// Country code, then alphanumeric registrant, then year and designation digits
+		if (i < 2 && !letter) || (i >= 2 && i < 5 && !letter && !digit) || (i >= 5 && !digit) {
+			return "", fmt.Errorf("%w: malformed ISRC %q", ErrInvalidMetadata, isrc)
+		}
+	}
+	return isrc, nil
+}
+
+// applySongUpdate changes song as update describes
+func applySongUpdate(song *models.Song, update models.SongUpdate) error {
+	for _, f := range []struct {
+		dst      *string
+		src      *string
+		required string
+	}{
+		{&song.Title, update.Title, "title"},
+		{&song.Artist, update.Artist, "artist"},
+		{&song.YouTubeID, update.YouTubeID, ""},
+		{&song.SpotifyID, update.SpotifyID, ""},
+		{&song.Album, update.Album, ""},
+		{&song.Genre, update.Genre, ""},
+	} {
+		if f.src == nil {
+			continue
+		}
+		v := strings.TrimSpace(*f.src)
+		if v == "" && f.required != "" {
+			return fmt.Errorf("%w: %s can't be empty", ErrInvalidMetadata, f.required)
+		}
+		*f.dst = v
+	}
+
+	if update.ISRC != nil {
+		isrc, err := NormalizeISRC(*update.ISRC)
+		if err != nil {
+			return err
+		}
+		song.ISRC = isrc
+	}
+	if update.Year != nil {
+		if *update.Year < 0 || *update.Year > 9999 {
+			return fmt.Errorf("%w: year %d", ErrInvalidMetadata, *update.Year)
+		}
+		song.Year = *update.Year
+	}
+	if update.Tags != nil {
+		song.Tags = nil
+		seen := make(map[string]bool)
+		for _, tag := range *update.Tags {
+			tag = strings.TrimSpace(tag)
+			if tag != "" && !seen[tag] {
+				seen[tag] = true
+				song.Tags = append(song.Tags, tag)
+			}
+		}
+	}
+	for service, id := range update.ExternalIDs {
+		service, id = strings.TrimSpace(service), strings.TrimSpace(id)
+		if service == "" {
+			return fmt.Errorf("%w: external ID without a service", ErrInvalidMetadata)
+		}
+		if id == "" {
+			delete(song.ExternalIDs, service)
+			continue
+		}
+		if song.ExternalIDs == nil {
+			song.ExternalIDs = make(map[string]string)
+		}
+		song.ExternalIDs[service] = id
+	}
+	if len(song.ExternalIDs) == 0 {
+		song.ExternalIDs = nil
+	}
+	return nil
+}
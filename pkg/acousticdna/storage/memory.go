@@ -0,0 +1,399 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+	"github.com/himanishpuri/AcousticDNA/pkg/utils"
+)
+
+// MemoryStore keeps songs and fingerprints in process memory. It has no
+// external dependencies, which makes it handy for tests and small tools;
+// everything is lost when the process exits.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	songs  map[string]*models.Song
+	order  []string          // song IDs in registration order
+	byName map[string]string // SongKey -> song ID
+	hashes map[uint32][]models.Couple
+
+	// songHashes lists the buckets each song appears in so deletes don't
+	// have to scan the whole index
+	songHashes map[string]map[uint32]int
+	meta       map[string]string
+	jobs       map[string]models.Job
+	keys       map[string]models.APIKey
+	closed     bool
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		songs:      make(map[string]*models.Song),
+		byName:     make(map[string]string),
+		hashes:     make(map[uint32][]models.Couple),
+		songHashes: make(map[string]map[uint32]int),
+		meta:       make(map[string]string),
+		jobs:       make(map[string]models.Job),
+		keys:       make(map[string]models.APIKey),
+	}
+}
+
+func (m *MemoryStore) RegisterSong(title, artist, youtubeID string, durationMs int) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return "", false, ErrClosed
+	}
+
+	key := SongKey(title, artist)
+	if id, ok := m.byName[key]; ok {
+		song := m.songs[id]
+		if song.YouTubeID == "" && youtubeID != "" {
+			song.YouTubeID = youtubeID
+		}
+		return id, false, nil
+	}
+
+	id := utils.GenerateUUID()
+	m.songs[id] = &models.Song{
+		ID:         id,
+		Title:      title,
+		Artist:     artist,
+		YouTubeID:  youtubeID,
+		DurationMs: durationMs,
+		CreatedAt:  time.Now().UTC(),
+	}
+	m.byName[key] = id
+	m.order = append(m.order, id)
+	return id, true, nil
+}
+
+func (m *MemoryStore) StoreFingerprints(fp map[uint32][]models.Couple) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+
+	for hash, couples := range fp {
+		for _, c := range couples {
+			m.hashes[hash] = append(m.hashes[hash], c)
+
+			perSong := m.songHashes[c.SongID]
+			if perSong == nil {
+				perSong = make(map[uint32]int)
+				m.songHashes[c.SongID] = perSong
+			}
+			perSong[hash]++
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetCouplesByHash(hash uint32) ([]models.Couple, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	bucket := m.hashes[hash]
+	out := make([]models.Couple, len(bucket))
+	copy(out, bucket)
+	return out, nil
+}
+
+func (m *MemoryStore) GetCouplesByHashes(hashes []uint32) (map[uint32][]models.Couple, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	result := make(map[uint32][]models.Couple)
+	for _, h := range hashes {
+		if _, done := result[h]; done {
+			continue
+		}
+		bucket := m.hashes[h]
+		if len(bucket) == 0 {
+			continue
+		}
+		out := make([]models.Couple, len(bucket))
+		copy(out, bucket)
+		result[h] = out
+	}
+	return result, nil
+}
+
+func (m *MemoryStore) DeleteSongByID(songID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+
+	for hash := range m.songHashes[songID] {
+		bucket := m.hashes[hash]
+		kept := bucket[:0]
+		for _, c := range bucket {
+			if c.SongID != songID {
+				kept = append(kept, c)
+			}
+		}
+		if len(kept) == 0 {
+			delete(m.hashes, hash)
+		} else {
+			m.hashes[hash] = kept
+		}
+	}
+	delete(m.songHashes, songID)
+
+	song, ok := m.songs[songID]
+	if !ok {
+		return nil
+	}
+	delete(m.byName, SongKey(song.Title, song.Artist))
+	delete(m.songs, songID)
+	for i, id := range m.order {
+		if id == songID {
+			m.order = append(m.order[:i], m.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// UpdateSong overwrites the metadata of song.ID with song's; the duration
+// is left alone
+func (m *MemoryStore) UpdateSong(song *models.Song) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+
+	stored, ok := m.songs[song.ID]
+	if !ok {
+		return ErrSongNotFound
+	}
+	key := SongKey(song.Title, song.Artist)
+	if id, ok := m.byName[key]; ok && id != song.ID {
+		return ErrSongExists
+	}
+
+	delete(m.byName, SongKey(stored.Title, stored.Artist))
+	m.byName[key] = song.ID
+	updated := song.Clone()
+	updated.DurationMs, updated.CreatedAt = stored.DurationMs, stored.CreatedAt
+	m.songs[song.ID] = &updated
+	return nil
+}
+
+func (m *MemoryStore) GetSongByID(songID string) (*models.Song, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	song, ok := m.songs[songID]
+	if !ok {
+		return nil, ErrSongNotFound
+	}
+	out := song.Clone()
+	return &out, nil
+}
+
+func (m *MemoryStore) GetFingerprintCount(songID string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return 0, ErrClosed
+	}
+
+	count := 0
+	for _, n := range m.songHashes[songID] {
+		count += n
+	}
+	return count, nil
+}
+
+func (m *MemoryStore) ListSongs() ([]models.Song, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	songs := make([]models.Song, 0, len(m.order))
+	for _, id := range m.order {
+		songs = append(songs, m.songs[id].Clone())
+	}
+	return songs, nil
+}
+
+func (m *MemoryStore) QuerySongs(q models.SongQuery) (*models.SongPage, error) {
+	songs, err := m.ListSongs()
+	if err != nil {
+		return nil, err
+	}
+	return SelectSongs(songs, q)
+}
+
+// ForEachFingerprint calls fn for every stored couple. The store is locked
+// for reading meanwhile, so fn must not write to it.
+func (m *MemoryStore) ForEachFingerprint(fn func(hash uint32, c models.Couple) error) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return ErrClosed
+	}
+
+	for hash, bucket := range m.hashes {
+		for _, c := range bucket {
+			if err := fn(hash, c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetMeta(key string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return "", ErrClosed
+	}
+	return m.meta[key], nil
+}
+
+func (m *MemoryStore) SetMeta(key, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	m.meta[key] = value
+	return nil
+}
+
+func (m *MemoryStore) SaveJob(job *models.Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	m.jobs[job.ID] = *job
+	return nil
+}
+
+func (m *MemoryStore) GetJob(id string) (*models.Job, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return &job, nil
+}
+
+// ListJobs returns every stored job, oldest first
+func (m *MemoryStore) ListJobs() ([]models.Job, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+	jobs := make([]models.Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].CreatedAt.Equal(jobs[j].CreatedAt) {
+			return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs, nil
+}
+
+func (m *MemoryStore) DeleteJob(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	delete(m.jobs, id)
+	return nil
+}
+
+func (m *MemoryStore) SaveAPIKey(key *models.APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	m.keys[key.ID] = *key
+	return nil
+}
+
+func (m *MemoryStore) GetAPIKey(id string) (*models.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+	key, ok := m.keys[id]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	return &key, nil
+}
+
+func (m *MemoryStore) FindAPIKey(hash string) (*models.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+	for _, key := range m.keys {
+		if key.Hash == hash {
+			return &key, nil
+		}
+	}
+	return nil, ErrAPIKeyNotFound
+}
+
+// ListAPIKeys returns every key, oldest first
+func (m *MemoryStore) ListAPIKeys() ([]models.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+	keys := make([]models.APIKey, 0, len(m.keys))
+	for _, key := range m.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+func (m *MemoryStore) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
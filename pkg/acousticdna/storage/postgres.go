@@ -0,0 +1,729 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+	"github.com/himanishpuri/AcousticDNA/pkg/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// postgresSchema is applied on connect; every statement is idempotent.
+// Hashes and anchor times are unsigned 32-bit values kept in INTEGER columns
+// as their two's-complement bit pattern, which halves the index size
+// compared to BIGINT.
+var postgresSchema = []string{
+	`CREATE TABLE IF NOT EXISTS songs (
+		id          VARCHAR(36) PRIMARY KEY,
+		title       TEXT NOT NULL,
+		artist      TEXT NOT NULL,
+		youtube_id  TEXT NOT NULL DEFAULT '',
+		spotify_id  TEXT NOT NULL DEFAULT '',
+		duration_ms INTEGER NOT NULL DEFAULT 0,
+		created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+		CONSTRAINT songs_title_artist_key UNIQUE (title, artist)
+	)`,
+	`ALTER TABLE songs ADD COLUMN IF NOT EXISTS album TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE songs ADD COLUMN IF NOT EXISTS isrc TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE songs ADD COLUMN IF NOT EXISTS year INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE songs ADD COLUMN IF NOT EXISTS genre TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE songs ADD COLUMN IF NOT EXISTS tags TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE songs ADD COLUMN IF NOT EXISTS external_ids TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE songs ADD COLUMN IF NOT EXISTS name_key TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX IF NOT EXISTS idx_songs_name_key ON songs (name_key)`,
+	`CREATE INDEX IF NOT EXISTS idx_songs_youtube_id ON songs (youtube_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_songs_created_at ON songs (created_at, id)`,
+	`CREATE INDEX IF NOT EXISTS idx_songs_isrc ON songs (isrc)`,
+	`CREATE INDEX IF NOT EXISTS idx_songs_spotify_id ON songs (spotify_id)`,
+	`CREATE TABLE IF NOT EXISTS fingerprints (
+		hash           INTEGER NOT NULL,
+		song_id        VARCHAR(36) NOT NULL REFERENCES songs (id) ON DELETE CASCADE,
+		anchor_time_ms INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_fingerprints_hash ON fingerprints (hash)`,
+	`CREATE INDEX IF NOT EXISTS idx_fingerprints_song ON fingerprints (song_id)`,
+	`CREATE TABLE IF NOT EXISTS meta (
+		key   TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS jobs (
+		id         VARCHAR(36) PRIMARY KEY,
+		kind       TEXT NOT NULL,
+		status     TEXT NOT NULL,
+		stage      TEXT NOT NULL DEFAULT '',
+		source     TEXT NOT NULL DEFAULT '',
+		title      TEXT NOT NULL DEFAULT '',
+		artist     TEXT NOT NULL DEFAULT '',
+		youtube_id TEXT NOT NULL DEFAULT '',
+		song_id    TEXT NOT NULL DEFAULT '',
+		error      TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs (status)`,
+	`CREATE TABLE IF NOT EXISTS api_keys (
+		id         VARCHAR(36) PRIMARY KEY,
+		name       TEXT NOT NULL DEFAULT '',
+		role       TEXT NOT NULL,
+		prefix     TEXT NOT NULL DEFAULT '',
+		hash       TEXT NOT NULL UNIQUE,
+		created_at TIMESTAMPTZ NOT NULL,
+		revoked_at TIMESTAMPTZ
+	)`,
+}
+
+// postgresTimeout bounds each storage call, since the Storage interface
+// carries no context of its own
+const postgresTimeout = 5 * time.Minute
+
+type PostgresClient struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresClient connects to the database at dsn (postgres://...) and
+// creates the schema if needed.
+func NewPostgresClient(dsn string) (*PostgresClient, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("opening postgres pool: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("connecting to postgres: %w", err)
+	}
+
+	for _, stmt := range postgresSchema {
+		if _, err := pool.Exec(ctx, stmt); err != nil {
+			pool.Close()
+			return nil, fmt.Errorf("migrating postgres schema: %w", err)
+		}
+	}
+	if err := backfillPostgresNameKeys(ctx, pool); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return &PostgresClient{pool: pool}, nil
+}
+
+// backfillPostgresNameKeys sets the name key of songs stored before there
+// was one. SongKey folds case in Go, which SQL's lower() doesn't match for
+// every script, so the keys are computed here.
+func backfillPostgresNameKeys(ctx context.Context, pool *pgxpool.Pool) error {
+	rows, err := pool.Query(ctx, `SELECT id, title, artist FROM songs WHERE name_key = ''`)
+	if err != nil {
+		return fmt.Errorf("reading songs without a name key: %w", err)
+	}
+	keys := make(map[string]string)
+	for rows.Next() {
+		var id, title, artist string
+		if err := rows.Scan(&id, &title, &artist); err != nil {
+			rows.Close()
+			return fmt.Errorf("reading songs without a name key: %w", err)
+		}
+		keys[id] = SongKey(title, artist)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("reading songs without a name key: %w", err)
+	}
+
+	for id, key := range keys {
+		if _, err := pool.Exec(ctx, `UPDATE songs SET name_key = $2 WHERE id = $1`, id, key); err != nil {
+			return fmt.Errorf("setting name key of %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func (c *PostgresClient) Close() error {
+	if c == nil || c.pool == nil {
+		return nil
+	}
+	c.pool.Close()
+	return nil
+}
+
+func (c *PostgresClient) RegisterSong(title, artist, youtubeID string, durationMs int) (string, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	key := SongKey(title, artist)
+	tx, err := c.pool.Begin(ctx)
+	if err != nil {
+		return "", false, fmt.Errorf("registering song: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Registrations of the same key queue on a transaction lock, so spelling
+	// variants can't both be inserted. An existing song keeps its ID; only a
+	// missing YouTube ID is filled in.
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, key); err != nil {
+		return "", false, fmt.Errorf("registering song: %w", err)
+	}
+
+	var id, storedYouTubeID string
+	created := false
+	err = tx.QueryRow(ctx, `SELECT id, youtube_id FROM songs WHERE name_key = $1 ORDER BY created_at, id LIMIT 1`, key).
+		Scan(&id, &storedYouTubeID)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		id, created = utils.GenerateUUID(), true
+		_, err = tx.Exec(ctx, `
+			INSERT INTO songs (id, title, artist, name_key, youtube_id, duration_ms)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			id, title, artist, key, youtubeID, durationMs,
+		)
+	case err == nil && storedYouTubeID == "" && youtubeID != "":
+		_, err = tx.Exec(ctx, `UPDATE songs SET youtube_id = $2 WHERE id = $1`, id, youtubeID)
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("registering song: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", false, fmt.Errorf("registering song: %w", err)
+	}
+	return id, created, nil
+}
+
+func (c *PostgresClient) DeleteSongByID(songID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	// Fingerprints go with the song through ON DELETE CASCADE
+	if _, err := c.pool.Exec(ctx, `DELETE FROM songs WHERE id = $1`, songID); err != nil {
+		return fmt.Errorf("deleting song: %w", err)
+	}
+	return nil
+}
+
+// StoreFingerprints bulk-loads the couples with COPY, which is an order of
+// magnitude faster than batched INSERTs for the thousands of rows a song produces.
+func (c *PostgresClient) StoreFingerprints(fp map[uint32][]models.Couple) error {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	rows := make([][]any, 0, len(fp))
+	for hash, couples := range fp {
+		for _, cou := range couples {
+			rows = append(rows, []any{int32(hash), cou.SongID, int32(cou.AnchorTimeMs)})
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	_, err := c.pool.CopyFrom(
+		ctx,
+		pgx.Identifier{"fingerprints"},
+		[]string{"hash", "song_id", "anchor_time_ms"},
+		pgx.CopyFromRows(rows),
+	)
+	if err != nil {
+		return fmt.Errorf("copying fingerprints: %w", err)
+	}
+	return nil
+}
+
+func (c *PostgresClient) GetCouplesByHash(hash uint32) ([]models.Couple, error) {
+	result, err := c.GetCouplesByHashes([]uint32{hash})
+	if err != nil {
+		return nil, err
+	}
+	out := result[hash]
+	if out == nil {
+		out = []models.Couple{}
+	}
+	return out, nil
+}
+
+func (c *PostgresClient) GetCouplesByHashes(hashes []uint32) (map[uint32][]models.Couple, error) {
+	result := make(map[uint32][]models.Couple)
+	if len(hashes) == 0 {
+		return result, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	keys := make([]int32, len(hashes))
+	for i, h := range hashes {
+		keys[i] = int32(h)
+	}
+
+	rows, err := c.pool.Query(ctx,
+		`SELECT hash, song_id, anchor_time_ms FROM fingerprints WHERE hash = ANY($1)`, keys)
+	if err != nil {
+		return nil, fmt.Errorf("batch querying fingerprints: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash, anchor int32
+		var songID string
+		if err := rows.Scan(&hash, &songID, &anchor); err != nil {
+			return nil, fmt.Errorf("scanning fingerprint: %w", err)
+		}
+		result[uint32(hash)] = append(result[uint32(hash)], models.Couple{
+			SongID:       songID,
+			AnchorTimeMs: uint32(anchor),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("batch querying fingerprints: %w", err)
+	}
+	return result, nil
+}
+
+// ForEachFingerprint streams every stored fingerprint to fn
+func (c *PostgresClient) ForEachFingerprint(fn func(hash uint32, cou models.Couple) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rows, err := c.pool.Query(ctx, `SELECT hash, song_id, anchor_time_ms FROM fingerprints`)
+	if err != nil {
+		return fmt.Errorf("scanning fingerprints: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash, anchor int32
+		var songID string
+		if err := rows.Scan(&hash, &songID, &anchor); err != nil {
+			return fmt.Errorf("reading fingerprint row: %w", err)
+		}
+		if err := fn(uint32(hash), models.Couple{SongID: songID, AnchorTimeMs: uint32(anchor)}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+const songColumns = `id, title, artist, youtube_id, duration_ms, created_at, spotify_id, album, isrc, year, genre, tags, external_ids`
+
+func scanSong(row pgx.Row) (models.Song, error) {
+	var song models.Song
+	var tags, externalIDs string
+	err := row.Scan(&song.ID, &song.Title, &song.Artist, &song.YouTubeID, &song.DurationMs, &song.CreatedAt,
+		&song.SpotifyID, &song.Album, &song.ISRC, &song.Year, &song.Genre, &tags, &externalIDs)
+	song.Tags, song.ExternalIDs = decodeTags(tags), decodeExternalIDs(externalIDs)
+	return song, err
+}
+
+// UpdateSong overwrites the metadata of song.ID with song's; the duration
+// is left alone
+func (c *PostgresClient) UpdateSong(song *models.Song) error {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	key := SongKey(song.Title, song.Artist)
+	tx, err := c.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("updating song %s: %w", song.ID, err)
+	}
+	defer tx.Rollback(ctx)
+
+	// The same lock as RegisterSong, so a rename can't race a registration
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, key); err != nil {
+		return fmt.Errorf("updating song %s: %w", song.ID, err)
+	}
+	var clash bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM songs WHERE name_key = $1 AND id <> $2)`, key, song.ID).Scan(&clash); err != nil {
+		return fmt.Errorf("checking title and artist: %w", err)
+	}
+	if clash {
+		return fmt.Errorf("%w: %s - %s", ErrSongExists, song.Artist, song.Title)
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE songs SET title = $2, artist = $3, name_key = $4, youtube_id = $5, spotify_id = $6, album = $7,
+			isrc = $8, year = $9, genre = $10, tags = $11, external_ids = $12
+		WHERE id = $1`,
+		song.ID, song.Title, song.Artist, key, song.YouTubeID, song.SpotifyID, song.Album,
+		song.ISRC, song.Year, song.Genre, encodeTags(song.Tags), encodeExternalIDs(song.ExternalIDs),
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
+		return fmt.Errorf("%w: %s - %s", ErrSongExists, song.Artist, song.Title)
+	}
+	if err != nil {
+		return fmt.Errorf("updating song %s: %w", song.ID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: %s", ErrSongNotFound, song.ID)
+	}
+	return tx.Commit(ctx)
+}
+
+func (c *PostgresClient) GetSongByID(songID string) (*models.Song, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	song, err := scanSong(c.pool.QueryRow(ctx, `SELECT `+songColumns+` FROM songs WHERE id = $1`, songID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrSongNotFound, songID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying song: %w", err)
+	}
+	return &song, nil
+}
+
+func (c *PostgresClient) GetFingerprintCount(songID string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	var count int
+	if err := c.pool.QueryRow(ctx,
+		`SELECT count(*) FROM fingerprints WHERE song_id = $1`, songID,
+	).Scan(&count); err != nil {
+		return 0, fmt.Errorf("counting fingerprints: %w", err)
+	}
+	return count, nil
+}
+
+func (c *PostgresClient) ListSongs() ([]models.Song, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	rows, err := c.pool.Query(ctx, `SELECT `+songColumns+` FROM songs ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("listing songs: %w", err)
+	}
+	defer rows.Close()
+
+	songs := make([]models.Song, 0)
+	for rows.Next() {
+		song, err := scanSong(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning song: %w", err)
+		}
+		songs = append(songs, song)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("listing songs: %w", err)
+	}
+	return songs, nil
+}
+
+// QuerySongs returns one page of the songs matching q
+func (c *PostgresClient) QuerySongs(q models.SongQuery) (*models.SongPage, error) {
+	if err := checkQuery(&q); err != nil {
+		return nil, err
+	}
+	cursor, err := decodeCursor(q)
+	if err != nil {
+		return nil, err
+	}
+
+	var where []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	for _, term := range searchTerms(q.Search) {
+		p := arg("%" + escapeLike(term) + "%")
+		where = append(where, fmt.Sprintf(`(title ILIKE %[1]s OR artist ILIKE %[1]s)`, p))
+	}
+	if q.MinDurationMs > 0 {
+		where = append(where, "duration_ms >= "+arg(q.MinDurationMs))
+	}
+	if q.MaxDurationMs > 0 {
+		where = append(where, "duration_ms <= "+arg(q.MaxDurationMs))
+	}
+	switch q.Source {
+	case models.SourceYouTube:
+		where = append(where, "youtube_id <> ''")
+	case models.SourceFile:
+		where = append(where, "youtube_id = ''")
+	}
+	if !q.CreatedAfter.IsZero() {
+		where = append(where, "created_at >= "+arg(q.CreatedAfter))
+	}
+	if !q.CreatedBefore.IsZero() {
+		where = append(where, "created_at < "+arg(q.CreatedBefore))
+	}
+	filter := ""
+	if len(where) > 0 {
+		filter = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	var total int
+	if err := c.pool.QueryRow(ctx, `SELECT count(*) FROM songs`+filter, args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("counting songs: %w", err)
+	}
+
+	column := map[models.SongSort]string{
+		models.SortByCreated:  "created_at",
+		models.SortByTitle:    "title",
+		models.SortByArtist:   "artist",
+		models.SortByDuration: "duration_ms",
+	}[q.Sort]
+	dir, cmp := "ASC", ">"
+	if q.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	if cursor != nil {
+		after, err := cursorSong(cursor)
+		if err != nil {
+			return nil, err
+		}
+		var value any = cursor.Value
+		switch q.Sort {
+		case models.SortByCreated:
+			value = after.CreatedAt
+		case models.SortByDuration:
+			value = after.DurationMs
+		}
+		where = append(where, fmt.Sprintf("(%s, id) %s (%s, %s)", column, cmp, arg(value), arg(cursor.ID)))
+		filter = " WHERE " + strings.Join(where, " AND ")
+	}
+	sql := fmt.Sprintf(`SELECT %s FROM songs%s ORDER BY %s %s, id %s`, songColumns, filter, column, dir, dir)
+	if q.Limit > 0 {
+		sql += " LIMIT " + arg(q.Limit+1)
+	}
+
+	rows, err := c.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying songs: %w", err)
+	}
+	defer rows.Close()
+
+	page := &models.SongPage{Total: total, Songs: make([]models.Song, 0)}
+	for rows.Next() {
+		song, err := scanSong(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning song: %w", err)
+		}
+		page.Songs = append(page.Songs, song)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("querying songs: %w", err)
+	}
+
+	if q.Limit > 0 && len(page.Songs) > q.Limit {
+		page.Songs = page.Songs[:q.Limit]
+		last := page.Songs[len(page.Songs)-1]
+		page.NextCursor = songCursor{Sort: q.Sort, Desc: q.Desc, Value: sortValue(last, q.Sort), ID: last.ID}.encode()
+	}
+	return page, nil
+}
+
+func (c *PostgresClient) GetMeta(key string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	var value string
+	err := c.pool.QueryRow(ctx, `SELECT value FROM meta WHERE key = $1`, key).Scan(&value)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading meta %s: %w", key, err)
+	}
+	return value, nil
+}
+
+func (c *PostgresClient) SetMeta(key, value string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	if _, err := c.pool.Exec(ctx, `
+		INSERT INTO meta (key, value) VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value`, key, value); err != nil {
+		return fmt.Errorf("writing meta %s: %w", key, err)
+	}
+	return nil
+}
+
+// SizeBytes returns the size of the database on disk
+func (c *PostgresClient) SizeBytes() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	var size int64
+	if err := c.pool.QueryRow(ctx, `SELECT pg_database_size(current_database())`).Scan(&size); err != nil {
+		return 0, fmt.Errorf("reading database size: %w", err)
+	}
+	return size, nil
+}
+
+// SaveJob inserts job or replaces the stored copy
+func (c *PostgresClient) SaveJob(job *models.Job) error {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	if _, err := c.pool.Exec(ctx, `
+		INSERT INTO jobs (id, kind, status, stage, source, title, artist, youtube_id, song_id, error, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (id) DO UPDATE SET
+			kind = EXCLUDED.kind, status = EXCLUDED.status, stage = EXCLUDED.stage,
+			source = EXCLUDED.source, title = EXCLUDED.title, artist = EXCLUDED.artist,
+			youtube_id = EXCLUDED.youtube_id, song_id = EXCLUDED.song_id,
+			error = EXCLUDED.error, updated_at = EXCLUDED.updated_at`,
+		job.ID, string(job.Kind), string(job.Status), string(job.Stage), job.Source, job.Title,
+		job.Artist, job.YouTubeID, job.SongID, job.Error, job.CreatedAt, job.UpdatedAt,
+	); err != nil {
+		return fmt.Errorf("saving job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+const jobColumns = `id, kind, status, stage, source, title, artist, youtube_id, song_id, error, created_at, updated_at`
+
+func scanJob(row pgx.Row) (models.Job, error) {
+	var job models.Job
+	var kind, status, stage string
+	err := row.Scan(&job.ID, &kind, &status, &stage, &job.Source, &job.Title, &job.Artist,
+		&job.YouTubeID, &job.SongID, &job.Error, &job.CreatedAt, &job.UpdatedAt)
+	job.Kind, job.Status, job.Stage = models.JobKind(kind), models.JobStatus(status), models.JobStage(stage)
+	return job, err
+}
+
+func (c *PostgresClient) GetJob(id string) (*models.Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	job, err := scanJob(c.pool.QueryRow(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading job %s: %w", id, err)
+	}
+	return &job, nil
+}
+
+// ListJobs returns every stored job, oldest first
+func (c *PostgresClient) ListJobs() ([]models.Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	rows, err := c.pool.Query(ctx, `SELECT `+jobColumns+` FROM jobs ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("listing jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []models.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("listing jobs: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("listing jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+func (c *PostgresClient) DeleteJob(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	if _, err := c.pool.Exec(ctx, `DELETE FROM jobs WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("deleting job %s: %w", id, err)
+	}
+	return nil
+}
+
+// SaveAPIKey inserts key or replaces the stored copy
+func (c *PostgresClient) SaveAPIKey(key *models.APIKey) error {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	var revoked *time.Time
+	if key.Revoked() {
+		revoked = &key.RevokedAt
+	}
+	if _, err := c.pool.Exec(ctx, `
+		INSERT INTO api_keys (id, name, role, prefix, hash, created_at, revoked_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE SET
+			name = EXCLUDED.name, role = EXCLUDED.role, prefix = EXCLUDED.prefix,
+			hash = EXCLUDED.hash, revoked_at = EXCLUDED.revoked_at`,
+		key.ID, key.Name, string(key.Role), key.Prefix, key.Hash, key.CreatedAt, revoked,
+	); err != nil {
+		return fmt.Errorf("saving API key %s: %w", key.ID, err)
+	}
+	return nil
+}
+
+const apiKeyColumns = `id, name, role, prefix, hash, created_at, revoked_at`
+
+func scanAPIKey(row pgx.Row) (models.APIKey, error) {
+	var key models.APIKey
+	var role string
+	var revoked *time.Time
+	err := row.Scan(&key.ID, &key.Name, &role, &key.Prefix, &key.Hash, &key.CreatedAt, &revoked)
+	key.Role = models.Role(role)
+	if revoked != nil {
+		key.RevokedAt = *revoked
+	}
+	return key, err
+}
+
+func (c *PostgresClient) GetAPIKey(id string) (*models.APIKey, error) {
+	return c.findAPIKey(`id = $1`, id)
+}
+
+func (c *PostgresClient) FindAPIKey(hash string) (*models.APIKey, error) {
+	return c.findAPIKey(`hash = $1`, hash)
+}
+
+func (c *PostgresClient) findAPIKey(where, arg string) (*models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	key, err := scanAPIKey(c.pool.QueryRow(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE `+where, arg))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading API key: %w", err)
+	}
+	return &key, nil
+}
+
+// ListAPIKeys returns every key, oldest first
+func (c *PostgresClient) ListAPIKeys() ([]models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	rows, err := c.pool.Query(ctx, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("listing API keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("listing API keys: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("listing API keys: %w", err)
+	}
+	return keys, nil
+}
@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// ErrInvalidQuery is returned by QuerySongs for an unknown sort or source,
+// or a cursor that doesn't belong to the query
+var ErrInvalidQuery = errors.New("invalid song query")
+
+// songCursor is the position after the last song of a page: its sort key
+// and ID, which breaks ties. Cursors are opaque to callers.
+type songCursor struct {
+	Sort  models.SongSort `json:"s"`
+	Desc  bool            `json:"d,omitempty"`
+	Value string          `json:"v"`
+	ID    string          `json:"id"`
+}
+
+func (c songCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// checkQuery validates q and fills in its default sort
+func checkQuery(q *models.SongQuery) error {
+	if q.Sort == "" {
+		q.Sort = models.SortByCreated
+	}
+	switch q.Sort {
+	case models.SortByCreated, models.SortByTitle, models.SortByArtist, models.SortByDuration:
+	default:
+		return fmt.Errorf("%w: unknown sort %q", ErrInvalidQuery, q.Sort)
+	}
+	switch q.Source {
+	case "", models.SourceYouTube, models.SourceFile:
+	default:
+		return fmt.Errorf("%w: unknown source %q", ErrInvalidQuery, q.Source)
+	}
+	if q.Limit < 0 || q.MinDurationMs < 0 || q.MaxDurationMs < 0 {
+		return fmt.Errorf("%w: negative limit or duration", ErrInvalidQuery)
+	}
+	return nil
+}
+
+// decodeCursor reads q's cursor, or returns nil when there is none
+func decodeCursor(q models.SongQuery) (*songCursor, error) {
+	if q.Cursor == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	var c songCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	if c.Sort != q.Sort || c.Desc != q.Desc {
+		return nil, fmt.Errorf("%w: cursor is for another sort order", ErrInvalidQuery)
+	}
+	return &c, nil
+}
+
+// searchTerms splits a search into lowercase terms
+func searchTerms(search string) []string {
+	return strings.Fields(strings.ToLower(search))
+}
+
+// escapeLike makes term match literally inside a LIKE pattern with
+// ESCAPE '\'
+func escapeLike(term string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+}
+
+// sortValue is song's key for the sort order, as stored in a cursor
+func sortValue(song models.Song, by models.SongSort) string {
+	switch by {
+	case models.SortByTitle:
+		return song.Title
+	case models.SortByArtist:
+		return song.Artist
+	case models.SortByDuration:
+		return strconv.Itoa(song.DurationMs)
+	default:
+		return song.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+}
+
+// compareSongs orders songs by the sort key, then by ID
+func compareSongs(a, b models.Song, by models.SongSort) int {
+	var c int
+	switch by {
+	case models.SortByTitle:
+		c = strings.Compare(a.Title, b.Title)
+	case models.SortByArtist:
+		c = strings.Compare(a.Artist, b.Artist)
+	case models.SortByDuration:
+		c = a.DurationMs - b.DurationMs
+	default:
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	}
+	if c != 0 {
+		return c
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+// cursorSong turns a cursor back into a song that sorts where the page ended
+func cursorSong(c *songCursor) (models.Song, error) {
+	song := models.Song{ID: c.ID}
+	var err error
+	switch c.Sort {
+	case models.SortByTitle:
+		song.Title = c.Value
+	case models.SortByArtist:
+		song.Artist = c.Value
+	case models.SortByDuration:
+		song.DurationMs, err = strconv.Atoi(c.Value)
+	default:
+		song.CreatedAt, err = time.Parse(time.RFC3339Nano, c.Value)
+	}
+	if err != nil {
+		return song, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	return song, nil
+}
+
+// matchesQuery reports whether song passes q's filters
+func matchesQuery(song models.Song, q models.SongQuery, terms []string) bool {
+	title, artist := strings.ToLower(song.Title), strings.ToLower(song.Artist)
+	for _, term := range terms {
+		if !strings.Contains(title, term) && !strings.Contains(artist, term) {
+			return false
+		}
+	}
+	switch {
+	case q.MinDurationMs > 0 && song.DurationMs < q.MinDurationMs,
+		q.MaxDurationMs > 0 && song.DurationMs > q.MaxDurationMs,
+		q.Source == models.SourceYouTube && song.YouTubeID == "",
+		q.Source == models.SourceFile && song.YouTubeID != "",
+		!q.CreatedAfter.IsZero() && song.CreatedAt.Before(q.CreatedAfter),
+		!q.CreatedBefore.IsZero() && !song.CreatedAt.Before(q.CreatedBefore):
+		return false
+	}
+	return true
+}
+
+// SelectSongs answers a query over songs held in memory, for backends
+// without a query engine. The page reuses songs' backing array.
+func SelectSongs(songs []models.Song, q models.SongQuery) (*models.SongPage, error) {
+	if err := checkQuery(&q); err != nil {
+		return nil, err
+	}
+	cursor, err := decodeCursor(q)
+	if err != nil {
+		return nil, err
+	}
+
+	terms := searchTerms(q.Search)
+	matched := songs[:0]
+	for _, song := range songs {
+		if matchesQuery(song, q, terms) {
+			matched = append(matched, song)
+		}
+	}
+	less := func(a, b models.Song) bool {
+		if q.Desc {
+			return compareSongs(a, b, q.Sort) > 0
+		}
+		return compareSongs(a, b, q.Sort) < 0
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return less(matched[i], matched[j]) })
+
+	page := &models.SongPage{Total: len(matched)}
+	if cursor != nil {
+		after, err := cursorSong(cursor)
+		if err != nil {
+			return nil, err
+		}
+		start := sort.Search(len(matched), func(i int) bool { return less(after, matched[i]) })
+		matched = matched[start:]
+	}
+	if q.Limit > 0 && len(matched) > q.Limit {
+		matched = matched[:q.Limit]
+		last := matched[len(matched)-1]
+		page.NextCursor = songCursor{Sort: q.Sort, Desc: q.Desc, Value: sortValue(last, q.Sort), ID: last.ID}.encode()
+	}
+	page.Songs = matched
+	return page, nil
+}
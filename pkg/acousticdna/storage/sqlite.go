@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -32,10 +33,37 @@ type Song struct {
 	ID         string `gorm:"primaryKey;type:varchar(36)"`
 	Title      string `gorm:"uniqueIndex:idx_song_unique,priority:1;index:idx_song_meta,priority:1" json:"title"`
 	Artist     string `gorm:"uniqueIndex:idx_song_unique,priority:2;index:idx_song_meta,priority:2" json:"artist"`
+	NameKey    string `gorm:"index:idx_song_name_key" json:"-"` // SongKey(Title, Artist)
 	YouTubeID  string `gorm:"index:idx_youtube_id" json:"youtube_id"`
 	SpotifyID  string `gorm:"index:idx_spotify_id" json:"spotify_id"`
 	DurationMs int    `json:"duration_ms"`
 	CreatedAt  time.Time
+
+	Album       string `json:"album"`
+	ISRC        string `gorm:"column:isrc;index:idx_isrc" json:"isrc"`
+	Year        int    `json:"year"`
+	Genre       string `json:"genre"`
+	Tags        string `json:"tags"`                                    // JSON array
+	ExternalIDs string `gorm:"column:external_ids" json:"external_ids"` // JSON object
+}
+
+// Model converts a row to the domain song
+func (s *Song) Model() models.Song {
+	return models.Song{
+		ID:          s.ID,
+		Title:       s.Title,
+		Artist:      s.Artist,
+		YouTubeID:   s.YouTubeID,
+		DurationMs:  s.DurationMs,
+		CreatedAt:   s.CreatedAt,
+		SpotifyID:   s.SpotifyID,
+		Album:       s.Album,
+		ISRC:        s.ISRC,
+		Year:        s.Year,
+		Genre:       s.Genre,
+		Tags:        decodeTags(s.Tags),
+		ExternalIDs: decodeExternalIDs(s.ExternalIDs),
+	}
 }
 
 type Fingerprint struct {
@@ -45,6 +73,106 @@ type Fingerprint struct {
 	AnchorTimeMs uint32 `json:"anchor_time_ms"`
 }
 
+// Meta holds catalogue-wide settings such as the fingerprint profile
+type Meta struct {
+	Key   string `gorm:"primaryKey"`
+	Value string
+}
+
+func (Meta) TableName() string { return "meta" }
+
+// Job is a background ingestion job, see models.Job
+type Job struct {
+	ID        string `gorm:"primaryKey;type:varchar(36)"`
+	Kind      string
+	Status    string `gorm:"index:idx_job_status"`
+	Stage     string
+	Source    string
+	Title     string
+	Artist    string
+	YouTubeID string
+	SongID    string
+	Error     string
+	CreatedAt time.Time `gorm:"autoCreateTime:false"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime:false"` // Set by the job queue
+}
+
+// APIKey is a server credential, see models.APIKey
+type APIKey struct {
+	ID        string `gorm:"primaryKey;type:varchar(36)"`
+	Name      string
+	Role      string
+	Prefix    string
+	Hash      string    `gorm:"uniqueIndex:idx_api_key_hash"`
+	CreatedAt time.Time `gorm:"autoCreateTime:false"`
+	RevokedAt *time.Time
+}
+
+func newAPIKeyRow(key *models.APIKey) *APIKey {
+	row := &APIKey{
+		ID:        key.ID,
+		Name:      key.Name,
+		Role:      string(key.Role),
+		Prefix:    key.Prefix,
+		Hash:      key.Hash,
+		CreatedAt: key.CreatedAt,
+	}
+	if key.Revoked() {
+		revoked := key.RevokedAt
+		row.RevokedAt = &revoked
+	}
+	return row
+}
+
+func (k *APIKey) model() models.APIKey {
+	key := models.APIKey{
+		ID:        k.ID,
+		Name:      k.Name,
+		Role:      models.Role(k.Role),
+		Prefix:    k.Prefix,
+		Hash:      k.Hash,
+		CreatedAt: k.CreatedAt,
+	}
+	if k.RevokedAt != nil {
+		key.RevokedAt = *k.RevokedAt
+	}
+	return key
+}
+
+func newJobRow(job *models.Job) *Job {
+	return &Job{
+		ID:        job.ID,
+		Kind:      string(job.Kind),
+		Status:    string(job.Status),
+		Stage:     string(job.Stage),
+		Source:    job.Source,
+		Title:     job.Title,
+		Artist:    job.Artist,
+		YouTubeID: job.YouTubeID,
+		SongID:    job.SongID,
+		Error:     job.Error,
+		CreatedAt: job.CreatedAt,
+		UpdatedAt: job.UpdatedAt,
+	}
+}
+
+func (j *Job) model() models.Job {
+	return models.Job{
+		ID:        j.ID,
+		Kind:      models.JobKind(j.Kind),
+		Status:    models.JobStatus(j.Status),
+		Stage:     models.JobStage(j.Stage),
+		Source:    j.Source,
+		Title:     j.Title,
+		Artist:    j.Artist,
+		YouTubeID: j.YouTubeID,
+		SongID:    j.SongID,
+		Error:     j.Error,
+		CreatedAt: j.CreatedAt,
+		UpdatedAt: j.UpdatedAt,
+	}
+}
+
 func NewDBClient() (*DBClient, error) {
 	dbPath := os.Getenv("ACOUSTIC_DB_PATH")
 	if dbPath == "" {
@@ -78,14 +206,32 @@ func NewDBClientWithPath(dbPath string) (*DBClient, error) {
 	sqlDB.SetMaxIdleConns(5)
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
-	if err := db.AutoMigrate(&Song{}, &Fingerprint{}); err != nil {
+	if err := db.AutoMigrate(&Song{}, &Fingerprint{}, &Meta{}, &Job{}, &APIKey{}); err != nil {
 		sqlDB.Close()
 		return nil, fmt.Errorf("auto migrate: %w", err)
 	}
+	if err := backfillNameKeys(db); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
 
 	return &DBClient{DB: db, db: sqlDB}, nil
 }
 
+// backfillNameKeys sets the name key of songs stored before there was one
+func backfillNameKeys(db *gorm.DB) error {
+	var songs []Song
+	if err := db.Select("id", "title", "artist").Where("name_key = '' OR name_key IS NULL").Find(&songs).Error; err != nil {
+		return fmt.Errorf("reading songs without a name key: %w", err)
+	}
+	for _, song := range songs {
+		if err := db.Model(&Song{}).Where("id = ?", song.ID).Update("name_key", SongKey(song.Title, song.Artist)).Error; err != nil {
+			return fmt.Errorf("setting name key of %s: %w", song.ID, err)
+		}
+	}
+	return nil
+}
+
 func (c *DBClient) Close() error {
 	if c == nil || c.db == nil {
 		return nil
@@ -93,44 +239,195 @@ func (c *DBClient) Close() error {
 	return c.db.Close()
 }
 
-func (c *DBClient) RegisterSong(title, artist, youtubeID string, durationMs int) (string, error) {
+func (c *DBClient) RegisterSong(title, artist, youtubeID string, durationMs int) (string, bool, error) {
 	if c == nil || c.DB == nil {
-		return "", errors.New(errDBClientNil)
+		return "", false, errors.New(errDBClientNil)
 	}
 
-	var song Song
-
-	err := c.DB.Where("title = ? AND artist = ?", title, artist).First(&song).Error
-	if err == nil {
-		if song.YouTubeID == "" && youtubeID != "" {
-			if err := c.DB.Model(&song).Update("YouTubeID", youtubeID).Error; err != nil {
-				return "", fmt.Errorf("updating youtube_id: %w", err)
+	var id string
+	var created bool
+	err := c.DB.Transaction(func(tx *gorm.DB) error {
+		var song Song
+		err := tx.Where("name_key = ?", SongKey(title, artist)).Order("created_at, id").First(&song).Error
+		if err == nil {
+			id = song.ID
+			if song.YouTubeID == "" && youtubeID != "" {
+				if err := tx.Model(&song).Update("YouTubeID", youtubeID).Error; err != nil {
+					return fmt.Errorf("updating youtube_id: %w", err)
+				}
 			}
-			song.YouTubeID = youtubeID
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("querying existing song: %w", err)
+		}
+
+		song = Song{
+			ID:         utils.GenerateUUID(),
+			Title:      title,
+			Artist:     artist,
+			NameKey:    SongKey(title, artist),
+			YouTubeID:  youtubeID,
+			DurationMs: durationMs,
+		}
+		if err := tx.Create(&song).Error; err != nil {
+			return fmt.Errorf("creating song: %w", err)
 		}
-		return song.ID, nil
+		id, created = song.ID, true
+		return nil
+	})
+	if err != nil && isUniqueViolation(err) {
+		// Another connection registered the song first
+		var song Song
+		if fetchErr := c.DB.Where("name_key = ?", SongKey(title, artist)).Order("created_at, id").First(&song).Error; fetchErr != nil {
+			return "", false, fmt.Errorf("fetching song after constraint violation: %w", fetchErr)
+		}
+		return song.ID, false, nil
+	}
+	if err != nil {
+		return "", false, err
 	}
+	return id, created, nil
+}
+
+func isUniqueViolation(err error) bool {
+	return errors.Is(err, gorm.ErrDuplicatedKey) || strings.Contains(err.Error(), "constraint failed")
+}
 
-	if !errors.Is(err, gorm.ErrRecordNotFound) {
-		return "", fmt.Errorf("querying existing song: %w", err)
+// UpdateSong overwrites the metadata of song.ID with song's; the duration
+// is left alone
+func (c *DBClient) UpdateSong(song *models.Song) error {
+	if c == nil || c.DB == nil {
+		return errors.New(errDBClientNil)
 	}
 
-	uuid := utils.GenerateUUID()
-	song = Song{ID: uuid, Title: title, Artist: artist, YouTubeID: youtubeID, DurationMs: durationMs}
-	err = c.DB.Create(&song).Error
+	return c.DB.Transaction(func(tx *gorm.DB) error {
+		var clash int64
+		if err := tx.Model(&Song{}).
+			Where("name_key = ? AND id <> ?", SongKey(song.Title, song.Artist), song.ID).
+			Count(&clash).Error; err != nil {
+			return fmt.Errorf("checking title and artist: %w", err)
+		}
+		if clash > 0 {
+			return fmt.Errorf("%w: %s - %s", ErrSongExists, song.Artist, song.Title)
+		}
+
+		res := tx.Model(&Song{}).Where("id = ?", song.ID).Updates(map[string]any{
+			"title":        song.Title,
+			"artist":       song.Artist,
+			"name_key":     SongKey(song.Title, song.Artist),
+			"you_tube_id":  song.YouTubeID,
+			"spotify_id":   song.SpotifyID,
+			"album":        song.Album,
+			"isrc":         song.ISRC,
+			"year":         song.Year,
+			"genre":        song.Genre,
+			"tags":         encodeTags(song.Tags),
+			"external_ids": encodeExternalIDs(song.ExternalIDs),
+		})
+		if res.Error != nil {
+			return fmt.Errorf("updating song %s: %w", song.ID, res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("%w: %s", ErrSongNotFound, song.ID)
+		}
+		return nil
+	})
+}
+
+// songRow is a song with its rowid, which follows registration order
+type songRow struct {
+	Song  `gorm:"embedded"`
+	RowID int64 `gorm:"column:row_id"`
+}
+
+// QuerySongs returns one page of the songs matching q. Registration order
+// is rowid order, since created_at is stored as text.
+func (c *DBClient) QuerySongs(q models.SongQuery) (*models.SongPage, error) {
+	if c == nil || c.DB == nil {
+		return nil, errors.New(errDBClientNil)
+	}
+	if err := checkQuery(&q); err != nil {
+		return nil, err
+	}
+	cursor, err := decodeCursor(q)
 	if err != nil {
-		if errors.Is(err, gorm.ErrDuplicatedKey) ||
-			(err.Error() != "" && (strings.Contains(err.Error(), "UNIQUE constraint failed") ||
-				strings.Contains(err.Error(), "constraint failed"))) {
-			if fetchErr := c.DB.Where("title = ? AND artist = ?", title, artist).First(&song).Error; fetchErr != nil {
-				return "", fmt.Errorf("fetching song after constraint violation: %w", fetchErr)
+		return nil, err
+	}
+
+	tx := c.DB.Table("songs")
+	for _, term := range searchTerms(q.Search) {
+		like := "%" + escapeLike(term) + "%"
+		tx = tx.Where(`(title LIKE ? ESCAPE '\' OR artist LIKE ? ESCAPE '\')`, like, like)
+	}
+	if q.MinDurationMs > 0 {
+		tx = tx.Where("duration_ms >= ?", q.MinDurationMs)
+	}
+	if q.MaxDurationMs > 0 {
+		tx = tx.Where("duration_ms <= ?", q.MaxDurationMs)
+	}
+	switch q.Source {
+	case models.SourceYouTube:
+		tx = tx.Where("you_tube_id <> ''")
+	case models.SourceFile:
+		tx = tx.Where("you_tube_id = ''")
+	}
+	if !q.CreatedAfter.IsZero() {
+		tx = tx.Where("julianday(created_at) >= julianday(?)", q.CreatedAfter)
+	}
+	if !q.CreatedBefore.IsZero() {
+		tx = tx.Where("julianday(created_at) < julianday(?)", q.CreatedBefore)
+	}
+
+	var total int64
+	if err := tx.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("counting songs: %w", err)
+	}
+
+	column := map[models.SongSort]string{
+		models.SortByCreated:  "rowid",
+		models.SortByTitle:    "title",
+		models.SortByArtist:   "artist",
+		models.SortByDuration: "duration_ms",
+	}[q.Sort]
+	dir, cmp := "ASC", ">"
+	if q.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	if cursor != nil {
+		var value any = cursor.Value
+		if q.Sort == models.SortByCreated || q.Sort == models.SortByDuration {
+			if value, err = strconv.ParseInt(cursor.Value, 10, 64); err != nil {
+				return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
 			}
-			return song.ID, nil
 		}
-		return "", fmt.Errorf("creating song: %w", err)
+		tx = tx.Where(fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, cmp), value, value, cursor.ID)
+	}
+	tx = tx.Select("songs.*, rowid AS row_id").Order(fmt.Sprintf("%s %s, id %s", column, dir, dir))
+	if q.Limit > 0 {
+		tx = tx.Limit(q.Limit + 1)
 	}
 
-	return song.ID, nil
+	var rows []songRow
+	if err := tx.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("querying songs: %w", err)
+	}
+
+	page := &models.SongPage{Total: int(total)}
+	if q.Limit > 0 && len(rows) > q.Limit {
+		rows = rows[:q.Limit]
+		last := rows[len(rows)-1]
+		value := sortValue(last.Model(), q.Sort)
+		if q.Sort == models.SortByCreated {
+			value = strconv.FormatInt(last.RowID, 10)
+		}
+		page.NextCursor = songCursor{Sort: q.Sort, Desc: q.Desc, Value: value, ID: last.ID}.encode()
+	}
+	page.Songs = make([]models.Song, len(rows))
+	for i := range rows {
+		page.Songs[i] = rows[i].Model()
+	}
+	return page, nil
 }
 
 func (c *DBClient) DeleteSongByID(songID string) error {
@@ -221,6 +518,175 @@ func (c *DBClient) GetCouplesByHashes(hashes []uint32) (map[uint32][]models.Coup
 	return result, nil
 }
 
+// ForEachFingerprint streams every stored fingerprint row to fn
+func (c *DBClient) ForEachFingerprint(fn func(hash uint32, cou models.Couple) error) error {
+	if c == nil || c.DB == nil {
+		return errors.New(errDBClientNil)
+	}
+
+	rows, err := c.DB.Model(&Fingerprint{}).Select("hash", "song_id", "anchor_time_ms").Rows()
+	if err != nil {
+		return fmt.Errorf("scanning fingerprints: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash, anchor uint32
+		var songID string
+		if err := rows.Scan(&hash, &songID, &anchor); err != nil {
+			return fmt.Errorf("reading fingerprint row: %w", err)
+		}
+		if err := fn(hash, models.Couple{SongID: songID, AnchorTimeMs: anchor}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (c *DBClient) GetMeta(key string) (string, error) {
+	if c == nil || c.DB == nil {
+		return "", errors.New(errDBClientNil)
+	}
+	var m Meta
+	err := c.DB.Where("key = ?", key).First(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading meta %s: %w", key, err)
+	}
+	return m.Value, nil
+}
+
+func (c *DBClient) SetMeta(key, value string) error {
+	if c == nil || c.DB == nil {
+		return errors.New(errDBClientNil)
+	}
+	if err := c.DB.Save(&Meta{Key: key, Value: value}).Error; err != nil {
+		return fmt.Errorf("writing meta %s: %w", key, err)
+	}
+	return nil
+}
+
+// SizeBytes returns the size of the database file
+func (c *DBClient) SizeBytes() (int64, error) {
+	if c == nil || c.DB == nil {
+		return 0, errors.New(errDBClientNil)
+	}
+	var pages, pageSize int64
+	if err := c.DB.Raw("PRAGMA page_count").Scan(&pages).Error; err != nil {
+		return 0, fmt.Errorf("reading page count: %w", err)
+	}
+	if err := c.DB.Raw("PRAGMA page_size").Scan(&pageSize).Error; err != nil {
+		return 0, fmt.Errorf("reading page size: %w", err)
+	}
+	return pages * pageSize, nil
+}
+
+// SaveJob inserts job or replaces the stored copy
+func (c *DBClient) SaveJob(job *models.Job) error {
+	if c == nil || c.DB == nil {
+		return errors.New(errDBClientNil)
+	}
+	if err := c.DB.Save(newJobRow(job)).Error; err != nil {
+		return fmt.Errorf("saving job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+func (c *DBClient) GetJob(id string) (*models.Job, error) {
+	if c == nil || c.DB == nil {
+		return nil, errors.New(errDBClientNil)
+	}
+	var row Job
+	err := c.DB.Where("id = ?", id).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading job %s: %w", id, err)
+	}
+	job := row.model()
+	return &job, nil
+}
+
+// ListJobs returns every stored job, oldest first
+func (c *DBClient) ListJobs() ([]models.Job, error) {
+	if c == nil || c.DB == nil {
+		return nil, errors.New(errDBClientNil)
+	}
+	var rows []Job
+	if err := c.DB.Order("created_at, id").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("listing jobs: %w", err)
+	}
+	jobs := make([]models.Job, len(rows))
+	for i := range rows {
+		jobs[i] = rows[i].model()
+	}
+	return jobs, nil
+}
+
+func (c *DBClient) DeleteJob(id string) error {
+	if c == nil || c.DB == nil {
+		return errors.New(errDBClientNil)
+	}
+	if err := c.DB.Delete(&Job{}, "id = ?", id).Error; err != nil {
+		return fmt.Errorf("deleting job %s: %w", id, err)
+	}
+	return nil
+}
+
+// SaveAPIKey inserts key or replaces the stored copy
+func (c *DBClient) SaveAPIKey(key *models.APIKey) error {
+	if c == nil || c.DB == nil {
+		return errors.New(errDBClientNil)
+	}
+	if err := c.DB.Save(newAPIKeyRow(key)).Error; err != nil {
+		return fmt.Errorf("saving API key %s: %w", key.ID, err)
+	}
+	return nil
+}
+
+func (c *DBClient) GetAPIKey(id string) (*models.APIKey, error) {
+	return c.findAPIKey("id = ?", id)
+}
+
+func (c *DBClient) FindAPIKey(hash string) (*models.APIKey, error) {
+	return c.findAPIKey("hash = ?", hash)
+}
+
+func (c *DBClient) findAPIKey(where string, arg string) (*models.APIKey, error) {
+	if c == nil || c.DB == nil {
+		return nil, errors.New(errDBClientNil)
+	}
+	var row APIKey
+	err := c.DB.Where(where, arg).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading API key: %w", err)
+	}
+	key := row.model()
+	return &key, nil
+}
+
+// ListAPIKeys returns every key, oldest first
+func (c *DBClient) ListAPIKeys() ([]models.APIKey, error) {
+	if c == nil || c.DB == nil {
+		return nil, errors.New(errDBClientNil)
+	}
+	var rows []APIKey
+	if err := c.DB.Order("created_at, id").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("listing API keys: %w", err)
+	}
+	keys := make([]models.APIKey, len(rows))
+	for i := range rows {
+		keys[i] = rows[i].model()
+	}
+	return keys, nil
+}
+
 // QueryTopMatches is a convenience wrapper that fetches all couple lists for query hashes and
 // performs in-memory voting. It expects queryHashes in the same packed form your hash.go creates.
 // This mirrors earlier QueryFingerprints logic but uses the DB for bucket lookup.
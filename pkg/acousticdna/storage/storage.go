@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrSongNotFound is returned by every backend when a song ID is unknown
+	ErrSongNotFound = errors.New("song not found")
+
+	// ErrSongExists is returned by UpdateSong when another song already has
+	// the new title and artist, as compared by SongKey
+	ErrSongExists = errors.New("a song with this title and artist already exists")
+
+	// ErrJobNotFound is returned by every backend when a job ID is unknown
+	ErrJobNotFound = errors.New("job not found")
+
+	// ErrAPIKeyNotFound is returned by every backend when an API key ID or
+	// hash is unknown
+	ErrAPIKeyNotFound = errors.New("API key not found")
+
+	// ErrClosed is returned when a store is used after Close
+	ErrClosed = errors.New("storage is closed")
+)
+
+// SongKey is what every backend, and the importers, compare to tell whether
+// two songs are the same: title and artist with case folded, surrounding
+// space trimmed and inner runs of space collapsed. "The Beatles" and
+// " the  beatles" are one artist.
+func SongKey(title, artist string) string {
+	return foldName(title) + "\x00" + foldName(artist)
+}
+
+func foldName(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// encodeTags and encodeExternalIDs store a song's tags and external IDs as
+// JSON text; empty ones are stored as ""
+func encodeTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(tags)
+	return string(b)
+}
+
+func encodeExternalIDs(ids map[string]string) string {
+	if len(ids) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(ids)
+	return string(b)
+}
+
+func decodeTags(s string) []string {
+	var tags []string
+	if s != "" {
+		json.Unmarshal([]byte(s), &tags)
+	}
+	return tags
+}
+
+func decodeExternalIDs(s string) map[string]string {
+	var ids map[string]string
+	if s != "" {
+		json.Unmarshal([]byte(s), &ids)
+	}
+	return ids
+}
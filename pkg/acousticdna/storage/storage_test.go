@@ -0,0 +1,86 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+package storage_test
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna"
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/storagetest"
+	"github.com/jackc/pgx/v5"
+)
+
+// postgresDSNEnv names the variable holding a database the PostgreSQL
+// backend is tested against; the test is skipped without it
+const postgresDSNEnv = "ACOUSTIC_TEST_POSTGRES_DSN"
+
+func TestMemoryStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) acousticdna.Storage {
+		return acousticdna.NewMemoryStorage()
+	})
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) acousticdna.Storage {
+		s, err := acousticdna.OpenStorage("sqlite://" + filepath.Join(t.TempDir(), "catalogue.sqlite3"))
+		if err != nil {
+			t.Fatalf("OpenStorage: %v", err)
+		}
+		return s
+	})
+}
+
+// TestPostgresStorage gives every subtest a schema of its own, so each
+// starts empty, and drops it afterwards
+func TestPostgresStorage(t *testing.T) {
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s not set", postgresDSNEnv)
+	}
+
+	var n int
+	storagetest.Run(t, func(t *testing.T) acousticdna.Storage {
+		n++
+		schema := fmt.Sprintf("acousticdna_test_%d_%d", time.Now().UnixNano(), n)
+		ctx := context.Background()
+		conn, err := pgx.Connect(ctx, dsn)
+		if err != nil {
+			t.Fatalf("connecting to postgres: %v", err)
+		}
+		defer conn.Close(ctx)
+		if _, err := conn.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+			t.Fatalf("creating schema: %v", err)
+		}
+		t.Cleanup(func() {
+			conn, err := pgx.Connect(ctx, dsn)
+			if err != nil {
+				t.Errorf("connecting to postgres: %v", err)
+				return
+			}
+			defer conn.Close(ctx)
+			if _, err := conn.Exec(ctx, "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+				t.Errorf("dropping schema: %v", err)
+			}
+		})
+
+		u, err := url.Parse(dsn)
+		if err != nil {
+			t.Fatalf("parsing %s: %v", postgresDSNEnv, err)
+		}
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		s, err := acousticdna.OpenStorage(u.String())
+		if err != nil {
+			t.Fatalf("OpenStorage: %v", err)
+		}
+		return s
+	})
+}
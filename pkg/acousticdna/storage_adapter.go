@@ -4,8 +4,12 @@
 package acousticdna
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/storage"
 	"github.com/himanishpuri/AcousticDNA/pkg/models"
+	"gorm.io/gorm"
 )
 
 // storageAdapter adapts the storage.DBClient to implement the Storage interface.
@@ -22,7 +26,7 @@ func NewSQLiteStorage(dbPath string) (Storage, error) {
 	return &storageAdapter{db: db}, nil
 }
 
-func (s *storageAdapter) RegisterSong(title, artist, youtubeID string, durationMs int) (string, error) {
+func (s *storageAdapter) RegisterSong(title, artist, youtubeID string, durationMs int) (string, bool, error) {
 	return s.db.RegisterSong(title, artist, youtubeID, durationMs)
 }
 
@@ -63,6 +67,10 @@ func (s *storageAdapter) GetCouplesByHashes(hashes []uint32) (map[uint32][]model
 	return s.db.GetCouplesByHashes(hashes)
 }
 
+func (s *storageAdapter) UpdateSong(song *models.Song) error {
+	return s.db.UpdateSong(song)
+}
+
 func (s *storageAdapter) DeleteSongByID(songID string) error {
 	return s.db.DeleteSongByID(songID)
 }
@@ -70,16 +78,14 @@ func (s *storageAdapter) DeleteSongByID(songID string) error {
 func (s *storageAdapter) GetSongByID(songID string) (*models.Song, error) {
 	var dbSong storage.Song
 	if err := s.db.DB.Where("id = ?", songID).First(&dbSong).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", storage.ErrSongNotFound, songID)
+		}
 		return nil, err
 	}
 
-	return &models.Song{
-		ID:         dbSong.ID,
-		Title:      dbSong.Title,
-		Artist:     dbSong.Artist,
-		YouTubeID:  dbSong.YouTubeID,
-		DurationMs: dbSong.DurationMs,
-	}, nil
+	song := dbSong.Model()
+	return &song, nil
 }
 
 func (s *storageAdapter) GetFingerprintCount(songID string) (int, error) {
@@ -97,19 +103,65 @@ func (s *storageAdapter) ListSongs() ([]models.Song, error) {
 	}
 
 	songs := make([]models.Song, len(dbSongs))
-	for i, dbSong := range dbSongs {
-		songs[i] = models.Song{
-			ID:         dbSong.ID,
-			Title:      dbSong.Title,
-			Artist:     dbSong.Artist,
-			YouTubeID:  dbSong.YouTubeID,
-			DurationMs: dbSong.DurationMs,
-		}
+	for i := range dbSongs {
+		songs[i] = dbSongs[i].Model()
 	}
 
 	return songs, nil
 }
 
+func (s *storageAdapter) QuerySongs(q models.SongQuery) (*models.SongPage, error) {
+	return s.db.QuerySongs(q)
+}
+
+func (s *storageAdapter) ForEachFingerprint(fn func(hash uint32, c models.Couple) error) error {
+	return s.db.ForEachFingerprint(fn)
+}
+
+func (s *storageAdapter) GetMeta(key string) (string, error) {
+	return s.db.GetMeta(key)
+}
+
+func (s *storageAdapter) SetMeta(key, value string) error {
+	return s.db.SetMeta(key, value)
+}
+
+func (s *storageAdapter) SizeBytes() (int64, error) {
+	return s.db.SizeBytes()
+}
+
+func (s *storageAdapter) SaveJob(job *models.Job) error {
+	return s.db.SaveJob(job)
+}
+
+func (s *storageAdapter) GetJob(id string) (*models.Job, error) {
+	return s.db.GetJob(id)
+}
+
+func (s *storageAdapter) ListJobs() ([]models.Job, error) {
+	return s.db.ListJobs()
+}
+
+func (s *storageAdapter) DeleteJob(id string) error {
+	return s.db.DeleteJob(id)
+}
+
+func (s *storageAdapter) SaveAPIKey(key *models.APIKey) error {
+	return s.db.SaveAPIKey(key)
+}
+
+func (s *storageAdapter) GetAPIKey(id string) (*models.APIKey, error) {
+	return s.db.GetAPIKey(id)
+}
+
+func (s *storageAdapter) FindAPIKey(hash string) (*models.APIKey, error) {
+	return s.db.FindAPIKey(hash)
+}
+
+func (s *storageAdapter) ListAPIKeys() ([]models.APIKey, error) {
+	return s.db.ListAPIKeys()
+}
+
 func (s *storageAdapter) Close() error {
 	return s.db.Close()
 }
@@ -0,0 +1,124 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+package acousticdna
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/index"
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/storage"
+)
+
+// ErrSongNotFound is returned by every Storage backend for an unknown song ID
+var ErrSongNotFound = storage.ErrSongNotFound
+
+// ErrSongExists is returned by UpdateSong when another song already has the
+// new title and artist, and by StoreSong for a song already catalogued
+var ErrSongExists = storage.ErrSongExists
+
+// ErrInvalidQuery is returned by QuerySongs for a bad sort, source or cursor
+var ErrInvalidQuery = storage.ErrInvalidQuery
+
+// ErrJobNotFound is returned by every JobStore for an unknown job ID
+var ErrJobNotFound = storage.ErrJobNotFound
+
+// ErrAPIKeyNotFound is returned by every KeyStore for an unknown API key
+var ErrAPIKeyNotFound = storage.ErrAPIKeyNotFound
+
+// NewMemoryStorage creates an in-process Storage. Nothing is persisted.
+func NewMemoryStorage() Storage {
+	return storage.NewMemoryStore()
+}
+
+// NewPostgresStorage connects to PostgreSQL and creates the schema if needed.
+func NewPostgresStorage(dsn string) (Storage, error) {
+	client, err := storage.NewPostgresClient(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// NewIndexStorage memory-maps a fingerprint index built with BuildIndex.
+// The returned Storage is read-only.
+func NewIndexStorage(path string) (Storage, error) {
+	ix, err := index.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return ix, nil
+}
+
+// BuildIndex compiles every song and fingerprint in src into an index file
+// at path. src must be able to enumerate its fingerprints, which all
+// built-in backends can.
+func BuildIndex(src Storage, path string) (index.Stats, error) {
+	source, ok := src.(index.Source)
+	if !ok {
+		return index.Stats{}, fmt.Errorf("storage %T can't enumerate its fingerprints", src)
+	}
+
+	b := index.NewBuilder()
+	if err := b.AddSource(source); err != nil {
+		return index.Stats{}, fmt.Errorf("reading catalogue: %w", err)
+	}
+
+	// The index answers queries for the same profile as its source
+	profile, err := src.GetMeta(ProfileMetaKey)
+	if err != nil {
+		return index.Stats{}, fmt.Errorf("reading fingerprint profile: %w", err)
+	}
+	if profile != "" {
+		b.SetMeta(ProfileMetaKey, profile)
+	}
+	return b.WriteFile(path)
+}
+
+// OpenStorage picks a backend from a DSN:
+//
+//	memory://                 in-memory, nothing persisted
+//	sqlite:///abs/path.db     SQLite file (sqlite://rel/path.db for a relative path)
+//	postgres://user@host/db   PostgreSQL (postgresql:// works too)
+//	index:///path/to/file.adx read-only memory-mapped index (see BuildIndex)
+//
+// A value without a scheme is treated as a SQLite file path.
+func OpenStorage(dsn string) (Storage, error) {
+	scheme, rest, ok := strings.Cut(dsn, "://")
+	if !ok {
+		return NewSQLiteStorage(dsn)
+	}
+
+	switch strings.ToLower(scheme) {
+	case "memory", "mem":
+		return NewMemoryStorage(), nil
+	case "sqlite", "sqlite3":
+		if rest == "" {
+			return nil, fmt.Errorf("sqlite DSN %q has no path", dsn)
+		}
+		return NewSQLiteStorage(rest)
+	case "postgres", "postgresql":
+		return NewPostgresStorage(dsn)
+	case "index":
+		if rest == "" {
+			return nil, fmt.Errorf("index DSN %q has no path", dsn)
+		}
+		return NewIndexStorage(rest)
+	default:
+		return nil, fmt.Errorf("unsupported storage scheme %q", scheme)
+	}
+}
+
+// RedactDSN hides any password in dsn so it can be logged or shown
+func RedactDSN(dsn string) string {
+	if !strings.Contains(dsn, "://") {
+		return dsn
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return dsn
+	}
+	return u.Redacted()
+}
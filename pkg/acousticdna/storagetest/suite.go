@@ -0,0 +1,672 @@
+// Package storagetest is a conformance suite for acousticdna.Storage
+// implementations. A backend is checked by calling Run from a test:
+//
+//	func TestMemoryStorage(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) acousticdna.Storage {
+//			return acousticdna.NewMemoryStorage()
+//		})
+//	}
+//
+// Open must return an empty store each time it is called; the suite closes
+// it when the subtest finishes.
+package storagetest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna"
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/storage"
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// OpenFunc returns a fresh, empty Storage for one subtest
+type OpenFunc func(t *testing.T) acousticdna.Storage
+
+// Run exercises every Storage method against stores returned by open
+func Run(t *testing.T, open OpenFunc) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s acousticdna.Storage)
+	}{
+		{"RegisterSong", testRegisterSong},
+		{"RegisterSongDeduplicates", testRegisterSongDeduplicates},
+		{"GetSongByIDUnknown", testGetSongByIDUnknown},
+		{"StoreAndGetCouplesByHash", testStoreAndGetCouplesByHash},
+		{"GetCouplesByHashes", testGetCouplesByHashes},
+		{"HashRange", testHashRange},
+		{"GetFingerprintCount", testGetFingerprintCount},
+		{"ListSongs", testListSongs},
+		{"QuerySongs", testQuerySongs},
+		{"UpdateSong", testUpdateSong},
+		{"DeleteSongByID", testDeleteSongByID},
+		{"Meta", testMeta},
+		{"Jobs", testJobs},
+		{"APIKeys", testAPIKeys},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := open(t)
+			t.Cleanup(func() {
+				if err := s.Close(); err != nil {
+					t.Errorf("Close: %v", err)
+				}
+			})
+			tc.fn(t, s)
+		})
+	}
+}
+
+func mustRegister(t *testing.T, s acousticdna.Storage, title, artist, youtubeID string, durationMs int) string {
+	t.Helper()
+	id, _ := register(t, s, title, artist, youtubeID, durationMs)
+	return id
+}
+
+// register calls RegisterSong, failing the test on error
+func register(t *testing.T, s acousticdna.Storage, title, artist, youtubeID string, durationMs int) (string, bool) {
+	t.Helper()
+	id, created, err := s.RegisterSong(title, artist, youtubeID, durationMs)
+	if err != nil {
+		t.Fatalf("RegisterSong(%q, %q): %v", title, artist, err)
+	}
+	if id == "" {
+		t.Fatalf("RegisterSong(%q, %q) returned an empty ID", title, artist)
+	}
+	return id, created
+}
+
+func mustStore(t *testing.T, s acousticdna.Storage, fps map[uint32][]models.Couple) {
+	t.Helper()
+	if err := s.StoreFingerprints(fps); err != nil {
+		t.Fatalf("StoreFingerprints: %v", err)
+	}
+}
+
+// sortedCouples renders couples in a canonical order for comparison
+func sortedCouples(couples []models.Couple) []string {
+	out := make([]string, len(couples))
+	for i, c := range couples {
+		out[i] = fmt.Sprintf("%s@%d", c.SongID, c.AnchorTimeMs)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func assertCouples(t *testing.T, what string, got, want []models.Couple) {
+	t.Helper()
+	g, w := sortedCouples(got), sortedCouples(want)
+	if fmt.Sprint(g) != fmt.Sprint(w) {
+		t.Errorf("%s = %v, want %v", what, g, w)
+	}
+}
+
+func testRegisterSong(t *testing.T, s acousticdna.Storage) {
+	id, created := register(t, s, "Sandstorm", "Darude", "y6120QOlsfU", 225000)
+	if !created {
+		t.Errorf("RegisterSong of a new song reported created = false")
+	}
+
+	song, err := s.GetSongByID(id)
+	if err != nil {
+		t.Fatalf("GetSongByID: %v", err)
+	}
+	if song.CreatedAt.IsZero() {
+		t.Errorf("GetSongByID returned no creation time")
+	}
+	want := models.Song{ID: id, Title: "Sandstorm", Artist: "Darude", YouTubeID: "y6120QOlsfU", DurationMs: 225000,
+		CreatedAt: song.CreatedAt}
+	if !reflect.DeepEqual(*song, want) {
+		t.Errorf("GetSongByID = %+v, want %+v", *song, want)
+	}
+
+	other, created := register(t, s, "Sandstorm", "Someone Else", "", 0)
+	if other == id || !created {
+		t.Errorf("different artist reused song ID %s (created = %v)", id, created)
+	}
+}
+
+func testRegisterSongDeduplicates(t *testing.T, s acousticdna.Storage) {
+	id := mustRegister(t, s, "Song", "Artist", "", 1000)
+
+	again, created := register(t, s, "Song", "Artist", "abc123", 2000)
+	if again != id {
+		t.Fatalf("re-registering returned %s, want existing %s", again, id)
+	}
+	if created {
+		t.Errorf("re-registering reported created = true")
+	}
+
+	song, err := s.GetSongByID(id)
+	if err != nil {
+		t.Fatalf("GetSongByID: %v", err)
+	}
+	if song.YouTubeID != "abc123" {
+		t.Errorf("missing YouTube ID not filled in: got %q", song.YouTubeID)
+	}
+
+	// An existing YouTube ID is never overwritten
+	mustRegister(t, s, "Song", "Artist", "other", 0)
+	song, err = s.GetSongByID(id)
+	if err != nil {
+		t.Fatalf("GetSongByID: %v", err)
+	}
+	if song.YouTubeID != "abc123" {
+		t.Errorf("YouTube ID overwritten: got %q", song.YouTubeID)
+	}
+
+	// Titles and artists are compared by storage.SongKey, and the first
+	// spelling is kept
+	for _, variant := range [][2]string{{"song", "ARTIST"}, {"  Song ", "Artist"}, {"Song", "Artist\t"}} {
+		again, created := register(t, s, variant[0], variant[1], "", 0)
+		if again != id || created {
+			t.Errorf("registering %q by %q returned %s (created %v), want existing %s", variant[0], variant[1], again, created, id)
+		}
+	}
+	song, err = s.GetSongByID(id)
+	if err != nil {
+		t.Fatalf("GetSongByID: %v", err)
+	}
+	if song.Title != "Song" || song.Artist != "Artist" {
+		t.Errorf("stored spelling changed to %q by %q", song.Title, song.Artist)
+	}
+	if other := mustRegister(t, s, "Song 2", "Artist", "", 0); other == id {
+		t.Errorf("a different title was registered as the existing song")
+	}
+}
+
+func testGetSongByIDUnknown(t *testing.T, s acousticdna.Storage) {
+	_, err := s.GetSongByID("00000000-0000-0000-0000-000000000000")
+	if !errors.Is(err, storage.ErrSongNotFound) {
+		t.Errorf("GetSongByID(unknown) error = %v, want ErrSongNotFound", err)
+	}
+}
+
+func testStoreAndGetCouplesByHash(t *testing.T, s acousticdna.Storage) {
+	a := mustRegister(t, s, "A", "Artist", "", 0)
+	b := mustRegister(t, s, "B", "Artist", "", 0)
+
+	mustStore(t, s, map[uint32][]models.Couple{
+		100: {{SongID: a, AnchorTimeMs: 10}, {SongID: a, AnchorTimeMs: 20}},
+		200: {{SongID: a, AnchorTimeMs: 30}},
+	})
+	mustStore(t, s, map[uint32][]models.Couple{
+		100: {{SongID: b, AnchorTimeMs: 40}},
+	})
+
+	got, err := s.GetCouplesByHash(100)
+	if err != nil {
+		t.Fatalf("GetCouplesByHash: %v", err)
+	}
+	assertCouples(t, "GetCouplesByHash(100)", got, []models.Couple{
+		{SongID: a, AnchorTimeMs: 10},
+		{SongID: a, AnchorTimeMs: 20},
+		{SongID: b, AnchorTimeMs: 40},
+	})
+
+	got, err = s.GetCouplesByHash(999)
+	if err != nil {
+		t.Fatalf("GetCouplesByHash(unknown): %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("GetCouplesByHash(unknown) = %v, want empty", got)
+	}
+}
+
+func testGetCouplesByHashes(t *testing.T, s acousticdna.Storage) {
+	a := mustRegister(t, s, "A", "Artist", "", 0)
+	mustStore(t, s, map[uint32][]models.Couple{
+		1: {{SongID: a, AnchorTimeMs: 1}},
+		2: {{SongID: a, AnchorTimeMs: 2}, {SongID: a, AnchorTimeMs: 3}},
+		3: {{SongID: a, AnchorTimeMs: 4}},
+	})
+
+	got, err := s.GetCouplesByHashes([]uint32{1, 2, 2, 42})
+	if err != nil {
+		t.Fatalf("GetCouplesByHashes: %v", err)
+	}
+	if len(got) != 2 {
+		t.Errorf("GetCouplesByHashes returned %d buckets, want 2 (unrequested or missing hashes included?)", len(got))
+	}
+	assertCouples(t, "bucket 1", got[1], []models.Couple{{SongID: a, AnchorTimeMs: 1}})
+	assertCouples(t, "bucket 2", got[2], []models.Couple{{SongID: a, AnchorTimeMs: 2}, {SongID: a, AnchorTimeMs: 3}})
+	if _, ok := got[42]; ok {
+		t.Errorf("GetCouplesByHashes included a bucket for an unknown hash")
+	}
+
+	empty, err := s.GetCouplesByHashes(nil)
+	if err != nil {
+		t.Fatalf("GetCouplesByHashes(nil): %v", err)
+	}
+	if empty == nil || len(empty) != 0 {
+		t.Errorf("GetCouplesByHashes(nil) = %v, want an empty map", empty)
+	}
+}
+
+// testHashRange checks that the full unsigned 32-bit range round-trips
+func testHashRange(t *testing.T, s acousticdna.Storage) {
+	a := mustRegister(t, s, "A", "Artist", "", 0)
+	hashes := []uint32{0, 1 << 31, 0xFFFFFFFF}
+	fps := make(map[uint32][]models.Couple)
+	for _, h := range hashes {
+		fps[h] = []models.Couple{{SongID: a, AnchorTimeMs: 0xFFFFFFF0}}
+	}
+	mustStore(t, s, fps)
+
+	got, err := s.GetCouplesByHashes(hashes)
+	if err != nil {
+		t.Fatalf("GetCouplesByHashes: %v", err)
+	}
+	for _, h := range hashes {
+		assertCouples(t, fmt.Sprintf("bucket %#x", h), got[h], fps[h])
+	}
+}
+
+func testGetFingerprintCount(t *testing.T, s acousticdna.Storage) {
+	a := mustRegister(t, s, "A", "Artist", "", 0)
+	b := mustRegister(t, s, "B", "Artist", "", 0)
+	mustStore(t, s, map[uint32][]models.Couple{
+		1: {{SongID: a, AnchorTimeMs: 1}, {SongID: b, AnchorTimeMs: 1}},
+		2: {{SongID: a, AnchorTimeMs: 2}, {SongID: a, AnchorTimeMs: 3}},
+	})
+
+	for _, tc := range []struct {
+		id   string
+		want int
+	}{{a, 3}, {b, 1}, {"00000000-0000-0000-0000-000000000000", 0}} {
+		got, err := s.GetFingerprintCount(tc.id)
+		if err != nil {
+			t.Fatalf("GetFingerprintCount(%s): %v", tc.id, err)
+		}
+		if got != tc.want {
+			t.Errorf("GetFingerprintCount(%s) = %d, want %d", tc.id, got, tc.want)
+		}
+	}
+}
+
+func testListSongs(t *testing.T, s acousticdna.Storage) {
+	songs, err := s.ListSongs()
+	if err != nil {
+		t.Fatalf("ListSongs on empty store: %v", err)
+	}
+	if len(songs) != 0 {
+		t.Fatalf("ListSongs on empty store = %d songs, want 0", len(songs))
+	}
+
+	want := map[string]string{}
+	for _, title := range []string{"One", "Two", "Three"} {
+		want[mustRegister(t, s, title, "Artist", "", 0)] = title
+	}
+
+	songs, err = s.ListSongs()
+	if err != nil {
+		t.Fatalf("ListSongs: %v", err)
+	}
+	if len(songs) != len(want) {
+		t.Fatalf("ListSongs = %d songs, want %d", len(songs), len(want))
+	}
+	for _, song := range songs {
+		if want[song.ID] != song.Title {
+			t.Errorf("ListSongs returned unexpected song %+v", song)
+		}
+	}
+}
+
+func testQuerySongs(t *testing.T, s acousticdna.Storage) {
+	titles := func(songs []models.Song) []string {
+		out := make([]string, len(songs))
+		for i, song := range songs {
+			out[i] = song.Title
+		}
+		return out
+	}
+	query := func(q models.SongQuery) *models.SongPage {
+		t.Helper()
+		page, err := s.QuerySongs(q)
+		if err != nil {
+			t.Fatalf("QuerySongs(%+v): %v", q, err)
+		}
+		return page
+	}
+
+	songs := []struct {
+		title, artist, youtubeID string
+		durationMs               int
+	}{
+		{"Sandstorm", "Darude", "y6120QOlsfU", 225000},
+		{"Strobe", "deadmau5", "", 634000},
+		{"Ghosts 'n' Stuff", "deadmau5", "h7ArUgxtlJs", 330000},
+		{"100% Pure", "Someone", "", 180000},
+		{"Levels", "Avicii", "", 200000},
+	}
+	for _, song := range songs {
+		mustRegister(t, s, song.title, song.artist, song.youtubeID, song.durationMs)
+		time.Sleep(2 * time.Millisecond) // distinct creation times
+	}
+
+	// Unfiltered pages follow registration order and cover every song once
+	var seen []string
+	q := models.SongQuery{Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatalf("pagination did not end after %d pages", pages)
+		}
+		page := query(q)
+		if page.Total != len(songs) {
+			t.Errorf("Total = %d, want %d", page.Total, len(songs))
+		}
+		seen = append(seen, titles(page.Songs)...)
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	want := []string{"Sandstorm", "Strobe", "Ghosts 'n' Stuff", "100% Pure", "Levels"}
+	if fmt.Sprint(seen) != fmt.Sprint(want) {
+		t.Errorf("paged titles = %q, want %q", seen, want)
+	}
+
+	tests := []struct {
+		name string
+		q    models.SongQuery
+		want []string
+	}{
+		{"search artist, any case", models.SongQuery{Search: "DEADMAU5", Sort: models.SortByTitle},
+			[]string{"Ghosts 'n' Stuff", "Strobe"}},
+		{"every term must match", models.SongQuery{Search: "deadmau5 str"}, []string{"Strobe"}},
+		{"wildcards are literal", models.SongQuery{Search: "100%"}, []string{"100% Pure"}},
+		{"underscore is literal", models.SongQuery{Search: "_"}, nil},
+		{"duration range", models.SongQuery{MinDurationMs: 200000, MaxDurationMs: 330000, Sort: models.SortByDuration},
+			[]string{"Levels", "Sandstorm", "Ghosts 'n' Stuff"}},
+		{"youtube source", models.SongQuery{Source: models.SourceYouTube}, []string{"Sandstorm", "Ghosts 'n' Stuff"}},
+		{"file source, artist descending", models.SongQuery{Source: models.SourceFile, Sort: models.SortByArtist, Desc: true},
+			[]string{"Strobe", "100% Pure", "Levels"}},
+		{"created in the future", models.SongQuery{CreatedAfter: time.Now().Add(time.Hour)}, nil},
+		{"created before now", models.SongQuery{CreatedBefore: time.Now().Add(time.Minute), Desc: true},
+			[]string{"Levels", "100% Pure", "Ghosts 'n' Stuff", "Strobe", "Sandstorm"}},
+	}
+	for _, tc := range tests {
+		page := query(tc.q)
+		if got := titles(page.Songs); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: titles = %q, want %q", tc.name, got, tc.want)
+		}
+		if page.Total != len(tc.want) || page.NextCursor != "" {
+			t.Errorf("%s: Total = %d, NextCursor = %q; want %d and none", tc.name, page.Total, page.NextCursor, len(tc.want))
+		}
+	}
+
+	// Descending title pages with ties broken by ID
+	first := query(models.SongQuery{Sort: models.SortByTitle, Desc: true, Limit: 3})
+	rest := query(models.SongQuery{Sort: models.SortByTitle, Desc: true, Limit: 3, Cursor: first.NextCursor})
+	got := append(titles(first.Songs), titles(rest.Songs)...)
+	want = []string{"Strobe", "Sandstorm", "Levels", "Ghosts 'n' Stuff", "100% Pure"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("descending title pages = %q, want %q", got, want)
+	}
+
+	for _, bad := range []models.SongQuery{
+		{Sort: "rating"},
+		{Source: "vinyl"},
+		{Cursor: "not a cursor"},
+		{Sort: models.SortByArtist, Cursor: first.NextCursor},
+	} {
+		if _, err := s.QuerySongs(bad); !errors.Is(err, storage.ErrInvalidQuery) {
+			t.Errorf("QuerySongs(%+v): err = %v, want ErrInvalidQuery", bad, err)
+		}
+	}
+}
+
+func testUpdateSong(t *testing.T, s acousticdna.Storage) {
+	id := mustRegister(t, s, "Song", "Artist", "", 1000)
+	mustRegister(t, s, "Taken", "Artist", "", 0)
+
+	update := models.Song{
+		ID: id, Title: "Renamed", Artist: "Artist", YouTubeID: "abc123", SpotifyID: "sp1",
+		Album: "Album", ISRC: "USRC17607839", Year: 1999, Genre: "House",
+		Tags:        []string{"club", "90s"},
+		ExternalIDs: map[string]string{"musicbrainz": "mb-1"},
+	}
+	if err := s.UpdateSong(&update); err != nil {
+		t.Fatalf("UpdateSong: %v", err)
+	}
+	update.Tags[0] = "changed after update"
+
+	song, err := s.GetSongByID(id)
+	if err != nil {
+		t.Fatalf("GetSongByID: %v", err)
+	}
+	want := update
+	want.DurationMs, want.CreatedAt = 1000, song.CreatedAt
+	want.Tags = []string{"club", "90s"}
+	if !reflect.DeepEqual(*song, want) {
+		t.Errorf("GetSongByID after update = %+v, want %+v", *song, want)
+	}
+
+	// The new title+artist is registered under the same song
+	if again := mustRegister(t, s, "Renamed", "Artist", "", 0); again != id {
+		t.Errorf("re-registering renamed song returned %s, want %s", again, id)
+	}
+
+	clash := want
+	clash.Title = "Taken"
+	if err := s.UpdateSong(&clash); !errors.Is(err, storage.ErrSongExists) {
+		t.Errorf("UpdateSong to an existing title+artist: err = %v, want ErrSongExists", err)
+	}
+	clash.Title = " TAKEN"
+	if err := s.UpdateSong(&clash); !errors.Is(err, storage.ErrSongExists) {
+		t.Errorf("UpdateSong to another spelling of an existing title+artist: err = %v, want ErrSongExists", err)
+	}
+
+	// Respelling a song's own title is not a clash
+	respelled := want
+	respelled.Title = "RENAMED"
+	if err := s.UpdateSong(&respelled); err != nil {
+		t.Errorf("UpdateSong respelling its own title: %v", err)
+	}
+	if again := mustRegister(t, s, "renamed", "artist", "", 0); again != id {
+		t.Errorf("re-registering the respelled song returned %s, want %s", again, id)
+	}
+
+	unknown := models.Song{ID: "00000000-0000-0000-0000-000000000000", Title: "X", Artist: "Y"}
+	if err := s.UpdateSong(&unknown); !errors.Is(err, storage.ErrSongNotFound) {
+		t.Errorf("UpdateSong of an unknown song: err = %v, want ErrSongNotFound", err)
+	}
+}
+
+func testDeleteSongByID(t *testing.T, s acousticdna.Storage) {
+	a := mustRegister(t, s, "A", "Artist", "", 0)
+	b := mustRegister(t, s, "B", "Artist", "", 0)
+	mustStore(t, s, map[uint32][]models.Couple{
+		1: {{SongID: a, AnchorTimeMs: 1}, {SongID: b, AnchorTimeMs: 2}},
+		2: {{SongID: a, AnchorTimeMs: 3}},
+	})
+
+	if err := s.DeleteSongByID(a); err != nil {
+		t.Fatalf("DeleteSongByID: %v", err)
+	}
+
+	if _, err := s.GetSongByID(a); !errors.Is(err, storage.ErrSongNotFound) {
+		t.Errorf("GetSongByID after delete error = %v, want ErrSongNotFound", err)
+	}
+	got, err := s.GetCouplesByHashes([]uint32{1, 2})
+	if err != nil {
+		t.Fatalf("GetCouplesByHashes: %v", err)
+	}
+	assertCouples(t, "bucket 1 after delete", got[1], []models.Couple{{SongID: b, AnchorTimeMs: 2}})
+	if len(got[2]) != 0 {
+		t.Errorf("bucket 2 still holds %v after delete", got[2])
+	}
+	if n, err := s.GetFingerprintCount(a); err != nil || n != 0 {
+		t.Errorf("GetFingerprintCount after delete = %d, %v; want 0, nil", n, err)
+	}
+
+	songs, err := s.ListSongs()
+	if err != nil {
+		t.Fatalf("ListSongs: %v", err)
+	}
+	if len(songs) != 1 || songs[0].ID != b {
+		t.Errorf("ListSongs after delete = %+v, want only %s", songs, b)
+	}
+
+	// Title and artist are free to be registered again
+	if again := mustRegister(t, s, "A", "Artist", "", 0); again == a {
+		t.Errorf("re-registering a deleted song returned its old ID")
+	}
+
+	if err := s.DeleteSongByID("00000000-0000-0000-0000-000000000000"); err != nil {
+		t.Errorf("DeleteSongByID(unknown) = %v, want nil", err)
+	}
+}
+
+func testMeta(t *testing.T, s acousticdna.Storage) {
+	got, err := s.GetMeta("missing")
+	if err != nil {
+		t.Fatalf("GetMeta(unset): %v", err)
+	}
+	if got != "" {
+		t.Errorf("GetMeta(unset) = %q, want empty", got)
+	}
+
+	for _, value := range []string{`{"name":"default"}`, `{"name":"speech"}`} {
+		if err := s.SetMeta("fingerprint_profile", value); err != nil {
+			t.Fatalf("SetMeta: %v", err)
+		}
+		got, err := s.GetMeta("fingerprint_profile")
+		if err != nil {
+			t.Fatalf("GetMeta: %v", err)
+		}
+		if got != value {
+			t.Errorf("GetMeta = %q, want %q", got, value)
+		}
+	}
+}
+
+func testJobs(t *testing.T, s acousticdna.Storage) {
+	store, ok := s.(acousticdna.JobStore)
+	if !ok {
+		t.Skipf("%T does not persist jobs", s)
+	}
+
+	if _, err := store.GetJob("missing"); !errors.Is(err, storage.ErrJobNotFound) {
+		t.Errorf("GetJob(unknown) error = %v, want ErrJobNotFound", err)
+	}
+
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	first := models.Job{
+		ID:        "00000000-0000-0000-0000-000000000001",
+		Kind:      models.JobFromFile,
+		Status:    models.JobQueued,
+		Source:    "/spool/a.mp3",
+		Title:     "Song A",
+		Artist:    "Artist",
+		CreatedAt: created,
+		UpdatedAt: created,
+	}
+	second := first
+	second.ID = "00000000-0000-0000-0000-000000000002"
+	second.Kind = models.JobFromYouTube
+	second.CreatedAt = created.Add(time.Second)
+
+	for _, job := range []models.Job{second, first} {
+		if err := store.SaveJob(&job); err != nil {
+			t.Fatalf("SaveJob(%s): %v", job.ID, err)
+		}
+	}
+
+	first.Status, first.Stage, first.SongID = models.JobSucceeded, models.StageStoring, "song-a"
+	first.UpdatedAt = created.Add(time.Minute)
+	if err := store.SaveJob(&first); err != nil {
+		t.Fatalf("SaveJob(update): %v", err)
+	}
+	got, err := store.GetJob(first.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if got.Status != first.Status || got.Stage != first.Stage || got.SongID != first.SongID ||
+		got.Source != first.Source || !got.UpdatedAt.Equal(first.UpdatedAt) {
+		t.Errorf("GetJob = %+v, want %+v", *got, first)
+	}
+
+	jobs, err := store.ListJobs()
+	if err != nil {
+		t.Fatalf("ListJobs: %v", err)
+	}
+	if len(jobs) != 2 || jobs[0].ID != first.ID || jobs[1].ID != second.ID {
+		t.Errorf("ListJobs returned %d jobs, want %s then %s", len(jobs), first.ID, second.ID)
+	}
+
+	if err := store.DeleteJob(first.ID); err != nil {
+		t.Fatalf("DeleteJob: %v", err)
+	}
+	if _, err := store.GetJob(first.ID); !errors.Is(err, storage.ErrJobNotFound) {
+		t.Errorf("GetJob after delete error = %v, want ErrJobNotFound", err)
+	}
+}
+
+func testAPIKeys(t *testing.T, s acousticdna.Storage) {
+	store, ok := s.(acousticdna.KeyStore)
+	if !ok {
+		t.Skipf("%T does not persist API keys", s)
+	}
+
+	if _, err := store.GetAPIKey("missing"); !errors.Is(err, storage.ErrAPIKeyNotFound) {
+		t.Errorf("GetAPIKey(unknown) error = %v, want ErrAPIKeyNotFound", err)
+	}
+	if _, err := store.FindAPIKey("missing"); !errors.Is(err, storage.ErrAPIKeyNotFound) {
+		t.Errorf("FindAPIKey(unknown) error = %v, want ErrAPIKeyNotFound", err)
+	}
+
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	first := models.APIKey{
+		ID:        "00000000-0000-0000-0000-000000000001",
+		Name:      "ci",
+		Role:      models.RoleEditor,
+		Prefix:    "adna_abc",
+		Hash:      "hash-1",
+		CreatedAt: created,
+	}
+	second := first
+	second.ID = "00000000-0000-0000-0000-000000000002"
+	second.Role = models.RoleMatcher
+	second.Hash = "hash-2"
+	second.CreatedAt = created.Add(time.Second)
+
+	for _, key := range []models.APIKey{second, first} {
+		if err := store.SaveAPIKey(&key); err != nil {
+			t.Fatalf("SaveAPIKey(%s): %v", key.ID, err)
+		}
+	}
+
+	got, err := store.FindAPIKey(second.Hash)
+	if err != nil {
+		t.Fatalf("FindAPIKey: %v", err)
+	}
+	if got.ID != second.ID || got.Role != second.Role || got.Revoked() {
+		t.Errorf("FindAPIKey = %+v, want %+v", *got, second)
+	}
+
+	first.RevokedAt = created.Add(time.Hour)
+	if err := store.SaveAPIKey(&first); err != nil {
+		t.Fatalf("SaveAPIKey(revoke): %v", err)
+	}
+	got, err = store.GetAPIKey(first.ID)
+	if err != nil {
+		t.Fatalf("GetAPIKey: %v", err)
+	}
+	if !got.RevokedAt.Equal(first.RevokedAt) || got.Name != first.Name || got.Prefix != first.Prefix {
+		t.Errorf("GetAPIKey = %+v, want %+v", *got, first)
+	}
+
+	keys, err := store.ListAPIKeys()
+	if err != nil {
+		t.Fatalf("ListAPIKeys: %v", err)
+	}
+	if len(keys) != 2 || keys[0].ID != first.ID || keys[1].ID != second.ID {
+		t.Errorf("ListAPIKeys returned %d keys, want %s then %s", len(keys), first.ID, second.ID)
+	}
+}
@@ -0,0 +1,152 @@
+package acousticdna
+
+import (
+	"sort"
+	"time"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// TimelineConfig tunes AnalyzeTimeline
+type TimelineConfig struct {
+	// Window is how much of the recording each query looks at and Hop how
+	// far consecutive windows are apart
+	Window time.Duration
+	Hop    time.Duration
+
+	// A window's result only counts as a sighting above both thresholds
+	MinScore      int
+	MinConfidence float64
+
+	// MinWindows is the fewest windows a track must be sighted in to be
+	// reported; lone sightings are usually chance matches
+	MinWindows int
+
+	// OffsetToleranceMs is how far the song-to-recording offset may drift
+	// between windows while still counting as the same playback
+	OffsetToleranceMs int32
+
+	// MinGap is the shortest unrecognised stretch reported as a gap
+	MinGap time.Duration
+}
+
+type TimelineOption func(*TimelineConfig)
+
+func WithTimelineWindow(window, hop time.Duration) TimelineOption {
+	return func(c *TimelineConfig) {
+		c.Window = window
+		c.Hop = hop
+	}
+}
+
+func WithTimelineThresholds(minScore int, minConfidence float64) TimelineOption {
+	return func(c *TimelineConfig) {
+		c.MinScore = minScore
+		c.MinConfidence = minConfidence
+	}
+}
+
+func WithTimelineMinWindows(n int) TimelineOption {
+	return func(c *TimelineConfig) {
+		c.MinWindows = n
+	}
+}
+
+func WithTimelineMinGap(gap time.Duration) TimelineOption {
+	return func(c *TimelineConfig) {
+		c.MinGap = gap
+	}
+}
+
+func defaultTimelineConfig() *TimelineConfig {
+	return &TimelineConfig{
+		Window:            20 * time.Second,
+		Hop:               10 * time.Second,
+		MinScore:          20,
+		MinConfidence:     40,
+		MinWindows:        2,
+		OffsetToleranceMs: 1000,
+		MinGap:            3 * time.Second,
+	}
+}
+
+// maxTimelineRounds caps how often one window is re-matched after cutting
+// out the playbacks already found in it
+const maxTimelineRounds = 3
+
+// timelineSighting is one song recognised in one analysis window
+type timelineSighting struct {
+	songID   string
+	offsetMs int32
+	startMs  int64
+	endMs    int64
+}
+
+// timelineSpan is a run of sightings of the same playback
+type timelineSpan struct {
+	timelineSighting
+	windows int
+}
+
+// mergeSightings chains sightings, given in window order, into playbacks.
+// A sighting continues a playback of the same song if the offsets agree and
+// it starts no later than one window after the playback was last seen, so
+// a single window lost to a noisy transition doesn't split a track. The
+// same song played twice, or at a different offset, becomes two spans.
+func mergeSightings(sightings []timelineSighting, cfg *TimelineConfig) []timelineSpan {
+	maxGap := cfg.Window.Milliseconds()
+
+	var spans []timelineSpan
+	for _, s := range sightings {
+		merged := false
+		for i := len(spans) - 1; i >= 0; i-- {
+			sp := &spans[i]
+			if sp.songID != s.songID || s.startMs > sp.endMs+maxGap {
+				continue
+			}
+			if d := s.offsetMs - sp.offsetMs; d > cfg.OffsetToleranceMs || d < -cfg.OffsetToleranceMs {
+				continue
+			}
+			if s.startMs < sp.startMs {
+				sp.startMs = s.startMs
+			}
+			if s.endMs > sp.endMs {
+				sp.endMs = s.endMs
+			}
+			// Follow slow drift rather than the first window's offset
+			sp.offsetMs = s.offsetMs
+			sp.windows++
+			merged = true
+			break
+		}
+		if !merged {
+			spans = append(spans, timelineSpan{timelineSighting: s, windows: 1})
+		}
+	}
+	return spans
+}
+
+// timelineGaps returns the stretches of at least minGap that no track covers
+func timelineGaps(tracks []models.TimelineTrack, durationMs int64, minGap time.Duration) []models.TimeSpan {
+	spans := make([]models.TimeSpan, len(tracks))
+	for i, t := range tracks {
+		spans[i] = models.TimeSpan{StartMs: t.StartMs, EndMs: t.EndMs}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].StartMs < spans[j].StartMs })
+
+	gaps := []models.TimeSpan{}
+	covered := int64(0)
+	addGap := func(end int64) {
+		if end-covered >= minGap.Milliseconds() && end > covered {
+			gaps = append(gaps, models.TimeSpan{StartMs: covered, EndMs: end})
+		}
+	}
+	for _, sp := range spans {
+		addGap(sp.StartMs)
+		if sp.EndMs > covered {
+			covered = sp.EndMs
+		}
+	}
+	addGap(durationMs)
+	return gaps
+}
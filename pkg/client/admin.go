@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// Health reports whether the server is live and ready
+func (c *Client) Health(ctx context.Context) (*models.HealthResponse, error) {
+	var health models.HealthResponse
+	if err := c.doJSON(ctx, http.MethodGet, "/health", nil, nil, &health); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+// Metrics returns the catalogue's size and profile. It needs the admin role.
+func (c *Client) Metrics(ctx context.Context) (*models.MetricsResponse, error) {
+	var metrics models.MetricsResponse
+	if err := c.doJSON(ctx, http.MethodGet, "/api/health/metrics", nil, nil, &metrics); err != nil {
+		return nil, err
+	}
+	return &metrics, nil
+}
+
+// ListAPIKeys returns every API key, revoked ones included. It needs the
+// admin role, as do the other key methods.
+func (c *Client) ListAPIKeys(ctx context.Context) (*models.ListAPIKeysResponse, error) {
+	var resp models.ListAPIKeysResponse
+	if err := c.doJSON(ctx, http.MethodGet, "/api/keys", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CreateAPIKey creates a key with role. The response carries the key
+// itself, which the server never shows again.
+func (c *Client) CreateAPIKey(ctx context.Context, name string, role models.Role) (*models.CreateAPIKeyResponse, error) {
+	if !role.Valid() {
+		return nil, errors.New("role must be metrics, matcher, editor or admin")
+	}
+	var resp models.CreateAPIKeyResponse
+	req := models.CreateAPIKeyRequest{Name: name, Role: role}
+	if err := c.doJSON(ctx, http.MethodPost, "/api/keys", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) RevokeAPIKey(ctx context.Context, id string) (*models.APIKeyDTO, error) {
+	var key models.APIKeyDTO
+	if err := c.doJSON(ctx, http.MethodDelete, "/api/keys/"+id, nil, nil, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
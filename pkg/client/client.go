@@ -0,0 +1,206 @@
+// Package client is a typed Go client for the AcousticDNA REST API. Its
+// requests and responses are the DTOs in pkg/models, as described by the
+// OpenAPI document the server publishes at /api/openapi.json.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// Config tunes a Client
+type Config struct {
+	// HTTPClient sends the requests; uploads and matches can take minutes,
+	// so its timeout should allow for them
+	HTTPClient *http.Client
+
+	// APIKey is sent in X-API-Key. BearerToken, a JWT, is sent instead when
+	// there is no key.
+	APIKey      string
+	BearerToken string
+
+	UserAgent string
+}
+
+type Option func(*Config)
+
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Config) {
+		if hc != nil {
+			c.HTTPClient = hc
+		}
+	}
+}
+
+func WithAPIKey(key string) Option {
+	return func(c *Config) {
+		c.APIKey = key
+	}
+}
+
+func WithBearerToken(token string) Option {
+	return func(c *Config) {
+		c.BearerToken = token
+	}
+}
+
+func WithUserAgent(ua string) Option {
+	return func(c *Config) {
+		c.UserAgent = ua
+	}
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		HTTPClient: &http.Client{Timeout: 5 * time.Minute},
+		UserAgent:  "acousticdna-go-client",
+	}
+}
+
+// Client calls one AcousticDNA server. It is safe for concurrent use.
+type Client struct {
+	base *url.URL
+	cfg  *Config
+}
+
+// New returns a client of the server at baseURL, e.g. http://localhost:8080
+func New(baseURL string, opts ...Option) (*Client, error) {
+	base, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL %q: scheme must be http or https", baseURL)
+	}
+
+	cfg := defaultConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return &Client{base: base, cfg: cfg}, nil
+}
+
+// Error is a response with an error status
+type Error struct {
+	StatusCode int
+	Message    string
+
+	// RetryAfter is how long to wait before retrying a rate-limited request
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("acousticdna: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("acousticdna: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// IsNotFound reports whether err is a 404 from the server
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsRateLimited reports whether err is a 429 from the server; its Error
+// says when to retry
+func IsRateLimited(err error) bool {
+	return hasStatus(err, http.StatusTooManyRequests)
+}
+
+func hasStatus(err error, status int) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
+
+// url resolves a path and query against the base URL
+func (c *Client) url(path string, query url.Values) string {
+	u := *c.base
+	u.Path = c.base.Path + path
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// newRequest builds an authenticated request
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.url(path, query), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.cfg.UserAgent != "" {
+		req.Header.Set("User-Agent", c.cfg.UserAgent)
+	}
+	switch {
+	case c.cfg.APIKey != "":
+		req.Header.Set("X-API-Key", c.cfg.APIKey)
+	case c.cfg.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.cfg.BearerToken)
+	}
+	return req, nil
+}
+
+// doJSON sends in, if not nil, as JSON and decodes the response into out
+func (c *Client) doJSON(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("encoding request: %w", err)
+		}
+		body, contentType = bytes.NewReader(data), "application/json"
+	}
+	req, err := c.newRequest(ctx, method, path, query, body, contentType)
+	if err != nil {
+		return err
+	}
+	return c.do(req, out)
+}
+
+// do sends req and decodes a successful response into out, or returns an
+// *Error for an error status
+func (c *Client) do(req *http.Request, out any) error {
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return responseError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding %s %s response: %w", req.Method, req.URL.Path, err)
+	}
+	return nil
+}
+
+// responseError reads the error body the server sends with an error status
+func responseError(resp *http.Response) error {
+	apiErr := &Error{StatusCode: resp.StatusCode}
+	var body models.ErrorResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err == nil {
+		apiErr.Message = body.Message
+	}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		apiErr.RetryAfter = time.Duration(secs) * time.Second
+	}
+	return apiErr
+}
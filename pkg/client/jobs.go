@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// defaultPollInterval is how often WaitJob checks a job by default
+const defaultPollInterval = 2 * time.Second
+
+// ListJobs returns the ingestion jobs with status, or all of them if it is
+// empty
+func (c *Client) ListJobs(ctx context.Context, status models.JobStatus) (*models.ListJobsResponse, error) {
+	params := url.Values{}
+	setString(params, "status", string(status))
+
+	var resp models.ListJobsResponse
+	if err := c.doJSON(ctx, http.MethodGet, "/api/jobs", params, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) GetJob(ctx context.Context, id string) (*models.JobDTO, error) {
+	var job models.JobDTO
+	if err := c.doJSON(ctx, http.MethodGet, "/api/jobs/"+id, nil, nil, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// CancelJob cancels a queued or running job
+func (c *Client) CancelJob(ctx context.Context, id string) (*models.JobDTO, error) {
+	var job models.JobDTO
+	if err := c.doJSON(ctx, http.MethodDelete, "/api/jobs/"+id, nil, nil, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// WaitJob polls a job every interval (2s if 0) until it has ended, and
+// returns it. A failed job is returned without error; check its Status.
+func (c *Client) WaitJob(ctx context.Context, id string, interval time.Duration) (*models.JobDTO, error) {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		job, err := c.GetJob(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if job.Status.Done() {
+			return job, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
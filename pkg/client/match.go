@@ -0,0 +1,40 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/acousticdna/fingerprint"
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// MatchFile uploads a recording and returns the songs it matches, best
+// first, with how the server fingerprinted it. name is the file's name,
+// whose extension tells the server how to decode it.
+func (c *Client) MatchFile(ctx context.Context, audio io.Reader, name string) (*models.MatchHashesResponse, error) {
+	var resp models.MatchHashesResponse
+	if err := c.upload(ctx, "/api/match", nil, audio, name, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// MatchHashes matches hashes fingerprinted by the caller. They must be made
+// with a profile compatible with the catalogue's; see Profile.
+func (c *Client) MatchHashes(ctx context.Context, req models.MatchHashesRequest) (*models.MatchHashesResponse, error) {
+	var resp models.MatchHashesResponse
+	if err := c.doJSON(ctx, http.MethodPost, "/api/match/hashes", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Profile returns the fingerprint profile of the server's catalogue
+func (c *Client) Profile(ctx context.Context) (*fingerprint.Profile, error) {
+	var profile fingerprint.Profile
+	if err := c.doJSON(ctx, http.MethodGet, "/api/profile", nil, nil, &profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
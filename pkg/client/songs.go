@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/himanishpuri/AcousticDNA/pkg/models"
+)
+
+// ListSongs returns one page of the catalogue. Zero fields of q don't
+// filter; a zero Limit gets the server's default page size, and at most
+// 1000 songs come back at once. Pass the page's NextCursor as q.Cursor for
+// the next page.
+func (c *Client) ListSongs(ctx context.Context, q models.SongQuery) (*models.ListSongsResponse, error) {
+	params := url.Values{}
+	setString(params, "search", q.Search)
+	setString(params, "source", string(q.Source))
+	setString(params, "sort", string(q.Sort))
+	setString(params, "cursor", q.Cursor)
+	setInt(params, "limit", q.Limit)
+	setInt(params, "min_duration_ms", q.MinDurationMs)
+	setInt(params, "max_duration_ms", q.MaxDurationMs)
+	if !q.CreatedAfter.IsZero() {
+		params.Set("created_after", q.CreatedAfter.Format(time.RFC3339Nano))
+	}
+	if !q.CreatedBefore.IsZero() {
+		params.Set("created_before", q.CreatedBefore.Format(time.RFC3339Nano))
+	}
+	if q.Desc {
+		params.Set("order", "desc")
+	}
+
+	var resp models.ListSongsResponse
+	if err := c.doJSON(ctx, http.MethodGet, "/api/songs", params, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) GetSong(ctx context.Context, id string) (*models.SongDTO, error) {
+	var song models.SongDTO
+	if err := c.doJSON(ctx, http.MethodGet, "/api/songs/"+id, nil, nil, &song); err != nil {
+		return nil, err
+	}
+	return &song, nil
+}
+
+// UpdateSong changes the fields of a song's metadata that update sets
+func (c *Client) UpdateSong(ctx context.Context, id string, update models.UpdateSongRequest) (*models.SongDTO, error) {
+	var song models.SongDTO
+	if err := c.doJSON(ctx, http.MethodPatch, "/api/songs/"+id, nil, update, &song); err != nil {
+		return nil, err
+	}
+	return &song, nil
+}
+
+// DeleteSong removes a song and its fingerprints
+func (c *Client) DeleteSong(ctx context.Context, id string) error {
+	return c.doJSON(ctx, http.MethodDelete, "/api/songs/"+id, nil, nil, nil)
+}
+
+// AddSongFile uploads a recording to be added in the background and returns
+// its job; see WaitJob. name is the file's name, whose extension tells the
+// server how to decode it. youtubeID may be empty.
+func (c *Client) AddSongFile(ctx context.Context, audio io.Reader, name, title, artist, youtubeID string) (*models.JobDTO, error) {
+	fields := [][2]string{{"title", title}, {"artist", artist}}
+	if youtubeID != "" {
+		fields = append(fields, [2]string{"youtube_id", youtubeID})
+	}
+	var job models.JobDTO
+	if err := c.upload(ctx, "/api/songs", fields, audio, name, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// AddSongYouTube queues a song to be downloaded from YouTube and added.
+// Title and artist are taken from the video when the request leaves them
+// out.
+func (c *Client) AddSongYouTube(ctx context.Context, req models.AddSongYouTubeRequest) (*models.JobDTO, error) {
+	var job models.JobDTO
+	if err := c.doJSON(ctx, http.MethodPost, "/api/songs/youtube", nil, req, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// upload streams a multipart form of fields and the audio file to path
+func (c *Client) upload(ctx context.Context, path string, fields [][2]string, audio io.Reader, name string, out any) error {
+	if name == "" {
+		name = "audio"
+	}
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	form := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writeForm(form, fields, audio, name))
+	}()
+
+	req, err := c.newRequest(ctx, http.MethodPost, path, nil, pr, form.FormDataContentType())
+	if err != nil {
+		return err
+	}
+	return c.do(req, out)
+}
+
+func writeForm(form *multipart.Writer, fields [][2]string, audio io.Reader, name string) error {
+	for _, f := range fields {
+		if err := form.WriteField(f[0], f[1]); err != nil {
+			return err
+		}
+	}
+	part, err := form.CreateFormFile("audio", name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, audio); err != nil {
+		return err
+	}
+	return form.Close()
+}
+
+func setString(params url.Values, name, v string) {
+	if v != "" {
+		params.Set(name, v)
+	}
+}
+
+func setInt(params url.Values, name string, v int) {
+	if v != 0 {
+		params.Set(name, strconv.Itoa(v))
+	}
+}
@@ -1,8 +1,10 @@
 package models
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
+	"time"
 )
 
 // Hash limit constants for validation
@@ -15,20 +17,53 @@ const (
 
 	// HashWarningThreshold triggers logging for large hash batches
 	HashWarningThreshold = 5000
+
+	// MaxQueryDurationMs is the latest anchor time accepted in a query
+	// (10 minutes, well past the ~2 minutes the hash limit allows)
+	MaxQueryDurationMs = 10 * 60 * 1000
 )
 
 // MatchHashesRequest is the request body for POST /api/match/hashes
 type MatchHashesRequest struct {
-	// Hashes is a map where keys are the hash values (as strings from JSON) and
-	// values are the anchor times in milliseconds
-	Hashes map[string]uint32 `json:"hashes" binding:"required"`
+	// Pairs lists every query hash with its anchor time. A hash may repeat
+	// with different anchor times; each occurrence counts when matching.
+	Pairs []HashPairDTO `json:"pairs,omitempty"`
+
+	// Hashes is the legacy form: a map where keys are the hash values (as
+	// strings from JSON) and values are the anchor times in milliseconds.
+	// It can only carry one anchor time per hash, so prefer Pairs.
+	Hashes map[string]uint32 `json:"hashes,omitempty"`
+
+	// Profile is the fingerprint profile (see fingerprint.Profile) the hashes
+	// were made with. When omitted the default profile is assumed.
+	Profile json.RawMessage `json:"profile,omitempty"`
+}
+
+// HashPairDTO is one query hash with the time of its anchor peak
+type HashPairDTO struct {
+	Hash         uint32 `json:"hash"`
+	AnchorTimeMs uint32 `json:"anchor_time_ms"`
 }
 
-// ToHashMap converts the string-keyed hash map to uint32-keyed map
-func (r *MatchHashesRequest) ToHashMap() (map[uint32]uint32, error) {
-	result := make(map[uint32]uint32, len(r.Hashes))
+// Len returns the number of hashes in the request
+func (r *MatchHashesRequest) Len() int {
+	return len(r.Pairs) + len(r.Hashes)
+}
+
+// ToQuery converts the request to query pairs, skipping hashes valid rejects
+func (r *MatchHashesRequest) ToQuery(valid func(hash uint32) bool) ([]HashPair, error) {
+	result := make([]HashPair, 0, r.Len())
 	invalidCount := 0
 
+	for _, p := range r.Pairs {
+		// Skip invalid hashes instead of failing the entire request
+		if !valid(p.Hash) {
+			invalidCount++
+			continue
+		}
+		result = append(result, HashPair{Hash: p.Hash, AnchorTimeMs: p.AnchorTimeMs})
+	}
+
 	for hashStr, anchorTime := range r.Hashes {
 		// Parse string key as uint32
 		hash64, err := strconv.ParseUint(hashStr, 10, 32)
@@ -37,24 +72,21 @@ func (r *MatchHashesRequest) ToHashMap() (map[uint32]uint32, error) {
 		}
 		hash := uint32(hash64)
 
-		// Validate the hash format and skip invalid ones
-		if !IsValidHash(hash) {
+		if !valid(hash) {
 			invalidCount++
-			// Skip invalid hashes instead of failing the entire request
 			continue
 		}
-
-		result[hash] = anchorTime
+		result = append(result, HashPair{Hash: hash, AnchorTimeMs: anchorTime})
 	}
 
 	// Log if we skipped invalid hashes
 	if invalidCount > 0 {
-		fmt.Printf("Warning: Skipped %d invalid hashes out of %d total\n", invalidCount, len(r.Hashes))
+		fmt.Printf("Warning: Skipped %d invalid hashes out of %d total\n", invalidCount, r.Len())
 	}
 
 	// If all hashes were invalid, that's an error
 	if len(result) == 0 {
-		return nil, fmt.Errorf("all %d hashes were invalid", len(r.Hashes))
+		return nil, fmt.Errorf("all %d hashes were invalid", r.Len())
 	}
 
 	return result, nil
@@ -62,18 +94,29 @@ func (r *MatchHashesRequest) ToHashMap() (map[uint32]uint32, error) {
 
 // Validate checks if the request is valid
 func (r *MatchHashesRequest) Validate() error {
-	if len(r.Hashes) == 0 {
+	if r.Len() == 0 {
 		return fmt.Errorf("hashes cannot be empty")
 	}
-	if len(r.Hashes) > MaxHashesHardLimit {
-		return fmt.Errorf("too many hashes: %d (maximum: %d)", len(r.Hashes), MaxHashesHardLimit)
+	if r.Len() > MaxHashesHardLimit {
+		return fmt.Errorf("too many hashes: %d (maximum: %d)", r.Len(), MaxHashesHardLimit)
+	}
+	for _, p := range r.Pairs {
+		if p.AnchorTimeMs > MaxQueryDurationMs {
+			return fmt.Errorf("anchor time %dms is beyond the longest query (%dms)", p.AnchorTimeMs, MaxQueryDurationMs)
+		}
+	}
+	for _, anchorTime := range r.Hashes {
+		if anchorTime > MaxQueryDurationMs {
+			return fmt.Errorf("anchor time %dms is beyond the longest query (%dms)", anchorTime, MaxQueryDurationMs)
+		}
 	}
 
-	// Validation of hash format is now done in ToHashMap() during conversion
+	// Validation of hash format is done in ToQuery() during conversion
 	return nil
 }
 
-// IsValidHash performs lightweight validation of hash structure
+// IsValidHash performs lightweight validation of hash structure under the
+// default fingerprint profile
 // Hash format: [anchorFreq (9 bits) | targetFreq (9 bits) | deltaTime (14 bits)]
 func IsValidHash(hash uint32) bool {
 	// Extract components using the same bit layout as hasher.go
@@ -105,8 +148,76 @@ func IsValidHash(hash uint32) bool {
 
 // MatchHashesResponse is the response for hash-based matching
 type MatchHashesResponse struct {
+	Verdict MatchVerdict     `json:"verdict"`
 	Matches []MatchResultDTO `json:"matches"`
 	Count   int              `json:"count"`
+
+	// Diagnostics is only set when the server fingerprinted the query itself
+	Diagnostics *QueryDiagnosticsDTO `json:"diagnostics,omitempty"`
+}
+
+// QueryDiagnosticsDTO describes how an uploaded query was fingerprinted
+type QueryDiagnosticsDTO struct {
+	DurationMs    int `json:"duration_ms"`
+	Frames        int `json:"frames"`
+	SkippedFrames int `json:"skipped_frames"`
+	ZeroFrames    int `json:"zero_frames"`
+	SilentFrames  int `json:"silent_frames"`
+	NoisyFrames   int `json:"noisy_frames"`
+	Peaks         int `json:"peaks"`
+	Hashes        int `json:"hashes"`
+}
+
+// NewQueryDiagnosticsDTO converts query diagnostics for the API
+func NewQueryDiagnosticsDTO(d QueryDiagnostics) *QueryDiagnosticsDTO {
+	return &QueryDiagnosticsDTO{
+		DurationMs:    d.DurationMs,
+		Frames:        d.Frames,
+		SkippedFrames: d.SkippedFrames(),
+		ZeroFrames:    d.ZeroFrames,
+		SilentFrames:  d.SilentFrames,
+		NoisyFrames:   d.NoisyFrames,
+		Peaks:         d.Peaks,
+		Hashes:        d.Hashes,
+	}
+}
+
+// MatchVerdict sums up a match response
+type MatchVerdict string
+
+const (
+	// VerdictMatch means one song is certain enough to be the answer
+	VerdictMatch MatchVerdict = "match"
+	// VerdictWeakMatch means there are candidates but none is certain enough
+	VerdictWeakMatch MatchVerdict = "weak_match"
+	// VerdictNoMatch means nothing in the catalogue resembles the query
+	VerdictNoMatch MatchVerdict = "no_match"
+)
+
+// Verdict sums up match results
+func Verdict(results []MatchResult) MatchVerdict {
+	for _, r := range results {
+		if r.Matched {
+			return VerdictMatch
+		}
+	}
+	if len(results) > 0 {
+		return VerdictWeakMatch
+	}
+	return VerdictNoMatch
+}
+
+// NewMatchHashesResponse converts match results for the API
+func NewMatchHashesResponse(results []MatchResult) MatchHashesResponse {
+	resp := MatchHashesResponse{
+		Verdict: Verdict(results),
+		Matches: make([]MatchResultDTO, len(results)),
+		Count:   len(results),
+	}
+	for i, result := range results {
+		resp.Matches[i] = NewMatchResultDTO(result)
+	}
+	return resp
 }
 
 // MatchResultDTO represents a single match result
@@ -118,6 +229,65 @@ type MatchResultDTO struct {
 	Score      int     `json:"score"`
 	OffsetMs   int32   `json:"offset_ms"`
 	Confidence float64 `json:"confidence"`
+	SpeedRatio float64 `json:"speed_ratio"`
+
+	// Probability (0-1) that this is the right song; matched marks the
+	// answer, if there is one
+	Probability float64 `json:"probability"`
+	Matched     bool    `json:"matched"`
+	SongMetadataDTO
+
+	// Segments lists the spans of the query that line up with the song
+	Segments []SegmentDTO `json:"segments,omitempty"`
+
+	// Density holds the number of aligned hashes in each second of the query
+	Density []int `json:"density,omitempty"`
+}
+
+// SegmentDTO pairs a span of the query with the span of the song it matches
+type SegmentDTO struct {
+	QueryStartMs uint32 `json:"query_start_ms"`
+	QueryEndMs   uint32 `json:"query_end_ms"`
+	SongStartMs  uint32 `json:"song_start_ms"`
+	SongEndMs    uint32 `json:"song_end_ms"`
+	Score        int    `json:"score"`
+}
+
+// NewMatchResultDTO converts a match result for the API
+func NewMatchResultDTO(m MatchResult) MatchResultDTO {
+	segments := make([]SegmentDTO, len(m.Segments))
+	for i, seg := range m.Segments {
+		segments[i] = SegmentDTO{
+			QueryStartMs: seg.QueryStartMs,
+			QueryEndMs:   seg.QueryEndMs,
+			SongStartMs:  seg.RefStartMs,
+			SongEndMs:    seg.RefEndMs,
+			Score:        seg.Count,
+		}
+	}
+	return MatchResultDTO{
+		SongID:      m.SongID,
+		Title:       m.Title,
+		Artist:      m.Artist,
+		YouTubeID:   m.YouTubeID,
+		Score:       m.Score,
+		OffsetMs:    m.OffsetMs,
+		Confidence:  m.Confidence,
+		SpeedRatio:  m.SpeedRatio,
+		Probability: m.Probability,
+		Matched:     m.Matched,
+		SongMetadataDTO: SongMetadataDTO{
+			SpotifyID:   m.SpotifyID,
+			Album:       m.Album,
+			ISRC:        m.ISRC,
+			Year:        m.Year,
+			Genre:       m.Genre,
+			Tags:        m.Tags,
+			ExternalIDs: m.ExternalIDs,
+		},
+		Segments: segments,
+		Density:  m.Density,
+	}
 }
 
 // AddSongYouTubeRequest is the request body for POST /api/songs/youtube
@@ -152,17 +322,85 @@ type AddSongResponse struct {
 
 // SongDTO represents a song in API responses
 type SongDTO struct {
-	ID         string `json:"id"`
-	Title      string `json:"title"`
-	Artist     string `json:"artist"`
-	YouTubeID  string `json:"youtube_id,omitempty"`
-	DurationMs int    `json:"duration_ms"`
+	ID         string    `json:"id"`
+	Title      string    `json:"title"`
+	Artist     string    `json:"artist"`
+	YouTubeID  string    `json:"youtube_id,omitempty"`
+	DurationMs int       `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at,omitzero"`
+	SongMetadataDTO
 }
 
-// ListSongsResponse is the response for GET /api/songs
+// SongMetadataDTO is the optional song metadata shared by songs and matches
+type SongMetadataDTO struct {
+	SpotifyID   string            `json:"spotify_id,omitempty"`
+	Album       string            `json:"album,omitempty"`
+	ISRC        string            `json:"isrc,omitempty"`
+	Year        int               `json:"year,omitempty"`
+	Genre       string            `json:"genre,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	ExternalIDs map[string]string `json:"external_ids,omitempty"`
+}
+
+// NewSongDTO converts a song for the API
+func NewSongDTO(song Song) SongDTO {
+	return SongDTO{
+		ID:         song.ID,
+		Title:      song.Title,
+		Artist:     song.Artist,
+		YouTubeID:  song.YouTubeID,
+		DurationMs: song.DurationMs,
+		CreatedAt:  song.CreatedAt,
+		SongMetadataDTO: SongMetadataDTO{
+			SpotifyID:   song.SpotifyID,
+			Album:       song.Album,
+			ISRC:        song.ISRC,
+			Year:        song.Year,
+			Genre:       song.Genre,
+			Tags:        song.Tags,
+			ExternalIDs: song.ExternalIDs,
+		},
+	}
+}
+
+// UpdateSongRequest is the request body for PATCH /api/songs/{id}. Omitted
+// fields are left alone; an external ID set to "" is removed.
+type UpdateSongRequest struct {
+	Title       *string           `json:"title,omitempty"`
+	Artist      *string           `json:"artist,omitempty"`
+	YouTubeID   *string           `json:"youtube_id,omitempty"`
+	SpotifyID   *string           `json:"spotify_id,omitempty"`
+	Album       *string           `json:"album,omitempty"`
+	ISRC        *string           `json:"isrc,omitempty"`
+	Year        *int              `json:"year,omitempty"`
+	Genre       *string           `json:"genre,omitempty"`
+	Tags        *[]string         `json:"tags,omitempty"`
+	ExternalIDs map[string]string `json:"external_ids,omitempty"`
+}
+
+// SongUpdate converts the request for the service
+func (r UpdateSongRequest) SongUpdate() SongUpdate {
+	return SongUpdate{
+		Title:       r.Title,
+		Artist:      r.Artist,
+		YouTubeID:   r.YouTubeID,
+		SpotifyID:   r.SpotifyID,
+		Album:       r.Album,
+		ISRC:        r.ISRC,
+		Year:        r.Year,
+		Genre:       r.Genre,
+		Tags:        r.Tags,
+		ExternalIDs: r.ExternalIDs,
+	}
+}
+
+// ListSongsResponse is the response for GET /api/songs. Pass NextCursor
+// back as the cursor parameter to get the next page.
 type ListSongsResponse struct {
-	Songs []SongDTO `json:"songs"`
-	Count int       `json:"count"`
+	Songs      []SongDTO `json:"songs"`
+	Count      int       `json:"count"` // Songs on this page
+	Total      int       `json:"total"` // Songs matching the filters
+	NextCursor string    `json:"next_cursor,omitempty"`
 }
 
 // DeleteSongResponse is the response for DELETE /api/songs/{id}
@@ -171,6 +409,98 @@ type DeleteSongResponse struct {
 	ID      string `json:"id"`
 }
 
+// JobDTO is a background ingestion job in API responses
+type JobDTO struct {
+	ID        string    `json:"id"`
+	Kind      JobKind   `json:"kind"`
+	Status    JobStatus `json:"status"`
+	Stage     JobStage  `json:"stage,omitempty"`
+	Title     string    `json:"title,omitempty"`
+	Artist    string    `json:"artist,omitempty"`
+	YouTubeID string    `json:"youtube_id,omitempty"`
+	SongID    string    `json:"song_id,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NewJobDTO converts a job for the API. The spool path of an upload is
+// internal and left out.
+func NewJobDTO(job Job) JobDTO {
+	return JobDTO{
+		ID:        job.ID,
+		Kind:      job.Kind,
+		Status:    job.Status,
+		Stage:     job.Stage,
+		Title:     job.Title,
+		Artist:    job.Artist,
+		YouTubeID: job.YouTubeID,
+		SongID:    job.SongID,
+		Error:     job.Error,
+		CreatedAt: job.CreatedAt,
+		UpdatedAt: job.UpdatedAt,
+	}
+}
+
+// ListJobsResponse is the response for GET /api/jobs
+type ListJobsResponse struct {
+	Jobs  []JobDTO `json:"jobs"`
+	Count int      `json:"count"`
+}
+
+// APIKeyDTO is an API key in API responses; the key itself is never listed
+type APIKeyDTO struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name,omitempty"`
+	Role      Role       `json:"role"`
+	Prefix    string     `json:"prefix"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// NewAPIKeyDTO converts an API key for the API, leaving out its hash
+func NewAPIKeyDTO(key APIKey) APIKeyDTO {
+	dto := APIKeyDTO{
+		ID:        key.ID,
+		Name:      key.Name,
+		Role:      key.Role,
+		Prefix:    key.Prefix,
+		CreatedAt: key.CreatedAt,
+	}
+	if key.Revoked() {
+		revoked := key.RevokedAt
+		dto.RevokedAt = &revoked
+	}
+	return dto
+}
+
+// CreateAPIKeyRequest is the request body for POST /api/keys
+type CreateAPIKeyRequest struct {
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+}
+
+// CreateAPIKeyResponse carries a new key, the only time it is shown
+type CreateAPIKeyResponse struct {
+	Key    string    `json:"key"`
+	APIKey APIKeyDTO `json:"api_key"`
+}
+
+// ListAPIKeysResponse is the response for GET /api/keys
+type ListAPIKeysResponse struct {
+	Keys  []APIKeyDTO `json:"keys"`
+	Count int         `json:"count"`
+}
+
+// HealthResponse is the response of /health and /health/ready
+type HealthResponse struct {
+	Status string `json:"status"` // healthy or ready, draining, unavailable
+	Live   bool   `json:"live"`
+	Ready  bool   `json:"ready"`
+	Reason string `json:"reason,omitempty"` // Why the server isn't ready
+	Time   string `json:"time"`
+}
+
 // MetricsResponse provides server health and database metrics
 type MetricsResponse struct {
 	Status           string `json:"status"`
@@ -178,6 +508,7 @@ type MetricsResponse struct {
 	SongCount        int    `json:"song_count"`
 	FingerprintCount int64  `json:"fingerprint_count"`
 	SampleRate       int    `json:"sample_rate"`
+	Profile          string `json:"profile"`
 }
 
 // ErrorResponse is the standard error response format
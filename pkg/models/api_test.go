@@ -0,0 +1,34 @@
+package models
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestMatchHashesRequestValidate(t *testing.T) {
+	pair := HashPairDTO{Hash: 1 << 23, AnchorTimeMs: 1000}
+	late := HashPairDTO{Hash: 1 << 23, AnchorTimeMs: math.MaxUint32}
+	tests := []struct {
+		name string
+		req  MatchHashesRequest
+		err  string
+	}{
+		{"pairs", MatchHashesRequest{Pairs: []HashPairDTO{pair}}, ""},
+		{"legacy hashes", MatchHashesRequest{Hashes: map[string]uint32{"8388608": 1000}}, ""},
+		{"last anchor time", MatchHashesRequest{Pairs: []HashPairDTO{{Hash: 1, AnchorTimeMs: MaxQueryDurationMs}}}, ""},
+		{"empty", MatchHashesRequest{}, "empty"},
+		{"too many", MatchHashesRequest{Pairs: make([]HashPairDTO, MaxHashesHardLimit+1)}, "too many"},
+		{"late pair", MatchHashesRequest{Pairs: []HashPairDTO{pair, late}}, "anchor time"},
+		{"late legacy hash", MatchHashesRequest{Hashes: map[string]uint32{"8388608": MaxQueryDurationMs + 1}}, "anchor time"},
+	}
+	for _, tc := range tests {
+		err := tc.req.Validate()
+		switch {
+		case tc.err == "" && err != nil:
+			t.Errorf("%s: %v", tc.name, err)
+		case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+			t.Errorf("%s: error %v, want one about %q", tc.name, err, tc.err)
+		}
+	}
+}
@@ -7,9 +7,19 @@ type Couple struct {
 	AnchorTimeMs uint32
 }
 
+// HashPair is one query hash with the time of its anchor peak
+type HashPair struct {
+	Hash         uint32
+	AnchorTimeMs uint32
+}
+
 // Match represents a candidate match returned by the query matcher.
 type Match struct {
 	SongID   string // UUID of the song
-	OffsetMs int32  // dbAnchorTimeMs - queryAnchorTimeMs
+	OffsetMs int32  // dbAnchorTimeMs - SpeedRatio*queryAnchorTimeMs
 	Count    int
+
+	// SpeedRatio is reference time per query time; 1.03 means the query
+	// plays 3% faster than the catalogue recording
+	SpeedRatio float64
 }
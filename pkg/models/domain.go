@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // MatchResult represents a song match result with metadata and scoring.
 type MatchResult struct {
 	SongID     string  // Database ID of the matched song (UUID)
@@ -9,13 +11,160 @@ type MatchResult struct {
 	Score      int     // Number of matching fingerprint hashes
 	OffsetMs   int32   // Time offset in milliseconds
 	Confidence float64 // Match confidence as a percentage (0-100)
+	SpeedRatio float64 // Estimated playback speed of the query relative to the reference (1 = unchanged)
+
+	// Probability (0-1) that this is the right song. Matched is set on the
+	// one result, if any, that is certain enough to report as the answer;
+	// the others are weak matches.
+	Probability float64
+	Matched     bool
+
+	// The rest of the matched song's metadata
+	SpotifyID   string
+	Album       string
+	ISRC        string
+	Year        int
+	Genre       string
+	Tags        []string
+	ExternalIDs map[string]string
+
+	Segments []Segment // Spans of the query that line up with the song, in query order
+	Density  []int     // Aligned hashes in each second of the query
+}
+
+// SongFingerprints is a fingerprinted recording that hasn't been stored yet;
+// its couples get their song ID when it is
+type SongFingerprints struct {
+	DurationMs int
+	Hashes     map[uint32][]Couple
+}
+
+// QueryDiagnostics describes how a query clip was fingerprinted. Frames of
+// digital silence, near silence or noise get no peaks, since their hashes
+// would match anything.
+type QueryDiagnostics struct {
+	DurationMs   int
+	Frames       int // Spectrogram frames
+	ZeroFrames   int // ...skipped as digital silence
+	SilentFrames int // ...skipped as too quiet
+	NoisyFrames  int // ...skipped as noise-like
+	Peaks        int
+	Hashes       int
+}
+
+// SkippedFrames returns the number of frames that got no peaks for being
+// silent or noisy
+func (d QueryDiagnostics) SkippedFrames() int {
+	return d.ZeroFrames + d.SilentFrames + d.NoisyFrames
+}
+
+// Segment is a stretch of the query that lines up with a stretch of the
+// matched song. Times are anchor times in milliseconds.
+type Segment struct {
+	QueryStartMs uint32
+	QueryEndMs   uint32
+	RefStartMs   uint32
+	RefEndMs     uint32
+	Count        int // Aligned hashes in the segment
 }
 
 // Song represents a song entry in the database.
 type Song struct {
-	ID         string // Database ID (UUID)
-	Title      string // Song title
-	Artist     string // Artist name
-	YouTubeID  string // YouTube video ID (if available)
-	DurationMs int    // Duration in milliseconds
+	ID         string    // Database ID (UUID)
+	Title      string    // Song title
+	Artist     string    // Artist name
+	YouTubeID  string    // YouTube video ID (if available)
+	DurationMs int       // Duration in milliseconds
+	CreatedAt  time.Time // When the song was registered
+
+	SpotifyID   string
+	Album       string
+	ISRC        string            // International Standard Recording Code, e.g. USRC17607839
+	Year        int               // Release year, 0 when unknown
+	Genre       string            // Genre as tagged, e.g. "Electronic"
+	Tags        []string          // Free-form labels
+	ExternalIDs map[string]string // IDs in other catalogues by service, e.g. "musicbrainz"
+}
+
+// Clone returns a copy of s that shares no tags or external IDs with it
+func (s Song) Clone() Song {
+	if s.Tags != nil {
+		s.Tags = append([]string(nil), s.Tags...)
+	}
+	if s.ExternalIDs != nil {
+		ids := make(map[string]string, len(s.ExternalIDs))
+		for k, v := range s.ExternalIDs {
+			ids[k] = v
+		}
+		s.ExternalIDs = ids
+	}
+	return s
+}
+
+// SongUpdate changes some of a song's metadata; nil fields are left alone.
+// ExternalIDs are merged into the song's, and an empty value removes that
+// service.
+type SongUpdate struct {
+	Title       *string
+	Artist      *string
+	YouTubeID   *string
+	SpotifyID   *string
+	Album       *string
+	ISRC        *string
+	Year        *int
+	Genre       *string
+	Tags        *[]string
+	ExternalIDs map[string]string
+}
+
+// Timeline lists the catalogue tracks found in a long recording such as a
+// DJ mix or a podcast. Times are milliseconds from the start of the recording.
+type Timeline struct {
+	DurationMs int64
+	Tracks     []TimelineTrack // Ordered by start; neighbours may overlap in a crossfade
+	Gaps       []TimeSpan      // Stretches where no track was recognised
+}
+
+// TimelineTrack is one playback of a catalogue track within a recording.
+// The embedded match is scored over the whole span, and its OffsetMs maps
+// recording time to song time.
+type TimelineTrack struct {
+	MatchResult
+	StartMs     int64
+	EndMs       int64
+	SongStartMs int64 // Position in the song at StartMs
+	Windows     int   // Analysis windows the track was recognised in
+}
+
+// TimeSpan is a stretch of a recording
+type TimeSpan struct {
+	StartMs int64
+	EndMs   int64
+}
+
+// DuplicatePair is the audio shared by two catalogue songs. Coverage is the
+// fraction of each song's fingerprints that line up with the other song;
+// Overlap is the coverage of the shorter one.
+type DuplicatePair struct {
+	SongA      string
+	SongB      string
+	Score      int     // Aligned hashes
+	Overlap    float64 // 0-1
+	CoverageA  float64
+	CoverageB  float64
+	OffsetMs   int32 // SongB time - SpeedRatio*SongA time
+	SpeedRatio float64
+	Identical  bool // Both songs are essentially the same recording
+}
+
+// DuplicateCluster is a group of songs linked by shared audio. A cluster of
+// partial overlaps names each set of identical recordings by the song kept
+// when merging them.
+type DuplicateCluster struct {
+	Songs []Song
+	Pairs []DuplicatePair
+
+	// Identical is set when every pair is audio-identical, which makes the
+	// cluster safe to merge into one song
+	Identical bool
 }
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// JobStatus is where an ingestion job is in its lifecycle
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCanceled  JobStatus = "canceled"
+)
+
+// Done reports whether the job has finished, one way or another
+func (s JobStatus) Done() bool {
+	return s == JobSucceeded || s == JobFailed || s == JobCanceled
+}
+
+// JobStage is the step a running job is on
+type JobStage string
+
+const (
+	StageDownloading    JobStage = "downloading"
+	StageFingerprinting JobStage = "fingerprinting"
+	StageStoring        JobStage = "storing"
+)
+
+// JobKind is what a job ingests from
+type JobKind string
+
+const (
+	JobFromFile    JobKind = "file"
+	JobFromYouTube JobKind = "youtube"
+)
+
+// Job is a song being added in the background
+type Job struct {
+	ID     string
+	Kind   JobKind
+	Status JobStatus
+	Stage  JobStage // Empty until the job starts
+
+	// Source is the spooled upload for a file job, the URL for a YouTube one
+	Source    string
+	Title     string
+	Artist    string
+	YouTubeID string
+
+	SongID string // Set once the song is stored
+	Error  string // Why the job failed
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+// Role is what a caller of the server may do. Each role from matcher on may
+// do everything the roles before it may; metrics only reads the Prometheus
+// metrics, and only admin includes it.
+type Role string
+
+const (
+	// RoleMetrics may only read /metrics, for monitoring scrapers
+	RoleMetrics Role = "metrics"
+	// RoleMatcher may match audio and read the catalogue
+	RoleMatcher Role = "matcher"
+	// RoleEditor may also add, edit and delete songs and follow their jobs
+	RoleEditor Role = "editor"
+	// RoleAdmin may also manage API keys and read server metrics
+	RoleAdmin Role = "admin"
+)
+
+// Roles lists every role, least privileged first
+var Roles = []Role{RoleMetrics, RoleMatcher, RoleEditor, RoleAdmin}
+
+// rank orders roles by privilege; unknown roles rank 0
+func (r Role) rank() int {
+	for i, role := range Roles {
+		if role == r {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Valid reports whether r is one of Roles
+func (r Role) Valid() bool {
+	return r.rank() > 0
+}
+
+// Allows reports whether r may do what required may
+func (r Role) Allows(required Role) bool {
+	switch {
+	case !r.Valid():
+		return false
+	case required == RoleMetrics:
+		// Scraping is for monitoring and admins, not for API clients
+		return r == RoleMetrics || r == RoleAdmin
+	case r == RoleMetrics:
+		return false
+	}
+	return r.rank() >= required.rank()
+}
+
+// Outranks reports whether r comes after other in Roles, e.g. to pick the
+// most privileged of several
+func (r Role) Outranks(other Role) bool {
+	return r.rank() > other.rank()
+}
+
+// APIKey is a server credential. Only a hash of the key is stored; the key
+// itself is shown once, when it is created.
+type APIKey struct {
+	ID     string
+	Name   string
+	Role   Role
+	Prefix string // The key's first characters, to tell keys apart
+	Hash   string // Hex SHA-256 of the key
+
+	CreatedAt time.Time
+	RevokedAt time.Time // Zero while the key is valid
+}
+
+// Revoked reports whether the key has been revoked
+func (k APIKey) Revoked() bool {
+	return !k.RevokedAt.IsZero()
+}
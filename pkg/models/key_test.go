@@ -0,0 +1,38 @@
+package models
+
+import "testing"
+
+func TestRoleAllows(t *testing.T) {
+	// allowed[r] lists what r may do, by required role
+	allowed := map[Role][]Role{
+		RoleMetrics: {RoleMetrics},
+		RoleMatcher: {RoleMatcher},
+		RoleEditor:  {RoleMatcher, RoleEditor},
+		RoleAdmin:   {RoleMetrics, RoleMatcher, RoleEditor, RoleAdmin},
+		"root":      nil,
+	}
+	for r, may := range allowed {
+		for _, required := range Roles {
+			want := false
+			for _, m := range may {
+				want = want || m == required
+			}
+			if got := r.Allows(required); got != want {
+				t.Errorf("%q.Allows(%q) = %v, want %v", r, required, got, want)
+			}
+		}
+	}
+}
+
+func TestRoleOutranks(t *testing.T) {
+	for i, r := range Roles {
+		if !r.Outranks("") {
+			t.Errorf("%q doesn't outrank no role", r)
+		}
+		for _, lower := range Roles[:i] {
+			if !r.Outranks(lower) || lower.Outranks(r) {
+				t.Errorf("%q and %q are out of order", r, lower)
+			}
+		}
+	}
+}
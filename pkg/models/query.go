@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// SongSort is the order QuerySongs returns songs in
+type SongSort string
+
+const (
+	SortByCreated  SongSort = "created" // registration order
+	SortByTitle    SongSort = "title"
+	SortByArtist   SongSort = "artist"
+	SortByDuration SongSort = "duration"
+)
+
+// SongSource tells songs added from YouTube apart from uploaded files
+type SongSource string
+
+const (
+	SourceYouTube SongSource = "youtube" // songs with a YouTube ID
+	SourceFile    SongSource = "file"    // songs without one
+)
+
+// SongQuery selects one page of the catalogue. Zero fields don't filter.
+type SongQuery struct {
+	// Search keeps songs whose title or artist contains every
+	// whitespace-separated term, ignoring case
+	Search string
+
+	MinDurationMs int
+	MaxDurationMs int
+	Source        SongSource
+	CreatedAfter  time.Time // inclusive
+	CreatedBefore time.Time // exclusive
+
+	Sort SongSort // default SortByCreated
+	Desc bool
+
+	// Limit caps the page size; 0 returns every remaining song
+	Limit int
+
+	// Cursor continues after the page that returned it, and must come from
+	// a query with the same sort order
+	Cursor string
+}
+
+// SongPage is one page of QuerySongs results
+type SongPage struct {
+	Songs      []Song
+	Total      int    // Songs matching the filters across all pages
+	NextCursor string // Empty on the last page
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// followReader keeps reading past EOF, like tail -f
+type followReader struct {
+	ctx  context.Context
+	r    io.Reader
+	poll time.Duration
+}
+
+// NewFollowReader wraps a file that is still being written. Instead of
+// returning io.EOF it waits poll between attempts for more data, and only
+// reports EOF once ctx is done.
+func NewFollowReader(ctx context.Context, r io.Reader, poll time.Duration) io.Reader {
+	return &followReader{ctx: ctx, r: r, poll: poll}
+}
+
+func (f *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := f.r.Read(p)
+		if !errors.Is(err, io.EOF) {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+
+		select {
+		case <-f.ctx.Done():
+			return 0, io.EOF
+		case <-time.After(f.poll):
+		}
+	}
+}
@@ -39,6 +39,10 @@ if [ $? -ne 0 ]; then
     exit 1
 fi
 
+# wasm/ carries the same module for embedding outside the web interface
+mkdir -p wasm
+cp web/public/fingerprint.wasm wasm/acousticdna.wasm
+
 # Copy wasm_exec.js from Go SDK
 echo -e "${YELLOW}📋 Copying WASM runtime (wasm_exec.js)...${NC}"
 
@@ -84,11 +88,22 @@ echo ""
 echo -e "${GREEN}✅ Build completed successfully!${NC}"
 echo ""
 echo -e "${BLUE}📊 Build Information:${NC}"
-echo -e "   WASM Binary: ${GREEN}web/public/fingerprint.wasm${NC}"
+echo -e "   WASM Binary: ${GREEN}web/public/fingerprint.wasm${NC} (also wasm/acousticdna.wasm)"
 echo -e "   Size:        ${YELLOW}${WASM_SIZE}${NC} (${WASM_SIZE_BYTES} bytes)"
 echo -e "   Runtime:     ${GREEN}web/public/wasm_exec.js${NC}"
 echo ""
 
+# Smoke-test the module against what the web interface expects of it
+if command -v node &> /dev/null; then
+    if ! node scripts/check-wasm.cjs web/public/wasm_exec.js web/public/fingerprint.wasm; then
+        echo -e "${RED}❌ The WASM module failed its smoke test${NC}"
+        exit 1
+    fi
+else
+    echo -e "${YELLOW}   Skipping the smoke test: node is not installed${NC}"
+fi
+echo ""
+
 # Size warnings
 if [ "$WASM_SIZE_BYTES" -gt 10485760 ]; then  # > 10 MB
     echo -e "${RED}⚠️  Warning: WASM binary is very large (>10 MB)${NC}"
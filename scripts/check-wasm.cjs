@@ -0,0 +1,91 @@
+// Smoke test of a built WASM module against what web/src/api/wasm.js
+// expects: generateFingerprint takes the catalogue's profile as a fourth
+// argument, echoes it as result.profile, and returns every (hash, anchor
+// time) pair in time order, which the page sends to /api/match/hashes as
+// "pairs".
+//
+// Usage: node scripts/check-wasm.cjs web/public/wasm_exec.js web/public/fingerprint.wasm
+
+const fs = require('fs');
+const path = require('path');
+
+const [wasmExec, wasmFile] = process.argv.slice(2);
+if (!wasmExec || !wasmFile) {
+    console.error('usage: node check-wasm.cjs <wasm_exec.js> <module.wasm>');
+    process.exit(2);
+}
+
+function fail(message) {
+    console.error(`❌ ${message}`);
+    process.exit(1);
+}
+
+// A few seconds of tones that change every quarter second, which gives the
+// peak picker plenty to find
+function testSignal(rate, seconds) {
+    const samples = new Array(rate * seconds);
+    for (let i = 0; i < samples.length; i++) {
+        const step = Math.floor((i / rate) * 4);
+        const freq = 300 + ((step * 7) % 11) * 120;
+        samples[i] = 0.5 * Math.sin((2 * Math.PI * freq * i) / rate);
+    }
+    return samples;
+}
+
+function checkPairs(result, what) {
+    if (result.error !== 0) {
+        fail(`${what}: error ${result.error}: ${result.data}`);
+    }
+    const pairs = result.data;
+    if (!Array.isArray(pairs) || pairs.length === 0) {
+        fail(`${what}: no hash pairs returned`);
+    }
+    let last = -1;
+    for (const pair of pairs) {
+        if (!Number.isInteger(pair.hash) || pair.hash < 0 || pair.hash > 0xffffffff) {
+            fail(`${what}: hash ${pair.hash} is not an unsigned 32-bit integer`);
+        }
+        if (!Number.isInteger(pair.anchorTime) || pair.anchorTime < last) {
+            fail(`${what}: anchor times are not in order (${pair.anchorTime} after ${last})`);
+        }
+        last = pair.anchorTime;
+    }
+    return pairs;
+}
+
+// Without a window the module still registers generateFingerprint; it just
+// can't announce itself
+globalThis.window = undefined;
+const { log, error } = console;
+console.log = console.error = () => {};
+require(path.resolve(wasmExec));
+
+const go = new Go();
+WebAssembly.instantiate(fs.readFileSync(wasmFile), go.importObject).then(({ instance }) => {
+    go.run(instance);
+    Object.assign(console, { log, error });
+    if (typeof generateFingerprint !== 'function') {
+        fail('generateFingerprint was not registered');
+    }
+
+    const samples = testSignal(11025, 5);
+    const byName = generateFingerprint(samples, 11025, 1, 'default');
+    const pairs = checkPairs(byName, 'profile by name');
+    if (!byName.profile || byName.profile.name !== 'default') {
+        fail('result.profile is missing; the module predates fingerprint profiles');
+    }
+
+    // The page passes the profile as /api/profile serves it
+    const byObject = generateFingerprint(samples, 11025, 1, byName.profile);
+    if (checkPairs(byObject, 'profile as an object').length !== pairs.length) {
+        fail('the same profile as a name and as an object gave different fingerprints');
+    }
+
+    const unknown = generateFingerprint(samples, 11025, 1, 'no-such-profile');
+    if (unknown.error === 0) {
+        fail('an unknown profile was accepted');
+    }
+
+    console.log(`   Smoke test:  ${pairs.length} hash pairs with profile ${byName.profile.name}@${byName.profile.version}`);
+    process.exit(0);
+});
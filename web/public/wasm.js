@@ -12,6 +12,7 @@ class WASMLoader {
         this.generateFingerprint = null;
         this.wasmInstance = null;
         this.audioContext = null;
+        this.profile = null;
     }
 
     /**
@@ -248,7 +249,7 @@ class WASMLoader {
 
             // Call WASM fingerprint function with mono samples at correct sample rate
             const startFingerprint = performance.now();
-            const result = this.generateFingerprint(samples, finalSampleRate, 1); // Always mono now
+            const result = this.generateFingerprint(samples, finalSampleRate, 1, this.profile); // Always mono now
             const fingerprintTime = (performance.now() - startFingerprint).toFixed(0);
 
             // Check for errors
@@ -258,6 +259,7 @@ class WASMLoader {
 
             // Convert JavaScript array to regular array
             const hashes = Array.from(result.data);
+            this.profile = result.profile;
 
             console.log(`✅ Generated ${hashes.length} hashes in ${fingerprintTime}ms`);
             console.log(`   Hashes per second: ${(hashes.length / audioBuffer.duration).toFixed(0)}`);
@@ -275,30 +277,36 @@ class WASMLoader {
         }
     }
 
+    /**
+     * Headers that authenticate requests to the server, if an API key has
+     * been saved in localStorage as acousticdna_api_key
+     * @param {Object} headers - Other headers to send
+     * @returns {Object} The headers with X-API-Key added
+     */
+    authHeaders(headers = {}) {
+        const apiKey = localStorage.getItem('acousticdna_api_key');
+        return apiKey ? { ...headers, 'X-API-Key': apiKey } : headers;
+    }
+
     /**
      * Convert hash array to the format expected by the server API
      * @param {Array<{hash: number, anchorTime: number}>} hashes
-     * @returns {Object} Map of hash -> anchorTime
+     * @returns {Array<{hash: number, anchor_time_ms: number}>} Query pairs
      */
     hashesToServerFormat(hashes) {
-        const hashMap = {};
-        for (const { hash, anchorTime } of hashes) {
+        // Every occurrence is sent: a hash that repeats at different anchor
+        // times is still evidence for the match
+        const pairs = hashes.map(({ hash, anchorTime }) => ({
             // Ensure hash is treated as unsigned 32-bit integer
-            // JavaScript numbers are 64-bit floats, but we need to ensure proper serialization
-            const hashKey = hash >>> 0; // Convert to unsigned 32-bit integer
-
-            // If multiple hashes have the same value, keep the first occurrence
-            // (In practice, each hash should be unique in the query)
-            if (!(hashKey in hashMap)) {
-                hashMap[hashKey] = anchorTime;
-            }
-        }
+            hash: hash >>> 0,
+            anchor_time_ms: anchorTime,
+        }));
 
         // Debug: Log a few sample hashes to verify format
-        const sampleHashes = Object.keys(hashMap).slice(0, 5);
+        const sampleHashes = pairs.slice(0, 5).map((p) => p.hash);
         console.log(`   Sample hash values: ${sampleHashes.join(', ')}`);
 
-        return hashMap;
+        return pairs;
     }
 
     /**
@@ -312,17 +320,17 @@ class WASMLoader {
             throw new Error('WASM not initialized');
         }
 
-        const hashMap = this.hashesToServerFormat(hashes);
+        const pairs = this.hashesToServerFormat(hashes);
 
-        console.log(`🔍 Sending ${Object.keys(hashMap).length} unique hashes to server...`);
+        console.log(`🔍 Sending ${pairs.length} hashes to server...`);
 
         try {
             const response = await fetch(`${serverUrl}/api/match/hashes`, {
                 method: 'POST',
-                headers: {
+                headers: this.authHeaders({
                     'Content-Type': 'application/json',
-                },
-                body: JSON.stringify({ hashes: hashMap }),
+                }),
+                body: JSON.stringify({ pairs, profile: this.profile }),
             });
 
             if (!response.ok) {
@@ -341,6 +349,24 @@ class WASMLoader {
         }
     }
 
+    /**
+     * Fetch the fingerprint profile of the server's catalogue so that the
+     * hashes generated here can be matched against it
+     * @param {string} serverUrl - Base URL of the AcousticDNA server
+     * @returns {Promise<Object>} The profile
+     */
+    async fetchProfile(serverUrl = 'http://localhost:8080') {
+        const response = await fetch(`${serverUrl}/api/profile`, {
+            headers: this.authHeaders(),
+        });
+        if (!response.ok) {
+            throw new Error(`Failed to fetch fingerprint profile: ${response.status}`);
+        }
+        this.profile = await response.json();
+        console.log(`🧬 Using fingerprint profile ${this.profile.name}@${this.profile.version}`);
+        return this.profile;
+    }
+
     /**
      * Complete workflow: process file and match against server
      * @param {File} file - Audio file
@@ -349,6 +375,9 @@ class WASMLoader {
      * @returns {Promise<Object>} Match results
      */
     async processAndMatch(file, serverUrl = 'http://localhost:8080', progressCallback = null) {
+        // Fingerprint with the catalogue's profile
+        await this.fetchProfile(serverUrl);
+
         // Generate fingerprints
         const hashes = await this.processAudioFile(file, progressCallback);
 
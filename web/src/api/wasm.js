@@ -7,6 +7,7 @@ class WASMLoader {
         this.generateFingerprint = null;
         this.wasmInstance = null;
         this.audioContext = null;
+        this.profile = null;
     }
 
     async init() {
@@ -169,7 +170,7 @@ class WASMLoader {
             }
 
             const startFingerprint = performance.now();
-            const result = this.generateFingerprint(samples, audioBuffer.sampleRate, channels);
+            const result = this.generateFingerprint(samples, audioBuffer.sampleRate, channels, this.profile);
             const fingerprintTime = (performance.now() - startFingerprint).toFixed(0);
 
             if (result.error !== 0) {
@@ -177,6 +178,7 @@ class WASMLoader {
             }
 
             const hashes = Array.from(result.data);
+            this.profile = result.profile;
 
             console.log(`✅ Generated ${hashes.length} hashes in ${fingerprintTime}ms`);
             console.log(`   Hashes per second: ${(hashes.length / audioBuffer.duration).toFixed(0)}`);
@@ -193,14 +195,18 @@ class WASMLoader {
         }
     }
 
+    // Headers that authenticate a request to the server, with the API key
+    // saved in localStorage as acousticdna_api_key if there is one
+    authHeaders(headers = {}) {
+        const apiKey = localStorage.getItem('acousticdna_api_key');
+        return apiKey ? { ...headers, 'X-API-Key': apiKey } : headers;
+    }
+
     hashesToServerFormat(hashes) {
-        const hashMap = {};
-        for (const { hash, anchorTime } of hashes) {
-            if (!(hash in hashMap)) {
-                hashMap[hash] = anchorTime;
-            }
-        }
-        return hashMap;
+        return hashes.map(({ hash, anchorTime }) => ({
+            hash: hash >>> 0,
+            anchor_time_ms: anchorTime,
+        }));
     }
 
     async matchHashes(hashes, serverUrl = 'http://localhost:8080') {
@@ -208,17 +214,17 @@ class WASMLoader {
             throw new Error('WASM not initialized');
         }
 
-        const hashMap = this.hashesToServerFormat(hashes);
+        const pairs = this.hashesToServerFormat(hashes);
 
-        console.log(`🔍 Sending ${Object.keys(hashMap).length} unique hashes to server...`);
+        console.log(`🔍 Sending ${pairs.length} hashes to server...`);
 
         try {
             const response = await fetch(`${serverUrl}/api/match/hashes`, {
                 method: 'POST',
-                headers: {
+                headers: this.authHeaders({
                     'Content-Type': 'application/json',
-                },
-                body: JSON.stringify({ hashes: hashMap }),
+                }),
+                body: JSON.stringify({ pairs, profile: this.profile }),
             });
 
             if (!response.ok) {
@@ -237,7 +243,19 @@ class WASMLoader {
         }
     }
 
+    async fetchProfile(serverUrl = 'http://localhost:8080') {
+        const response = await fetch(`${serverUrl}/api/profile`, {
+            headers: this.authHeaders(),
+        });
+        if (!response.ok) {
+            throw new Error(`Failed to fetch fingerprint profile: ${response.status}`);
+        }
+        this.profile = await response.json();
+        return this.profile;
+    }
+
     async processAndMatch(file, serverUrl = 'http://localhost:8080', progressCallback = null) {
+        await this.fetchProfile(serverUrl);
         const hashes = await this.processAudioFile(file, progressCallback);
         const results = await this.matchHashes(hashes, serverUrl);
 